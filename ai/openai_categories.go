@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/matrix-org/policyserv/harms"
+)
+
+// OpenAIModerationCategories - The categories returned by OpenAI's moderation API. OpenAI-compatible chat providers are
+// asked to score the same categories.
+var OpenAIModerationCategories = []string{
+	"harassment",
+	"harassment/threatening",
+	"hate",
+	"hate/threatening",
+	"illicit",
+	"illicit/violent",
+	"self-harm",
+	"self-harm/instructions",
+	"self-harm/intent",
+	"sexual",
+	"sexual/minors",
+	"violence",
+	"violence/graphic",
+}
+
+// OpenAIModerationCategoryHarms - The MSC4456 harms returned when each category is flagged.
+var OpenAIModerationCategoryHarms = map[string][]harms.Harm{
+	"harassment":             {harms.HarassmentGeneral},
+	"harassment/threatening": {harms.HarassmentTargeted, harms.ViolenceThreats},
+	"hate":                   {harms.HarassmentHate},
+	"hate/threatening":       {harms.HarassmentHate, harms.ViolenceThreats},
+	"illicit":                {harms.TOSProhibited},
+	"illicit/violent":        {harms.TOSProhibited, harms.ViolenceGeneral},
+	"self-harm":              {harms.DangerSelfHarm},
+	"self-harm/instructions": {harms.DangerSelfHarm},
+	"self-harm/intent":       {harms.DangerSelfHarm},
+	"sexual":                 {harms.AdultGeneral},
+	"sexual/minors":          {harms.ChildSafetyCSAM},
+	"violence":               {harms.ViolenceGeneral},
+	"violence/graphic":       {harms.ViolenceGraphic},
+}
+
+// DefaultOpenAIModerationThreshold - The score at or above which a category is flagged when no threshold is configured
+// for it.
+const DefaultOpenAIModerationThreshold = 0.5
+
+// OpenAIModerationCategoryConfig - Which categories cause a message to be flagged, and at which scores.
+type OpenAIModerationCategoryConfig struct {
+	// Categories - The categories to flag. When empty, all categories are considered.
+	Categories []string
+	// CategoryThresholds - The score at or above which a category is flagged. Categories without a threshold use
+	// DefaultOpenAIModerationThreshold.
+	CategoryThresholds map[string]float64
+}
+
+// ValidateOpenAIModerationCategories - Ensures the categories and thresholds are known to policyserv and that the
+// thresholds are between 0 and 1.
+func ValidateOpenAIModerationCategories(categories []string, thresholds map[string]float64) error {
+	for _, category := range categories {
+		if !slices.Contains(OpenAIModerationCategories, category) {
+			return fmt.Errorf("unknown moderation category: %s", category)
+		}
+	}
+	for category, threshold := range thresholds {
+		if !slices.Contains(OpenAIModerationCategories, category) {
+			return fmt.Errorf("unknown moderation category: %s", category)
+		}
+		if threshold < 0 || threshold > 1 {
+			return fmt.Errorf("threshold for %s must be between 0 and 1", category)
+		}
+	}
+	return nil
+}
+
+// flaggedCategories - Returns the considered categories whose scores meet their thresholds.
+func (c OpenAIModerationCategoryConfig) flaggedCategories(scores map[string]float64) []string {
+	categories := c.Categories
+	if len(categories) == 0 {
+		categories = OpenAIModerationCategories
+	}
+	flagged := make([]string, 0)
+	for _, category := range categories {
+		threshold, ok := c.CategoryThresholds[category]
+		if !ok {
+			threshold = DefaultOpenAIModerationThreshold
+		}
+		if score, ok := scores[category]; ok && score >= threshold {
+			flagged = append(flagged, category)
+		}
+	}
+	return flagged
+}
+
+// harmsForCategories - Converts flagged categories into the harms returned by the providers, without duplicates.
+func harmsForCategories(categories []string) []harms.Harm {
+	harmIds := make([]harms.Harm, 0)
+	for _, category := range categories {
+		for _, harm := range OpenAIModerationCategoryHarms[category] {
+			if !slices.Contains(harmIds, harm) {
+				harmIds = append(harmIds, harm)
+			}
+		}
+	}
+	return harmIds
+}
+
+// parseCategoryScores - Parses a JSON object of category to score. Values which aren't numbers are skipped.
+func parseCategoryScores(raw string) (map[string]float64, error) {
+	val := make(map[string]any)
+	err := json.Unmarshal([]byte(raw), &val)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64)
+	for category, v := range val {
+		if f, ok := v.(float64); ok {
+			scores[category] = f
+		}
+	}
+	return scores, nil
+}
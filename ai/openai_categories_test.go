@@ -0,0 +1,31 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOpenAIModerationCategories(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, ValidateOpenAIModerationCategories(nil, nil))
+	assert.NoError(t, ValidateOpenAIModerationCategories(OpenAIModerationCategories, map[string]float64{"hate": 0, "sexual/minors": 1}))
+	assert.EqualError(t, ValidateOpenAIModerationCategories([]string{"spam"}, nil), "unknown moderation category: spam")
+	assert.EqualError(t, ValidateOpenAIModerationCategories(nil, map[string]float64{"spam": 0.5}), "unknown moderation category: spam")
+	assert.EqualError(t, ValidateOpenAIModerationCategories(nil, map[string]float64{"hate": -0.1}), "threshold for hate must be between 0 and 1")
+}
+
+func TestOpenAIModerationCategoryHarms(t *testing.T) {
+	t.Parallel()
+
+	// Every category must map to at least one harm, otherwise flagged messages would be returned without a reason
+	assert.Len(t, OpenAIModerationCategoryHarms, len(OpenAIModerationCategories))
+	for _, category := range OpenAIModerationCategories {
+		assert.NotEmpty(t, OpenAIModerationCategoryHarms[category], category)
+	}
+
+	// Harms shared by several categories are only returned once
+	assert.Equal(t, []harms.Harm{harms.HarassmentHate, harms.ViolenceThreats, harms.HarassmentTargeted}, harmsForCategories([]string{"hate", "hate/threatening", "harassment/threatening"}))
+}
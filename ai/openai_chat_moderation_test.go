@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIChatModeration(t *testing.T) {
+	t.Parallel()
+
+	apiKey := "not_a_real_key"
+	model := "llama3"
+	mockApi := test.MakeOpenAIChatServer(t, apiKey, model)
+	defer mockApi.Close()
+
+	provider, err := NewOpenAIChatModeration(apiKey, option.WithHTTPClient(mockApi.Client()), option.WithBaseURL(mockApi.URL), option.WithMaxRetries(0))
+	assert.NoError(t, err)
+	assert.NotNil(t, provider)
+
+	cnf := &OpenAIChatModerationConfig{FailSecure: true, Model: model}
+
+	// Scores at or above DefaultOpenAIModerationThreshold are flagged by default
+	ret, err := provider.CheckEvent(context.Background(), cnf, &Input{Event: test.MustMakeKeywordEvent(test.KeywordSpammy)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.HarassmentGeneral), ret)
+
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: test.MustMakeKeywordEvent(test.KeywordSpammyCSAM)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.AdultGeneral, harms.ChildSafetyCSAM), ret)
+
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: test.MustMakeKeywordEvent(test.KeywordNeutral)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+
+	// Thresholds and category selection apply to chat scores too
+	ret, err = provider.CheckEvent(context.Background(), &OpenAIChatModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{CategoryThresholds: map[string]float64{"harassment": 0.8}},
+		Model:                          model,
+	}, &Input{Event: test.MustMakeKeywordEvent(test.KeywordSpammy)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	ret, err = provider.CheckEvent(context.Background(), &OpenAIChatModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{Categories: []string{"hate"}},
+		Model:                          model,
+	}, &Input{Event: test.MustMakeKeywordEvent(test.KeywordSpammy)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+
+	// Errors and replies which aren't classifications respect FailSecure
+	for _, keyword := range []string{test.KeywordIntentionalFail, test.KeywordInvalidResponse} {
+		ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: test.MustMakeKeywordEvent(keyword)})
+		assert.NoError(t, err)
+		test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.OtherGeneral), ret)
+		ret, err = provider.CheckEvent(context.Background(), &OpenAIChatModerationConfig{Model: model}, &Input{Event: test.MustMakeKeywordEvent(keyword)})
+		assert.NoError(t, err)
+		test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	}
+}
@@ -2,29 +2,49 @@ package ai
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"slices"
 
-	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/media"
+	"github.com/matrix-org/policyserv/storage"
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 )
 
+// openAIOmniSupportedImageTypes - The image types the omni moderation model accepts.
+var openAIOmniSupportedImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
 type OpenAIOmniModerationConfig struct {
+	OpenAIModerationCategoryConfig
+
 	FailSecure bool
+	// MaxMediaBytes - Media larger than this is not sent to OpenAI. When zero, media is not scanned.
+	MaxMediaBytes int64
+}
+
+// MediaScoreCache - Stores category scores for media so the same media isn't scored again for every community. This is
+// implemented by storage.PersistentStorage.
+type MediaScoreCache interface {
+	UpsertMediaScores(ctx context.Context, scores *storage.StoredMediaScores) error
+	GetMediaScores(ctx context.Context, mxcUri string, model string) (*storage.StoredMediaScores, error)
 }
 
 type OpenAIOmniModeration struct {
 	// Implements Provider[*OpenAIOmniModerationConfig]
 
 	client openai.Client
+	cache  MediaScoreCache
 }
 
-func NewOpenAIOmniModeration(cnf *config.InstanceConfig, additionalClientOptions ...option.RequestOption) (Provider[*OpenAIOmniModerationConfig], error) {
-	apiKey := cnf.OpenAIApiKey
+// NewOpenAIOmniModeration - Creates an omni moderation provider. The cache may be nil to score media every time.
+func NewOpenAIOmniModeration(apiKey string, cache MediaScoreCache, additionalClientOptions ...option.RequestOption) (Provider[*OpenAIOmniModerationConfig], error) {
 	if len(apiKey) == 0 {
 		return nil, errors.New("api key not set")
 	}
@@ -32,6 +52,7 @@ func NewOpenAIOmniModeration(cnf *config.InstanceConfig, additionalClientOptions
 	client := openai.NewClient(options...)
 	return &OpenAIOmniModeration{
 		client: client,
+		cache:  cache,
 	}, nil
 }
 
@@ -51,29 +72,155 @@ func (m *OpenAIOmniModeration) CheckEvent(ctx context.Context, cnf *OpenAIOmniMo
 		})
 		if err != nil {
 			log.Printf("[%s | %s] Error checking message: %s", input.Event.EventID(), input.Event.RoomID(), err)
-			if cnf.FailSecure {
-				log.Printf("[%s | %s] Returning spam response to block events and discourage retries", input.Event.EventID(), input.Event.RoomID())
-				return harms.ProhibitedContent(harms.OtherGeneral), nil
-			} else {
-				log.Printf("[%s | %s] Returning neutral response despite error, per config", input.Event.EventID(), input.Event.RoomID())
-				return harms.NeutralContent(), nil
-			}
+			return failureResult(cnf.FailSecure, input), nil
 		}
 		for _, r := range res.Results {
 			// Note: we compress JSON here because the OpenAI library tends to return *a lot* of redundant detail, including JSON with newlines in it.
 			log.Printf("[%s | %s] Result for sender %s: Flagged=%t Flags=%s Scores=%s", input.Event.EventID(), input.Event.RoomID(), input.Event.SenderID(), r.Flagged, compressJsonResponse(r.Categories), compressJsonResponse(r.CategoryScores))
-			if r.Flagged {
-				harmIds := []harms.Harm{harms.SpamGeneral}
-				if r.Categories.SexualMinors {
-					harmIds = append(harmIds, harms.ChildSafetyCSAM)
-				}
-				return harms.ProhibitedContent(harmIds...), nil
+			scores, err := parseCategoryScores(r.CategoryScores.RawJSON())
+			if err != nil {
+				log.Printf("[%s | %s] Error parsing category scores: %s", input.Event.EventID(), input.Event.RoomID(), err)
+				return failureResult(cnf.FailSecure, input), nil
+			}
+			if flagged := cnf.flaggedCategories(scores); len(flagged) > 0 {
+				log.Printf("[%s | %s] Flagged for categories: %v", input.Event.EventID(), input.Event.RoomID(), flagged)
+				return harms.ProhibitedContent(harmsForCategories(flagged)...), nil
 			}
 		}
 	}
+
+	// Each media item is scored on its own (rather than in the same request as the text) so its scores can be cached
+	// and reused by other communities.
+	for _, item := range input.Medias {
+		scores, err := m.mediaScores(ctx, cnf, input, item)
+		if err != nil {
+			log.Printf("[%s | %s] Error checking media %s: %s", input.Event.EventID(), input.Event.RoomID(), item, err)
+			return failureResult(cnf.FailSecure, input), nil
+		}
+		if scores == nil {
+			continue // skipped
+		}
+		if flagged := cnf.flaggedCategories(scores); len(flagged) > 0 {
+			log.Printf("[%s | %s] Media %s flagged for categories: %v", input.Event.EventID(), input.Event.RoomID(), item, flagged)
+			return harms.ProhibitedContent(harmsForCategories(flagged)...), nil
+		}
+	}
 	return harms.NeutralContent(), nil
 }
 
+// mediaScores - Returns the category scores for the media item, from the cache if possible. Returns nil scores if the
+// media can't be scanned by the model, such as when it's too large, not an image, or can't be downloaded.
+func (m *OpenAIOmniModeration) mediaScores(ctx context.Context, cnf *OpenAIOmniModerationConfig, input *Input, item *media.Item) (map[string]float64, error) {
+	if cnf.MaxMediaBytes <= 0 {
+		return nil, nil
+	}
+
+	model := string(openai.ModerationModelOmniModerationLatest)
+	if m.cache != nil {
+		cached, err := m.cache.GetMediaScores(ctx, item.String(), model)
+		if err != nil {
+			log.Printf("[%s | %s] Non-fatal error getting cached media scores: %s", input.Event.EventID(), input.Event.RoomID(), err)
+		} else if cached != nil && cached.CategoryScores != nil {
+			log.Printf("[%s | %s] Using cached media scores for %s", input.Event.EventID(), input.Event.RoomID(), item)
+			return cached.CategoryScores, nil
+		} else if cached != nil {
+			// The media was skipped before. It's only downloaded again if it would no longer be skipped, like when the
+			// size limit is raised.
+			if reason := skipReason(cnf, cached.SizeBytes, cached.MimeType); reason != "" {
+				log.Printf("[%s | %s] Skipping media %s (cached): %s", input.Event.EventID(), input.Event.RoomID(), item, reason)
+				return nil, nil
+			}
+		}
+	}
+
+	log.Printf("[%s | %s] Downloading media %s", input.Event.EventID(), input.Event.RoomID(), item)
+	b, err := item.DownloadLimited(cnf.MaxMediaBytes)
+	if errors.Is(err, media.MediaTooLargeError) {
+		log.Printf("[%s | %s] Skipping media %s: %s", input.Event.EventID(), input.Event.RoomID(), item, err)
+		m.cacheScores(ctx, input, &storage.StoredMediaScores{
+			MxcUri:    item.String(),
+			Model:     model,
+			SizeBytes: cnf.MaxMediaBytes + 1, // we stopped downloading, so only know it's larger than the limit
+		})
+		return nil, nil
+	}
+	if err != nil {
+		// Clients can't render media which can't be downloaded either, so it's skipped rather than failing the check.
+		// The skip isn't cached because the media may become available later.
+		log.Printf("[%s | %s] Skipping media %s which couldn't be downloaded: %s", input.Event.EventID(), input.Event.RoomID(), item, err)
+		return nil, nil
+	}
+	mimeType := http.DetectContentType(b)
+	if reason := skipReason(cnf, int64(len(b)), mimeType); reason != "" {
+		log.Printf("[%s | %s] Skipping media %s: %s", input.Event.EventID(), input.Event.RoomID(), item, reason)
+		m.cacheScores(ctx, input, &storage.StoredMediaScores{
+			MxcUri:    item.String(),
+			Model:     model,
+			SizeBytes: int64(len(b)),
+			MimeType:  mimeType,
+		})
+		return nil, nil
+	}
+
+	res, err := m.client.Moderations.New(ctx, openai.ModerationNewParams{
+		Model: openai.ModerationModelOmniModerationLatest,
+		Input: openai.ModerationNewParamsInputUnion{
+			OfModerationMultiModalArray: []openai.ModerationMultiModalInputUnionParam{{
+				OfImageURL: &openai.ModerationImageURLInputParam{
+					ImageURL: openai.ModerationImageURLInputImageURLParam{
+						URL: "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(b),
+					},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64)
+	for _, r := range res.Results {
+		log.Printf("[%s | %s] Result for media %s: Flagged=%t Scores=%s", input.Event.EventID(), input.Event.RoomID(), item, r.Flagged, compressJsonResponse(r.CategoryScores))
+		resultScores, err := parseCategoryScores(r.CategoryScores.RawJSON())
+		if err != nil {
+			return nil, err
+		}
+		for category, score := range resultScores {
+			scores[category] = max(scores[category], score)
+		}
+	}
+
+	m.cacheScores(ctx, input, &storage.StoredMediaScores{
+		MxcUri:         item.String(),
+		Model:          model,
+		CategoryScores: scores,
+		SizeBytes:      int64(len(b)),
+		MimeType:       mimeType,
+	})
+	return scores, nil
+}
+
+func (m *OpenAIOmniModeration) cacheScores(ctx context.Context, input *Input, scores *storage.StoredMediaScores) {
+	if m.cache == nil {
+		return
+	}
+	err := m.cache.UpsertMediaScores(ctx, scores)
+	if err != nil {
+		log.Printf("[%s | %s] Non-fatal error caching media scores: %s", input.Event.EventID(), input.Event.RoomID(), err)
+	}
+}
+
+// skipReason - Returns why media of the given size and type can't be scanned by the model, or an empty string if it can.
+// The type is empty (and not checked) for media which was too large to download.
+func skipReason(cnf *OpenAIOmniModerationConfig, sizeBytes int64, mimeType string) string {
+	if sizeBytes > cnf.MaxMediaBytes {
+		return fmt.Sprintf("%d bytes is larger than the limit of %d", sizeBytes, cnf.MaxMediaBytes)
+	}
+	if mimeType != "" && !slices.Contains(openAIOmniSupportedImageTypes, mimeType) {
+		return fmt.Sprintf("unsupported type %s", mimeType)
+	}
+	return ""
+}
+
 type compressible interface {
 	RawJSON() string // same definition that's shared with the OpenAI response parts
 }
@@ -4,8 +4,8 @@ import (
 	"context"
 	"testing"
 
-	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/media"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/openai/openai-go/v3/option"
 	"github.com/stretchr/testify/assert"
@@ -28,7 +28,8 @@ func TestOpenAIOmniModeration(t *testing.T) {
 
 	// Create the provider
 	provider, err := NewOpenAIOmniModeration(
-		&config.InstanceConfig{OpenAIApiKey: apiKey},
+		apiKey,
+		nil,
 		option.WithHTTPClient(client),
 		option.WithBaseURL(mockApi.URL),
 	)
@@ -38,13 +39,13 @@ func TestOpenAIOmniModeration(t *testing.T) {
 	spammyEvent1 := test.MustMakeKeywordEvent(test.KeywordSpammy)
 	ret, err := provider.CheckEvent(context.Background(), &OpenAIOmniModerationConfig{FailSecure: true}, &Input{Event: spammyEvent1})
 	assert.NoError(t, err)
-	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.SpamGeneral), ret)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.HarassmentGeneral), ret) // hate is below the default threshold
 
 	spammyEvent2 := test.MustMakeKeywordEvent(test.KeywordSpammyCSAM)
 	ret, err = provider.CheckEvent(context.Background(), &OpenAIOmniModerationConfig{FailSecure: true}, &Input{Event: spammyEvent2})
 	assert.NoError(t, err)
 	test.AssertEqualContentInfo(t, harms.ProhibitedContent(
-		harms.SpamGeneral,
+		harms.AdultGeneral,
 		harms.ChildSafetyCSAM, // should have been detected
 	), ret)
 
@@ -67,3 +68,148 @@ func TestOpenAIOmniModeration(t *testing.T) {
 	assert.NoError(t, err)
 	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
 }
+
+func TestOpenAIOmniModerationCategories(t *testing.T) {
+	t.Parallel()
+
+	apiKey := "not_a_real_key"
+	mockApi := test.MakeOpenAIModerationServer(t, apiKey)
+	defer mockApi.Close()
+	provider, err := NewOpenAIOmniModeration(apiKey, nil, option.WithHTTPClient(mockApi.Client()), option.WithBaseURL(mockApi.URL))
+	assert.NoError(t, err)
+
+	csamEvent := test.MustMakeKeywordEvent(test.KeywordSpammyCSAM)
+	spammyEvent := test.MustMakeKeywordEvent(test.KeywordSpammy)
+	neutralEvent := test.MustMakeKeywordEvent(test.KeywordNeutral)
+
+	// Selecting categories only flags those categories
+	cnf := &OpenAIOmniModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{Categories: []string{"sexual/minors"}},
+	}
+	ret, err := provider.CheckEvent(context.Background(), cnf, &Input{Event: csamEvent})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.ChildSafetyCSAM), ret)
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: spammyEvent}) // flagged overall, but not for the category
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+
+	// Categories outside the selection are ignored
+	cnf = &OpenAIOmniModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{Categories: []string{"harassment"}},
+	}
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: csamEvent})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+
+	// Thresholds replace the default threshold, rather than relying on OpenAI's flags
+	cnf = &OpenAIOmniModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{CategoryThresholds: map[string]float64{"harassment": 0}},
+	}
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: neutralEvent})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.HarassmentGeneral), ret)
+	cnf = &OpenAIOmniModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{CategoryThresholds: map[string]float64{"harassment": 0.8, "hate": 0.2}},
+	}
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: spammyEvent}) // flagged by OpenAI for harassment
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.HarassmentHate), ret)
+}
+
+func TestOpenAIOmniModerationMedia(t *testing.T) {
+	t.Parallel()
+
+	apiKey := "not_a_real_key"
+	mockApi := test.MakeOpenAIModerationServer(t, apiKey)
+	defer mockApi.Close()
+	db := test.NewMemoryStorage(t)
+	provider, err := NewOpenAIOmniModeration(apiKey, db, option.WithHTTPClient(mockApi.Client()), option.WithBaseURL(mockApi.URL), option.WithMaxRetries(0))
+	assert.NoError(t, err)
+
+	downloader := test.MustMakeMediaDownloader(t).
+		Set("example.org", "spammy", test.MustMakeKeywordImage(t, test.KeywordSpammy)).
+		Set("example.org", "neutral", test.MustMakeKeywordImage(t, test.KeywordNeutral)).
+		Set("example.org", "fail", test.MustMakeKeywordImage(t, test.KeywordIntentionalFail)).
+		Set("example.org", "not_an_image", []byte("this is text"))
+	mustMakeItem := func(mediaId string) *media.Item {
+		item, err := media.NewItem("mxc://example.org/"+mediaId, downloader)
+		assert.NoError(t, err)
+		return item
+	}
+	cnf := &OpenAIOmniModerationConfig{FailSecure: true, MaxMediaBytes: 1024 * 1024}
+	neutralEvent := test.MustMakeKeywordEvent(test.KeywordNeutral)
+
+	// Images are scored alongside the text
+	ret, err := provider.CheckEvent(context.Background(), cnf, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("neutral"), mustMakeItem("spammy")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.AdultGeneral), ret)
+	assert.Equal(t, 2, downloader.DownloadCalls)
+
+	// Scores are cached by MXC URI, so the media isn't downloaded or scored again, even with different thresholds
+	scores, err := db.GetMediaScores(context.Background(), "mxc://example.org/spammy", "omni-moderation-latest")
+	assert.NoError(t, err)
+	assert.NotNil(t, scores)
+	assert.Equal(t, 0.9, scores.CategoryScores["sexual"])
+	ret, err = provider.CheckEvent(context.Background(), &OpenAIOmniModerationConfig{
+		OpenAIModerationCategoryConfig: OpenAIModerationCategoryConfig{CategoryThresholds: map[string]float64{"sexual": 0.95}},
+		MaxMediaBytes:                  1024 * 1024,
+	}, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("spammy")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	assert.Equal(t, 2, downloader.DownloadCalls)
+
+	// Media which isn't an image, or is too large, is skipped
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("not_an_image")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	ret, err = provider.CheckEvent(context.Background(), &OpenAIOmniModerationConfig{FailSecure: true, MaxMediaBytes: 10}, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("fail")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	assert.Equal(t, 4, downloader.DownloadCalls)
+
+	// ... and skips are cached, so the media isn't downloaded again
+	scores, err = db.GetMediaScores(context.Background(), "mxc://example.org/not_an_image", "omni-moderation-latest")
+	assert.NoError(t, err)
+	assert.NotNil(t, scores)
+	assert.Nil(t, scores.CategoryScores)
+	assert.Equal(t, int64(len("this is text")), scores.SizeBytes)
+	scores, err = db.GetMediaScores(context.Background(), "mxc://example.org/fail", "omni-moderation-latest")
+	assert.NoError(t, err)
+	assert.NotNil(t, scores)
+	assert.Nil(t, scores.CategoryScores)
+	assert.Equal(t, int64(11), scores.SizeBytes) // the download stopped after one byte more than the limit
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("not_an_image")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	ret, err = provider.CheckEvent(context.Background(), &OpenAIOmniModerationConfig{FailSecure: true, MaxMediaBytes: 10}, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("fail")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	assert.Equal(t, 4, downloader.DownloadCalls)
+
+	// ... and media isn't scanned at all without a size limit
+	downloads := downloader.DownloadCalls
+	ret, err = provider.CheckEvent(context.Background(), &OpenAIOmniModerationConfig{FailSecure: true}, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("fail")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	assert.Equal(t, downloads, downloader.DownloadCalls)
+
+	// Scoring errors respect FailSecure, and aren't cached. The media skipped above for being too large is downloaded
+	// again because the limit is now higher.
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("fail")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.OtherGeneral), ret)
+	assert.Equal(t, downloads+1, downloader.DownloadCalls)
+	scores, err = db.GetMediaScores(context.Background(), "mxc://example.org/fail", "omni-moderation-latest")
+	assert.NoError(t, err)
+	assert.Nil(t, scores.CategoryScores) // only the earlier skip is cached
+
+	// Media which can't be downloaded is skipped rather than failing the check, even with FailSecure. The skip isn't
+	// cached, as the media might be downloadable later.
+	ret, err = provider.CheckEvent(context.Background(), cnf, &Input{Event: neutralEvent, Medias: []*media.Item{mustMakeItem("missing")}})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+	assert.Equal(t, downloads+2, downloader.DownloadCalls)
+	scores, err = db.GetMediaScores(context.Background(), "mxc://example.org/missing", "omni-moderation-latest")
+	assert.NoError(t, err)
+	assert.Nil(t, scores)
+}
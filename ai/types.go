@@ -2,6 +2,7 @@ package ai
 
 import (
 	"context"
+	"log"
 
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/harms"
@@ -16,3 +17,14 @@ type Input struct {
 type Provider[ConfigT any] interface {
 	CheckEvent(ctx context.Context, cnf ConfigT, input *Input) (*harms.ContentInfo, error)
 }
+
+// failureResult - The result returned by providers when the upstream service can't be reached or returns something
+// unexpected. When failSecure is true, the event is treated as spam to block it and discourage retries.
+func failureResult(failSecure bool, input *Input) *harms.ContentInfo {
+	if failSecure {
+		log.Printf("[%s | %s] Returning spam response to block events and discourage retries", input.Event.EventID(), input.Event.RoomID())
+		return harms.ProhibitedContent(harms.OtherGeneral)
+	}
+	log.Printf("[%s | %s] Returning neutral response despite error, per config", input.Event.EventID(), input.Event.RoomID())
+	return harms.NeutralContent()
+}
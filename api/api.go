@@ -8,6 +8,7 @@ import (
 
 	"github.com/matrix-org/policyserv/community"
 	"github.com/matrix-org/policyserv/homeserver"
+	"github.com/matrix-org/policyserv/media"
 	"github.com/matrix-org/policyserv/metrics"
 	"github.com/matrix-org/policyserv/storage"
 )
@@ -17,25 +18,31 @@ type Config struct {
 	ApiKey            string
 	JoinViaServer     string
 	EventFetchServers []string
+	// AllowedWebhookDomains - The hostnames webhook destinations may be registered for.
+	AllowedWebhookDomains []string
 }
 
 type Api struct {
-	storage           storage.PersistentStorage
-	hs                *homeserver.Homeserver
-	communityManager  *community.Manager
-	apiKey            string
-	joinViaServer     string
-	eventFetchServers []string
+	storage               storage.PersistentStorage
+	hs                    *homeserver.Homeserver
+	communityManager      *community.Manager
+	apiKey                string
+	joinViaServer         string
+	eventFetchServers     []string
+	mediaDownloader       media.Downloader // the homeserver, except in tests
+	allowedWebhookDomains []string
 }
 
 func NewApi(config *Config, storage storage.PersistentStorage, hs *homeserver.Homeserver, communityManager *community.Manager) (*Api, error) {
 	return &Api{
-		storage:           storage,
-		hs:                hs,
-		communityManager:  communityManager,
-		apiKey:            config.ApiKey,
-		joinViaServer:     config.JoinViaServer,
-		eventFetchServers: config.EventFetchServers,
+		storage:               storage,
+		hs:                    hs,
+		communityManager:      communityManager,
+		apiKey:                config.ApiKey,
+		joinViaServer:         config.JoinViaServer,
+		eventFetchServers:     config.EventFetchServers,
+		mediaDownloader:       hs,
+		allowedWebhookDomains: config.AllowedWebhookDomains,
 	}, nil
 }
 
@@ -97,18 +104,39 @@ func (a *Api) BindTo(mux *http.ServeMux) error {
 	mux.Handle("/_policyserv/v1/check/text", a.httpCommunityAuthenticatedRequestHandler(httpCheckTextCommunityApi))
 	mux.Handle("/_policyserv/v1/check/event_id", a.httpCommunityAuthenticatedRequestHandler(httpCheckEventIdCommunityApi))
 	mux.Handle("/_policyserv/v1/join/{roomId}", a.httpCommunityAuthenticatedRequestHandler(httpJoinRoomCommunityApi))
+	mux.Handle("/_policyserv/v1/decisions", a.httpCommunityAuthenticatedRequestHandler(httpGetDecisionsCommunityApi))
+	mux.Handle("/_policyserv/v1/overrides", a.httpCommunityAuthenticatedRequestHandler(httpOverridesCommunityApi))
+	mux.Handle("/_policyserv/v1/hellbans", a.httpCommunityAuthenticatedRequestHandler(httpHellbansCommunityApi))
+	mux.Handle("/_policyserv/v1/raids", a.httpCommunityAuthenticatedRequestHandler(httpRaidsCommunityApi))
+	mux.Handle("/_policyserv/v1/media_hashes", a.httpCommunityAuthenticatedRequestHandler(httpMediaHashesCommunityApi))
+	mux.Handle("/_policyserv/v1/webhooks", a.httpCommunityAuthenticatedRequestHandler(httpWebhooksCommunityApi))
+	mux.Handle("/_policyserv/v1/community", a.httpCommunityAuthenticatedRequestHandler(httpGetCommunityCommunityApi))
+	mux.Handle("/_policyserv/v1/community/config", a.httpCommunityAuthenticatedRequestHandler(httpPatchCommunityConfigCommunityApi))
+	mux.Handle("/_policyserv/v1/community/rotate_access_token", a.httpCommunityAuthenticatedRequestHandler(httpRotateCommunityAccessTokenCommunityApi))
+	mux.Handle("/_policyserv/v1/community/rotate_webhook_secret", a.httpCommunityAuthenticatedRequestHandler(httpRotateCommunityWebhookSecretCommunityApi))
+	mux.Handle("/_policyserv/v1/rooms", a.httpCommunityAuthenticatedRequestHandler(httpGetRoomsCommunityApi))
+	mux.Handle("/_policyserv/v1/rooms/{roomId}", a.httpCommunityAuthenticatedRequestHandler(httpRoomCommunityApi))
+	mux.Handle("/_policyserv/v1/keyword_templates/{name}", a.httpCommunityAuthenticatedRequestHandler(httpKeywordTemplatesCommunityApi))
 
 	// Admin API
 	if a.apiKey != "" {
 		log.Println("Enabling policyserv API")
 		mux.Handle("/api/v1/rooms", a.httpAuthenticatedRequestHandler(httpGetRoomsApi))
 		mux.Handle("/api/v1/set_room_moderator", a.httpAuthenticatedRequestHandler(httpSetModeratorApi))
-		mux.Handle("/api/v1/rooms/{id}", a.httpAuthenticatedRequestHandler(httpGetRoomApi))
+		mux.Handle("/api/v1/rooms/{id}", a.httpAuthenticatedRequestHandler(httpRoomApi))
 		mux.Handle("/api/v1/rooms/{roomId}/join", a.httpAuthenticatedRequestHandler(httpAddRoomApi))
+		mux.Handle("/api/v1/rooms/{id}/move", a.httpAuthenticatedRequestHandler(httpMoveRoomApi))
 		mux.Handle("/api/v1/communities/new", a.httpAuthenticatedRequestHandler(httpCreateCommunityApi))
 		mux.Handle("/api/v1/communities/{id}", a.httpAuthenticatedRequestHandler(httpCommunities))
 		mux.Handle("/api/v1/communities/{id}/config", a.httpAuthenticatedRequestHandler(httpSetCommunityConfigApi))
 		mux.Handle("/api/v1/communities/{id}/rotate_access_token", a.httpAuthenticatedRequestHandler(httpRotateCommunityAccessTokenApi))
+		mux.Handle("/api/v1/communities/{id}/rotate_webhook_secret", a.httpAuthenticatedRequestHandler(httpRotateCommunityWebhookSecretApi))
+		mux.Handle("/api/v1/communities/{id}/decisions", a.httpAuthenticatedRequestHandler(httpGetDecisionsApi))
+		mux.Handle("/api/v1/communities/{id}/overrides", a.httpAuthenticatedRequestHandler(httpOverridesApi))
+		mux.Handle("/api/v1/communities/{id}/hellbans", a.httpAuthenticatedRequestHandler(httpHellbansApi))
+		mux.Handle("/api/v1/communities/{id}/raids", a.httpAuthenticatedRequestHandler(httpRaidsApi))
+		mux.Handle("/api/v1/communities/{id}/media_hashes", a.httpAuthenticatedRequestHandler(httpMediaHashesApi))
+		mux.Handle("/api/v1/communities/{id}/webhooks", a.httpAuthenticatedRequestHandler(httpWebhooksApi))
 		mux.Handle("/api/v1/instance/community_config", a.httpAuthenticatedRequestHandler(httpGetInstanceConfigApi))
 		mux.Handle("/api/v1/sources/muninn/set_member_directory_event", a.httpAuthenticatedRequestHandler(httpSetMuninnSourceData))
 		mux.Handle("/api/v1/keyword_templates/{name}", a.httpAuthenticatedRequestHandler(httpKeywordTemplates))
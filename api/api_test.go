@@ -41,8 +41,12 @@ func makeApi(t *testing.T) *Api {
 	assert.NoError(t, err)
 	assert.NotNil(t, pool)
 
+	_, signingKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
 	hs, err := homeserver.NewHomeserver(&homeserver.Config{
-		ServerName: "example.org",
+		ServerName:        "example.org",
+		PrivateSigningKey: signingKey, // used by federation requests, which are expected to fail in tests
 		KeyQueryServer: &homeserver.KeyQueryServer{
 			Name:           "example.org",
 			PreferredKeyId: "abc",
@@ -9,6 +9,7 @@ import (
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
 )
 
 func httpCreateCommunityApi(api *Api, w http.ResponseWriter, r *http.Request) {
@@ -47,7 +48,7 @@ func httpCreateCommunityApi(api *Api, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = respondJson("httpCreateCommunityApi", r, w, community)
+	err = respondJson("httpCreateCommunityApi", r, w, redactCommunity(community))
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
@@ -83,7 +84,7 @@ func communityGetHandler(api *Api, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = respondJson("communityGetHandler", r, w, community)
+	err = respondJson("communityGetHandler", r, w, redactCommunity(community))
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
@@ -123,6 +124,13 @@ func communityPatchHandler(api *Api, w http.ResponseWriter, r *http.Request) {
 	community.CommunityId = communityId
 	community.ApiAccessToken = accessToken
 
+	// The config may have been replaced too, so needs the same validation as the config endpoint
+	err = api.communityManager.ValidateCommunityConfig(community.Config)
+	if err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
 	// Update in the database before returning
 	err = api.storage.UpsertCommunity(r.Context(), community)
 	if err != nil {
@@ -130,7 +138,7 @@ func communityPatchHandler(api *Api, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = respondJson("communityGetHandler", r, w, community)
+	err = respondJson("communityGetHandler", r, w, redactCommunity(community))
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
@@ -167,14 +175,30 @@ func httpSetCommunityConfigApi(api *Api, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	community.Config = req
+	doHttpSetCommunityConfig("httpSetCommunityConfigApi", api, w, r, community, req)
+}
+
+func doHttpSetCommunityConfig(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity, communityConfig *config.CommunityConfig) {
+	errs := newErrorResponder(funcName, w, r)
+
+	err := api.communityManager.ValidateCommunityConfig(communityConfig)
+	if err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	if communityConfig.OpenAIFilterApiKey == nil && community.Config != nil {
+		// The API key is never returned, so clients replacing the whole config won't know to include it
+		communityConfig.OpenAIFilterApiKey = community.Config.OpenAIFilterApiKey
+	}
+	community.Config = communityConfig
 	err = api.storage.UpsertCommunity(r.Context(), community)
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
 	}
 
-	err = respondJson("httpSetCommunityConfigApi", r, w, community)
+	err = respondJson(funcName, r, w, redactCommunity(community))
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
@@ -204,17 +228,23 @@ func httpRotateCommunityAccessTokenApi(api *Api, w http.ResponseWriter, r *http.
 		return
 	}
 
+	doHttpRotateCommunityAccessToken("httpRotateCommunityAccessTokenApi", api, w, r, community)
+}
+
+func doHttpRotateCommunityAccessToken(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
 	oldAccessToken := internal.Dereference(community.ApiAccessToken)
 
 	newAccessToken := fmt.Sprintf("pst_%s", rand.Text())
 	community.ApiAccessToken = internal.Pointer(newAccessToken)
-	err = api.storage.UpsertCommunity(r.Context(), community)
+	err := api.storage.UpsertCommunity(r.Context(), community)
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
 	}
 
-	err = respondJson("httpRotateCommunityAccessTokenApi", r, w, map[string]string{
+	err = respondJson(funcName, r, w, map[string]string{
 		"old_access_token": oldAccessToken,
 		"new_access_token": newAccessToken,
 	})
@@ -223,3 +253,15 @@ func httpRotateCommunityAccessTokenApi(api *Api, w http.ResponseWriter, r *http.
 		return
 	}
 }
+
+// redactCommunity - Returns a copy of the community without the secrets stored in its config, like the community's
+// OpenAI API key. Secrets stored outside the config (like the webhook secret) are already excluded from JSON.
+func redactCommunity(community *storage.StoredCommunity) *storage.StoredCommunity {
+	redacted := *community
+	if community.Config != nil && community.Config.OpenAIFilterApiKey != nil {
+		cnf := *community.Config
+		cnf.OpenAIFilterApiKey = nil
+		redacted.Config = &cnf
+	}
+	return &redacted
+}
@@ -128,8 +128,9 @@ func TestGetCommunity(t *testing.T) {
 	assert.NotEmpty(t, community.CommunityId)
 	assert.Equal(t, name, community.Name)
 
-	// Set an access token for the community. This is to ensure we don't leak it through the request.
+	// Set an access token and OpenAI API key for the community. This is to ensure we don't leak them through the request.
 	community.ApiAccessToken = internal.Pointer("pst_TESTING")
+	community.Config.OpenAIFilterApiKey = internal.Pointer("sk-TESTING")
 	err = api.storage.UpsertCommunity(context.Background(), community)
 	assert.NoError(t, err)
 	community.ApiAccessToken = nil // so the assert.Equal() passes later
@@ -139,6 +140,8 @@ func TestGetCommunity(t *testing.T) {
 	r.SetPathValue("id", community.CommunityId)
 	communityGetHandler(api, w, r)
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "sk-TESTING")
+	community.Config.OpenAIFilterApiKey = nil // so the assert.Equal() passes too
 	fromRes := &storage.StoredCommunity{}
 	err = json.Unmarshal(w.Body.Bytes(), fromRes)
 	assert.NoError(t, err)
@@ -217,6 +220,36 @@ func TestPatchCommunity(t *testing.T) {
 	// case *should* cover this.
 }
 
+func TestPatchCommunityInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	assert.NotNil(t, community)
+
+	patchBody := map[string]any{
+		"name": "New Name",
+		"config": &config.CommunityConfig{
+			FilterPipeline: &[]*config.FilterPipelineGroup{{
+				Filters: []string{"NotARealFilter"},
+			}},
+		},
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPatch, "/api/v1/communities/"+community.CommunityId, test.MakeJsonBody(t, patchBody))
+	r.SetPathValue("id", community.CommunityId)
+	communityPatchHandler(api, w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "filter pipeline group 0: unknown filter name: NotARealFilter")
+
+	// The community should not have been changed
+	fromDb, err := api.storage.GetCommunity(context.Background(), community.CommunityId)
+	assert.NoError(t, err)
+	assert.Equal(t, community, fromDb)
+}
+
 func TestSetCommunityConfigWrongMethod(t *testing.T) {
 	t.Parallel()
 
@@ -282,6 +315,69 @@ func TestSetCommunityConfig(t *testing.T) {
 	// case *should* cover this.
 }
 
+func TestSetCommunityConfigKeepsOpenAIApiKey(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	community.Config.OpenAIFilterApiKey = internal.Pointer("sk-TESTING")
+	err = api.storage.UpsertCommunity(context.Background(), community)
+	assert.NoError(t, err)
+
+	setConfig := func(cnf *config.CommunityConfig) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/communities/"+community.CommunityId+"/config", test.MakeJsonBody(t, cnf))
+		r.SetPathValue("id", community.CommunityId)
+		httpSetCommunityConfigApi(api, w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "sk-")
+	}
+	getApiKey := func() *string {
+		fromDb, err := api.storage.GetCommunity(context.Background(), community.CommunityId)
+		assert.NoError(t, err)
+		return fromDb.Config.OpenAIFilterApiKey
+	}
+
+	// The API key is never returned, so omitting it keeps the existing key
+	setConfig(&config.CommunityConfig{KeywordFilterKeywords: &[]string{"keyword1"}})
+	assert.Equal(t, internal.Pointer("sk-TESTING"), getApiKey())
+
+	// ... but it can still be changed or removed
+	setConfig(&config.CommunityConfig{OpenAIFilterApiKey: internal.Pointer("sk-CHANGED")})
+	assert.Equal(t, internal.Pointer("sk-CHANGED"), getApiKey())
+	setConfig(&config.CommunityConfig{OpenAIFilterApiKey: internal.Pointer("")})
+	assert.Equal(t, internal.Pointer(""), getApiKey())
+}
+
+func TestSetCommunityConfigInvalidPipeline(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	assert.NotNil(t, community)
+
+	cnf := &config.CommunityConfig{
+		FilterPipeline: &[]*config.FilterPipelineGroup{{
+			Filters: []string{"NotARealFilter"},
+		}},
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/communities/"+community.CommunityId+"/config", test.MakeJsonBody(t, cnf))
+	r.SetPathValue("id", community.CommunityId)
+	httpSetCommunityConfigApi(api, w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "filter pipeline group 0: unknown filter name: NotARealFilter")
+
+	// The config should not have been changed
+	fromDb, err := api.storage.GetCommunity(context.Background(), community.CommunityId)
+	assert.NoError(t, err)
+	assert.Equal(t, community, fromDb)
+}
+
 func TestRotateCommunityAccessTokenWrongMethod(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+const defaultDecisionsLimit = 50
+const maxDecisionsLimit = 500
+
+type decisionResponse struct {
+	*storage.StoredDecision
+	Class string       `json:"class"`
+	Harms []harms.Harm `json:"harms"`
+}
+
+type decisionsResponse struct {
+	Decisions []*decisionResponse `json:"decisions"`
+	// NextBatch - Supplied as `from` to get the next page of decisions. Omitted when there are no more decisions.
+	NextBatch string `json:"next_batch,omitempty"`
+}
+
+func httpGetDecisionsApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpGetDecisionsApi")
+	t := metrics.StartRequestTimer(r.Method, "httpGetDecisionsApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpGetDecisionsApi", w, r)
+
+	if r.Method != http.MethodGet {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpGetDecisions("httpGetDecisionsApi", api, w, r, community)
+}
+
+func doHttpGetDecisions(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	query, err := parseDecisionQuery(r, community.CommunityId)
+	if err != nil {
+		errs.text(http.StatusBadRequest, "M_INVALID_PARAM", err.Error())
+		return
+	}
+
+	decisions, err := api.storage.GetDecisions(r.Context(), query)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	resp := &decisionsResponse{
+		Decisions: make([]*decisionResponse, len(decisions)),
+	}
+	for i, decision := range decisions {
+		resp.Decisions[i] = &decisionResponse{
+			StoredDecision: decision,
+			Class:          decision.ContentInfo.Class().String(),
+			Harms:          decision.ContentInfo.Harms(),
+		}
+	}
+	if len(decisions) == query.Limit {
+		// There might be more decisions
+		resp.NextBatch = strconv.FormatInt(decisions[len(decisions)-1].Id, 10)
+	}
+
+	err = respondJson(funcName, r, w, resp)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func parseDecisionQuery(r *http.Request, communityId string) (*storage.DecisionQuery, error) {
+	params := r.URL.Query()
+	query := &storage.DecisionQuery{
+		CommunityId:  communityId,
+		EventId:      params.Get("event_id"),
+		RoomId:       params.Get("room_id"),
+		SenderUserId: params.Get("sender"),
+		Harm:         harms.Harm(params.Get("harm")),
+		Limit:        defaultDecisionsLimit,
+	}
+
+	parseInt := func(name string, dest *int64) error {
+		val := params.Get(name)
+		if val == "" {
+			return nil
+		}
+		parsed, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("%s must be a positive integer", name)
+		}
+		*dest = parsed
+		return nil
+	}
+	if err := parseInt("since", &query.SinceTimestampMillis); err != nil {
+		return nil, err
+	}
+	if err := parseInt("until", &query.UntilTimestampMillis); err != nil {
+		return nil, err
+	}
+	if err := parseInt("from", &query.BeforeId); err != nil {
+		return nil, err
+	}
+	limit := int64(query.Limit)
+	if err := parseInt("limit", &limit); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxDecisionsLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxDecisionsLimit)
+	}
+	query.Limit = int(limit)
+
+	return query, nil
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func insertTestDecisions(t *testing.T, api *Api, communityId string) {
+	for i, decision := range []*storage.StoredDecision{{
+		EventId:                "$neutral",
+		RoomId:                 "!room1:example.org",
+		SenderUserId:           "@alice:example.org",
+		ContentInfo:            harms.NeutralContent(),
+		DecidedTimestampMillis: 1000,
+	}, {
+		EventId:                "$spam",
+		RoomId:                 "!room1:example.org",
+		SenderUserId:           "@bob:example.org",
+		ContentInfo:            harms.ProhibitedContent(harms.SpamFlooding),
+		DecidedTimestampMillis: 2000,
+	}, {
+		EventId:                "$other_room",
+		RoomId:                 "!room2:example.org",
+		SenderUserId:           "@alice:example.org",
+		ContentInfo:            harms.ProhibitedContent(harms.SpamGeneral),
+		DecidedTimestampMillis: 3000,
+	}} {
+		decision.CommunityId = communityId
+		decision.EventType = "m.room.message"
+		decision.FilterResponses = map[string][]string{"KeywordFilter": {decision.ContentInfo.Class().String()}}
+		decision.ShadowFilterResponses = make(map[string][]string)
+		decision.DurationMillis = int64(i)
+		err := api.storage.InsertDecision(context.Background(), decision)
+		assert.NoError(t, err)
+	}
+
+	// Also insert a decision for another community, which should never be returned
+	err := api.storage.InsertDecision(context.Background(), &storage.StoredDecision{
+		EventId:     "$different_community",
+		CommunityId: "not_" + communityId,
+		RoomId:      "!room1:example.org",
+		ContentInfo: harms.ProhibitedContent(harms.SpamFlooding),
+	})
+	assert.NoError(t, err)
+}
+
+func decodeDecisionEventIds(t *testing.T, w *httptest.ResponseRecorder) ([]string, string) {
+	resp := struct {
+		Decisions []struct {
+			EventId string   `json:"event_id"`
+			Class   string   `json:"class"`
+			Harms   []string `json:"harms"`
+		} `json:"decisions"`
+		NextBatch string `json:"next_batch"`
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	eventIds := make([]string, 0)
+	for _, d := range resp.Decisions {
+		eventIds = append(eventIds, d.EventId)
+	}
+	return eventIds, resp.NextBatch
+}
+
+func TestGetDecisionsApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	insertTestDecisions(t, api, community.CommunityId)
+
+	cases := map[string][]string{
+		"":                                    {"$other_room", "$spam", "$neutral"},
+		"?room_id=!room1:example.org":         {"$spam", "$neutral"},
+		"?sender=@alice:example.org":          {"$other_room", "$neutral"},
+		"?harm=" + string(harms.SpamFlooding): {"$spam"},
+		"?event_id=$neutral":                  {"$neutral"},
+		"?since=2000":                         {"$other_room", "$spam"},
+		"?until=2000":                         {"$neutral"},
+		"?since=1000&until=3000&sender=@bob:example.org": {"$spam"},
+	}
+	for query, expectedEventIds := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/communities/"+community.CommunityId+"/decisions"+query, nil)
+		r.SetPathValue("id", community.CommunityId)
+		httpGetDecisionsApi(api, w, r)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		eventIds, nextBatch := decodeDecisionEventIds(t, w)
+		assert.Equal(t, expectedEventIds, eventIds, query)
+		assert.Empty(t, nextBatch, query)
+	}
+
+	// Check that the class and harms are included
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/communities/"+community.CommunityId+"/decisions?event_id=$spam", nil)
+	r.SetPathValue("id", community.CommunityId)
+	httpGetDecisionsApi(api, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"decisions":[{
+		"id": 2,
+		"event_id": "$spam",
+		"community_id": "`+community.CommunityId+`",
+		"room_id": "!room1:example.org",
+		"sender": "@bob:example.org",
+		"event_type": "m.room.message",
+		"filter_responses": {"KeywordFilter": ["Prohibited"]},
+		"shadow_filter_responses": {},
+		"duration_ms": 1,
+		"decided_ts": 2000,
+		"class": "Prohibited",
+		"harms": ["`+string(harms.SpamFlooding)+`"]
+	}]}`, w.Body.String())
+}
+
+func TestGetDecisionsApiPagination(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	insertTestDecisions(t, api, community.CommunityId)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/communities/"+community.CommunityId+"/decisions?limit=2", nil)
+	r.SetPathValue("id", community.CommunityId)
+	httpGetDecisionsApi(api, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	eventIds, nextBatch := decodeDecisionEventIds(t, w)
+	assert.Equal(t, []string{"$other_room", "$spam"}, eventIds)
+	assert.NotEmpty(t, nextBatch)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/communities/"+community.CommunityId+"/decisions?limit=2&from="+nextBatch, nil)
+	r.SetPathValue("id", community.CommunityId)
+	httpGetDecisionsApi(api, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	eventIds, nextBatch = decodeDecisionEventIds(t, w)
+	assert.Equal(t, []string{"$neutral"}, eventIds)
+	assert.Empty(t, nextBatch)
+}
+
+func TestGetDecisionsApiErrors(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+
+	// Wrong method
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/communities/"+community.CommunityId+"/decisions", nil)
+	r.SetPathValue("id", community.CommunityId)
+	httpGetDecisionsApi(api, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+
+	// Unknown community
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/communities/nope/decisions", nil)
+	r.SetPathValue("id", "nope")
+	httpGetDecisionsApi(api, w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Community not found")
+
+	// Bad params
+	cases := map[string]string{
+		"?limit=0":     "limit must be between 1 and 500",
+		"?limit=501":   "limit must be between 1 and 500",
+		"?limit=ten":   "limit must be a positive integer",
+		"?since=-1":    "since must be a positive integer",
+		"?until=later": "until must be a positive integer",
+		"?from=abc":    "from must be a positive integer",
+	}
+	for query, expectedErr := range cases {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/api/v1/communities/"+community.CommunityId+"/decisions"+query, nil)
+		r.SetPathValue("id", community.CommunityId)
+		httpGetDecisionsApi(api, w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		test.AssertApiError(t, w, "M_INVALID_PARAM", expectedErr)
+	}
+}
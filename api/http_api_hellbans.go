@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+type hellbansResponse struct {
+	Hellbans []*storage.StoredHellban `json:"hellbans"`
+}
+
+type hellbanRequest struct {
+	UserId  string `json:"user_id"`
+	Minutes int    `json:"minutes,omitempty"` // only used when adding/extending
+}
+
+func httpHellbansApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpHellbansApi")
+	t := metrics.StartRequestTimer(r.Method, "httpHellbansApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpHellbansApi", w, r)
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpHellbans("httpHellbansApi", api, w, r, community)
+}
+
+func doHttpHellbans(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	if r.Method == http.MethodGet {
+		doHttpGetHellbans(funcName, api, w, r, community)
+	} else if r.Method == http.MethodPost {
+		doHttpSetHellban(funcName, api, w, r, community)
+	} else if r.Method == http.MethodDelete {
+		doHttpLiftHellban(funcName, api, w, r, community)
+	} else {
+		errs := newErrorResponder(funcName, w, r)
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+	}
+}
+
+func doHttpGetHellbans(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	hellbans, err := api.storage.GetActiveHellbans(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, &hellbansResponse{Hellbans: hellbans})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpSetHellban(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &hellbanRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateHellbanRequest(req, true); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	// Manual hellbans keep the user's strikes (if any) so they don't reset or add to escalation.
+	existing, err := api.storage.GetHellban(r.Context(), community.CommunityId, req.UserId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	hellban := &storage.StoredHellban{
+		CommunityId:            community.CommunityId,
+		UserId:                 req.UserId,
+		ExpiresTimestampMillis: time.Now().Add(time.Duration(req.Minutes) * time.Minute).UnixMilli(),
+	}
+	if existing != nil {
+		hellban.Strikes = existing.Strikes
+	}
+	// Note: the `ps_hellban_change` trigger takes care of telling the hellban prefilters.
+	err = api.storage.UpsertHellban(r.Context(), hellban)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, hellban)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpLiftHellban(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &hellbanRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateHellbanRequest(req, false); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	// Note: the `ps_hellban_change` trigger takes care of telling the hellban prefilters.
+	err = api.storage.DeleteHellban(r.Context(), community.CommunityId, req.UserId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, struct{}{})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func validateHellbanRequest(req *hellbanRequest, needsMinutes bool) error {
+	if !strings.HasPrefix(req.UserId, "@") || !strings.Contains(req.UserId, ":") {
+		return fmt.Errorf("user_id must be a user ID")
+	}
+	if needsMinutes && req.Minutes <= 0 {
+		return fmt.Errorf("minutes must be greater than zero")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func doHellbansRequest(t *testing.T, api *Api, communityId string, method string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/v1/communities/"+communityId+"/hellbans", strings.NewReader(body))
+	r.SetPathValue("id", communityId)
+	httpHellbansApi(api, w, r)
+	return w
+}
+
+func decodeHellbans(t *testing.T, w *httptest.ResponseRecorder) []*storage.StoredHellban {
+	resp := &hellbansResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), resp)
+	assert.NoError(t, err)
+	return resp.Hellbans
+}
+
+func TestHellbansApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+
+	// An expired hellban with strikes, which shouldn't be listed
+	err = api.storage.UpsertHellban(ctx, &storage.StoredHellban{
+		CommunityId:            community.CommunityId,
+		UserId:                 "@repeat:example.org",
+		ExpiresTimestampMillis: time.Now().Add(-1 * time.Minute).UnixMilli(),
+		Strikes:                3,
+	})
+	assert.NoError(t, err)
+
+	// Nothing to start with
+	w := doHellbansRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeHellbans(t, w))
+
+	// Add a couple
+	before := time.Now()
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodPost, `{"user_id":"@alice:example.org","minutes":10}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodPost, `{"user_id":"@repeat:example.org","minutes":5}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	hellbans := decodeHellbans(t, w)
+	assert.Len(t, hellbans, 2)
+	assert.Equal(t, "@repeat:example.org", hellbans[0].UserId) // soonest expiring first
+	assert.Equal(t, 3, hellbans[0].Strikes)                    // strikes are kept
+	assert.GreaterOrEqual(t, hellbans[0].ExpiresTimestampMillis, before.Add(5*time.Minute).UnixMilli())
+	assert.Equal(t, "@alice:example.org", hellbans[1].UserId)
+	assert.Equal(t, 0, hellbans[1].Strikes)
+	assert.Equal(t, community.CommunityId, hellbans[1].CommunityId)
+
+	// Extend one
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodPost, `{"user_id":"@repeat:example.org","minutes":60}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	hellban, err := api.storage.GetHellban(ctx, community.CommunityId, "@repeat:example.org")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, hellban.ExpiresTimestampMillis, before.Add(60*time.Minute).UnixMilli())
+
+	// Lift one
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodDelete, `{"user_id":"@alice:example.org"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	hellbans = decodeHellbans(t, w)
+	assert.Len(t, hellbans, 1)
+	assert.Equal(t, "@repeat:example.org", hellbans[0].UserId)
+}
+
+func TestHellbansApiInvalid(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		`{"user_id":"alice","minutes":10}`:             "user_id must be a user ID",
+		`{"user_id":"@alice:example.org"}`:             "minutes must be greater than zero",
+		`{"user_id":"@alice:example.org","minutes":0}`: "minutes must be greater than zero",
+	}
+	for body, expectedErr := range cases {
+		w := doHellbansRequest(t, api, community.CommunityId, http.MethodPost, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		test.AssertApiError(t, w, "M_BAD_JSON", expectedErr)
+	}
+
+	w := doHellbansRequest(t, api, community.CommunityId, http.MethodDelete, `{"user_id":"alice"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "user_id must be a user ID")
+
+	w = doHellbansRequest(t, api, community.CommunityId, http.MethodPut, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+
+	w = doHellbansRequest(t, api, "not_a_community", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Community not found")
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/matrix-org/policyserv/content"
+	"github.com/matrix-org/policyserv/media"
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+type mediaHashesResponse struct {
+	Hashes []*storage.StoredMediaHash `json:"hashes"`
+}
+
+type mediaHashRequest struct {
+	Bank   string                `json:"bank"`
+	Kind   storage.MediaHashKind `json:"kind"`
+	Value  string                `json:"value"`
+	MxcUri string                `json:"mxc_uri"`
+	Reason string                `json:"reason"`
+}
+
+func httpMediaHashesApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpMediaHashesApi")
+	t := metrics.StartRequestTimer(r.Method, "httpMediaHashesApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpMediaHashesApi", w, r)
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpMediaHashes("httpMediaHashesApi", api, w, r, community)
+}
+
+func doHttpMediaHashes(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	if r.Method == http.MethodGet {
+		doHttpGetMediaHashes(funcName, api, w, r, community)
+	} else if r.Method == http.MethodPost {
+		doHttpAddMediaHashes(funcName, api, w, r, community)
+	} else if r.Method == http.MethodDelete {
+		doHttpRemoveMediaHashes(funcName, api, w, r, community)
+	} else {
+		errs := newErrorResponder(funcName, w, r)
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+	}
+}
+
+func doHttpGetMediaHashes(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	hashes, err := api.storage.GetMediaHashes(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, &mediaHashesResponse{Hashes: hashes})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpAddMediaHashes(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &mediaHashRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateMediaHashRequest(req, true); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	hashes := content.MediaHashes{req.Kind: req.Value}
+	if req.MxcUri != "" {
+		// Moderators typically only know the MXC URI of the media they want to ban, so we hash it ourselves
+		item, err := media.NewItem(req.MxcUri, api.mediaDownloader)
+		if err != nil {
+			errs.text(http.StatusBadRequest, "M_BAD_JSON", "mxc_uri must be an MXC URI")
+			return
+		}
+		b, err := item.Download()
+		if err != nil {
+			log.Printf("%s: error downloading %s: %s", funcName, item, err)
+			errs.text(http.StatusNotFound, "M_NOT_FOUND", "Media could not be downloaded")
+			return
+		}
+		hashes = content.HashMedia(b)
+	}
+
+	added := make([]*storage.StoredMediaHash, 0, len(hashes))
+	for _, kind := range []storage.MediaHashKind{storage.MediaHashKindSha256, storage.MediaHashKindPHash, storage.MediaHashKindDHash} {
+		value, ok := hashes[kind]
+		if !ok {
+			continue
+		}
+		hash := &storage.StoredMediaHash{
+			CommunityId:            community.CommunityId,
+			Bank:                   req.Bank,
+			Kind:                   kind,
+			Value:                  value,
+			MxcUri:                 req.MxcUri,
+			Reason:                 req.Reason,
+			CreatedTimestampMillis: time.Now().UnixMilli(),
+		}
+		err = api.storage.UpsertMediaHash(r.Context(), hash)
+		if err != nil {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+			return
+		}
+		added = append(added, hash)
+	}
+
+	// Media scan results are cached (forever), so media which has already been seen needs to be scanned again
+	err = api.storage.DeleteMediaClassifications(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, &mediaHashesResponse{Hashes: added})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpRemoveMediaHashes(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &mediaHashRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateMediaHashRequest(req, false); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	if req.MxcUri != "" {
+		err = api.storage.DeleteMediaHashesByMxcUri(r.Context(), community.CommunityId, req.MxcUri)
+	} else {
+		err = api.storage.DeleteMediaHash(r.Context(), community.CommunityId, req.Bank, req.Kind, req.Value)
+	}
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	// Like adding hashes, media which was blocked by the removed hashes needs to be scanned again
+	err = api.storage.DeleteMediaClassifications(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, struct{}{})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+// validateMediaHashRequest - Ensures the request has either a kind and value, or an MXC URI. Hashes removed by MXC URI
+// are removed from all banks, so the bank is only required when adding or when removing by kind and value.
+func validateMediaHashRequest(req *mediaHashRequest, isAdd bool) error {
+	if req.MxcUri != "" {
+		if req.Kind != "" || req.Value != "" {
+			return errors.New("kind and value cannot be used with mxc_uri")
+		}
+		origin, mediaId, _ := strings.Cut(strings.TrimPrefix(req.MxcUri, "mxc://"), "/")
+		if !strings.HasPrefix(req.MxcUri, "mxc://") || origin == "" || mediaId == "" {
+			return errors.New("mxc_uri must be an MXC URI")
+		}
+		if isAdd && req.Bank == "" {
+			return errors.New("bank is required")
+		}
+		return nil
+	}
+
+	if req.Bank == "" {
+		return errors.New("bank is required")
+	}
+	switch req.Kind {
+	case storage.MediaHashKindSha256:
+		if b, err := hex.DecodeString(req.Value); err != nil || len(b) != 32 || strings.ToLower(req.Value) != req.Value {
+			return errors.New("value must be a lowercase hex-encoded SHA-256 hash")
+		}
+	case storage.MediaHashKindPHash, storage.MediaHashKindDHash:
+		if b, err := hex.DecodeString(req.Value); err != nil || len(b) != 8 || strings.ToLower(req.Value) != req.Value {
+			return errors.New("value must be a lowercase hex-encoded 64-bit perceptual hash")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %s, %s, or %s, or mxc_uri must be set", storage.MediaHashKindSha256, storage.MediaHashKindPHash, storage.MediaHashKindDHash)
+	}
+	return nil
+}
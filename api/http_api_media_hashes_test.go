@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/policyserv/content"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func doMediaHashesRequest(t *testing.T, api *Api, communityId string, method string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/v1/communities/"+communityId+"/media_hashes", strings.NewReader(body))
+	r.SetPathValue("id", communityId)
+	httpMediaHashesApi(api, w, r)
+	return w
+}
+
+func decodeMediaHashes(t *testing.T, w *httptest.ResponseRecorder) []*storage.StoredMediaHash {
+	resp := &mediaHashesResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), resp)
+	assert.NoError(t, err)
+	return resp.Hashes
+}
+
+func TestMediaHashesApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	imageBytes := test.MustMakeImage(t, 100, 100, 0)
+	api.mediaDownloader = test.MustMakeMediaDownloader(t).
+		Set("example.org", "image", imageBytes).
+		Set("example.org", "file", []byte("not an image"))
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	err = api.storage.UpsertMediaClassification(ctx, &storage.StoredMediaClassification{
+		MxcUri:          "mxc://example.org/image",
+		CommunityId:     community.CommunityId,
+		Classifications: storage.StoredClassifications{ContentInfo: harms.NeutralContent()},
+	})
+	assert.NoError(t, err)
+
+	// Nothing to start with
+	w := doMediaHashesRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeMediaHashes(t, w))
+
+	// Adding by MXC URI hashes the media, and clears the cached scan results
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodPost, `{"bank":"shock","mxc_uri":"mxc://example.org/image","reason":"gore"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	added := decodeMediaHashes(t, w)
+	expected := content.HashMedia(imageBytes)
+	assert.Len(t, added, 3)
+	for _, hash := range added {
+		assert.Equal(t, community.CommunityId, hash.CommunityId)
+		assert.Equal(t, "shock", hash.Bank)
+		assert.Equal(t, expected[hash.Kind], hash.Value)
+		assert.Equal(t, "mxc://example.org/image", hash.MxcUri)
+		assert.Equal(t, "gore", hash.Reason)
+		assert.NotZero(t, hash.CreatedTimestampMillis)
+	}
+	_, err = api.storage.GetMediaClassification(ctx, "mxc://example.org/image", community.CommunityId)
+	assert.Error(t, err)
+
+	// Media which isn't an image only gets a SHA-256 hash
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodPost, `{"bank":"shock","mxc_uri":"mxc://example.org/file"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	added = decodeMediaHashes(t, w)
+	assert.Len(t, added, 1)
+	assert.Equal(t, storage.MediaHashKindSha256, added[0].Kind)
+
+	// Hashes can be added directly too
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodPost, `{"bank":"other","kind":"phash","value":"0123456789abcdef"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeMediaHashes(t, w), 5)
+
+	// Remove by MXC URI, then by value
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodDelete, `{"mxc_uri":"mxc://example.org/image"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodDelete, `{"bank":"other","kind":"phash","value":"0123456789abcdef"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	hashes := decodeMediaHashes(t, w)
+	assert.Len(t, hashes, 1)
+	assert.Equal(t, "mxc://example.org/file", hashes[0].MxcUri)
+}
+
+func TestMediaHashesApiInvalid(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	api.mediaDownloader = test.MustMakeMediaDownloader(t)
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		`{"bank":"shock","kind":"md5","value":"d41d8cd98f00b204e9800998ecf8427e"}`: "kind must be one of sha256, phash, or dhash, or mxc_uri must be set",
+		`{"bank":"shock","kind":"sha256","value":"not a hash"}`:                    "value must be a lowercase hex-encoded SHA-256 hash",
+		`{"bank":"shock","kind":"phash","value":"0123456789ABCDEF"}`:               "value must be a lowercase hex-encoded 64-bit perceptual hash",
+		`{"bank":"shock","kind":"dhash","value":"0123"}`:                           "value must be a lowercase hex-encoded 64-bit perceptual hash",
+		`{"kind":"phash","value":"0123456789abcdef"}`:                              "bank is required",
+		`{"bank":"shock","mxc_uri":"https://example.org/image.png"}`:               "mxc_uri must be an MXC URI",
+		`{"bank":"shock","mxc_uri":"mxc://example.org"}`:                           "mxc_uri must be an MXC URI",
+		`{"bank":"shock","mxc_uri":"mxc://example.org/image","kind":"phash"}`:      "kind and value cannot be used with mxc_uri",
+	}
+	for body, expectedErr := range cases {
+		for _, method := range []string{http.MethodPost, http.MethodDelete} {
+			w := doMediaHashesRequest(t, api, community.CommunityId, method, body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			test.AssertApiError(t, w, "M_BAD_JSON", expectedErr)
+		}
+	}
+
+	// Adding by MXC URI requires a bank, but removing doesn't
+	w := doMediaHashesRequest(t, api, community.CommunityId, http.MethodPost, `{"mxc_uri":"mxc://example.org/image"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "bank is required")
+
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodPost, `{"bank":"shock","mxc_uri":"mxc://example.org/unknown"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Media could not be downloaded")
+
+	w = doMediaHashesRequest(t, api, community.CommunityId, http.MethodPut, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+
+	w = doMediaHashesRequest(t, api, "not_a_community", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Community not found")
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+type overridesResponse struct {
+	Overrides []*storage.StoredOverride `json:"overrides"`
+}
+
+type overrideRequest struct {
+	Kind   storage.OverrideKind `json:"kind"`
+	Value  string               `json:"value"`
+	Reason string               `json:"reason"`
+}
+
+func httpOverridesApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpOverridesApi")
+	t := metrics.StartRequestTimer(r.Method, "httpOverridesApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpOverridesApi", w, r)
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpOverrides("httpOverridesApi", api, w, r, community)
+}
+
+func doHttpOverrides(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	if r.Method == http.MethodGet {
+		doHttpGetOverrides(funcName, api, w, r, community)
+	} else if r.Method == http.MethodPost {
+		doHttpAddOverride(funcName, api, w, r, community)
+	} else if r.Method == http.MethodDelete {
+		doHttpRemoveOverride(funcName, api, w, r, community)
+	} else {
+		errs := newErrorResponder(funcName, w, r)
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+	}
+}
+
+func doHttpGetOverrides(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	overrides, err := api.storage.GetOverrides(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, &overridesResponse{Overrides: overrides})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpAddOverride(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &overrideRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateOverrideRequest(req); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	override := &storage.StoredOverride{
+		CommunityId:            community.CommunityId,
+		Kind:                   req.Kind,
+		Value:                  req.Value,
+		Reason:                 req.Reason,
+		CreatedTimestampMillis: time.Now().UnixMilli(),
+	}
+	err = api.storage.UpsertOverride(r.Context(), override)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	if override.Kind == storage.OverrideKindEventId {
+		// The event's result is cached (forever), so future checks won't reach the override prefilter. Forgetting the
+		// result gets the event checked again, at which point the override applies. This is safe to do for events in
+		// other communities too because the override only applies to the community's own rooms.
+		err = api.storage.DeleteEventResult(r.Context(), override.Value)
+		if err != nil {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+			return
+		}
+	}
+
+	err = respondJson(funcName, r, w, override)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpRemoveOverride(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &overrideRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateOverrideRequest(req); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	err = api.storage.DeleteOverride(r.Context(), community.CommunityId, req.Kind, req.Value)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if req.Kind == storage.OverrideKindEventId {
+		// Like when adding the override, the event needs checking again so the cached "allowed" result isn't used
+		// forever.
+		err = api.storage.DeleteEventResult(r.Context(), req.Value)
+		if err != nil {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+			return
+		}
+	}
+
+	err = respondJson(funcName, r, w, struct{}{})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func validateOverrideRequest(req *overrideRequest) error {
+	switch req.Kind {
+	case storage.OverrideKindEventId:
+		if !strings.HasPrefix(req.Value, "$") {
+			return fmt.Errorf("value must be an event ID")
+		}
+	case storage.OverrideKindUserId:
+		if !strings.HasPrefix(req.Value, "@") || !strings.Contains(req.Value, ":") {
+			return fmt.Errorf("value must be a user ID")
+		}
+	case storage.OverrideKindContentHash:
+		if b, err := hex.DecodeString(req.Value); err != nil || len(b) != 32 || strings.ToLower(req.Value) != req.Value {
+			return fmt.Errorf("value must be a lowercase hex-encoded SHA-256 hash")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %s, %s, or %s", storage.OverrideKindEventId, storage.OverrideKindUserId, storage.OverrideKindContentHash)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func doOverridesRequest(t *testing.T, api *Api, communityId string, method string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/v1/communities/"+communityId+"/overrides", strings.NewReader(body))
+	r.SetPathValue("id", communityId)
+	httpOverridesApi(api, w, r)
+	return w
+}
+
+func decodeOverrides(t *testing.T, w *httptest.ResponseRecorder) []*storage.StoredOverride {
+	resp := &overridesResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), resp)
+	assert.NoError(t, err)
+	return resp.Overrides
+}
+
+func TestOverridesApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	for _, eventId := range []string{"$spam", "$different_community"} {
+		err = api.storage.UpsertEventResult(ctx, &storage.StoredEventResult{
+			EventId:        eventId,
+			IsProbablySpam: true,
+			ContentInfo:    harms.ProhibitedContent(harms.SpamFlooding),
+		})
+		assert.NoError(t, err)
+	}
+
+	// Nothing to start with
+	w := doOverridesRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeOverrides(t, w))
+
+	// Allowing an event should forget the cached result so the event is checked again, this time with the override
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodPost, `{"kind":"event_id","value":"$spam","reason":"false positive"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	res, err := api.storage.GetEventResult(ctx, "$spam")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	// Events checked by other communities are forgotten too, but their overrides don't apply to other communities' rooms
+	// so the event will be flagged again
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodPost, `{"kind":"event_id","value":"$different_community"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	res, err = api.storage.GetEventResult(ctx, "$different_community")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodPost, `{"kind":"user_id","value":"@alice:example.org"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodPost, `{"kind":"content_hash","value":"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	overrides := decodeOverrides(t, w)
+	assert.Len(t, overrides, 4)
+	assert.Equal(t, storage.OverrideKindEventId, overrides[0].Kind)
+	assert.Equal(t, "$spam", overrides[0].Value)
+	assert.Equal(t, "false positive", overrides[0].Reason)
+	assert.NotZero(t, overrides[0].CreatedTimestampMillis)
+
+	// Remove one
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodDelete, `{"kind":"user_id","value":"@alice:example.org"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	overrides = decodeOverrides(t, w)
+	assert.Len(t, overrides, 3)
+	for _, o := range overrides {
+		assert.NotEqual(t, storage.OverrideKindUserId, o.Kind)
+	}
+
+	// Removing an event override should forget the "allowed" result the override caused
+	err = api.storage.UpsertEventResult(ctx, &storage.StoredEventResult{
+		EventId:        "$spam",
+		IsProbablySpam: false,
+		ContentInfo:    harms.AllowedContent(),
+	})
+	assert.NoError(t, err)
+	w = doOverridesRequest(t, api, community.CommunityId, http.MethodDelete, `{"kind":"event_id","value":"$spam"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	res, err = api.storage.GetEventResult(ctx, "$spam")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+}
+
+func TestOverridesApiInvalid(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		`{"kind":"room_id","value":"!foo:example.org"}`:                                                      "kind must be one of event_id, user_id, or content_hash",
+		`{"kind":"event_id","value":"@alice:example.org"}`:                                                   "value must be an event ID",
+		`{"kind":"user_id","value":"alice"}`:                                                                 "value must be a user ID",
+		`{"kind":"content_hash","value":"not a hash"}`:                                                       "value must be a lowercase hex-encoded SHA-256 hash",
+		`{"kind":"content_hash","value":"B94D27B9934D3E08A52E52D7DA7DABFAC484EFE37A5380EE9088F7ACE2EFCDE9"}`: "value must be a lowercase hex-encoded SHA-256 hash",
+	}
+	for body, expectedErr := range cases {
+		for _, method := range []string{http.MethodPost, http.MethodDelete} {
+			w := doOverridesRequest(t, api, community.CommunityId, method, body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			test.AssertApiError(t, w, "M_BAD_JSON", expectedErr)
+		}
+	}
+
+	w := doOverridesRequest(t, api, community.CommunityId, http.MethodPut, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+
+	w = doOverridesRequest(t, api, "not_a_community", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Community not found")
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+type raidsResponse struct {
+	Raids []*storage.StoredRaid `json:"raids"`
+}
+
+type raidRequest struct {
+	RoomId  string `json:"room_id"`           // empty for the whole community
+	Minutes int    `json:"minutes,omitempty"` // only used when starting/extending
+}
+
+func httpRaidsApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRaidsApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRaidsApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpRaidsApi", w, r)
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpRaids("httpRaidsApi", api, w, r, community)
+}
+
+func doHttpRaids(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	if r.Method == http.MethodGet {
+		doHttpGetRaids(funcName, api, w, r, community)
+	} else if r.Method == http.MethodPost {
+		doHttpStartRaid(funcName, api, w, r, community)
+	} else if r.Method == http.MethodDelete {
+		doHttpEndRaid(funcName, api, w, r, community)
+	} else {
+		errs := newErrorResponder(funcName, w, r)
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+	}
+}
+
+func doHttpGetRaids(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	raids, err := api.storage.GetActiveRaids(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, &raidsResponse{Raids: raids})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpStartRaid(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &raidRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateRaidRequest(req, true); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+	if !isRaidRoomInCommunity(api, r, errs, community, req.RoomId) {
+		return
+	}
+
+	// Manual raids always start now, so users who joined during an earlier (automatic) raid aren't caught by it.
+	now := time.Now()
+	raid := &storage.StoredRaid{
+		CommunityId:            community.CommunityId,
+		RoomId:                 req.RoomId,
+		StartedTimestampMillis: now.UnixMilli(),
+		ExpiresTimestampMillis: now.Add(time.Duration(req.Minutes) * time.Minute).UnixMilli(),
+		IsManual:               true,
+	}
+	// Note: the `ps_raid_change` trigger takes care of telling the raid prefilters.
+	err = api.storage.UpsertRaid(r.Context(), raid)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	err = api.communityManager.NotifyRaid(r.Context(), raid)
+	if err != nil {
+		// The raid is already in place, so we don't fail the request
+		log.Printf("[%s] Failed to notify about manual raid: %s", community.CommunityId, err)
+	}
+
+	err = respondJson(funcName, r, w, raid)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpEndRaid(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &raidRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateRaidRequest(req, false); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	// Note: the `ps_raid_change` trigger takes care of telling the raid prefilters.
+	err = api.storage.DeleteRaid(r.Context(), community.CommunityId, req.RoomId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, struct{}{})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+// isRaidRoomInCommunity - Returns true if the room ID is empty (the whole community) or belongs to the community.
+// Otherwise, an error is sent to the client and false is returned.
+func isRaidRoomInCommunity(api *Api, r *http.Request, errs *errorResponder, community *storage.StoredCommunity, roomId string) bool {
+	if roomId == "" {
+		return true
+	}
+	room, err := api.storage.GetRoom(r.Context(), roomId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return false
+	}
+	if room == nil || room.CommunityId != community.CommunityId {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Room not found in community")
+		return false
+	}
+	return true
+}
+
+func validateRaidRequest(req *raidRequest, needsMinutes bool) error {
+	if req.RoomId != "" && !strings.HasPrefix(req.RoomId, "!") {
+		return fmt.Errorf("room_id must be a room ID, or empty for the whole community")
+	}
+	if needsMinutes && req.Minutes <= 0 {
+		return fmt.Errorf("minutes must be greater than zero")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func doRaidsRequest(t *testing.T, api *Api, communityId string, method string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/v1/communities/"+communityId+"/raids", strings.NewReader(body))
+	r.SetPathValue("id", communityId)
+	httpRaidsApi(api, w, r)
+	return w
+}
+
+func decodeRaids(t *testing.T, w *httptest.ResponseRecorder) []*storage.StoredRaid {
+	resp := &raidsResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), resp)
+	assert.NoError(t, err)
+	return resp.Raids
+}
+
+func TestRaidsApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	err = api.storage.UpsertRoom(ctx, &storage.StoredRoom{
+		RoomId:      "!room:example.org",
+		CommunityId: community.CommunityId,
+	})
+	assert.NoError(t, err)
+
+	// An expired raid, which shouldn't be listed
+	err = api.storage.UpsertRaid(ctx, &storage.StoredRaid{
+		CommunityId:            community.CommunityId,
+		RoomId:                 "!old:example.org",
+		StartedTimestampMillis: time.Now().Add(-1 * time.Hour).UnixMilli(),
+		ExpiresTimestampMillis: time.Now().Add(-1 * time.Minute).UnixMilli(),
+	})
+	assert.NoError(t, err)
+
+	// Nothing to start with
+	w := doRaidsRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeRaids(t, w))
+
+	// Start one for the room and one for the whole community
+	before := time.Now()
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodPost, `{"room_id":"!room:example.org","minutes":10}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodPost, `{"room_id":"","minutes":5}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	raids := decodeRaids(t, w)
+	assert.Len(t, raids, 2)
+	assert.Equal(t, "", raids[0].RoomId) // soonest expiring first
+	assert.GreaterOrEqual(t, raids[0].ExpiresTimestampMillis, before.Add(5*time.Minute).UnixMilli())
+	assert.GreaterOrEqual(t, raids[0].StartedTimestampMillis, before.UnixMilli())
+	assert.True(t, raids[0].IsManual)
+	assert.Equal(t, "!room:example.org", raids[1].RoomId)
+	assert.Equal(t, community.CommunityId, raids[1].CommunityId)
+
+	// Extend one
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodPost, `{"room_id":"!room:example.org","minutes":60}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	raids, err = api.storage.GetActiveRaids(ctx, community.CommunityId)
+	assert.NoError(t, err)
+	assert.Len(t, raids, 2)
+	assert.GreaterOrEqual(t, raids[1].ExpiresTimestampMillis, before.Add(60*time.Minute).UnixMilli())
+
+	// End one
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodDelete, `{"room_id":""}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	raids = decodeRaids(t, w)
+	assert.Len(t, raids, 1)
+	assert.Equal(t, "!room:example.org", raids[0].RoomId)
+}
+
+func TestRaidsApiInvalid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	otherCommunity, err := api.storage.CreateCommunity(ctx, "Other Community")
+	assert.NoError(t, err)
+	err = api.storage.UpsertRoom(ctx, &storage.StoredRoom{
+		RoomId:      "!other:example.org",
+		CommunityId: otherCommunity.CommunityId,
+	})
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		`{"room_id":"#alias:example.org","minutes":10}`: "room_id must be a room ID, or empty for the whole community",
+		`{"room_id":""}`: "minutes must be greater than zero",
+		`{"room_id":"!room:example.org","minutes":0}`: "minutes must be greater than zero",
+	}
+	for body, expectedErr := range cases {
+		w := doRaidsRequest(t, api, community.CommunityId, http.MethodPost, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		test.AssertApiError(t, w, "M_BAD_JSON", expectedErr)
+	}
+
+	// Rooms must belong to the community
+	for _, roomId := range []string{"!unknown:example.org", "!other:example.org"} {
+		w := doRaidsRequest(t, api, community.CommunityId, http.MethodPost, `{"room_id":"`+roomId+`","minutes":10}`)
+		assert.Equal(t, http.StatusNotFound, w.Code, roomId)
+		test.AssertApiError(t, w, "M_NOT_FOUND", "Room not found in community")
+	}
+
+	w := doRaidsRequest(t, api, community.CommunityId, http.MethodDelete, `{"room_id":"#alias:example.org"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "room_id must be a room ID, or empty for the whole community")
+
+	w = doRaidsRequest(t, api, community.CommunityId, http.MethodPut, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+
+	w = doRaidsRequest(t, api, "not_a_community", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Community not found")
+}
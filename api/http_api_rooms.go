@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/matrix-org/policyserv/homeserver"
 	"github.com/matrix-org/policyserv/metrics"
@@ -42,14 +43,14 @@ func httpGetRoomsApi(api *Api, w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(b)
 }
 
-func httpGetRoomApi(api *Api, w http.ResponseWriter, r *http.Request) {
-	metrics.RecordHttpRequest(r.Method, "httpGetRoomApi")
-	t := metrics.StartRequestTimer(r.Method, "httpGetRoomApi")
+func httpRoomApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRoomApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRoomApi")
 	defer t.ObserveDuration()
 
-	errs := newErrorResponder("httpGetRoomApi", w, r)
+	errs := newErrorResponder("httpRoomApi", w, r)
 
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
 		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
 		return
 	}
@@ -65,7 +66,12 @@ func httpGetRoomApi(api *Api, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = respondJson("httpGetRoomApi", r, w, room)
+	if r.Method == http.MethodDelete {
+		doHttpRemoveRoom("httpRoomApi", api, w, r, room)
+		return
+	}
+
+	err = respondJson("httpRoomApi", r, w, room)
 	if err != nil {
 		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
 		return
@@ -128,6 +134,13 @@ func doHttpAddRoom(funcName string, api *Api, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// The room may have been removed from the community before, which stops the space sync from joining it
+	err = api.storage.DeleteRemovedRoom(r.Context(), community.CommunityId, roomId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
 	// Respond with the room's config details
 	err = respondJson(funcName, r, w, room)
 	if err != nil {
@@ -135,3 +148,121 @@ func doHttpAddRoom(funcName string, api *Api, w http.ResponseWriter, r *http.Req
 		return
 	}
 }
+
+func doHttpRemoveRoom(funcName string, api *Api, w http.ResponseWriter, r *http.Request, room *storage.StoredRoom) {
+	errs := newErrorResponder(funcName, w, r)
+
+	// This also stops us from signing events in the room
+	err := api.hs.LeaveRoom(r.Context(), room.RoomId, api.joinViaServer)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, make(map[string]any))
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func httpMoveRoomApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpMoveRoomApi")
+	t := metrics.StartRequestTimer(r.Method, "httpMoveRoomApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpMoveRoomApi", w, r)
+
+	if r.Method != http.MethodPost {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	req := struct {
+		CommunityId          string `json:"community_id"`
+		IncludeSpaceChildren bool   `json:"include_space_children"`
+	}{}
+	err := parseJsonBody(&req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+
+	// Ensure the community exists
+	community, err := api.storage.GetCommunity(r.Context(), req.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusBadRequest, "M_BAD_STATE", "Community not found")
+		return
+	}
+
+	id := r.PathValue("id")
+	room, err := api.storage.GetRoom(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if room == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Room not found")
+		return
+	}
+
+	rooms := []*storage.StoredRoom{room}
+	if req.IncludeSpaceChildren {
+		// We only know a space's children if we're protecting the space. Children we aren't protecting are skipped.
+		childRoomIds, err := api.storage.GetSpaceChildren(r.Context(), room.RoomId)
+		if err != nil {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+			return
+		}
+		for _, childRoomId := range childRoomIds {
+			child, err := api.storage.GetRoom(r.Context(), childRoomId)
+			if err != nil {
+				errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+				return
+			}
+			if child != nil && child.RoomId != room.RoomId {
+				rooms = append(rooms, child)
+			}
+		}
+	}
+
+	moved := make([]*storage.StoredRoom, 0, len(rooms))
+	for _, existing := range rooms {
+		// Copy the room rather than changing the stored value in place
+		toMove := *existing
+		toMove.CommunityId = community.CommunityId
+
+		// Note: the `ps_room_community_change` trigger publishes the change to all workers for us.
+		err = api.storage.UpsertRoom(r.Context(), &toMove)
+		if err != nil {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+			return
+		}
+		moved = append(moved, &toMove)
+
+		if existing.CommunityId != community.CommunityId {
+			// Stop the old community's space sync from joining the room back, and let the new community's sync
+			// find the room even if it was removed from the new community in the past.
+			err = api.storage.UpsertRemovedRoom(r.Context(), existing.CommunityId, existing.RoomId, time.Now().UnixMilli())
+			if err != nil {
+				errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+				return
+			}
+			err = api.storage.DeleteRemovedRoom(r.Context(), community.CommunityId, existing.RoomId)
+			if err != nil {
+				errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+				return
+			}
+		}
+	}
+
+	err = respondJson("httpMoveRoomApi", r, w, moved)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
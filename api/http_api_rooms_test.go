@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -19,9 +20,9 @@ func TestGetRoomWrongMethod(t *testing.T) {
 	api := makeApi(t)
 
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest(http.MethodPost /*this should be GET*/, "/api/v1/rooms/!room:example.org", nil)
+	r := httptest.NewRequest(http.MethodPost /*this should be GET or DELETE*/, "/api/v1/rooms/!room:example.org", nil)
 	r.SetPathValue("id", "!room:example.org")
-	httpGetRoomApi(api, w, r)
+	httpRoomApi(api, w, r)
 	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
 	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
 }
@@ -34,7 +35,7 @@ func TestGetRoomNotFound(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodGet, "/api/v1/rooms/not_a_real_id", nil)
 	r.SetPathValue("id", "not_a_real_id")
-	httpGetRoomApi(api, w, r)
+	httpRoomApi(api, w, r)
 	assert.Equal(t, http.StatusNotFound, w.Code)
 	test.AssertApiError(t, w, "M_NOT_FOUND", "Room not found")
 }
@@ -57,7 +58,7 @@ func TestGetRoom(t *testing.T) {
 	}
 	err := api.storage.UpsertRoom(ctx, room)
 	assert.NoError(t, err)
-	httpGetRoomApi(api, w, r)
+	httpRoomApi(api, w, r)
 	assert.Equal(t, http.StatusOK, w.Code)
 	fromRes := &storage.StoredRoom{}
 	err = json.Unmarshal(w.Body.Bytes(), fromRes)
@@ -65,6 +66,65 @@ func TestGetRoom(t *testing.T) {
 	assert.Equal(t, room, fromRes)
 }
 
+func TestRemoveRoom(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	api := makeApi(t)
+
+	roomId := "!room:example.org"
+	err := api.storage.UpsertRoom(ctx, &storage.StoredRoom{
+		RoomId:      roomId,
+		RoomVersion: "11",
+		CommunityId: "default",
+	})
+	assert.NoError(t, err)
+
+	// Give the room some learned state which should be cleared
+	err = api.storage.SetUserIdsAndDisplayNamesByRoomId(ctx, roomId, []string{"@alice:example.org"}, []string{"Alice"})
+	assert.NoError(t, err)
+	err = api.storage.SetListRules(ctx, roomId, []*storage.StoredListRule{{EntityType: "m.policy.rule.user", Entity: "@spam:example.org", Recommendation: "m.ban"}})
+	assert.NoError(t, err)
+	err = api.storage.InsertRoomMemberJoin(ctx, roomId, "@alice:example.org", 1234)
+	assert.NoError(t, err)
+	err = api.storage.SetTrustData(ctx, "test_source", roomId, map[string]any{"hello": "world"})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodDelete, "/api/v1/rooms/"+roomId, nil)
+	r.SetPathValue("id", roomId)
+	httpRoomApi(api, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	test.AssertJsonBody(t, w, map[string]any{})
+
+	room, err := api.storage.GetRoom(ctx, roomId)
+	assert.NoError(t, err)
+	assert.Nil(t, room)
+	userIds, _, err := api.storage.GetUserIdsAndDisplayNamesByRoomId(ctx, roomId)
+	assert.NoError(t, err)
+	assert.Empty(t, userIds)
+	banned, err := api.storage.IsUserBannedInList(ctx, roomId, "@spam:example.org")
+	assert.NoError(t, err)
+	assert.False(t, banned)
+	joinedTs, err := api.storage.GetRoomMemberJoinTimestamp(ctx, roomId, "@alice:example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), joinedTs)
+	trustData := make(map[string]any)
+	err = api.storage.GetTrustData(ctx, "test_source", roomId, &trustData)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	removed, err := api.storage.IsRoomRemoved(ctx, "default", roomId)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	// Removing it again should 404
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/rooms/"+roomId, nil)
+	r.SetPathValue("id", roomId)
+	httpRoomApi(api, w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Room not found")
+}
+
 func TestAddRoomWrongMethod(t *testing.T) {
 	t.Parallel()
 
@@ -171,3 +231,137 @@ func TestAddRoom(t *testing.T) {
 		CommunityId:                    "non_default",
 	}, fromRes)
 }
+
+func TestMoveRoomWrongMethod(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet /*this should be POST*/, "/api/v1/rooms/!room:example.org/move", nil)
+	r.SetPathValue("id", "!room:example.org")
+	httpMoveRoomApi(api, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
+
+func TestMoveRoomUnknownCommunity(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/rooms/!room:example.org/move", test.MakeJsonBody(t, map[string]any{
+		"community_id": "does_not_exist",
+	}))
+	r.SetPathValue("id", "!room:example.org")
+	httpMoveRoomApi(api, w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_STATE", "Community not found")
+}
+
+func TestMoveRoomNotFound(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(ctx, "Target")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/rooms/!room:example.org/move", test.MakeJsonBody(t, map[string]any{
+		"community_id": community.CommunityId,
+	}))
+	r.SetPathValue("id", "!room:example.org")
+	httpMoveRoomApi(api, w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Room not found")
+}
+
+func TestMoveRoom(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	api := makeApi(t)
+	source, err := api.storage.CreateCommunity(ctx, "Source")
+	assert.NoError(t, err)
+	target, err := api.storage.CreateCommunity(ctx, "Target")
+	assert.NoError(t, err)
+
+	space := &storage.StoredRoom{
+		RoomId:          "!space:example.org",
+		RoomVersion:     "11",
+		ModeratorUserId: "@mod:example.org",
+		CommunityId:     source.CommunityId,
+	}
+	child := &storage.StoredRoom{
+		RoomId:      "!child:example.org",
+		RoomVersion: "11",
+		CommunityId: source.CommunityId,
+	}
+	grandchild := &storage.StoredRoom{
+		RoomId:      "!grandchild:example.org",
+		RoomVersion: "11",
+		CommunityId: source.CommunityId,
+	}
+	for _, room := range []*storage.StoredRoom{space, child, grandchild} {
+		assert.NoError(t, api.storage.UpsertRoom(ctx, room))
+	}
+	// The unprotected child should be skipped
+	err = api.storage.SetSpaceChildren(ctx, space.RoomId, []string{child.RoomId, "!unprotected:example.org"})
+	assert.NoError(t, err)
+	// Only direct children are moved, so the grandchild should stay put
+	err = api.storage.SetSpaceChildren(ctx, child.RoomId, []string{grandchild.RoomId})
+	assert.NoError(t, err)
+
+	// Pretend the space was removed from the target community in the past
+	err = api.storage.UpsertRemovedRoom(ctx, target.CommunityId, space.RoomId, 1234)
+	assert.NoError(t, err)
+
+	doMove := func(includeSpaceChildren bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/rooms/"+space.RoomId+"/move", test.MakeJsonBody(t, map[string]any{
+			"community_id":           target.CommunityId,
+			"include_space_children": includeSpaceChildren,
+		}))
+		r.SetPathValue("id", space.RoomId)
+		httpMoveRoomApi(api, w, r)
+		return w
+	}
+	assertCommunityId := func(roomId string, communityId string) {
+		room, err := api.storage.GetRoom(ctx, roomId)
+		assert.NoError(t, err)
+		assert.NotNil(t, room)
+		assert.Equal(t, communityId, room.CommunityId)
+	}
+	assertRemoved := func(communityId string, roomId string, expected bool) {
+		removed, err := api.storage.IsRoomRemoved(ctx, communityId, roomId)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, removed)
+	}
+
+	// Moving just the space leaves the child alone
+	w := doMove(false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	movedSpace := *space
+	movedSpace.CommunityId = target.CommunityId
+	test.AssertJsonBody(t, w, []*storage.StoredRoom{&movedSpace})
+	assertCommunityId(space.RoomId, target.CommunityId)
+	assertCommunityId(child.RoomId, source.CommunityId)
+	assertRemoved(source.CommunityId, space.RoomId, true)
+	assertRemoved(target.CommunityId, space.RoomId, false)
+	assertRemoved(source.CommunityId, child.RoomId, false)
+
+	// Moving with children moves the rest
+	w = doMove(true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	movedChild := *child
+	movedChild.CommunityId = target.CommunityId
+	test.AssertJsonBody(t, w, []*storage.StoredRoom{&movedSpace, &movedChild})
+	assertCommunityId(space.RoomId, target.CommunityId)
+	assertCommunityId(child.RoomId, target.CommunityId)
+	assertCommunityId(grandchild.RoomId, source.CommunityId)
+	assertRemoved(source.CommunityId, space.RoomId, true)
+	assertRemoved(source.CommunityId, child.RoomId, true)
+	assertRemoved(source.CommunityId, grandchild.RoomId, false)
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+type webhooksResponse struct {
+	Webhooks []*storage.StoredWebhookDestination `json:"webhooks"`
+}
+
+type webhookRequest struct {
+	Id         string   `json:"id"`
+	Url        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+func httpWebhooksApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpWebhooksApi")
+	t := metrics.StartRequestTimer(r.Method, "httpWebhooksApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpWebhooksApi", w, r)
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpWebhooks("httpWebhooksApi", api, w, r, community)
+}
+
+func doHttpWebhooks(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	if r.Method == http.MethodGet {
+		doHttpGetWebhooks(funcName, api, w, r, community)
+	} else if r.Method == http.MethodPost {
+		doHttpAddWebhook(funcName, api, w, r, community)
+	} else if r.Method == http.MethodDelete {
+		doHttpRemoveWebhook(funcName, api, w, r, community)
+	} else {
+		errs := newErrorResponder(funcName, w, r)
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+	}
+}
+
+func doHttpGetWebhooks(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	destinations, err := api.storage.GetWebhookDestinations(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, &webhooksResponse{Webhooks: destinations})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpAddWebhook(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &webhookRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if err = validateWebhookRequest(req, api.allowedWebhookDomains); err != nil {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	destination := &storage.StoredWebhookDestination{
+		Id:                     req.Id,
+		CommunityId:            community.CommunityId,
+		Url:                    req.Url,
+		EventTypes:             req.EventTypes,
+		CreatedTimestampMillis: time.Now().UnixMilli(),
+	}
+	if destination.EventTypes == nil {
+		destination.EventTypes = make([]string, 0)
+	}
+	if destination.Id == "" {
+		destination.Id = storage.NextId()
+	} else {
+		// Replacing a destination must not let one community take over another community's destination
+		existing, err := api.storage.GetWebhookDestinations(r.Context(), community.CommunityId)
+		if err != nil {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+			return
+		}
+		idx := slices.IndexFunc(existing, func(d *storage.StoredWebhookDestination) bool {
+			return d.Id == req.Id
+		})
+		if idx < 0 {
+			errs.text(http.StatusNotFound, "M_NOT_FOUND", "Webhook not found")
+			return
+		}
+		destination.CreatedTimestampMillis = existing[idx].CreatedTimestampMillis
+	}
+
+	err = api.storage.UpsertWebhookDestination(r.Context(), destination)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, destination)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func doHttpRemoveWebhook(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	req := &webhookRequest{}
+	err := parseJsonBody(req, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	if req.Id == "" {
+		errs.text(http.StatusBadRequest, "M_BAD_JSON", "id is required")
+		return
+	}
+
+	err = api.storage.DeleteWebhookDestination(r.Context(), community.CommunityId, req.Id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, struct{}{})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+// validateWebhookRequest - Ensures the URL is one policyserv is allowed to send webhooks to, and that the event types
+// are known payload types.
+func validateWebhookRequest(req *webhookRequest, allowedDomains []string) error {
+	if req.Url == "" {
+		return errors.New("url is required")
+	}
+	if _, err := notifiers.ValidateWebhookUrl(req.Url, allowedDomains); err != nil {
+		return fmt.Errorf("url is not allowed: %w", err)
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(notifiers.WebhookPayloadTypes, notifiers.WebhookPayloadType(eventType)) {
+			return fmt.Errorf("unknown event type: %s", eventType)
+		}
+	}
+	return nil
+}
+
+func httpRotateCommunityWebhookSecretApi(api *Api, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRotateCommunityWebhookSecretApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRotateCommunityWebhookSecretApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpRotateCommunityWebhookSecretApi", w, r)
+
+	if r.Method != http.MethodPost {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	id := r.PathValue("id")
+	community, err := api.storage.GetCommunity(r.Context(), id)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if community == nil {
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Community not found")
+		return
+	}
+
+	doHttpRotateCommunityWebhookSecret("httpRotateCommunityWebhookSecretApi", api, w, r, community)
+}
+
+func doHttpRotateCommunityWebhookSecret(funcName string, api *Api, w http.ResponseWriter, r *http.Request, community *storage.StoredCommunity) {
+	errs := newErrorResponder(funcName, w, r)
+
+	oldSecret := internal.Dereference(community.WebhookSecret)
+
+	newSecret := fmt.Sprintf("psw_%s", rand.Text())
+	community.WebhookSecret = internal.Pointer(newSecret)
+	err := api.storage.UpsertCommunity(r.Context(), community)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson(funcName, r, w, map[string]string{
+		"old_webhook_secret": oldSecret,
+		"new_webhook_secret": newSecret,
+	})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
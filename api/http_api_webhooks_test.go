@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func doWebhooksRequest(t *testing.T, api *Api, communityId string, method string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/api/v1/communities/"+communityId+"/webhooks", strings.NewReader(body))
+	r.SetPathValue("id", communityId)
+	httpWebhooksApi(api, w, r)
+	return w
+}
+
+func decodeWebhooks(t *testing.T, w *httptest.ResponseRecorder) []*storage.StoredWebhookDestination {
+	resp := &webhooksResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), resp)
+	assert.NoError(t, err)
+	return resp.Webhooks
+}
+
+func TestWebhooksApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	api.allowedWebhookDomains = []string{"example.org"}
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+
+	// Nothing to start with
+	w := doWebhooksRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeWebhooks(t, w))
+
+	// Add a destination for everything, and one for spam only
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodPost, `{"url":"https://example.org/all"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	all := &storage.StoredWebhookDestination{}
+	err = json.Unmarshal(w.Body.Bytes(), all)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, all.Id)
+	assert.Equal(t, community.CommunityId, all.CommunityId)
+	assert.Equal(t, "https://example.org/all", all.Url)
+	assert.Empty(t, all.EventTypes)
+	assert.NotZero(t, all.CreatedTimestampMillis)
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodPost, `{"url":"https://example.org/spam","event_types":["event.spam"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	destinations := decodeWebhooks(t, w)
+	assert.Len(t, destinations, 2)
+	assert.Equal(t, all, destinations[0])
+	assert.Equal(t, []string{"event.spam"}, destinations[1].EventTypes)
+
+	// Destinations can be replaced by ID
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodPost, `{"id":"`+all.Id+`","url":"https://example.org/notices","event_types":["notice"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	destinations, err = api.storage.GetWebhookDestinations(ctx, community.CommunityId)
+	assert.NoError(t, err)
+	assert.Len(t, destinations, 2)
+	assert.Equal(t, all.Id, destinations[0].Id)
+	assert.Equal(t, "https://example.org/notices", destinations[0].Url)
+	assert.Equal(t, []string{"notice"}, destinations[0].EventTypes)
+	assert.Equal(t, all.CreatedTimestampMillis, destinations[0].CreatedTimestampMillis)
+
+	// ...but only if they belong to the community
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodPost, `{"id":"not_a_real_id","url":"https://example.org/all"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Webhook not found")
+
+	// Remove one
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodDelete, `{"id":"`+all.Id+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	destinations, err = api.storage.GetWebhookDestinations(ctx, community.CommunityId)
+	assert.NoError(t, err)
+	assert.Len(t, destinations, 1)
+	assert.Equal(t, "https://example.org/spam", destinations[0].Url)
+}
+
+func TestWebhooksApiValidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	api.allowedWebhookDomains = []string{"example.org"}
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		`{}`: "url is required",
+		`{"url":"https://evil.example.com/webhook"}`:                   "url is not allowed: webhook domain not allowed",
+		`{"url":"https://example.org/webhook","event_types":["nope"]}`: "unknown event type: nope",
+	}
+	for body, expectedError := range cases {
+		w := doWebhooksRequest(t, api, community.CommunityId, http.MethodPost, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		test.AssertApiError(t, w, "M_BAD_JSON", expectedError)
+	}
+
+	w := doWebhooksRequest(t, api, community.CommunityId, http.MethodDelete, `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "id is required")
+
+	w = doWebhooksRequest(t, api, community.CommunityId, http.MethodPut, `{}`)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+
+	w = doWebhooksRequest(t, api, "not_a_real_id", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Community not found")
+}
+
+func TestRotateCommunityWebhookSecret(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	community, err := api.storage.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	assert.Nil(t, community.WebhookSecret) // should be created without a secret
+
+	rotate := func() map[string]string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/communities/"+community.CommunityId+"/rotate_webhook_secret", nil)
+		r.SetPathValue("id", community.CommunityId)
+		httpRotateCommunityWebhookSecretApi(api, w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		res := make(map[string]string)
+		err := json.Unmarshal(w.Body.Bytes(), &res)
+		assert.NoError(t, err)
+		return res
+	}
+
+	first := rotate()
+	assert.Empty(t, first["old_webhook_secret"])
+	assert.NotEmpty(t, first["new_webhook_secret"])
+	fromDb, err := api.storage.GetCommunity(ctx, community.CommunityId)
+	assert.NoError(t, err)
+	assert.Equal(t, first["new_webhook_secret"], internal.Dereference(fromDb.WebhookSecret))
+
+	second := rotate()
+	assert.Equal(t, first["new_webhook_secret"], second["old_webhook_secret"])
+	assert.NotEqual(t, first["new_webhook_secret"], second["new_webhook_secret"])
+
+	// The secret is never exported with the community
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/communities/"+community.CommunityId, nil)
+	r.SetPathValue("id", community.CommunityId)
+	httpCommunities(api, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), second["new_webhook_secret"])
+}
+
+func TestRotateCommunityWebhookSecretWrongMethod(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/communities/not_a_real_id/rotate_webhook_secret", nil)
+	r.SetPathValue("id", "not_a_real_id")
+	httpRotateCommunityWebhookSecretApi(api, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpGetCommunityCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpGetCommunityCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpGetCommunityCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpGetCommunityCommunityApi", w, r)
+
+	if r.Method != http.MethodGet {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	err := respondJson("httpGetCommunityCommunityApi", r, w, redactCommunity(community))
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func httpPatchCommunityConfigCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpPatchCommunityConfigCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpPatchCommunityConfigCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpPatchCommunityConfigCommunityApi", w, r)
+
+	if r.Method != http.MethodPatch {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	// Apply the request body over top of a copy of the existing config. Fields which are set to null go back to the
+	// instance defaults. We copy the config so a rejected patch doesn't leave the community half-changed.
+	communityConfig := &config.CommunityConfig{}
+	b, err := json.Marshal(community.Config)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if err = json.Unmarshal(b, communityConfig); err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	err = parseJsonBody(communityConfig, r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+
+	doHttpSetCommunityConfig("httpPatchCommunityConfigCommunityApi", api, w, r, community, communityConfig)
+}
+
+func httpRotateCommunityAccessTokenCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRotateCommunityAccessTokenCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRotateCommunityAccessTokenCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpRotateCommunityAccessTokenCommunityApi", w, r)
+
+	if r.Method != http.MethodPost {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	doHttpRotateCommunityAccessToken("httpRotateCommunityAccessTokenCommunityApi", api, w, r, community)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCommunityCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/_policyserv/v1/community", nil)
+	httpGetCommunityCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	fromRes := &storage.StoredCommunity{}
+	err := json.Unmarshal(w.Body.Bytes(), fromRes)
+	assert.NoError(t, err)
+	assert.Equal(t, serverCommunity.CommunityId, fromRes.CommunityId)
+	assert.Equal(t, serverCommunity.Name, fromRes.Name)
+	assert.NotContains(t, w.Body.String(), internal.Dereference(serverCommunity.ApiAccessToken))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost /* should be GET */, "/_policyserv/v1/community", nil)
+	httpGetCommunityCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
+
+func TestPatchCommunityConfigCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+	serverCommunity.Config = &config.CommunityConfig{
+		KeywordFilterKeywords: &[]string{"keyword1"},
+		LengthFilterMaxLength: internal.Pointer(100),
+	}
+	err := api.storage.UpsertCommunity(ctx, serverCommunity)
+	assert.NoError(t, err)
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		community, err := api.storage.GetCommunity(ctx, serverCommunity.CommunityId)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, "/_policyserv/v1/community/config", bytes.NewBufferString(body))
+		httpPatchCommunityConfigCommunityApi(api, community, w, r)
+		return w
+	}
+
+	// Fields which aren't specified are kept, and null fields are reset
+	w := patch(`{"keyword_filter_keywords": ["keyword2"], "length_filter_max_length": null, "mention_filter_max_mentions": 5}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	fromDb, err := api.storage.GetCommunity(ctx, serverCommunity.CommunityId)
+	assert.NoError(t, err)
+	assert.Equal(t, &config.CommunityConfig{
+		KeywordFilterKeywords:    &[]string{"keyword2"},
+		MentionFilterMaxMentions: internal.Pointer(5),
+	}, fromDb.Config)
+	assert.Equal(t, serverCommunity.ApiAccessToken, fromDb.ApiAccessToken) // the token shouldn't be touched
+	fromRes := &storage.StoredCommunity{}
+	err = json.Unmarshal(w.Body.Bytes(), fromRes)
+	assert.NoError(t, err)
+	assert.Equal(t, fromDb.Config, fromRes.Config)
+
+	// Invalid configs are rejected
+	w = patch(`{"filter_pipeline": [{"filters": ["NotARealFilter"]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	test.AssertApiError(t, w, "M_BAD_JSON", "filter pipeline group 0: unknown filter name: NotARealFilter")
+	fromDb, err = api.storage.GetCommunity(ctx, serverCommunity.CommunityId)
+	assert.NoError(t, err)
+	assert.Nil(t, fromDb.Config.FilterPipeline)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost /* should be PATCH */, "/_policyserv/v1/community/config", nil)
+	httpPatchCommunityConfigCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
+
+func TestRotateCommunityAccessTokenCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+	oldAccessToken := internal.Dereference(serverCommunity.ApiAccessToken)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/community/rotate_access_token", nil)
+	httpRotateCommunityAccessTokenCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	fromRes := make(map[string]string)
+	err := json.Unmarshal(w.Body.Bytes(), &fromRes)
+	assert.NoError(t, err)
+	assert.Equal(t, oldAccessToken, fromRes["old_access_token"])
+	assert.NotEmpty(t, fromRes["new_access_token"])
+	assert.NotEqual(t, oldAccessToken, fromRes["new_access_token"])
+
+	// The old token should no longer work
+	community, err := api.storage.GetCommunityByAccessToken(ctx, oldAccessToken)
+	assert.NoError(t, err)
+	assert.Nil(t, community)
+	community, err = api.storage.GetCommunityByAccessToken(ctx, fromRes["new_access_token"])
+	assert.NoError(t, err)
+	assert.NotNil(t, community)
+	assert.Equal(t, serverCommunity.CommunityId, community.CommunityId)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet /* should be POST */, "/_policyserv/v1/community/rotate_access_token", nil)
+	httpRotateCommunityAccessTokenCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
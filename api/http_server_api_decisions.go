@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpGetDecisionsCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpGetDecisionsCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpGetDecisionsCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpGetDecisionsCommunityApi", w, r)
+
+	if r.Method != http.MethodGet {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	doHttpGetDecisions("httpGetDecisionsCommunityApi", api, w, r, community)
+}
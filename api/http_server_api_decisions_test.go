@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDecisionsCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+	insertTestDecisions(t, api, serverCommunity.CommunityId)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/_policyserv/v1/decisions?room_id=!room1:example.org", nil)
+	httpGetDecisionsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	eventIds, nextBatch := decodeDecisionEventIds(t, w)
+	assert.Equal(t, []string{"$spam", "$neutral"}, eventIds) // notably, doesn't include other communities
+	assert.Empty(t, nextBatch)
+}
+
+func TestGetDecisionsCommunityApiWrongMethod(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost /* should be GET */, "/_policyserv/v1/decisions", nil)
+	httpGetDecisionsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
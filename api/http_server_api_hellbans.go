@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpHellbansCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpHellbansCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpHellbansCommunityApi")
+	defer t.ObserveDuration()
+
+	doHttpHellbans("httpHellbansCommunityApi", api, w, r, community)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHellbansCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/hellbans", strings.NewReader(`{"user_id":"@alice:example.org","minutes":10}`))
+	httpHellbansCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/hellbans", nil)
+	httpHellbansCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	hellbans := decodeHellbans(t, w)
+	assert.Len(t, hellbans, 1)
+	assert.Equal(t, serverCommunity.CommunityId, hellbans[0].CommunityId)
+	assert.Equal(t, "@alice:example.org", hellbans[0].UserId)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/_policyserv/v1/hellbans", strings.NewReader(`{"user_id":"@alice:example.org"}`))
+	httpHellbansCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/hellbans", nil)
+	httpHellbansCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeHellbans(t, w))
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/pslib"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpKeywordTemplatesCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		getKeywordTemplateCommunityHandler(api, community, w, r)
+	} else if r.Method == http.MethodPost {
+		setKeywordTemplateCommunityHandler(api, community, w, r)
+	} else if r.Method == http.MethodDelete {
+		deleteKeywordTemplateCommunityHandler(api, community, w, r)
+	} else {
+		errs := newErrorResponder("httpKeywordTemplatesCommunityApi", w, r)
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+	}
+}
+
+func setKeywordTemplateCommunityHandler(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "setKeywordTemplateCommunityHandler")
+	t := metrics.StartRequestTimer(r.Method, "setKeywordTemplateCommunityHandler")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("setKeywordTemplateCommunityHandler", w, r)
+
+	name := r.PathValue("name")
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		errs.err(http.StatusBadRequest, "M_UNKNOWN", err)
+		return
+	}
+	body := string(b)
+
+	// Unlike instance-wide templates, we don't trust communities to upload working templates. A broken template would
+	// prevent the community's filters from being created.
+	if _, err = pslib.NewKeywordTemplate(name, body); err != nil {
+		errs.text(http.StatusBadRequest, "M_INVALID_PARAM", err.Error())
+		return
+	}
+
+	val := &storage.StoredKeywordTemplate{
+		Name: name,
+		Body: body,
+	}
+	err = api.storage.UpsertCommunityKeywordTemplate(r.Context(), community.CommunityId, val)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson("setKeywordTemplateCommunityHandler", r, w, val)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func getKeywordTemplateCommunityHandler(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "getKeywordTemplateCommunityHandler")
+	t := metrics.StartRequestTimer(r.Method, "getKeywordTemplateCommunityHandler")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("getKeywordTemplateCommunityHandler", w, r)
+
+	name := r.PathValue("name")
+	val, err := api.storage.GetCommunityKeywordTemplate(r.Context(), community.CommunityId, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errs.text(http.StatusNotFound, "M_NOT_FOUND", "Template not found")
+		} else {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		}
+		return
+	}
+
+	err = respondJson("getKeywordTemplateCommunityHandler", r, w, val)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func deleteKeywordTemplateCommunityHandler(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "deleteKeywordTemplateCommunityHandler")
+	t := metrics.StartRequestTimer(r.Method, "deleteKeywordTemplateCommunityHandler")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("deleteKeywordTemplateCommunityHandler", w, r)
+
+	name := r.PathValue("name")
+	_, err := api.storage.GetCommunityKeywordTemplate(r.Context(), community.CommunityId, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errs.text(http.StatusNotFound, "M_NOT_FOUND", "Template not found")
+		} else {
+			errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		}
+		return
+	}
+
+	// If the community's config still names the template, the filter falls back to the instance-wide template (if any)
+	err = api.storage.DeleteCommunityKeywordTemplate(r.Context(), community.CommunityId, name)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson("deleteKeywordTemplateCommunityHandler", r, w, struct{}{})
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordTemplateCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	template := &storage.StoredKeywordTemplate{
+		Name: "TESTING",
+		Body: "{{ if StringContains .BodyRaw \"spam\" }}org.example.spam{{ end }}",
+	}
+
+	// Instance-wide templates aren't visible through the community API
+	err := api.storage.UpsertKeywordTemplate(ctx, &storage.StoredKeywordTemplate{
+		Name: template.Name,
+		Body: "INSTANCE VALUE",
+	})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/_policyserv/v1/keyword_templates/"+template.Name, nil)
+	r.SetPathValue("name", template.Name)
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Template not found")
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/_policyserv/v1/keyword_templates/"+template.Name, bytes.NewBufferString(template.Body))
+	r.SetPathValue("name", template.Name)
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	test.AssertJsonBody(t, w, template)
+
+	// Verify it was persisted, without affecting the instance-wide template
+	val, err := api.storage.GetCommunityKeywordTemplate(ctx, serverCommunity.CommunityId, template.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, template, val)
+	val, err = api.storage.GetKeywordTemplate(ctx, template.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, "INSTANCE VALUE", val.Body)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/keyword_templates/"+template.Name, nil)
+	r.SetPathValue("name", template.Name)
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	test.AssertJsonBody(t, w, template)
+
+	// Deleting only removes the community's template
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/_policyserv/v1/keyword_templates/"+template.Name, nil)
+	r.SetPathValue("name", template.Name)
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	test.AssertJsonBody(t, w, struct{}{})
+	_, err = api.storage.GetCommunityKeywordTemplate(ctx, serverCommunity.CommunityId, template.Name)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	val, err = api.storage.GetKeywordTemplate(ctx, template.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, "INSTANCE VALUE", val.Body)
+
+	// Deleting it again is a 404
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/_policyserv/v1/keyword_templates/"+template.Name, nil)
+	r.SetPathValue("name", template.Name)
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	test.AssertApiError(t, w, "M_NOT_FOUND", "Template not found")
+}
+
+func TestKeywordTemplateCommunityApiInvalidTemplate(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/keyword_templates/TESTING", bytes.NewBufferString("{{ if }}"))
+	r.SetPathValue("name", "TESTING")
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "M_INVALID_PARAM")
+
+	_, err := api.storage.GetCommunityKeywordTemplate(context.Background(), serverCommunity.CommunityId, "TESTING")
+	assert.Error(t, err) // not persisted
+}
+
+func TestKeywordTemplateCommunityApiWrongMethod(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut /* should be GET, POST, or DELETE */, "/_policyserv/v1/keyword_templates/TESTING", nil)
+	r.SetPathValue("name", "TESTING")
+	httpKeywordTemplatesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
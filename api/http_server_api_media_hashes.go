@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpMediaHashesCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpMediaHashesCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpMediaHashesCommunityApi")
+	defer t.ObserveDuration()
+
+	doHttpMediaHashes("httpMediaHashesCommunityApi", api, w, r, community)
+}
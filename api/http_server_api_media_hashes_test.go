@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaHashesCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/media_hashes", strings.NewReader(`{"bank":"shock","kind":"dhash","value":"0123456789abcdef"}`))
+	httpMediaHashesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/media_hashes", nil)
+	httpMediaHashesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	hashes := decodeMediaHashes(t, w)
+	assert.Len(t, hashes, 1)
+	assert.Equal(t, serverCommunity.CommunityId, hashes[0].CommunityId)
+	assert.Equal(t, storage.MediaHashKindDHash, hashes[0].Kind)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/_policyserv/v1/media_hashes", strings.NewReader(`{"bank":"shock","kind":"dhash","value":"0123456789abcdef"}`))
+	httpMediaHashesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/media_hashes", nil)
+	httpMediaHashesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeMediaHashes(t, w))
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpOverridesCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpOverridesCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpOverridesCommunityApi")
+	defer t.ObserveDuration()
+
+	doHttpOverrides("httpOverridesCommunityApi", api, w, r, community)
+}
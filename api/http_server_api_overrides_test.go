@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverridesCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/overrides", strings.NewReader(`{"kind":"user_id","value":"@alice:example.org"}`))
+	httpOverridesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/overrides", nil)
+	httpOverridesCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	overrides := decodeOverrides(t, w)
+	assert.Len(t, overrides, 1)
+	assert.Equal(t, serverCommunity.CommunityId, overrides[0].CommunityId)
+	assert.Equal(t, storage.OverrideKindUserId, overrides[0].Kind)
+	assert.Equal(t, "@alice:example.org", overrides[0].Value)
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpRaidsCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRaidsCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRaidsCommunityApi")
+	defer t.ObserveDuration()
+
+	doHttpRaids("httpRaidsCommunityApi", api, w, r, community)
+}
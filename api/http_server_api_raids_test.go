@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaidsCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/raids", strings.NewReader(`{"room_id":"","minutes":10}`))
+	httpRaidsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/raids", nil)
+	httpRaidsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	raids := decodeRaids(t, w)
+	assert.Len(t, raids, 1)
+	assert.Equal(t, serverCommunity.CommunityId, raids[0].CommunityId)
+	assert.Equal(t, "", raids[0].RoomId)
+	assert.True(t, raids[0].IsManual)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/_policyserv/v1/raids", strings.NewReader(`{"room_id":""}`))
+	httpRaidsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/raids", nil)
+	httpRaidsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeRaids(t, w))
+}
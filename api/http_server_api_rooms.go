@@ -27,3 +27,64 @@ func httpJoinRoomCommunityApi(api *Api, community *storage.StoredCommunity, w ht
 	roomId := r.PathValue("roomId")
 	doHttpAddRoom("httpJoinRoomCommunityApi", api, w, r, roomId, community)
 }
+
+func httpGetRoomsCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpGetRoomsCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpGetRoomsCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpGetRoomsCommunityApi", w, r)
+
+	if r.Method != http.MethodGet {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	rooms, err := api.storage.GetRoomsByCommunityId(r.Context(), community.CommunityId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	err = respondJson("httpGetRoomsCommunityApi", r, w, rooms)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
+
+func httpRoomCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRoomCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRoomCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpRoomCommunityApi", w, r)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	roomId := r.PathValue("roomId")
+	room, err := api.storage.GetRoom(r.Context(), roomId)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	if room == nil || room.CommunityId != community.CommunityId {
+		// We don't reveal whether the room is protected by another community
+		errs.text(http.StatusNotFound, "M_NOT_FOUND", "Room not found")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		doHttpRemoveRoom("httpRoomCommunityApi", api, w, r, room)
+		return
+	}
+
+	err = respondJson("httpRoomCommunityApi", r, w, room)
+	if err != nil {
+		errs.err(http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+}
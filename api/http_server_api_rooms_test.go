@@ -108,3 +108,73 @@ func TestJoinRoomCommunityApi(t *testing.T) {
 		CommunityId:                    serverCommunity.CommunityId,
 	}, fromRes)
 }
+
+func TestRoomsCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+	otherCommunity, err := api.storage.CreateCommunity(ctx, "Other Community")
+	assert.NoError(t, err)
+
+	ourRoom := &storage.StoredRoom{
+		RoomId:                         "!ours:example.org",
+		RoomVersion:                    "11",
+		ModeratorUserId:                "@moderator:example.org",
+		LastCachedStateTimestampMillis: 1234,
+		CommunityId:                    serverCommunity.CommunityId,
+	}
+	theirRoom := &storage.StoredRoom{
+		RoomId:                         "!theirs:example.org",
+		RoomVersion:                    "11",
+		ModeratorUserId:                "@moderator:example.org",
+		LastCachedStateTimestampMillis: 1234,
+		CommunityId:                    otherCommunity.CommunityId,
+	}
+	for _, room := range []*storage.StoredRoom{ourRoom, theirRoom} {
+		assert.NoError(t, api.storage.UpsertRoom(ctx, room))
+	}
+
+	// Listing only shows the community's rooms
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/_policyserv/v1/rooms", nil)
+	httpGetRoomsCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rooms := make([]*storage.StoredRoom, 0)
+	err = json.Unmarshal(w.Body.Bytes(), &rooms)
+	assert.NoError(t, err)
+	assert.Equal(t, []*storage.StoredRoom{ourRoom}, rooms)
+
+	doRoomRequest := func(method string, roomId string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/_policyserv/v1/rooms/"+roomId, nil)
+		r.SetPathValue("roomId", roomId)
+		httpRoomCommunityApi(api, serverCommunity, w, r)
+		return w
+	}
+
+	w = doRoomRequest(http.MethodGet, ourRoom.RoomId)
+	assert.Equal(t, http.StatusOK, w.Code)
+	test.AssertJsonBody(t, w, ourRoom)
+
+	// Rooms belonging to other communities can't be seen or removed
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		w = doRoomRequest(method, theirRoom.RoomId)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		test.AssertApiError(t, w, "M_NOT_FOUND", "Room not found")
+	}
+	room, err := api.storage.GetRoom(ctx, theirRoom.RoomId)
+	assert.NoError(t, err)
+	assert.NotNil(t, room)
+
+	w = doRoomRequest(http.MethodDelete, ourRoom.RoomId)
+	assert.Equal(t, http.StatusOK, w.Code)
+	room, err = api.storage.GetRoom(ctx, ourRoom.RoomId)
+	assert.NoError(t, err)
+	assert.Nil(t, room)
+
+	w = doRoomRequest(http.MethodPut, ourRoom.RoomId)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	test.AssertApiError(t, w, "M_UNRECOGNIZED", "Method not allowed")
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func httpWebhooksCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpWebhooksCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpWebhooksCommunityApi")
+	defer t.ObserveDuration()
+
+	doHttpWebhooks("httpWebhooksCommunityApi", api, w, r, community)
+}
+
+func httpRotateCommunityWebhookSecretCommunityApi(api *Api, community *storage.StoredCommunity, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpRotateCommunityWebhookSecretCommunityApi")
+	t := metrics.StartRequestTimer(r.Method, "httpRotateCommunityWebhookSecretCommunityApi")
+	defer t.ObserveDuration()
+
+	errs := newErrorResponder("httpRotateCommunityWebhookSecretCommunityApi", w, r)
+
+	if r.Method != http.MethodPost {
+		errs.text(http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "Method not allowed")
+		return
+	}
+
+	doHttpRotateCommunityWebhookSecret("httpRotateCommunityWebhookSecretCommunityApi", api, w, r, community)
+}
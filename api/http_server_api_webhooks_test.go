@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooksCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	api.allowedWebhookDomains = []string{"example.org"}
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/webhooks", strings.NewReader(`{"url":"https://example.org/webhook"}`))
+	httpWebhooksCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/webhooks", nil)
+	httpWebhooksCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	destinations := decodeWebhooks(t, w)
+	assert.Len(t, destinations, 1)
+	assert.Equal(t, serverCommunity.CommunityId, destinations[0].CommunityId)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodDelete, "/_policyserv/v1/webhooks", strings.NewReader(`{"id":"`+destinations[0].Id+`"}`))
+	httpWebhooksCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_policyserv/v1/webhooks", nil)
+	httpWebhooksCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeWebhooks(t, w))
+}
+
+func TestRotateCommunityWebhookSecretCommunityApi(t *testing.T) {
+	t.Parallel()
+
+	api := makeApi(t)
+	serverCommunity := createCommunityWithAccessToken(t, api)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/_policyserv/v1/community/rotate_webhook_secret", nil)
+	httpRotateCommunityWebhookSecretCommunityApi(api, serverCommunity, w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	res := make(map[string]string)
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	assert.NoError(t, err)
+	assert.Empty(t, res["old_webhook_secret"])
+	assert.NotEmpty(t, res["new_webhook_secret"])
+
+	fromDb, err := api.storage.GetCommunity(context.Background(), serverCommunity.CommunityId)
+	assert.NoError(t, err)
+	assert.Equal(t, res["new_webhook_secret"], internal.Dereference(fromDb.WebhookSecret))
+	assert.Equal(t, "pst_TESTING_COMMUNITY", internal.Dereference(fromDb.ApiAccessToken)) // access token is unchanged
+}
@@ -52,7 +52,11 @@ func main() {
 	defer db.Close()
 	defer pubsubClient.Close()
 
-	notifier, err := notifiers.NewWebhookMatrixNotifier(db, instanceConfig.WebhookPoolSize, instanceConfig.AllowedWebhookDomains)
+	webhookNotifier, err := notifiers.NewWebhookMatrixNotifier(db, pubsubClient, instanceConfig.WebhookPoolSize, instanceConfig.AllowedWebhookDomains, time.Duration(instanceConfig.WebhookRetryIntervalSeconds)*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	notifier, err := notifiers.NewRoomMatrixNotifier(webhookNotifier, db, instanceConfig.WebhookPoolSize)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -71,6 +75,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err) // "should never happen"
 	}
+	notifier.SetSender(hs) // audit rooms are sent to by the homeserver
 	log.Println("Homeserver name: ", hs.ServerName)
 	log.Println("Homeserver KeyID:", hs.KeyId)
 	b64 := base64.StdEncoding.WithPadding(base64.NoPadding).EncodeToString(hs.GetPublicEventSigningKey())
@@ -124,7 +129,7 @@ func main() {
 		log.Fatal(err)
 	}
 	scheduler.Start() // start immediately so we can force jobs to run immediately too
-	err = setupScheduler(scheduler, hs, db, instanceConfig)
+	err = setupScheduler(scheduler, hs, db, notifier, webhookNotifier, instanceConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
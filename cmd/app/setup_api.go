@@ -10,9 +10,10 @@ import (
 
 func setupApi(instanceConfig *config.InstanceConfig, storage storage.PersistentStorage, hs *homeserver.Homeserver, communityManager *community.Manager) (*api.Api, error) {
 	apiConfig := &api.Config{
-		ApiKey:            instanceConfig.ApiKey,
-		JoinViaServer:     instanceConfig.JoinServer,
-		EventFetchServers: instanceConfig.EventFetchServers,
+		ApiKey:                instanceConfig.ApiKey,
+		JoinViaServer:         instanceConfig.JoinServer,
+		EventFetchServers:     instanceConfig.EventFetchServers,
+		AllowedWebhookDomains: instanceConfig.AllowedWebhookDomains,
 	}
 	return api.NewApi(apiConfig, storage, hs, communityManager)
 }
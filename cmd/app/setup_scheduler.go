@@ -10,11 +10,12 @@ import (
 	"github.com/go-co-op/gocron/v2"
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/homeserver"
+	"github.com/matrix-org/policyserv/notifiers"
 	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/tasks"
 )
 
-func setupScheduler(scheduler gocron.Scheduler, homeserver *homeserver.Homeserver, db storage.PersistentStorage, instanceConfig *config.InstanceConfig) error {
+func setupScheduler(scheduler gocron.Scheduler, homeserver *homeserver.Homeserver, db storage.PersistentStorage, notifier notifiers.MatrixNotifier, webhookNotifier *notifiers.WebhookMatrixNotifier, instanceConfig *config.InstanceConfig) error {
 	if err := scheduleMuninnTask(scheduler, db, instanceConfig); err != nil {
 		return err
 	}
@@ -24,6 +25,24 @@ func setupScheduler(scheduler gocron.Scheduler, homeserver *homeserver.Homeserve
 	if err := scheduleFederationCatchupTask(scheduler, homeserver, db, instanceConfig); err != nil {
 		return err
 	}
+	if err := scheduleSpaceSyncTask(scheduler, homeserver, db, notifier, instanceConfig); err != nil {
+		return err
+	}
+	if err := scheduleHellbanCleanupTask(scheduler, db); err != nil {
+		return err
+	}
+	if err := scheduleModeratorBlocklistCleanupTask(scheduler, db); err != nil {
+		return err
+	}
+	if err := scheduleRaidCleanupTask(scheduler, db); err != nil {
+		return err
+	}
+	if err := scheduleDecisionCleanupTask(scheduler, db, instanceConfig); err != nil {
+		return err
+	}
+	if err := scheduleWebhookRetryTask(scheduler, webhookNotifier, instanceConfig); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -102,6 +121,106 @@ func scheduleFederationCatchupTask(scheduler gocron.Scheduler, homeserver *homes
 	return nil
 }
 
+func scheduleSpaceSyncTask(scheduler gocron.Scheduler, homeserver *homeserver.Homeserver, db storage.PersistentStorage, notifier notifiers.MatrixNotifier, instanceConfig *config.InstanceConfig) error {
+	if instanceConfig.SpaceSyncIntervalMinutes <= 0 {
+		log.Println("Space sync is disabled. Set PS_SPACE_SYNC_INTERVAL_MINUTES to a positive number to enable it.")
+		return nil
+	}
+
+	// Like the state learning task, we add some jitter to avoid all processes trying to join rooms at the same time.
+	variance := time.Duration(float64(instanceConfig.SpaceSyncIntervalMinutes*60)*0.1) * time.Second
+	minMinutes := (time.Duration(instanceConfig.SpaceSyncIntervalMinutes) * time.Minute) - variance
+	maxMinutes := (time.Duration(instanceConfig.SpaceSyncIntervalMinutes) * time.Minute) + variance
+
+	syncTask, err := scheduler.NewJob(gocron.DurationRandomJob(minMinutes, maxMinutes), gocron.NewTask(tasks.SyncCommunitySpaces, homeserver, db, notifier, instanceConfig.JoinServer), gocron.WithName("SyncCommunitySpaces"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled space sync task every ~%d minutes: %s", instanceConfig.SpaceSyncIntervalMinutes, syncTask.ID())
+	runTaskNowish(syncTask)
+
+	return nil
+}
+
+func scheduleHellbanCleanupTask(scheduler gocron.Scheduler, db storage.PersistentStorage) error {
+	// Like the Muninn task, we run every hour +/- 10 minutes to avoid overlapping calls from other processes.
+	cleanupTask, err := scheduler.NewJob(gocron.DurationRandomJob(50*time.Minute, 70*time.Minute), gocron.NewTask(tasks.CleanupExpiredHellbans, db), gocron.WithName("CleanupExpiredHellbans"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled hellban cleanup task every hour: %s", cleanupTask.ID())
+	runTaskNowish(cleanupTask)
+
+	return nil
+}
+
+func scheduleModeratorBlocklistCleanupTask(scheduler gocron.Scheduler, db storage.PersistentStorage) error {
+	// Like the Muninn task, we run every hour +/- 10 minutes to avoid overlapping calls from other processes.
+	cleanupTask, err := scheduler.NewJob(gocron.DurationRandomJob(50*time.Minute, 70*time.Minute), gocron.NewTask(tasks.CleanupModeratorBlocklist, db), gocron.WithName("CleanupModeratorBlocklist"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled moderator blocklist cleanup task every hour: %s", cleanupTask.ID())
+	runTaskNowish(cleanupTask)
+
+	return nil
+}
+
+func scheduleRaidCleanupTask(scheduler gocron.Scheduler, db storage.PersistentStorage) error {
+	// Like the Muninn task, we run every hour +/- 10 minutes to avoid overlapping calls from other processes.
+	cleanupTask, err := scheduler.NewJob(gocron.DurationRandomJob(50*time.Minute, 70*time.Minute), gocron.NewTask(tasks.CleanupExpiredRaids, db), gocron.WithName("CleanupExpiredRaids"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled raid cleanup task every hour: %s", cleanupTask.ID())
+	runTaskNowish(cleanupTask)
+
+	return nil
+}
+
+func scheduleDecisionCleanupTask(scheduler gocron.Scheduler, db storage.PersistentStorage, instanceConfig *config.InstanceConfig) error {
+	if instanceConfig.DecisionRetentionDays <= 0 {
+		log.Println("Decisions are kept forever. Set PS_DECISION_RETENTION_DAYS to a positive number to clean them up.")
+		return nil
+	}
+
+	// Like the Muninn task, we run every hour +/- 10 minutes to avoid overlapping calls from other processes.
+	retention := time.Duration(instanceConfig.DecisionRetentionDays) * 24 * time.Hour
+	cleanupTask, err := scheduler.NewJob(gocron.DurationRandomJob(50*time.Minute, 70*time.Minute), gocron.NewTask(tasks.CleanupOldDecisions, db, retention), gocron.WithName("CleanupOldDecisions"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled decision cleanup task every hour, keeping %d days: %s", instanceConfig.DecisionRetentionDays, cleanupTask.ID())
+	runTaskNowish(cleanupTask)
+
+	return nil
+}
+
+func scheduleWebhookRetryTask(scheduler gocron.Scheduler, notifier *notifiers.WebhookMatrixNotifier, instanceConfig *config.InstanceConfig) error {
+	if instanceConfig.WebhookRetryIntervalSeconds <= 0 {
+		log.Println("Webhook retries are disabled. Set PS_WEBHOOK_RETRY_INTERVAL_SECONDS to a positive number to enable them.")
+		return nil
+	}
+
+	// Like federation catchup, the jitter avoids all processes trying to claim deliveries at the same time.
+	minTime := time.Second * time.Duration(math.Max(1, float64(instanceConfig.WebhookRetryIntervalSeconds)-2))
+	maxTime := time.Second * time.Duration(instanceConfig.WebhookRetryIntervalSeconds+2)
+
+	retryTask, err := scheduler.NewJob(gocron.DurationRandomJob(minTime, maxTime), gocron.NewTask(tasks.RetryWebhookDeliveries, notifier), gocron.WithName("RetryWebhookDeliveries"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled webhook retry task every ~%d seconds: %s", instanceConfig.WebhookRetryIntervalSeconds, retryTask.ID())
+
+	return nil
+}
+
 // runTaskNowish - Runs a gocron task as quickly as possible, with a small delay to avoid overlapping calls. The task will
 // wait asynchronously to run, so this will return immediately regardless of whether the task is running.
 func runTaskNowish(task gocron.Job) {
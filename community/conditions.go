@@ -0,0 +1,132 @@
+package community
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/filter"
+	"github.com/matrix-org/policyserv/filter/condition"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/trust"
+)
+
+// knownCapabilities are the trust capabilities which can be used in a condition.
+var knownCapabilities = []trust.Capability{trust.CapabilityMedia}
+
+// filterConditionsFor - Returns the conditions to apply to individual filters by name, per the community config.
+func (m *Manager) filterConditionsFor(communityConfig *config.CommunityConfig) (map[string]condition.Condition, error) {
+	conditions := make(map[string]condition.Condition)
+	for name, cnf := range internal.Dereference(communityConfig.FilterConditions) {
+		if !filter.IsRegistered(name) {
+			return nil, fmt.Errorf("filter conditions: unknown filter name: %s", name)
+		}
+		if cnf == nil {
+			continue // no condition means "always run"
+		}
+		cond, err := m.conditionFromConfig(cnf)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("filter conditions for %s", name), err)
+		}
+		conditions[name] = cond
+	}
+	return conditions, nil
+}
+
+// conditionFromConfig - Converts the JSON condition grammar into a condition.Condition. All criteria specified on a
+// single FilterCondition are ANDed together.
+func (m *Manager) conditionFromConfig(cnf *config.FilterCondition) (condition.Condition, error) {
+	conditions := make([]condition.Condition, 0)
+
+	convertAll := func(cnfs []*config.FilterCondition) ([]condition.Condition, error) {
+		converted := make([]condition.Condition, len(cnfs))
+		for i, c := range cnfs {
+			if c == nil {
+				return nil, errors.New("condition is null")
+			}
+			cond, err := m.conditionFromConfig(c)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = cond
+		}
+		return converted, nil
+	}
+
+	if len(cnf.AllOf) > 0 {
+		all, err := convertAll(cnf.AllOf)
+		if err != nil {
+			return nil, errors.Join(errors.New("all_of"), err)
+		}
+		conditions = append(conditions, condition.AllOf(all...))
+	}
+	if len(cnf.AnyOf) > 0 {
+		anyOf, err := convertAll(cnf.AnyOf)
+		if err != nil {
+			return nil, errors.Join(errors.New("any_of"), err)
+		}
+		conditions = append(conditions, condition.AnyOf(anyOf...))
+	}
+	if cnf.Not != nil {
+		not, err := m.conditionFromConfig(cnf.Not)
+		if err != nil {
+			return nil, errors.Join(errors.New("not"), err)
+		}
+		conditions = append(conditions, condition.Not(not))
+	}
+	if len(cnf.RoomIds) > 0 {
+		conditions = append(conditions, condition.AnyIn(condition.RoomId, cnf.RoomIds))
+	}
+	if len(cnf.InSpaceRoomIds) > 0 {
+		conditions = append(conditions, condition.AnyIn(func(spaceRoomId string) condition.Condition {
+			return condition.RoomInSpace(m.storage, spaceRoomId)
+		}, cnf.InSpaceRoomIds))
+	}
+	if len(cnf.SenderGlobs) > 0 {
+		conditions = append(conditions, condition.AnyIn(condition.SenderGlob, cnf.SenderGlobs))
+	}
+	if len(cnf.SenderServerNames) > 0 {
+		conditions = append(conditions, condition.AnyIn(condition.SenderServerName, cnf.SenderServerNames))
+	}
+	if cnf.SenderHasCapability != "" {
+		capability := trust.Capability(cnf.SenderHasCapability)
+		if !slices.Contains(knownCapabilities, capability) {
+			return nil, fmt.Errorf("unknown capability: %s", capability)
+		}
+		sources, err := m.trustSources()
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition.SenderHasCapability(sources, capability))
+	}
+	if cnf.SenderJoinedWithinMinutes < 0 {
+		return nil, errors.New("sender_joined_within_minutes must not be negative")
+	} else if cnf.SenderJoinedWithinMinutes > 0 {
+		conditions = append(conditions, condition.JoinedWithin(m.storage, time.Duration(cnf.SenderJoinedWithinMinutes)*time.Minute))
+	}
+
+	if len(conditions) == 0 {
+		return nil, errors.New("condition does not specify any criteria")
+	}
+	return condition.AllOf(conditions...), nil
+}
+
+// trustSources - The trust sources used by conditions. The community's self-directed trust is expressed through
+// sender globs instead.
+func (m *Manager) trustSources() ([]trust.Source, error) {
+	muninn, err := trust.NewMuninnHallSource(m.storage)
+	if err != nil {
+		return nil, err
+	}
+	creators, err := trust.NewCreatorSource(m.storage)
+	if err != nil {
+		return nil, err
+	}
+	powerLevels, err := trust.NewPowerLevelsSource(m.storage)
+	if err != nil {
+		return nil, err
+	}
+	return []trust.Source{muninn, creators, powerLevels}, nil
+}
@@ -0,0 +1,121 @@
+package community
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/filter"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionFromConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager := makeManager(t)
+
+	spaceRoomId := "!space:example.org"
+	childRoomId := "!child:example.org"
+	otherRoomId := "!other:example.org"
+	err := manager.storage.SetSpaceChildren(ctx, spaceRoomId, []string{childRoomId})
+	assert.NoError(t, err)
+	err = manager.storage.InsertRoomMemberJoin(ctx, childRoomId, "@new:example.org", time.Now().UnixMilli())
+	assert.NoError(t, err)
+	err = manager.storage.InsertRoomMemberJoin(ctx, childRoomId, "@old:example.org", time.Now().Add(-1*time.Hour).UnixMilli())
+	assert.NoError(t, err)
+
+	// "Rooms in the space, except for senders on example.com, unless they joined recently"
+	cond, err := manager.conditionFromConfig(&config.FilterCondition{
+		InSpaceRoomIds: []string{spaceRoomId},
+		AnyOf: []*config.FilterCondition{{
+			Not: &config.FilterCondition{SenderServerNames: []string{"example.com"}},
+		}, {
+			SenderJoinedWithinMinutes: 10,
+		}},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, cond)
+	assert.True(t, cond.Matches(ctx, "community", childRoomId, "@alice:example.org"))
+	assert.True(t, cond.Matches(ctx, "community", childRoomId, "@new:example.org"))
+	assert.True(t, cond.Matches(ctx, "community", childRoomId, "@old:example.org"))
+	assert.False(t, cond.Matches(ctx, "community", childRoomId, "@alice:example.com"))
+	assert.False(t, cond.Matches(ctx, "community", otherRoomId, "@alice:example.org"))
+
+	cond, err = manager.conditionFromConfig(&config.FilterCondition{
+		AllOf: []*config.FilterCondition{{
+			SenderGlobs: []string{"@*:example.org"},
+		}, {
+			SenderJoinedWithinMinutes: 10,
+		}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, cond.Matches(ctx, "community", childRoomId, "@new:example.org"))
+	assert.False(t, cond.Matches(ctx, "community", childRoomId, "@old:example.org"))
+	assert.False(t, cond.Matches(ctx, "community", childRoomId, "@unknown:example.org"))
+
+	// Nobody is trusted in the memory store by default
+	cond, err = manager.conditionFromConfig(&config.FilterCondition{
+		SenderHasCapability: "media",
+	})
+	assert.NoError(t, err)
+	assert.False(t, cond.Matches(ctx, "community", childRoomId, "@alice:example.org"))
+}
+
+func TestConditionFromConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	manager := makeManager(t)
+	cases := map[string]*config.FilterCondition{
+		"condition does not specify any criteria": {},
+		"all_of":                          {AllOf: []*config.FilterCondition{nil}},
+		"any_of":                          {AnyOf: []*config.FilterCondition{{}}},
+		"not":                             {Not: &config.FilterCondition{}},
+		"unknown capability: superpowers": {SenderHasCapability: "superpowers"},
+		"sender_joined_within_minutes must not be negative": {SenderJoinedWithinMinutes: -1},
+	}
+	for expectedErr, cnf := range cases {
+		_, err := manager.conditionFromConfig(cnf)
+		assert.ErrorContains(t, err, expectedErr)
+	}
+}
+
+func TestFilterConditionsFor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager := makeManager(t)
+
+	conditions, err := manager.filterConditionsFor(&config.CommunityConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, conditions)
+
+	conditions, err = manager.filterConditionsFor(&config.CommunityConfig{
+		FilterConditions: &map[string]*config.FilterCondition{
+			filter.KeywordFilterName: {RoomIds: []string{"!foo:example.org"}},
+			filter.LinkFilterName:    nil,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, conditions, 1)
+	assert.True(t, conditions[filter.KeywordFilterName].Matches(ctx, "community", "!foo:example.org", "@alice:example.org"))
+	assert.False(t, conditions[filter.KeywordFilterName].Matches(ctx, "community", "!bar:example.org", "@alice:example.org"))
+
+	communityConfig := &config.CommunityConfig{
+		FilterConditions: internal.Pointer(map[string]*config.FilterCondition{
+			"NotAFilter": {RoomIds: []string{"!foo:example.org"}},
+		}),
+	}
+	_, err = manager.filterConditionsFor(communityConfig)
+	assert.ErrorContains(t, err, "filter conditions: unknown filter name: NotAFilter")
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(communityConfig), "unknown filter name: NotAFilter")
+
+	communityConfig = &config.CommunityConfig{
+		FilterConditions: internal.Pointer(map[string]*config.FilterCondition{
+			filter.KeywordFilterName: {},
+		}),
+	}
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(communityConfig), "filter conditions for KeywordFilter")
+}
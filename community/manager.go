@@ -11,7 +11,6 @@ import (
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/content"
 	"github.com/matrix-org/policyserv/filter"
-	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/notifiers"
 	"github.com/matrix-org/policyserv/pubsub"
@@ -95,118 +94,42 @@ func (m *Manager) GetFilterSetForCommunityId(ctx context.Context, communityId st
 		return nil, nil
 	}
 
-	prefilters := []string{filter.ProtectLocalUserFilterName}
-	hellbanPrefilters := make([]string, 0) // these run after the prefilters, but before the other filters
-	filters := make([]string, 0)
-	postfilterSilences := make([]string, 0)
-	if len(internal.Dereference(communityConfig.KeywordFilterKeywords)) > 0 {
-		filters = append(filters, filter.KeywordFilterName)
-	}
-	if len(internal.Dereference(communityConfig.KeywordTemplateFilterTemplateNames)) > 0 {
-		filters = append(filters, filter.KeywordTemplateFilterName)
-	}
-	if len(internal.Dereference(communityConfig.EventTypePrefilterAllowedEventTypes)) > 0 || len(internal.Dereference(communityConfig.EventTypePrefilterAllowedStateEventTypes)) > 0 {
-		prefilters = append(prefilters, filter.EventTypeFilterName)
-	}
-	if len(internal.Dereference(communityConfig.SenderPrefilterAllowedSenders)) > 0 {
-		prefilters = append(prefilters, filter.SenderFilterName)
-	}
-	if internal.Dereference(communityConfig.DensityFilterMaxDensity) > 0 {
-		filters = append(filters, filter.DensityFilterName)
-	}
-	if internal.Dereference(communityConfig.LengthFilterMaxLength) > 0 {
-		filters = append(filters, filter.LengthFilterName)
-	}
-	if internal.Dereference(communityConfig.ManyAtsFilterMaxAts) > 0 {
-		filters = append(filters, filter.ManyAtsFilterName)
-	}
-	if len(internal.Dereference(communityConfig.MediaFilterMediaTypes)) > 0 {
-		filters = append(filters, filter.MediaFilterName)
-	}
-	if len(internal.Dereference(communityConfig.UntrustedMediaFilterMediaTypes)) > 0 {
-		filters = append(filters, filter.UntrustedMediaFilterName)
-	}
-	if internal.Dereference(communityConfig.InlineEmojiSizeFilterMaxHeightPixels) > 0 {
-		filters = append(filters, filter.InlineEmojiSizeFilterName)
-	}
-	if internal.Dereference(communityConfig.MentionFilterMaxMentions) > 0 {
-		filters = append(filters, filter.MentionsFilterName)
-	}
-	if internal.Dereference(communityConfig.MjolnirFilterEnabled) && m.instanceConfig.MjolnirFilterRoomID != "" {
-		filters = append(filters, filter.MjolnirFilterName)
-	}
-	if internal.Dereference(communityConfig.TrimLengthFilterMaxDifference) > 0 {
-		filters = append(filters, filter.TrimLengthFilterName)
-	}
-	if internal.Dereference(communityConfig.HellbanPostfilterMinutes) > 0 {
-		hellbanPrefilters = append(hellbanPrefilters, filter.HellbanPrefilterName)
-		postfilterSilences = append(postfilterSilences, filter.HellbanPostfilterName)
-	}
-	if m.instanceConfig.OpenAIApiKey != "" {
-		// Access to this filter is gated by further instance config (namely, the room IDs allowed to use it)
-		filters = append(filters, filter.OpenAIOmniFilterName)
-	}
-	if !internal.Dereference(communityConfig.StickyEventsFilterAllowStickyEvents) {
-		filters = append(filters, filter.StickyEventsFilterName)
-	}
-	if len(internal.Dereference(communityConfig.LinkFilterAllowedUrlGlobs)) > 0 || len(internal.Dereference(communityConfig.LinkFilterDeniedUrlGlobs)) > 0 {
-		filters = append(filters, filter.LinkFilterName)
-	}
-	if internal.Dereference(communityConfig.MentionFrequencyFilterRateLimit) > 0 {
-		filters = append(filters, filter.MentionsFrequencyFilterName)
-	}
-	if len(internal.Dereference(communityConfig.FrequencyFilterEventTypes)) > 0 && internal.Dereference(communityConfig.FrequencyFilterRateLimit) > 0 {
-		filters = append(filters, filter.FrequencyFilterName)
-	}
-	if internal.Dereference(communityConfig.UserIdContainsWordsFilterMaxWords) > 0 {
-		filters = append(filters, filter.UserIdContainsWordsFilterName)
+	groups, err := m.setGroupsFor(communityConfig)
+	if err != nil {
+		return nil, err
 	}
-	if internal.Dereference(communityConfig.UserIdLengthFilterMaxLength) > 0 {
-		filters = append(filters, filter.UserIdLengthFilterName)
+	filterConditions, err := m.filterConditionsFor(communityConfig)
+	if err != nil {
+		return nil, err
 	}
-	var scanner content.Scanner
+
+	scanners := make([]content.Scanner, 0)
 	if m.instanceConfig.HMAApiUrl != "" && len(internal.Dereference(communityConfig.HMAFilterEnabledBanks)) > 0 {
-		filters = append(filters, filter.MediaScanningFilterName)
-		scanner, err = content.NewHMAScanner(m.instanceConfig.HMAApiUrl, m.instanceConfig.HMAApiKey, internal.Dereference(communityConfig.HMAFilterEnabledBanks))
+		hmaScanner, err := content.NewHMAScanner(m.instanceConfig.HMAApiUrl, m.instanceConfig.HMAApiKey, internal.Dereference(communityConfig.HMAFilterEnabledBanks))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create HMA scanner: %w", err)
 		}
+		scanners = append(scanners, hmaScanner)
 	}
-	if communityConfig.UnsafeSigningKeyFilterEnabled {
-		prefilters = append(prefilters, filter.UnsafeSigningKeyFilterName)
+	if len(internal.Dereference(communityConfig.MediaHashFilterEnabledBanks)) > 0 {
+		localScanner, err := content.NewLocalHashScanner(m.storage, communityId, internal.Dereference(communityConfig.MediaHashFilterEnabledBanks), internal.Dereference(communityConfig.MediaHashFilterMaxDistance))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create local hash scanner: %w", err)
+		}
+		scanners = append(scanners, localScanner)
+	}
+	var scanner content.Scanner
+	if len(scanners) == 1 {
+		scanner = scanners[0]
+	} else if len(scanners) > 1 {
+		scanner = content.NewMultiScanner(scanners...)
 	}
 	setConfig := &filter.SetConfig{
-		CommunityConfig: communityConfig,
-		CommunityId:     communityId,
-		InstanceConfig:  m.instanceConfig,
-		Groups: []*filter.SetGroupConfig{{
-			// The first set group replaces the concept of "prefilters". We want this group to capture all events,
-			// so we set the classes appropriately.
-			EnabledNames: prefilters,
-			// Micro optimization: Put neutral first so we can skip CPU cycles in a loop in the general case. We also
-			// probably don't need to specify allowed and prohibited here because we have no code which pushes such
-			// classes right away, but for safety we might as well.
-			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral, harms.ContentClassAllowed, harms.ContentClassProhibited},
-		}, {
-			// This set group is similar to prefilters, but only contains the hellban prefilters. This is to prevent
-			// users being denied abilities that are intended to be granted to them via other prefilters (like an
-			// ability to leave the room).
-			EnabledNames: hellbanPrefilters,
-			// We want to capture "maybe spam", but not events that were already flagged as (not) spam.
-			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
-		}, {
-			// The third set group is what was previously the middle layer for filters. This is where the bulk of
-			// the work happens. We only want it to run if the prefilters didn't already declare an event spammy or
-			// neutral though, so we narrow the min/max range a bit.
-			EnabledNames: filters,
-			// Skip this group for events that are already (not) spam.
-			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
-		}, {
-			// The last set group is for telling the hellban postfilter if any previous filter flagged an event as
-			// spammy so it can put a silence in place.
-			EnabledNames:          postfilterSilences,
-			CheckedContentClasses: []harms.ContentClass{harms.ContentClassProhibited},
-		}},
+		CommunityConfig:  communityConfig,
+		CommunityId:      communityId,
+		InstanceConfig:   m.instanceConfig,
+		Groups:           groups,
+		FilterConditions: filterConditions,
 	}
 	filterSet, err := filter.NewSet(setConfig, m.storage, m.pubsubClient, m.notifier, scanner)
 	if err != nil {
@@ -218,6 +141,20 @@ func (m *Manager) GetFilterSetForCommunityId(ctx context.Context, communityId st
 	return filterSet, nil
 }
 
+// NotifyRaid - Tells the community's moderators that a raid was started manually. Automatically started raids are
+// notified by the raid prefilter.
+func (m *Manager) NotifyRaid(ctx context.Context, raid *storage.StoredRaid) error {
+	cnf, err := m.getCommunityConfig(ctx, raid.CommunityId)
+	if err != nil {
+		return err
+	}
+	if cnf == nil {
+		return fmt.Errorf("community %s not found", raid.CommunityId)
+	}
+	filter.NotifyRaid(m.notifier, raid, 0, internal.Dereference(cnf.RaidPrefilterLockdownUntrusted))
+	return nil
+}
+
 func (m *Manager) getCommunityConfig(ctx context.Context, communityId string) (*config.CommunityConfig, error) {
 	// Find JSON in database
 	community, err := m.storage.GetCommunity(ctx, communityId)
@@ -259,3 +259,36 @@ func TestCommunityManagerCacheInvalidation(t *testing.T) {
 	assert.NotNil(t, info)
 	assert.Equal(t, harms.ContentClassProhibited, info.Class()) // now it's spam
 }
+
+func TestNotifyRaid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	notifier := test.NewMatrixNotifier(t)
+	cnf, err := config.NewInstanceConfig()
+	assert.NoError(t, err)
+	manager, err := NewManager(cnf, db, test.NewMemoryPubsub(t), notifier)
+	assert.NoError(t, err)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	raid := &storage.StoredRaid{
+		CommunityId:            community.CommunityId,
+		RoomId:                 "!room:example.org",
+		StartedTimestampMillis: time.Now().UnixMilli(),
+		ExpiresTimestampMillis: time.Now().Add(10 * time.Minute).UnixMilli(),
+		IsManual:               true,
+	}
+	err = manager.NotifyRaid(ctx, raid)
+	assert.NoError(t, err)
+	sent := notifier.SentTo(community.CommunityId)
+	assert.Len(t, sent, 1)
+	assert.Contains(t, sent[0], "A moderator started a join raid")
+	assert.Contains(t, sent[0], "!room:example.org")
+
+	// Unknown communities are an error
+	raid.CommunityId = "unknown"
+	err = manager.NotifyRaid(ctx, raid)
+	assert.Error(t, err)
+}
@@ -0,0 +1,308 @@
+package community
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/matrix-org/policyserv/ai"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/filter"
+	"github.com/matrix-org/policyserv/filter/condition"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+)
+
+// ValidateCommunityConfig - Returns an error if the community config's filter pipeline, filter conditions, shadow
+// filter names, policy lists, or AI filter config cannot be used to create a filter set. A nil pipeline is valid and
+// means the built-in default pipeline is used.
+func (m *Manager) ValidateCommunityConfig(communityConfig *config.CommunityConfig) error {
+	if communityConfig == nil {
+		return nil
+	}
+	if communityConfig.FilterPipeline != nil {
+		if _, err := m.setGroupsFromPipeline(*communityConfig.FilterPipeline); err != nil {
+			return err
+		}
+	}
+	for _, name := range internal.Dereference(communityConfig.ShadowFilterNames) {
+		if !filter.IsRegistered(name) {
+			return fmt.Errorf("shadow filter names: unknown filter name: %s", name)
+		}
+		if name == filter.ProtectLocalUserFilterName {
+			return fmt.Errorf("shadow filter names: %s cannot be shadowed", name)
+		}
+	}
+	for i, list := range internal.Dereference(communityConfig.MjolnirFilterPolicyLists) {
+		if list == nil {
+			return fmt.Errorf("policy list %d is null", i)
+		}
+		if !strings.HasPrefix(list.RoomId, "!") {
+			return fmt.Errorf("policy list %d: room_id must be a room ID", i)
+		}
+	}
+	if err := m.validateOpenAIConfig(communityConfig); err != nil {
+		return err
+	}
+	_, err := m.filterConditionsFor(communityConfig)
+	return err
+}
+
+// validateOpenAIConfig - Returns an error if the community's AI filter config can't be used. The chat filter's model is
+// checked against the config layered over the instance defaults, as that's what the filter set will use.
+func (m *Manager) validateOpenAIConfig(communityConfig *config.CommunityConfig) error {
+	err := ai.ValidateOpenAIModerationCategories(internal.Dereference(communityConfig.OpenAIFilterCategories), internal.Dereference(communityConfig.OpenAIFilterCategoryThresholds))
+	if err != nil {
+		return err
+	}
+	if baseUrl := internal.Dereference(communityConfig.OpenAIFilterBaseUrl); baseUrl != "" {
+		if err = filter.ValidateOpenAIBaseUrl(baseUrl, m.instanceConfig.OpenAIAllowedDomains); err != nil {
+			return err
+		}
+	}
+
+	usesChatFilter := internal.Dereference(communityConfig.OpenAIChatFilterEnabled) || pipelineHasFilter(internal.Dereference(communityConfig.FilterPipeline), filter.OpenAIChatFilterName)
+	if !usesChatFilter {
+		return nil
+	}
+	b, err := json.Marshal(communityConfig)
+	if err != nil {
+		return err
+	}
+	layered, err := config.NewCommunityConfigForJSON(b)
+	if err != nil {
+		return err
+	}
+	if internal.Dereference(layered.OpenAIChatFilterModel) == "" {
+		return filter.ErrOpenAIChatFilterNoModel
+	}
+	return nil
+}
+
+// setGroupsFor - Returns the set group configs for the community config. If the community has defined its own
+// pipeline then that is used, otherwise the built-in default pipeline is returned.
+func (m *Manager) setGroupsFor(communityConfig *config.CommunityConfig) ([]*filter.SetGroupConfig, error) {
+	if communityConfig.FilterPipeline != nil {
+		groups, err := m.setGroupsFromPipeline(*communityConfig.FilterPipeline)
+		if err != nil {
+			return nil, err
+		}
+		// Custom pipelines can't opt out of the filters which protect policyserv itself, or of moderator overrides
+		required := []*filter.SetGroupConfig{safetySetGroup(), overrideSetGroup()}
+		if communityConfig.UnsafeSigningKeyFilterEnabled && !pipelineHasFilter(*communityConfig.FilterPipeline, filter.UnsafeSigningKeyFilterName) {
+			required = append(required, &filter.SetGroupConfig{
+				EnabledNames:          []string{filter.UnsafeSigningKeyFilterName},
+				CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+			})
+		}
+		return append(required, groups...), nil
+	}
+	return defaultSetGroups(communityConfig, m.instanceConfig), nil
+}
+
+func (m *Manager) setGroupsFromPipeline(pipeline []*config.FilterPipelineGroup) ([]*filter.SetGroupConfig, error) {
+	groups := make([]*filter.SetGroupConfig, 0, len(pipeline))
+	for i, groupCnf := range pipeline {
+		if groupCnf == nil {
+			return nil, fmt.Errorf("filter pipeline group %d is null", i)
+		}
+
+		for _, name := range groupCnf.Filters {
+			if !filter.IsRegistered(name) {
+				return nil, fmt.Errorf("filter pipeline group %d: unknown filter name: %s", i, name)
+			}
+		}
+
+		classes := []harms.ContentClass{harms.ContentClassNeutral}
+		if len(groupCnf.CheckedContentClasses) > 0 {
+			classes = make([]harms.ContentClass, len(groupCnf.CheckedContentClasses))
+			for j, val := range groupCnf.CheckedContentClasses {
+				class, err := harms.ParseContentClass(val)
+				if err != nil {
+					return nil, errors.Join(fmt.Errorf("filter pipeline group %d", i), err)
+				}
+				classes[j] = class
+			}
+		}
+
+		var cond condition.Condition
+		if groupCnf.Condition != nil {
+			var err error
+			cond, err = m.conditionFromConfig(groupCnf.Condition)
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("filter pipeline group %d", i), err)
+			}
+		}
+
+		// The override prefilter is always added before the pipeline, so there's no need to run it again
+		names := slices.DeleteFunc(slices.Clone(groupCnf.Filters), func(name string) bool {
+			return name == filter.OverridePrefilterName
+		})
+
+		groups = append(groups, &filter.SetGroupConfig{
+			EnabledNames:          names,
+			CheckedContentClasses: classes,
+			Condition:             cond,
+		})
+	}
+	return groups, nil
+}
+
+// safetySetGroup - The set group containing prefilters which protect policyserv itself. This is always the first
+// group, including in custom pipelines.
+func safetySetGroup() *filter.SetGroupConfig {
+	return &filter.SetGroupConfig{
+		// We want this group to capture all events, so we set the classes appropriately. Nothing is able to override
+		// these filters.
+		EnabledNames: []string{filter.ProtectLocalUserFilterName},
+		// Micro optimization: Put neutral first so we can skip CPU cycles in a loop in the general case. We also
+		// probably don't need to specify allowed and prohibited here because we have no code which pushes such
+		// classes right away, but for safety we might as well.
+		CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral, harms.ContentClassAllowed, harms.ContentClassProhibited},
+	}
+}
+
+// overrideSetGroup - The set group containing the override prefilter, so moderator overrides can allow events before
+// any other filter has a chance to flag them. This always comes straight after the safety group, including in custom
+// pipelines.
+func overrideSetGroup() *filter.SetGroupConfig {
+	return &filter.SetGroupConfig{
+		EnabledNames: []string{filter.OverridePrefilterName},
+		// If the safety prefilters already flagged the event, there's nothing to override.
+		CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+	}
+}
+
+// pipelineHasFilter - Returns true if any group in the pipeline enables the named filter.
+func pipelineHasFilter(pipeline []*config.FilterPipelineGroup, name string) bool {
+	for _, groupCnf := range pipeline {
+		if groupCnf != nil && slices.Contains(groupCnf.Filters, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultSetGroups - The built-in pipeline used when a community doesn't specify its own. Filters are only enabled
+// when their config would cause them to do something.
+func defaultSetGroups(communityConfig *config.CommunityConfig, instanceConfig *config.InstanceConfig) []*filter.SetGroupConfig {
+	prefilters := make([]string, 0)
+	hellbanPrefilters := make([]string, 0) // these run after the prefilters, but before the other filters
+	filters := make([]string, 0)
+	postfilterSilences := make([]string, 0)
+	if len(internal.Dereference(communityConfig.KeywordFilterKeywords)) > 0 {
+		filters = append(filters, filter.KeywordFilterName)
+	}
+	if len(internal.Dereference(communityConfig.KeywordTemplateFilterTemplateNames)) > 0 {
+		filters = append(filters, filter.KeywordTemplateFilterName)
+	}
+	if len(internal.Dereference(communityConfig.EventTypePrefilterAllowedEventTypes)) > 0 || len(internal.Dereference(communityConfig.EventTypePrefilterAllowedStateEventTypes)) > 0 {
+		prefilters = append(prefilters, filter.EventTypeFilterName)
+	}
+	if len(internal.Dereference(communityConfig.SenderPrefilterAllowedSenders)) > 0 {
+		prefilters = append(prefilters, filter.SenderFilterName)
+	}
+	if internal.Dereference(communityConfig.DensityFilterMaxDensity) > 0 {
+		filters = append(filters, filter.DensityFilterName)
+	}
+	if internal.Dereference(communityConfig.LengthFilterMaxLength) > 0 {
+		filters = append(filters, filter.LengthFilterName)
+	}
+	if internal.Dereference(communityConfig.ManyAtsFilterMaxAts) > 0 {
+		filters = append(filters, filter.ManyAtsFilterName)
+	}
+	if len(internal.Dereference(communityConfig.MediaFilterMediaTypes)) > 0 {
+		filters = append(filters, filter.MediaFilterName)
+	}
+	if len(internal.Dereference(communityConfig.UntrustedMediaFilterMediaTypes)) > 0 {
+		filters = append(filters, filter.UntrustedMediaFilterName)
+	}
+	if internal.Dereference(communityConfig.InlineEmojiSizeFilterMaxHeightPixels) > 0 {
+		filters = append(filters, filter.InlineEmojiSizeFilterName)
+	}
+	if internal.Dereference(communityConfig.MentionFilterMaxMentions) > 0 {
+		filters = append(filters, filter.MentionsFilterName)
+	}
+	if internal.Dereference(communityConfig.MjolnirFilterEnabled) && (instanceConfig.MjolnirFilterRoomID != "" || len(internal.Dereference(communityConfig.MjolnirFilterPolicyLists)) > 0) {
+		filters = append(filters, filter.MjolnirFilterName)
+	}
+	if internal.Dereference(communityConfig.TrimLengthFilterMaxDifference) > 0 {
+		filters = append(filters, filter.TrimLengthFilterName)
+	}
+	if internal.Dereference(communityConfig.HellbanPostfilterMinutes) > 0 {
+		hellbanPrefilters = append(hellbanPrefilters, filter.HellbanPrefilterName)
+		postfilterSilences = append(postfilterSilences, filter.HellbanPostfilterName)
+	}
+	// The raid prefilter is always enabled so moderators can start raids manually, even without join limits. It has
+	// nothing to do when no raid is active.
+	hellbanPrefilters = append(hellbanPrefilters, filter.RaidPrefilterName)
+	if instanceConfig.OpenAIApiKey != "" || (internal.Dereference(communityConfig.OpenAIFilterEnabled) && internal.Dereference(communityConfig.OpenAIFilterApiKey) != "") {
+		// When using the instance's API key, access to this filter is gated by further instance config (namely, the
+		// room IDs allowed to use it, unless communities are allowed to use the key everywhere)
+		filters = append(filters, filter.OpenAIOmniFilterName)
+	}
+	if internal.Dereference(communityConfig.OpenAIChatFilterEnabled) && internal.Dereference(communityConfig.OpenAIChatFilterModel) != "" {
+		filters = append(filters, filter.OpenAIChatFilterName)
+	}
+	if !internal.Dereference(communityConfig.StickyEventsFilterAllowStickyEvents) {
+		filters = append(filters, filter.StickyEventsFilterName)
+	}
+	if len(internal.Dereference(communityConfig.LinkFilterAllowedUrlGlobs)) > 0 || len(internal.Dereference(communityConfig.LinkFilterDeniedUrlGlobs)) > 0 {
+		filters = append(filters, filter.LinkFilterName)
+	}
+	if internal.Dereference(communityConfig.MentionFrequencyFilterRateLimit) > 0 {
+		filters = append(filters, filter.MentionsFrequencyFilterName)
+	}
+	if len(internal.Dereference(communityConfig.FrequencyFilterEventTypes)) > 0 && (internal.Dereference(communityConfig.FrequencyFilterRateLimit) > 0 || internal.Dereference(communityConfig.FrequencyFilterRoomRateLimit) > 0 || internal.Dereference(communityConfig.FrequencyFilterOriginRateLimit) > 0) {
+		filters = append(filters, filter.FrequencyFilterName)
+	}
+	if internal.Dereference(communityConfig.NearDuplicateFilterMaxSenders) > 0 || internal.Dereference(communityConfig.NearDuplicateFilterMaxRooms) > 0 {
+		filters = append(filters, filter.NearDuplicateFilterName)
+	}
+	if internal.Dereference(communityConfig.ModeratorBlocklistFilterMinutes) > 0 {
+		filters = append(filters, filter.ModeratorBlocklistFilterName)
+	}
+	if internal.Dereference(communityConfig.ImpersonationFilterEnabled) {
+		filters = append(filters, filter.ImpersonationFilterName)
+	}
+	if internal.Dereference(communityConfig.UserIdContainsWordsFilterMaxWords) > 0 {
+		filters = append(filters, filter.UserIdContainsWordsFilterName)
+	}
+	if internal.Dereference(communityConfig.UserIdLengthFilterMaxLength) > 0 {
+		filters = append(filters, filter.UserIdLengthFilterName)
+	}
+	hasHMA := instanceConfig.HMAApiUrl != "" && len(internal.Dereference(communityConfig.HMAFilterEnabledBanks)) > 0
+	if hasHMA || len(internal.Dereference(communityConfig.MediaHashFilterEnabledBanks)) > 0 {
+		filters = append(filters, filter.MediaScanningFilterName)
+	}
+	if communityConfig.UnsafeSigningKeyFilterEnabled {
+		prefilters = append(prefilters, filter.UnsafeSigningKeyFilterName)
+	}
+	return []*filter.SetGroupConfig{safetySetGroup(), overrideSetGroup(), {
+		// This set group replaces the concept of "prefilters".
+		EnabledNames: prefilters,
+		// Skip this group for events that were overridden (or flagged by the safety prefilters).
+		CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+	}, {
+		// This set group is similar to prefilters, but only contains the hellban and raid prefilters. This is to
+		// prevent users being denied abilities that are intended to be granted to them via other prefilters (like an
+		// ability to leave the room).
+		EnabledNames: hellbanPrefilters,
+		// We want to capture "maybe spam", but not events that were already flagged as (not) spam.
+		CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+	}, {
+		// This set group is what was previously the middle layer for filters. This is where the bulk of
+		// the work happens. We only want it to run if the prefilters didn't already declare an event spammy or
+		// neutral though, so we narrow the min/max range a bit.
+		EnabledNames: filters,
+		// Skip this group for events that are already (not) spam.
+		CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+	}, {
+		// The last set group is for telling the hellban postfilter if any previous filter flagged an event as
+		// spammy so it can put a silence in place.
+		EnabledNames:          postfilterSilences,
+		CheckedContentClasses: []harms.ContentClass{harms.ContentClassProhibited},
+	}}
+}
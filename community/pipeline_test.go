@@ -0,0 +1,345 @@
+package community
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/filter"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetGroupsForUsesDefault(t *testing.T) {
+	t.Parallel()
+
+	communityConfig := &config.CommunityConfig{
+		KeywordFilterKeywords:    &[]string{"keyword1"},
+		HellbanPostfilterMinutes: internal.Pointer(10),
+	}
+	manager := makeManager(t)
+
+	groups, err := manager.setGroupsFor(communityConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultSetGroups(communityConfig, manager.instanceConfig), groups)
+
+	// Spot check the layout
+	assert.Len(t, groups, 6)
+	assert.Equal(t, []string{filter.ProtectLocalUserFilterName}, groups[0].EnabledNames)
+	assert.Equal(t, []string{filter.OverridePrefilterName}, groups[1].EnabledNames)
+	assert.Equal(t, []harms.ContentClass{harms.ContentClassNeutral}, groups[1].CheckedContentClasses)
+	assert.Empty(t, groups[2].EnabledNames) // no other prefilters are configured
+	assert.Equal(t, []string{filter.HellbanPrefilterName, filter.RaidPrefilterName}, groups[3].EnabledNames) // raids can always be started manually
+	assert.Equal(t, []string{filter.KeywordFilterName, filter.StickyEventsFilterName}, groups[4].EnabledNames) // sticky events are disallowed unless set
+	assert.Equal(t, []string{filter.HellbanPostfilterName}, groups[5].EnabledNames)
+	assert.Equal(t, []harms.ContentClass{harms.ContentClassProhibited}, groups[5].CheckedContentClasses)
+}
+
+func TestSetGroupsForUsesPipeline(t *testing.T) {
+	t.Parallel()
+
+	communityConfig := &config.CommunityConfig{
+		KeywordFilterKeywords: &[]string{"keyword1"},
+		FilterPipeline: &[]*config.FilterPipelineGroup{{
+			Filters:               []string{filter.LinkFilterName, filter.SenderFilterName},
+			CheckedContentClasses: []string{"neutral", "allowed", "prohibited"},
+		}, {
+			Filters: []string{filter.KeywordFilterName},
+			Condition: &config.FilterCondition{
+				RoomIds: []string{"!foo:example.org"},
+			},
+		}},
+	}
+
+	groups, err := makeManager(t).setGroupsFor(communityConfig)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 4)
+	assert.Equal(t, safetySetGroup(), groups[0])   // always added
+	assert.Equal(t, overrideSetGroup(), groups[1]) // always added
+	assert.Equal(t, []string{filter.LinkFilterName, filter.SenderFilterName}, groups[2].EnabledNames)
+	assert.Equal(t, []harms.ContentClass{harms.ContentClassNeutral, harms.ContentClassAllowed, harms.ContentClassProhibited}, groups[2].CheckedContentClasses)
+	assert.Nil(t, groups[2].Condition)
+	assert.Equal(t, []string{filter.KeywordFilterName}, groups[3].EnabledNames)
+	assert.Equal(t, []harms.ContentClass{harms.ContentClassNeutral}, groups[3].CheckedContentClasses) // default
+	assert.NotNil(t, groups[3].Condition)
+	assert.True(t, groups[3].Condition.Matches(context.Background(), "community", "!foo:example.org", "@alice:example.org"))
+	assert.False(t, groups[3].Condition.Matches(context.Background(), "community", "!bar:example.org", "@alice:example.org"))
+}
+
+func TestSetGroupsForPipelineKeepsRequiredFilters(t *testing.T) {
+	t.Parallel()
+
+	manager := makeManager(t)
+	pipeline := []*config.FilterPipelineGroup{{
+		Filters: []string{filter.OverridePrefilterName, filter.LinkFilterName},
+	}}
+	communityConfig := &config.CommunityConfig{
+		UnsafeSigningKeyFilterEnabled: true,
+		FilterPipeline:                &pipeline,
+	}
+
+	// The unsafe signing key filter is added when it's enabled, and the override prefilter isn't run twice
+	groups, err := manager.setGroupsFor(communityConfig)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 4)
+	assert.Equal(t, safetySetGroup(), groups[0])
+	assert.Equal(t, overrideSetGroup(), groups[1])
+	assert.Equal(t, []string{filter.UnsafeSigningKeyFilterName}, groups[2].EnabledNames)
+	assert.Equal(t, []harms.ContentClass{harms.ContentClassNeutral}, groups[2].CheckedContentClasses)
+	assert.Equal(t, []string{filter.LinkFilterName}, groups[3].EnabledNames)
+	assert.Equal(t, []string{filter.OverridePrefilterName, filter.LinkFilterName}, pipeline[0].Filters) // not modified
+
+	// Pipelines which place the unsafe signing key filter themselves are left alone
+	pipeline[0].Filters = []string{filter.LinkFilterName, filter.UnsafeSigningKeyFilterName}
+	groups, err = manager.setGroupsFor(communityConfig)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []string{filter.LinkFilterName, filter.UnsafeSigningKeyFilterName}, groups[2].EnabledNames)
+
+	// ... and it isn't added when disabled
+	communityConfig.UnsafeSigningKeyFilterEnabled = false
+	pipeline[0].Filters = []string{filter.LinkFilterName}
+	groups, err = manager.setGroupsFor(communityConfig)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []string{filter.LinkFilterName}, groups[2].EnabledNames)
+}
+
+func TestSetGroupsForInvalidPipeline(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]*config.FilterPipelineGroup{
+		"filter pipeline group 0: unknown filter name: NotAFilter": {
+			Filters: []string{"NotAFilter"},
+		},
+		"unknown content class: spammy": {
+			Filters:               []string{filter.KeywordFilterName},
+			CheckedContentClasses: []string{"spammy"},
+		},
+		"condition does not specify any criteria": {
+			Filters:   []string{filter.KeywordFilterName},
+			Condition: &config.FilterCondition{},
+		},
+	}
+	manager := makeManager(t)
+	for expectedErr, group := range cases {
+		communityConfig := &config.CommunityConfig{
+			FilterPipeline: &[]*config.FilterPipelineGroup{group},
+		}
+		_, err := manager.setGroupsFor(communityConfig)
+		assert.ErrorContains(t, err, expectedErr)
+		assert.ErrorContains(t, manager.ValidateCommunityConfig(communityConfig), expectedErr)
+	}
+
+	// Null groups are also invalid
+	communityConfig := &config.CommunityConfig{
+		FilterPipeline: &[]*config.FilterPipelineGroup{nil},
+	}
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(communityConfig), "filter pipeline group 0 is null")
+
+	// ... but no pipeline is valid
+	assert.NoError(t, manager.ValidateCommunityConfig(&config.CommunityConfig{}))
+}
+
+func TestValidatePolicyLists(t *testing.T) {
+	t.Parallel()
+
+	manager := makeManager(t)
+
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		MjolnirFilterPolicyLists: &[]*config.PolicyList{nil},
+	}), "policy list 0 is null")
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		MjolnirFilterPolicyLists: &[]*config.PolicyList{{RoomId: "!list:example.org"}, {RoomId: "#alias:example.org"}},
+	}), "policy list 1: room_id must be a room ID")
+	assert.NoError(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		MjolnirFilterPolicyLists: &[]*config.PolicyList{{RoomId: "!list:example.org", Harm: "org.example.harm"}},
+	}))
+}
+
+func TestValidateShadowFilterNames(t *testing.T) {
+	t.Parallel()
+
+	manager := makeManager(t)
+
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		ShadowFilterNames: &[]string{"NotARealFilter"},
+	}), "shadow filter names: unknown filter name: NotARealFilter")
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		ShadowFilterNames: &[]string{filter.KeywordFilterName, filter.ProtectLocalUserFilterName},
+	}), "shadow filter names: ProtectLocalUserFilter cannot be shadowed")
+	assert.NoError(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		ShadowFilterNames: &[]string{filter.KeywordFilterName},
+	}))
+}
+
+func TestGetFilterSetWithPipeline(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager := makeManager(t)
+
+	communityId := "test_community"
+	protectedRoomId := "!protected:example.org"
+	otherRoomId := "!other:example.org"
+	for _, roomId := range []string{protectedRoomId, otherRoomId} {
+		err := manager.storage.UpsertRoom(ctx, &storage.StoredRoom{
+			RoomId:                         roomId,
+			RoomVersion:                    "11",
+			ModeratorUserId:                "@moderator:example.org",
+			LastCachedStateTimestampMillis: time.Now().UnixMilli(),
+			CommunityId:                    communityId,
+		})
+		assert.NoError(t, err)
+	}
+	err := manager.storage.UpsertCommunity(ctx, &storage.StoredCommunity{
+		CommunityId: communityId,
+		Name:        "Test Community",
+		Config: &config.CommunityConfig{
+			KeywordFilterKeywords: &[]string{"keyword1"},
+			FilterPipeline: &[]*config.FilterPipelineGroup{{
+				// The keyword filter should only apply to the protected room
+				Filters: []string{filter.KeywordFilterName},
+				Condition: &config.FilterCondition{
+					RoomIds: []string{protectedRoomId},
+				},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+
+	for roomId, expectedClass := range map[string]harms.ContentClass{
+		protectedRoomId: harms.ContentClassProhibited,
+		otherRoomId:     harms.ContentClassNeutral,
+	} {
+		set, err := manager.GetFilterSetForRoomId(ctx, roomId)
+		assert.NoError(t, err)
+		assert.NotNil(t, set)
+		info, err := set.CheckEvent(ctx, test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$event1",
+			RoomId:  roomId,
+			Type:    "m.room.message",
+			Sender:  "@test1:example.org",
+			Content: map[string]interface{}{
+				"body": "keyword1",
+			},
+		}), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedClass, info.Class())
+	}
+}
+
+func TestGetFilterSetWithPipelineProtectsLocalUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager := makeManager(t)
+
+	communityId := "test_community"
+	roomId := "!protected:example.org"
+	err := manager.storage.UpsertRoom(ctx, &storage.StoredRoom{
+		RoomId:                         roomId,
+		RoomVersion:                    "11",
+		ModeratorUserId:                "@moderator:example.org",
+		LastCachedStateTimestampMillis: time.Now().UnixMilli(),
+		CommunityId:                    communityId,
+	})
+	assert.NoError(t, err)
+	err = manager.storage.UpsertCommunity(ctx, &storage.StoredCommunity{
+		CommunityId: communityId,
+		Name:        "Test Community",
+		Config: &config.CommunityConfig{
+			// The pipeline doesn't include the ProtectLocalUserFilter
+			FilterPipeline: &[]*config.FilterPipelineGroup{{
+				Filters: []string{filter.LinkFilterName},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+
+	set, err := manager.GetFilterSetForRoomId(ctx, roomId)
+	assert.NoError(t, err)
+	localUserId := "@" + manager.instanceConfig.JoinLocalpart + ":" + manager.instanceConfig.HomeserverName
+	info, err := set.CheckEvent(ctx, test.MustMakePDU(&test.BaseClientEvent{
+		EventId:  "$kick",
+		RoomId:   roomId,
+		Type:     "m.room.member",
+		StateKey: &localUserId,
+		Sender:   "@moderator:example.org",
+		Content: map[string]any{
+			"membership": "leave",
+		},
+	}), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, harms.ContentClassProhibited, info.Class())
+}
+
+func TestValidateOpenAIConfig(t *testing.T) {
+	t.Parallel()
+
+	manager := makeManager(t)
+	manager.instanceConfig.OpenAIAllowedDomains = []string{"llm.example.org"}
+
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		OpenAIFilterCategories: &[]string{"harassment", "not-a-category"},
+	}), "unknown moderation category: not-a-category")
+	assert.ErrorContains(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		OpenAIFilterCategoryThresholds: &map[string]float64{"hate": 1.5},
+	}), "threshold for hate must be between 0 and 1")
+	assert.ErrorIs(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		OpenAIFilterBaseUrl: internal.Pointer("https://evil.example.org/v1"),
+	}), filter.ErrOpenAIBaseUrlDomainNotAllowed)
+	assert.ErrorIs(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		OpenAIChatFilterEnabled: internal.Pointer(true),
+	}), filter.ErrOpenAIChatFilterNoModel)
+	assert.ErrorIs(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		FilterPipeline: &[]*config.FilterPipelineGroup{{Filters: []string{filter.OpenAIChatFilterName}}},
+	}), filter.ErrOpenAIChatFilterNoModel)
+	assert.NoError(t, manager.ValidateCommunityConfig(&config.CommunityConfig{
+		OpenAIFilterCategories:         &[]string{"harassment", "sexual/minors"},
+		OpenAIFilterCategoryThresholds: &map[string]float64{"harassment": 0.8},
+		OpenAIFilterBaseUrl:            internal.Pointer("https://llm.example.org/v1"),
+		OpenAIChatFilterEnabled:        internal.Pointer(true),
+		OpenAIChatFilterModel:          internal.Pointer("llama3"),
+	}))
+}
+
+func TestDefaultSetGroupsOpenAI(t *testing.T) {
+	t.Parallel()
+
+	enabledNames := func(communityConfig *config.CommunityConfig, instanceConfig *config.InstanceConfig) []string {
+		names := make([]string, 0)
+		for _, group := range defaultSetGroups(communityConfig, instanceConfig) {
+			names = append(names, group.EnabledNames...)
+		}
+		return names
+	}
+
+	// Without any API key, the AI filters aren't used
+	names := enabledNames(&config.CommunityConfig{OpenAIFilterEnabled: internal.Pointer(true)}, &config.InstanceConfig{})
+	assert.NotContains(t, names, filter.OpenAIOmniFilterName)
+
+	// The instance's API key enables the filter (restricted to allowed rooms by the filter itself)
+	names = enabledNames(&config.CommunityConfig{}, &config.InstanceConfig{OpenAIApiKey: "key"})
+	assert.Contains(t, names, filter.OpenAIOmniFilterName)
+
+	// Communities can enable the filter with their own API key
+	names = enabledNames(&config.CommunityConfig{
+		OpenAIFilterEnabled: internal.Pointer(true),
+		OpenAIFilterApiKey:  internal.Pointer("key"),
+	}, &config.InstanceConfig{})
+	assert.Contains(t, names, filter.OpenAIOmniFilterName)
+
+	// The chat filter needs a model
+	names = enabledNames(&config.CommunityConfig{OpenAIChatFilterEnabled: internal.Pointer(true)}, &config.InstanceConfig{})
+	assert.NotContains(t, names, filter.OpenAIChatFilterName)
+	names = enabledNames(&config.CommunityConfig{
+		OpenAIChatFilterEnabled: internal.Pointer(true),
+		OpenAIChatFilterModel:   internal.Pointer("llama3"),
+	}, &config.InstanceConfig{})
+	assert.Contains(t, names, filter.OpenAIChatFilterName)
+}
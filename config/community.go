@@ -36,20 +36,69 @@ type CommunityConfig struct {
 	EventTypePrefilterAllowedEventTypes      *[]string `json:"event_type_prefilter_allowed_event_types,omitempty" envconfig:"event_type_prefilter_allowed_event_types" default:"m.room.redaction"`
 	EventTypePrefilterAllowedStateEventTypes *[]string `json:"event_type_prefilter_allowed_state_event_types,omitempty" envconfig:"event_type_prefilter_allowed_state_event_types" default:"m.room.power_levels,m.room.avatar,m.room.name,m.room.topic,m.room.join_rules,m.room.history_visibility,m.room.create,m.room.server_acl,m.room.tombstone,m.room.encryption,m.room.canonical_alias"`
 	HellbanPostfilterMinutes                 *int      `json:"hellban_postfilter_minutes,omitempty" envconfig:"hellban_postfilter_minutes" default:"60"`
+	HellbanPostfilterMaxMinutes              *int      `json:"hellban_postfilter_max_minutes,omitempty" envconfig:"hellban_postfilter_max_minutes" default:"0"`
 	MjolnirFilterEnabled                     *bool     `json:"mjolnir_filter_enabled,omitempty" envconfig:"mjolnir_filter_enabled" default:"true"`
 	WebhookUrl                               *string   `json:"webhook_url,omitempty" envconfig:"webhook_url" default:""`
 	OpenAIFilterFailSecure                   *bool     `json:"openai_filter_fail_secure,omitempty" envconfig:"openai_filter_fail_secure" default:"true"`
+	OpenAIFilterEnabled                      *bool     `json:"openai_filter_enabled,omitempty" envconfig:"openai_filter_enabled" default:"false"`
+	OpenAIFilterCategories                   *[]string `json:"openai_filter_categories,omitempty" envconfig:"openai_filter_categories" default:""`
+	OpenAIChatFilterEnabled                  *bool     `json:"openai_chat_filter_enabled,omitempty" envconfig:"openai_chat_filter_enabled" default:"false"`
+	OpenAIChatFilterModel                    *string   `json:"openai_chat_filter_model,omitempty" envconfig:"openai_chat_filter_model" default:""`
+	OpenAIChatFilterPrompt                   *string   `json:"openai_chat_filter_prompt,omitempty" envconfig:"openai_chat_filter_prompt" default:""`
 	StickyEventsFilterAllowStickyEvents      *bool     `json:"sticky_events_filter_allow_sticky_events,omitempty" envconfig:"sticky_events_filter_allow_sticky_events" default:"true"`
 	HMAFilterEnabledBanks                    *[]string `json:"hma_filter_enabled_banks,omitempty" envconfig:"hma_filter_enabled_banks" default:""`
+	MediaHashFilterEnabledBanks              *[]string `json:"media_hash_filter_enabled_banks,omitempty" envconfig:"media_hash_filter_enabled_banks" default:""`
+	MediaHashFilterMaxDistance               *int      `json:"media_hash_filter_max_distance,omitempty" envconfig:"media_hash_filter_max_distance" default:"10"`
 	LinkFilterAllowedUrlGlobs                *[]string `json:"link_filter_allowed_url_globs,omitempty" envconfig:"link_filter_allowed_url_globs" default:""`
 	LinkFilterDeniedUrlGlobs                 *[]string `json:"link_filter_denied_url_globs,omitempty" envconfig:"link_filter_denied_url_globs" default:""`
 	UnsafeSigningKeyFilterEnabled            bool      `json:"unsafe_signing_key_filter_enabled,omitempty" envconfig:"unsafe_signing_key_filter_enabled" default:"true"`
 	FrequencyFilterEventTypes                *[]string `json:"frequency_filter_event_types,omitempty" envconfig:"frequency_filter_event_types" default:"m.room.message,m.sticker,m.reaction"`
 	FrequencyFilterRateLimit                 *float64  `json:"frequency_filter_rate_limit,omitempty" envconfig:"frequency_filter_rate_limit" default:"0"`
+	FrequencyFilterRoomRateLimit             *float64  `json:"frequency_filter_room_rate_limit,omitempty" envconfig:"frequency_filter_room_rate_limit" default:"0"`
+	FrequencyFilterOriginRateLimit           *float64  `json:"frequency_filter_origin_rate_limit,omitempty" envconfig:"frequency_filter_origin_rate_limit" default:"0"`
+	NearDuplicateFilterMaxSenders            *int      `json:"near_duplicate_filter_max_senders,omitempty" envconfig:"near_duplicate_filter_max_senders" default:"0"`
+	NearDuplicateFilterMaxRooms              *int      `json:"near_duplicate_filter_max_rooms,omitempty" envconfig:"near_duplicate_filter_max_rooms" default:"0"`
+	NearDuplicateFilterWindowSeconds         *int      `json:"near_duplicate_filter_window_seconds,omitempty" envconfig:"near_duplicate_filter_window_seconds" default:"300"`
+	NearDuplicateFilterMaxDistance           *int      `json:"near_duplicate_filter_max_distance,omitempty" envconfig:"near_duplicate_filter_max_distance" default:"10"`
+	NearDuplicateFilterMinLength             *int      `json:"near_duplicate_filter_min_length,omitempty" envconfig:"near_duplicate_filter_min_length" default:"20"`
+	ModeratorBlocklistFilterMinutes          *int      `json:"moderator_blocklist_filter_minutes,omitempty" envconfig:"moderator_blocklist_filter_minutes" default:"0"`
+	ModeratorBlocklistFilterMaxDistance      *int      `json:"moderator_blocklist_filter_max_distance,omitempty" envconfig:"moderator_blocklist_filter_max_distance" default:"6"`
+	ModeratorBlocklistFilterMinLength        *int      `json:"moderator_blocklist_filter_min_length,omitempty" envconfig:"moderator_blocklist_filter_min_length" default:"20"`
+	ImpersonationFilterEnabled               *bool     `json:"impersonation_filter_enabled,omitempty" envconfig:"impersonation_filter_enabled" default:"false"`
+	ImpersonationFilterCheckAvatars          *bool     `json:"impersonation_filter_check_avatars,omitempty" envconfig:"impersonation_filter_check_avatars" default:"true"`
+	ImpersonationFilterProtectedUserGlobs    *[]string `json:"impersonation_filter_protected_user_globs,omitempty" envconfig:"impersonation_filter_protected_user_globs" default:""`
+	RaidPrefilterRoomJoinsPerMinute          *int      `json:"raid_prefilter_room_joins_per_minute,omitempty" envconfig:"raid_prefilter_room_joins_per_minute" default:"0"`
+	RaidPrefilterCommunityJoinsPerMinute     *int      `json:"raid_prefilter_community_joins_per_minute,omitempty" envconfig:"raid_prefilter_community_joins_per_minute" default:"0"`
+	RaidPrefilterMinutes                     *int      `json:"raid_prefilter_minutes,omitempty" envconfig:"raid_prefilter_minutes" default:"30"`
+	RaidPrefilterLockdownUntrusted           *bool     `json:"raid_prefilter_lockdown_untrusted,omitempty" envconfig:"raid_prefilter_lockdown_untrusted" default:"true"`
+	RaidPrefilterTrustedUserGlobs            *[]string `json:"raid_prefilter_trusted_user_globs,omitempty" envconfig:"raid_prefilter_trusted_user_globs" default:""`
 	ModerationBotUserId                      *string   `json:"moderation_bot_user_id,omitempty" envconfig:"moderation_bot_user_id" default:""`
 	UserIdContainsWordsFilterMaxWords        *int      `json:"user_id_contains_words_filter_max_words,omitempty" envconfig:"user_id_contains_words_filter_max_words" default:"0"`
 	UserIdLengthFilterMaxLength              *int      `json:"user_id_length_filter_max_length,omitempty" envconfig:"user_id_length_filter_max_length" default:"0"`
 	InlineEmojiSizeFilterMaxHeightPixels     *int      `json:"inline_emoji_size_filter_max_height_pixels,omitempty" envconfig:"inline_emoji_size_filter_max_height_pixels" default:"32"`
+	TextNormalizationFilterNames             *[]string `json:"text_normalization_filter_names,omitempty" envconfig:"text_normalization_filter_names" default:""`
+	ShadowFilterNames                        *[]string `json:"shadow_filter_names,omitempty" envconfig:"shadow_filter_names" default:""`
+	ShadowModeEnabled                        *bool     `json:"shadow_mode_enabled,omitempty" envconfig:"shadow_mode_enabled" default:"false"`
+
+	// FilterPipeline is only configurable per-community (not through environment variables). When nil, the built-in
+	// pipeline is used. See community.Manager for details.
+	FilterPipeline *[]*FilterPipelineGroup `json:"filter_pipeline,omitempty" ignored:"true"`
+	// FilterConditions maps filter names to conditions under which those filters run, regardless of which pipeline
+	// is used. Like FilterPipeline, this is only configurable per-community.
+	FilterConditions *map[string]*FilterCondition `json:"filter_conditions,omitempty" ignored:"true"`
+	// MjolnirFilterPolicyLists are the policy lists the community subscribes to, in addition to the instance's
+	// MjolnirFilterRoomID. Like FilterPipeline, this is only configurable per-community.
+	MjolnirFilterPolicyLists *[]*PolicyList `json:"mjolnir_filter_policy_lists,omitempty" ignored:"true"`
+	// AuditRoomId is the room policyserv sends audit messages to as its own user, in addition to any webhooks. Like
+	// FilterPipeline, this is only configurable per-community because policyserv only accepts invites to these rooms.
+	AuditRoomId *string `json:"audit_room_id,omitempty" ignored:"true"`
+	// OpenAIFilterCategoryThresholds maps moderation categories to the score at or above which the category is flagged.
+	// The environment variable format is `category:score,category:score`.
+	OpenAIFilterCategoryThresholds *map[string]float64 `json:"openai_filter_category_thresholds,omitempty" envconfig:"openai_filter_category_thresholds" default:""`
+	// OpenAIFilterApiKey and OpenAIFilterBaseUrl let communities use their own account or OpenAI-compatible endpoint
+	// for the AI filters. These are only configurable per-community because the instance has its own settings.
+	OpenAIFilterApiKey  *string `json:"openai_filter_api_key,omitempty" ignored:"true"`
+	OpenAIFilterBaseUrl *string `json:"openai_filter_base_url,omitempty" ignored:"true"`
 }
 
 func (c *CommunityConfig) Clone() (*CommunityConfig, error) {
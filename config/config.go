@@ -25,6 +25,9 @@ type InstanceConfig struct {
 	StateCacheMinutes                int      `envconfig:"state_cache_minutes" default:"5"`
 	StateCacheIntervalMinutes        int      `envconfig:"state_cache_interval_minutes" default:"60"`
 	FederationCatchupIntervalSeconds int      `envconfig:"federation_catchup_interval_seconds" default:"15"`
+	SpaceSyncIntervalMinutes         int      `envconfig:"space_sync_interval_minutes" default:"15"`
+	DecisionRetentionDays            int      `envconfig:"decision_retention_days" default:"30"`
+	FrequencyCounterBackend          string   `envconfig:"frequency_counter_backend" default:"pubsub"`
 
 	HomeserverName                   string   `envconfig:"homeserver_name" default:"localhost"`
 	HomeserverSigningKeyPath         string   `envconfig:"homeserver_signing_key_path" default:"./signing.key"`
@@ -34,12 +37,17 @@ type InstanceConfig struct {
 	HomeserverAllowedNetworks        []string `envconfig:"homeserver_allowed_networks" default:"0.0.0.0/0"`
 	HomeserverDeniedNetworks         []string `envconfig:"homeserver_denied_networks" default:"127.0.0.1/8,10.0.0.0/8,172.16.0.0./12,192.168.0.0/16,100.64.0.0/10,169.254.0.0/16,::1/128,fe80::/64,fc00::/7"`
 
-	// Note: the Mjolnir filter can't be configured by communities at the moment
+	// Note: communities can subscribe to additional policy lists, but can't change this one
 	MjolnirFilterRoomID string `envconfig:"mjolnir_filter_room_id" default:""`
 
-	// Note: the OpenAI filter can't be configured by communities at the moment
-	OpenAIApiKey         string   `envconfig:"openai_filter_api_key" default:""`
-	OpenAIAllowedRoomIds []string `envconfig:"openai_filter_allowed_room_ids" default:""`
+	// Note: communities can use their own API key and endpoint for the AI filters, but can only use the instance's API
+	// key outside of the allowed rooms if OpenAIAllowCommunities is set.
+	OpenAIApiKey           string   `envconfig:"openai_filter_api_key" default:""`
+	OpenAIBaseUrl          string   `envconfig:"openai_filter_base_url" default:""`
+	OpenAIAllowedRoomIds   []string `envconfig:"openai_filter_allowed_room_ids" default:""`
+	OpenAIAllowCommunities bool     `envconfig:"openai_filter_allow_communities" default:"false"`
+	OpenAIAllowedDomains   []string `envconfig:"openai_filter_allowed_domains" default:""`
+	OpenAIMaxMediaBytes    int64    `envconfig:"openai_filter_max_media_bytes" default:"4194304"`
 
 	MuninnHallSourceApiUrl string `envconfig:"muninn_hall_source_api_url" default:"https://mau.bot/_matrix/maubot/plugin/muninnbot/member_directory"`
 	MuninnHallSourceApiKey string `envconfig:"muninn_hall_source_api_key" default:""`
@@ -55,8 +63,9 @@ type InstanceConfig struct {
 	ModeratorAccessTokens map[string]string `envconfig:"moderator_access_tokens" default:""`
 	ModerationPoolSize    int               `envconfig:"moderation_pool_size" default:"25"`
 
-	AllowedWebhookDomains []string `envconfig:"allowed_webhook_domains" default:"element.ems.host"`
-	WebhookPoolSize       int      `envconfig:"webhook_pool_size" default:"5"`
+	AllowedWebhookDomains       []string `envconfig:"allowed_webhook_domains" default:"element.ems.host"`
+	WebhookPoolSize             int      `envconfig:"webhook_pool_size" default:"5"`
+	WebhookRetryIntervalSeconds int      `envconfig:"webhook_retry_interval_seconds" default:"30"`
 
 	HMAApiUrl string `envconfig:"hma_api_url" default:""`
 	HMAApiKey string `envconfig:"hma_api_key" default:""`
@@ -0,0 +1,42 @@
+package config
+
+// FilterPipelineGroup - A community-defined group of filters. Groups are executed in order, and all filters within a
+// group are executed concurrently. See filter.SetGroupConfig for details on how groups are run.
+type FilterPipelineGroup struct {
+	// Filters - The filter names to run in this group, like "KeywordFilter".
+	Filters []string `json:"filters"`
+
+	// CheckedContentClasses - The content classes this group runs against. Valid values are "neutral", "allowed", and
+	// "prohibited". If empty, the group only runs against "neutral" content (the typical case for filters).
+	CheckedContentClasses []string `json:"checked_content_classes,omitempty"`
+
+	// Condition - Optional condition which must match for the group's filters to run against an event. If nil, the
+	// group's filters always run.
+	Condition *FilterCondition `json:"condition,omitempty"`
+}
+
+// FilterCondition - Describes a condition under which filters are run. All specified criteria must match for the
+// condition to match. At least one criterion must be specified.
+type FilterCondition struct {
+	// AllOf - If non-empty, all of these conditions must match.
+	AllOf []*FilterCondition `json:"all_of,omitempty"`
+	// AnyOf - If non-empty, at least one of these conditions must match.
+	AnyOf []*FilterCondition `json:"any_of,omitempty"`
+	// Not - If set, this condition must *not* match.
+	Not *FilterCondition `json:"not,omitempty"`
+
+	// RoomIds - If non-empty, the event's room ID must be one of these values.
+	RoomIds []string `json:"room_ids,omitempty"`
+	// InSpaceRoomIds - If non-empty, the event's room must be a child of at least one of these spaces.
+	InSpaceRoomIds []string `json:"in_space_room_ids,omitempty"`
+
+	// SenderGlobs - If non-empty, the sender's user ID must match at least one of these globs.
+	SenderGlobs []string `json:"sender_globs,omitempty"`
+	// SenderServerNames - If non-empty, the sender must be on one of these server names.
+	SenderServerNames []string `json:"sender_server_names,omitempty"`
+	// SenderHasCapability - If set, the sender must be trusted with this capability (like "media").
+	SenderHasCapability string `json:"sender_has_capability,omitempty"`
+	// SenderJoinedWithinMinutes - If greater than zero, the sender must have joined the room less than this many
+	// minutes ago.
+	SenderJoinedWithinMinutes int `json:"sender_joined_within_minutes,omitempty"`
+}
@@ -95,4 +95,7 @@ func TestNewDefaultCommunityConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEqual(t, 100, *cnf.InlineEmojiSizeFilterMaxHeightPixels)
 	assert.NotEqual(t, []string{"spammy spam", "example"}, *cnf.KeywordFilterKeywords)
+
+	// The moderator blocklist filter records content for every event, so it's opt-in
+	assert.Equal(t, 0, *cnf.ModeratorBlocklistFilterMinutes)
 }
@@ -0,0 +1,13 @@
+package config
+
+// PolicyList - A moderation policy list room which a community subscribes to. See the Policy list filter for details.
+type PolicyList struct {
+	// RoomId - The policy list's room ID. policyserv must be joined to the room to learn its rules.
+	RoomId string `json:"room_id"`
+
+	// Harm - The harm to flag matching events with. If empty, the "other" harm is used.
+	Harm string `json:"harm,omitempty"`
+
+	// Recommendations - The rule recommendations to act upon, like "m.ban". If empty, only "m.ban" rules are used.
+	Recommendations []string `json:"recommendations,omitempty"`
+}
@@ -0,0 +1,127 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // register decoder
+	_ "image/jpeg" // register decoder
+	_ "image/png"  // register decoder
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+// pHashSize - The size of the grayscale image the DCT is computed over. Only the lowest 8x8 frequencies are used.
+const pHashSize = 32
+
+// decodeImage - Decodes a GIF, JPEG, or PNG image. Only the first frame of animated images is returned.
+func decodeImage(b []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	return img, err
+}
+
+// pHash - Computes a 64-bit perceptual hash of the image's structure, based on its lowest frequencies. Resized,
+// re-encoded, or slightly recoloured copies of an image produce hashes with a small hashDistance between them.
+func pHash(img image.Image) uint64 {
+	pixels := grayscale(img, pHashSize, pHashSize)
+
+	// 2D DCT-II, computed one dimension at a time. We only need the lowest 8x8 frequencies.
+	cosines := [8][pHashSize]float64{}
+	for u := 0; u < 8; u++ {
+		for x := 0; x < pHashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * pHashSize))
+		}
+	}
+	rows := [pHashSize][8]float64{}
+	for y := 0; y < pHashSize; y++ {
+		for u := 0; u < 8; u++ {
+			for x := 0; x < pHashSize; x++ {
+				rows[y][u] += pixels[y*pHashSize+x] * cosines[u][x]
+			}
+		}
+	}
+	frequencies := make([]float64, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			for y := 0; y < pHashSize; y++ {
+				frequencies[v*8+u] += rows[y][u] * cosines[v][y]
+			}
+		}
+	}
+
+	sorted := slices.Clone(frequencies)
+	slices.Sort(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+	return bitsFrom(func(i int) bool {
+		return frequencies[i] > median
+	})
+}
+
+// dHash - Computes a 64-bit perceptual hash of the image's gradients, by comparing each pixel to its neighbour. This
+// is cheaper than pHash and catches slightly different edits, so the two are typically used together.
+func dHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+	return bitsFrom(func(i int) bool {
+		x := i % 8
+		y := i / 8
+		return pixels[y*9+x+1] > pixels[y*9+x]
+	})
+}
+
+// hashDistance - The number of bits which differ between two perceptual hashes. Zero means the images look the same.
+func hashDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// formatImageHash - Returns the perceptual hash as a fixed-length hex string, suitable for storage.
+func formatImageHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// parseImageHash - Parses a perceptual hash previously returned by formatImageHash.
+func parseImageHash(val string) (uint64, error) {
+	return strconv.ParseUint(val, 16, 64)
+}
+
+// bitsFrom - Builds a 64-bit hash where the first bit (in row-major order) is the most significant bit.
+func bitsFrom(isSet func(i int) bool) uint64 {
+	hash := uint64(0)
+	for i := 0; i < 64; i++ {
+		if isSet(i) {
+			hash |= 1 << (63 - i)
+		}
+	}
+	return hash
+}
+
+// grayscale - Resizes the image to width x height by averaging the source pixels covered by each target pixel, and
+// returns the luminance of each target pixel in row-major order.
+func grayscale(img image.Image, width int, height int) []float64 {
+	bounds := img.Bounds()
+	srcWidth := bounds.Dx()
+	srcHeight := bounds.Dy()
+	pixels := make([]float64, width*height)
+	if srcWidth == 0 || srcHeight == 0 {
+		return pixels
+	}
+
+	for ty := 0; ty < height; ty++ {
+		y0 := ty * srcHeight / height
+		y1 := max((ty+1)*srcHeight/height, y0+1) // upscaled images repeat source pixels
+		for tx := 0; tx < width; tx++ {
+			x0 := tx * srcWidth / width
+			x1 := max((tx+1)*srcWidth/width, x0+1)
+			sum := float64(0)
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					sum += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+				}
+			}
+			pixels[ty*width+tx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return pixels
+}
@@ -0,0 +1,86 @@
+package content
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestImage - Draws a scene at the given size, so the same scene can be drawn at different resolutions.
+func makeTestImage(width int, height int, scene func(x float64, y float64) color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, scene(float64(x)/float64(width), float64(y)/float64(height)))
+		}
+	}
+	return img
+}
+
+func circleScene(x float64, y float64) color.Color {
+	if math.Hypot(x-0.3, y-0.4) < 0.2 {
+		return color.RGBA{R: 220, G: 40, B: 40, A: 255}
+	}
+	if x > 0.6 && y > 0.5 {
+		return color.RGBA{R: 30, G: 30, B: 160, A: 255}
+	}
+	return color.RGBA{R: uint8(255 * x), G: uint8(200 * y), B: 100, A: 255}
+}
+
+func stripeScene(x float64, y float64) color.Color {
+	if int(y*8)%2 == 0 {
+		return color.RGBA{R: 240, G: 240, B: 240, A: 255}
+	}
+	return color.RGBA{R: uint8(80 * x), G: 20, B: 20, A: 255}
+}
+
+func mustEncode(t *testing.T, img image.Image, asJpeg bool) []byte {
+	buf := &bytes.Buffer{}
+	var err error
+	if asJpeg {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 60})
+	} else {
+		err = png.Encode(buf, img)
+	}
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestImageHashes(t *testing.T) {
+	t.Parallel()
+
+	original, err := decodeImage(mustEncode(t, makeTestImage(400, 300, circleScene), false))
+	assert.NoError(t, err)
+	originalPHash := pHash(original)
+	originalDHash := dHash(original)
+
+	// Hashes are stable
+	assert.Equal(t, originalPHash, pHash(original))
+	assert.Equal(t, originalDHash, dHash(original))
+
+	// Resized and re-encoded copies are close
+	for _, copied := range []image.Image{
+		makeTestImage(150, 110, circleScene),
+		makeTestImage(64, 48, circleScene), // thumbnail sized
+	} {
+		decoded, err := decodeImage(mustEncode(t, copied, true))
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, hashDistance(originalPHash, pHash(decoded)), 10)
+		assert.LessOrEqual(t, hashDistance(originalDHash, dHash(decoded)), 10)
+	}
+
+	// Different images are far away
+	different := makeTestImage(400, 300, stripeScene)
+	assert.Greater(t, hashDistance(originalPHash, pHash(different)), 16)
+	assert.Greater(t, hashDistance(originalDHash, dHash(different)), 16)
+
+	// Things which aren't images can't be hashed
+	_, err = decodeImage([]byte("not an image"))
+	assert.Error(t, err)
+}
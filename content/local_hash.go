@@ -0,0 +1,94 @@
+package content
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"slices"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// MediaHashes - The hashes of a piece of media, by kind. Perceptual hashes are only computed for images which can be
+// decoded.
+type MediaHashes map[storage.MediaHashKind]string
+
+// HashMedia - Computes the SHA-256 hash of the media, and the perceptual hashes if the media is an image.
+func HashMedia(content []byte) MediaHashes {
+	sum := sha256.Sum256(content)
+	hashes := MediaHashes{
+		storage.MediaHashKindSha256: hex.EncodeToString(sum[:]),
+	}
+	img, err := decodeImage(content)
+	if err == nil {
+		hashes[storage.MediaHashKindPHash] = formatImageHash(pHash(img))
+		hashes[storage.MediaHashKindDHash] = formatImageHash(dHash(img))
+	}
+	return hashes
+}
+
+// LocalHashScanner - Matches media against the community's own hash banks, without needing an external service like
+// HMA. Identical files are matched by SHA-256, and images which have been resized or re-encoded are matched by
+// perceptual hash.
+type LocalHashScanner struct {
+	storage          storage.PersistentStorage
+	communityId      string
+	enabledBankNames []string
+	maxDistance      int
+}
+
+func NewLocalHashScanner(storage storage.PersistentStorage, communityId string, enabledBankNames []string, maxDistance int) (*LocalHashScanner, error) {
+	return &LocalHashScanner{
+		storage:          storage,
+		communityId:      communityId,
+		enabledBankNames: enabledBankNames,
+		maxDistance:      maxDistance,
+	}, nil
+}
+
+func (s *LocalHashScanner) Scan(ctx context.Context, contentType Type, content []byte) (*harms.ContentInfo, error) {
+	// Media scan results are cached, so we don't bother keeping the banks in memory
+	banked, err := s.storage.GetMediaHashes(ctx, s.communityId)
+	if err != nil {
+		return nil, err
+	}
+	if len(banked) == 0 {
+		return harms.NeutralContent(), nil // don't bother hashing
+	}
+
+	hashes := HashMedia(content)
+	for _, b := range banked {
+		if !slices.Contains(s.enabledBankNames, b.Bank) {
+			continue
+		}
+		if s.matches(hashes, b) {
+			log.Printf("Media (%s) matched %s hash in bank %s for community %s", contentType, b.Kind, b.Bank, s.communityId)
+			return harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia), nil
+		}
+	}
+	return harms.NeutralContent(), nil
+}
+
+func (s *LocalHashScanner) matches(hashes MediaHashes, banked *storage.StoredMediaHash) bool {
+	hash, ok := hashes[banked.Kind]
+	if !ok {
+		return false // not an image, probably
+	}
+	if banked.Kind == storage.MediaHashKindSha256 {
+		return hash == banked.Value
+	}
+
+	a, err := parseImageHash(hash)
+	if err != nil {
+		log.Printf("Error parsing computed %s hash %s: %s", banked.Kind, hash, err)
+		return false
+	}
+	b, err := parseImageHash(banked.Value)
+	if err != nil {
+		log.Printf("Error parsing banked %s hash %s in bank %s for community %s: %s", banked.Kind, banked.Value, banked.Bank, s.communityId, err)
+		return false
+	}
+	return hashDistance(a, b) <= s.maxDistance
+}
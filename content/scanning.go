@@ -9,3 +9,29 @@ import (
 type Scanner interface {
 	Scan(ctx context.Context, contentType Type, content []byte) (*harms.ContentInfo, error)
 }
+
+// MultiScanner - Runs content through several scanners, returning the most severe result with the harms from every
+// scanner combined.
+type MultiScanner struct {
+	scanners []Scanner
+}
+
+func NewMultiScanner(scanners ...Scanner) *MultiScanner {
+	return &MultiScanner{scanners: scanners}
+}
+
+func (s *MultiScanner) Scan(ctx context.Context, contentType Type, content []byte) (*harms.ContentInfo, error) {
+	contentClass := harms.ContentClassNeutral
+	harmIds := make([]harms.Harm, 0)
+	for _, scanner := range s.scanners {
+		res, err := scanner.Scan(ctx, contentType, content)
+		if err != nil {
+			return nil, err
+		}
+		if contentClass < res.Class() {
+			contentClass = res.Class()
+		}
+		harmIds = append(harmIds, res.Harms()...)
+	}
+	return harms.NewContentInfo(contentClass, harmIds...), nil
+}
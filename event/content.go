@@ -0,0 +1,368 @@
+package event
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"golang.org/x/net/html"
+)
+
+// Content - The parts of an event a client may render, as returned by ExtractContent.
+type Content struct {
+	// Texts - The plain text a client may render, like message bodies, file names, and poll answers.
+	Texts []string
+	// Html - The HTML a client may render, like `formatted_body`.
+	Html []string
+	// Quoted - The reply fallbacks removed from the start of reply bodies. The quote can't be checked against the event
+	// being replied to, and clients without reply support still render it.
+	Quoted []string
+	// MediaUrls - The media a client may render, like an image's `url` and its thumbnail, inline images, avatars, and
+	// custom emoji. The URLs are not validated, and may not be MXC URIs.
+	MediaUrls []string
+}
+
+// PlainText - Returns all of the plain text, one per line.
+func (c *Content) PlainText() string {
+	return strings.Join(c.Texts, "\n")
+}
+
+// AllText - Returns all of the plain text followed by all of the HTML and reply fallbacks, one per line. This is useful
+// for filters which search for words or links rather than caring about the structure of the text.
+func (c *Content) AllText() string {
+	return strings.Join(slices.Concat(c.Texts, c.Html, c.Quoted), "\n")
+}
+
+// HasText - Returns true if there is any plain text, HTML, or reply fallback.
+func (c *Content) HasText() bool {
+	return len(c.Texts) > 0 || len(c.Html) > 0 || len(c.Quoted) > 0
+}
+
+// contentFields - The fields of a JSON object in an event's content. Each field is decoded on its own, and fields with
+// the wrong type are treated as missing, so one bad field doesn't stop the rest of the content from being extracted.
+// Clients typically ignore fields they can't use, so the other fields will still be rendered.
+type contentFields map[string]json.RawMessage
+
+// parseFields - Returns the fields of the JSON object. Anything other than an object has no fields.
+func parseFields(raw json.RawMessage) contentFields {
+	fields := make(contentFields)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return make(contentFields)
+	}
+	return fields
+}
+
+// has - Returns true if the field is present and not null.
+func (f contentFields) has(key string) bool {
+	raw, ok := f[key]
+	return ok && string(raw) != "null"
+}
+
+// string - Returns the field as a string, or an empty string if it's missing or not a string.
+func (f contentFields) string(key string) string {
+	val := ""
+	if err := json.Unmarshal(f[key], &val); err != nil {
+		return ""
+	}
+	return val
+}
+
+// object - Returns the fields of the field, or no fields if it's missing or not an object.
+func (f contentFields) object(key string) contentFields {
+	return parseFields(f[key])
+}
+
+// array - Returns the items of the field, or nil if it's missing or not an array.
+func (f contentFields) array(key string) []json.RawMessage {
+	items := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(f[key], &items); err != nil {
+		return nil
+	}
+	return items
+}
+
+type textBlock struct {
+	Body     string
+	Mimetype string
+}
+
+// textBlocks - An extensible events text content block. Early versions of MSC1767 used a string rather than an array,
+// so both are accepted.
+type textBlocks []textBlock
+
+func parseTextBlocks(raw json.RawMessage) textBlocks {
+	str := ""
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return textBlocks{{Body: str}}
+	}
+	items := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+	blocks := make(textBlocks, 0, len(items))
+	for _, item := range items {
+		block := parseFields(item)
+		blocks = append(blocks, textBlock{Body: block.string("body"), Mimetype: block.string("mimetype")})
+	}
+	return blocks
+}
+
+// extensibleContent - The content blocks which carry text in extensible events (MSC1767), including the unstable
+// prefixes which are still sent by some clients.
+type extensibleContent struct {
+	Text          textBlocks
+	LegacyText    string
+	LegacyHtml    string
+	LegacyMessage textBlocks
+}
+
+func parseExtensibleContent(fields contentFields) extensibleContent {
+	return extensibleContent{
+		Text:          parseTextBlocks(fields["m.text"]),
+		LegacyText:    fields.string("org.matrix.msc1767.text"),
+		LegacyHtml:    fields.string("org.matrix.msc1767.html"),
+		LegacyMessage: parseTextBlocks(fields["org.matrix.msc1767.message"]),
+	}
+}
+
+// pollContent - The poll content block of a poll start event (MSC3381).
+type pollContent struct {
+	Question extensibleContent
+	Answers  []extensibleContent
+}
+
+// parsePollContent - Returns the poll content block, or nil if the field is missing.
+func parsePollContent(fields contentFields, key string) *pollContent {
+	if !fields.has(key) {
+		return nil
+	}
+	poll := fields.object(key)
+	content := &pollContent{
+		Question: parseExtensibleContent(poll.object("question")),
+		Answers:  make([]extensibleContent, 0),
+	}
+	for _, answer := range poll.array("answers") {
+		content.Answers = append(content.Answers, parseExtensibleContent(parseFields(answer)))
+	}
+	return content
+}
+
+type messageContent struct {
+	extensibleContent
+
+	Body             string
+	FormattedBody    string
+	Filename         string
+	Url              string
+	FileUrl          string // `file.url`, used in place of `url` by encrypted media
+	AvatarUrl        string
+	ThumbnailUrl     string // `info.thumbnail_url`
+	ThumbnailFileUrl string // `info.thumbnail_file.url`, used in place of `info.thumbnail_url` by encrypted media
+
+	Poll       *pollContent
+	LegacyPoll *pollContent
+	NewContent *messageContent // only set if `m.new_content` is present
+	RelType    string          // `m.relates_to.rel_type`
+	Key        string          // `m.relates_to.key`
+	IsReply    bool            // whether `m.relates_to.m.in_reply_to` is present
+}
+
+func parseMessageContent(fields contentFields) *messageContent {
+	info := fields.object("info")
+	relatesTo := fields.object("m.relates_to")
+	content := &messageContent{
+		extensibleContent: parseExtensibleContent(fields),
+
+		Body:             fields.string("body"),
+		FormattedBody:    fields.string("formatted_body"),
+		Filename:         fields.string("filename"),
+		Url:              fields.string("url"),
+		FileUrl:          fields.object("file").string("url"),
+		AvatarUrl:        fields.string("avatar_url"),
+		ThumbnailUrl:     info.string("thumbnail_url"),
+		ThumbnailFileUrl: info.object("thumbnail_file").string("url"),
+
+		Poll:       parsePollContent(fields, "m.poll"),
+		LegacyPoll: parsePollContent(fields, "org.matrix.msc3381.poll.start"),
+		RelType:    relatesTo.string("rel_type"),
+		Key:        relatesTo.string("key"),
+		IsReply:    relatesTo.has("m.in_reply_to"),
+	}
+	if fields.has("m.new_content") {
+		content.NewContent = parseMessageContent(fields.object("m.new_content"))
+	}
+	return content
+}
+
+// ExtractContent - Returns the text, HTML, and media a client may render for the event, so filters can check what
+// users will actually see. This covers edits (`m.new_content`), replies, polls, stickers, file captions, reactions, and
+// extensible events. Reply fallbacks are moved to Quoted because they quote another event rather than being written by
+// the sender. Only media is extracted from state events, like avatars and image packs.
+//
+// Fields with the wrong type are skipped rather than failing the whole extraction, so a sender can't hide the rest of
+// the content from filters by breaking one field.
+func ExtractContent(event gomatrixserverlib.PDU) *Content {
+	fields := parseFields(event.Content())
+	raw := parseMessageContent(fields)
+
+	c := &Content{
+		Texts:     make([]string, 0),
+		Html:      make([]string, 0),
+		Quoted:    make([]string, 0),
+		MediaUrls: make([]string, 0),
+	}
+	isState := event.StateKey() != nil
+	if raw.RelType == "m.replace" && raw.NewContent != nil {
+		// Clients which support edits render the new content instead, so it goes first. The edit's own content is a
+		// fallback for other clients, and is usually the same text prefixed with an asterisk.
+		c.addMessage(event.Type(), raw.NewContent, isState)
+		raw.Body = strings.TrimPrefix(raw.Body, "* ")
+		raw.FormattedBody = strings.TrimPrefix(raw.FormattedBody, "* ")
+	}
+	if raw.IsReply && (event.Type() == "m.room.message" || event.Type() == "m.sticker") {
+		var quoted string
+		raw.Body, quoted = splitReplyFallback(raw.Body)
+		if quoted != "" {
+			c.Quoted = append(c.Quoted, quoted)
+		}
+	}
+	c.addMessage(event.Type(), raw, isState)
+	if event.Type() == "m.reaction" && !isState {
+		c.addTexts(raw.Key)
+	}
+	if event.Type() == "im.ponies.room_emotes" && isState {
+		// The image pack content (MSC2545), which holds custom emoji and stickers
+		c.addMediaUrls(fields.object("pack").string("avatar_url"))
+		images := fields.object("images")
+		// Sort the shortcodes so the order is stable
+		for _, shortcode := range slices.Sorted(maps.Keys(images)) {
+			c.addMediaUrls(images.object(shortcode).string("url"))
+		}
+	}
+	return c
+}
+
+func (c *Content) addMessage(eventType string, content *messageContent, isState bool) {
+	c.addMediaUrls(content.Url, content.FileUrl, content.ThumbnailUrl, content.ThumbnailFileUrl)
+	if isState {
+		if eventType == "m.room.member" {
+			c.addMediaUrls(content.AvatarUrl)
+		}
+		return
+	}
+
+	// Only the event types defined by the spec use `body` and friends, other event types need to use extensible events
+	if eventType == "m.room.message" || eventType == "m.sticker" {
+		// For files, the body is the caption if there's also a file name
+		c.addTexts(content.Body, content.Filename)
+		c.addHtml(stripHtmlReplyFallback(content.FormattedBody))
+	}
+	c.addExtensible(&content.extensibleContent)
+	for _, poll := range []*pollContent{content.Poll, content.LegacyPoll} {
+		if poll == nil {
+			continue
+		}
+		c.addExtensible(&poll.Question)
+		for i := range poll.Answers {
+			c.addExtensible(&poll.Answers[i])
+		}
+	}
+}
+
+func (c *Content) addExtensible(content *extensibleContent) {
+	c.addTexts(content.LegacyText)
+	c.addHtml(content.LegacyHtml)
+	for _, block := range slices.Concat(content.Text, content.LegacyMessage) {
+		if block.Mimetype == "text/html" {
+			c.addHtml(block.Body)
+		} else {
+			c.addTexts(block.Body) // plain text is the default
+		}
+	}
+}
+
+// addTexts, addHtml, and addMediaUrls skip empty and duplicate values, as many of the fields are fallbacks for each
+// other and will often be the same.
+
+func (c *Content) addTexts(texts ...string) {
+	for _, text := range texts {
+		if text != "" && !slices.Contains(c.Texts, text) {
+			c.Texts = append(c.Texts, text)
+		}
+	}
+}
+
+func (c *Content) addHtml(html string) {
+	if html != "" && !slices.Contains(c.Html, html) {
+		c.Html = append(c.Html, html)
+		c.addMediaUrls(imageUrls(html)...) // inline images and custom emoji
+	}
+}
+
+func (c *Content) addMediaUrls(urls ...string) {
+	for _, url := range urls {
+		if url != "" && !slices.Contains(c.MediaUrls, url) {
+			c.MediaUrls = append(c.MediaUrls, url)
+		}
+	}
+}
+
+// splitReplyFallback - Separates the quoted lines (and the blank line after them) which clients put at the start of a
+// reply's body from the rest of the body. Fallbacks always start by quoting the replied-to event's sender, like
+// `> <@alice:example.org> hello`, so bodies which merely start with a quote are left alone.
+func splitReplyFallback(body string) (string, string) {
+	if !strings.HasPrefix(body, "> <@") {
+		return body, ""
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && (strings.HasPrefix(lines[i], "> ") || lines[i] == ">") {
+		i++
+	}
+	quoted := strings.Join(lines[:i], "\n")
+	if i < len(lines) && lines[i] == "" {
+		i++
+	}
+	return strings.Join(lines[i:], "\n"), quoted
+}
+
+// stripHtmlReplyFallback - Removes the `<mx-reply>` block which clients put at the start of a reply's formatted body.
+// Clients don't render the block, so it's removed even if the event isn't a reply.
+func stripHtmlReplyFallback(html string) string {
+	start := strings.Index(html, "<mx-reply>")
+	end := strings.Index(html, "</mx-reply>")
+	if start < 0 || end < start {
+		return html
+	}
+	return html[:start] + html[end+len("</mx-reply>"):]
+}
+
+// imageUrls - Returns the MXC URIs of the `<img>` tags in the HTML. Clients only render images from MXC URIs, so other
+// URLs are skipped.
+func imageUrls(text string) []string {
+	urls := make([]string, 0)
+	tokenizer := html.NewTokenizer(strings.NewReader(text))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// This is usually io.EOF, but if it isn't we still return what we found so far
+			return urls
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttrs := tokenizer.TagName()
+		if string(name) != "img" {
+			continue
+		}
+		for hasAttrs {
+			var key, val []byte
+			key, val, hasAttrs = tokenizer.TagAttr()
+			if strings.ToLower(string(key)) == "src" && strings.HasPrefix(string(val), "mxc://") {
+				urls = append(urls, string(val))
+			}
+		}
+	}
+}
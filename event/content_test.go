@@ -0,0 +1,468 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractContent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		TestName  string
+		EventType string
+		StateKey  *string
+		Content   map[string]any
+		Texts     []string
+		Html      []string
+		Quoted    []string
+		MediaUrls []string
+	}{
+		{
+			TestName:  "text message",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":        "m.text",
+				"body":           "hello world",
+				"format":         "org.matrix.custom.html",
+				"formatted_body": "<b>hello world</b>",
+			},
+			Texts: []string{"hello world"},
+			Html:  []string{"<b>hello world</b>"},
+		},
+		{
+			TestName:  "edit",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype": "m.text",
+				"body":    "* hello world",
+				"m.new_content": map[string]any{
+					"msgtype":        "m.text",
+					"body":           "buy my stuff",
+					"formatted_body": "<a href=\"https://example.org\">buy my stuff</a>",
+				},
+				"m.relates_to": map[string]any{"rel_type": "m.replace", "event_id": "$original"},
+			},
+			Texts: []string{"buy my stuff", "hello world"}, // the new content first, then the fallback
+			Html:  []string{"<a href=\"https://example.org\">buy my stuff</a>"},
+		},
+		{
+			TestName:  "edit with the same fallback",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":       "m.text",
+				"body":          "* hello world",
+				"m.new_content": map[string]any{"msgtype": "m.text", "body": "hello world"},
+				"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": "$original"},
+			},
+			Texts: []string{"hello world"},
+		},
+		{
+			TestName:  "new content without an edit relation",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":       "m.text",
+				"body":          "hello world",
+				"m.new_content": map[string]any{"msgtype": "m.text", "body": "not rendered"},
+			},
+			Texts: []string{"hello world"},
+		},
+		{
+			TestName:  "reply",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":        "m.text",
+				"body":           "> <@alice:example.org> first line\n> second line\n\nthe reply",
+				"format":         "org.matrix.custom.html",
+				"formatted_body": "<mx-reply><blockquote>first line<br>second line</blockquote></mx-reply>the <b>reply</b>",
+				"m.relates_to":   map[string]any{"m.in_reply_to": map[string]any{"event_id": "$original"}},
+			},
+			Texts:  []string{"the reply"},
+			Html:   []string{"the <b>reply</b>"},
+			Quoted: []string{"> <@alice:example.org> first line\n> second line"},
+		},
+		{
+			TestName:  "reply which starts with a quote rather than a fallback",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":      "m.text",
+				"body":         "> a quote\n\nmy thoughts",
+				"m.relates_to": map[string]any{"m.in_reply_to": map[string]any{"event_id": "$original"}},
+			},
+			Texts: []string{"> a quote\n\nmy thoughts"},
+		},
+		{
+			TestName:  "quote which isn't a reply",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype": "m.text",
+				"body":    "> a quote\n\nmy thoughts",
+			},
+			Texts: []string{"> a quote\n\nmy thoughts"},
+		},
+		{
+			TestName:  "image with caption",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":  "m.image",
+				"body":     "look at this",
+				"filename": "cat.png",
+				"url":      "mxc://example.org/image",
+				"info":     map[string]any{"thumbnail_url": "mxc://example.org/thumbnail"},
+			},
+			Texts:     []string{"look at this", "cat.png"},
+			MediaUrls: []string{"mxc://example.org/image", "mxc://example.org/thumbnail"},
+		},
+		{
+			TestName:  "edited image",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype": "m.image",
+				"body":    "* cat.png",
+				"url":     "mxc://example.org/image",
+				"m.new_content": map[string]any{
+					"msgtype": "m.image",
+					"body":    "cat.png",
+					"url":     "mxc://example.org/replacement",
+				},
+				"m.relates_to": map[string]any{"rel_type": "m.replace", "event_id": "$original"},
+			},
+			Texts:     []string{"cat.png"},
+			MediaUrls: []string{"mxc://example.org/replacement", "mxc://example.org/image"},
+		},
+		{
+			TestName:  "encrypted image",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype": "m.image",
+				"body":    "cat.png",
+				"file":    map[string]any{"url": "mxc://example.org/image", "v": "v2"},
+				"info":    map[string]any{"thumbnail_file": map[string]any{"url": "mxc://example.org/thumbnail"}},
+			},
+			Texts:     []string{"cat.png"},
+			MediaUrls: []string{"mxc://example.org/image", "mxc://example.org/thumbnail"},
+		},
+		{
+			TestName:  "inline images and custom emoji",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":        "m.text",
+				"body":           "hello :wave:",
+				"format":         "org.matrix.custom.html",
+				"formatted_body": "hello <img data-mx-emoticon src=\"mxc://example.org/wave\" height=\"32\"> <IMG SRC=\"mxc://example.org/image\"/> <img src=\"https://example.org/ignored.png\"> <img src=\"mxc://example.org/wave\">",
+			},
+			Texts:     []string{"hello :wave:"},
+			Html:      []string{"hello <img data-mx-emoticon src=\"mxc://example.org/wave\" height=\"32\"> <IMG SRC=\"mxc://example.org/image\"/> <img src=\"https://example.org/ignored.png\"> <img src=\"mxc://example.org/wave\">"},
+			MediaUrls: []string{"mxc://example.org/wave", "mxc://example.org/image"},
+		},
+		{
+			TestName:  "inline image in a reply fallback",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":        "m.text",
+				"body":           "> <@alice:example.org> look\n\nnice",
+				"format":         "org.matrix.custom.html",
+				"formatted_body": "<mx-reply><blockquote><img src=\"mxc://example.org/quoted\"></blockquote></mx-reply>nice",
+				"m.relates_to":   map[string]any{"m.in_reply_to": map[string]any{"event_id": "$original"}},
+			},
+			Texts:  []string{"nice"},
+			Html:   []string{"nice"},
+			Quoted: []string{"> <@alice:example.org> look"},
+		},
+		{
+			TestName:  "sticker",
+			EventType: "m.sticker",
+			Content: map[string]any{
+				"body": "a waving cat",
+				"url":  "mxc://example.org/sticker",
+			},
+			Texts:     []string{"a waving cat"},
+			MediaUrls: []string{"mxc://example.org/sticker"},
+		},
+		{
+			TestName:  "reaction",
+			EventType: "m.reaction",
+			Content: map[string]any{
+				"m.relates_to": map[string]any{"rel_type": "m.annotation", "event_id": "$original", "key": "💖"},
+			},
+			Texts: []string{"💖"},
+		},
+		{
+			TestName:  "poll",
+			EventType: "m.poll.start",
+			Content: map[string]any{
+				"m.text": []any{map[string]any{"body": "What's your favourite?\n1. Cats\n2. Dogs"}},
+				"m.poll": map[string]any{
+					"kind":           "m.disclosed",
+					"max_selections": 1,
+					"question":       map[string]any{"m.text": []any{map[string]any{"body": "What's your favourite?"}}},
+					"answers": []any{
+						map[string]any{"m.id": "1", "m.text": []any{map[string]any{"body": "Cats"}}},
+						map[string]any{"m.id": "2", "m.text": []any{map[string]any{"body": "Dogs"}}},
+					},
+				},
+			},
+			Texts: []string{"What's your favourite?\n1. Cats\n2. Dogs", "What's your favourite?", "Cats", "Dogs"},
+		},
+		{
+			TestName:  "unstable poll",
+			EventType: "org.matrix.msc3381.poll.start",
+			Content: map[string]any{
+				"org.matrix.msc1767.text": "What's your favourite?\n1. Cats\n2. Dogs",
+				"org.matrix.msc3381.poll.start": map[string]any{
+					"question": map[string]any{"org.matrix.msc1767.text": "What's your favourite?"},
+					"answers": []any{
+						map[string]any{"id": "1", "org.matrix.msc1767.text": "Cats"},
+						map[string]any{"id": "2", "org.matrix.msc1767.text": "Dogs"},
+					},
+				},
+			},
+			Texts: []string{"What's your favourite?\n1. Cats\n2. Dogs", "What's your favourite?", "Cats", "Dogs"},
+		},
+		{
+			TestName:  "extensible event",
+			EventType: "m.message",
+			Content: map[string]any{
+				"m.text": []any{
+					map[string]any{"body": "<b>hello world</b>", "mimetype": "text/html"},
+					map[string]any{"body": "hello world"},
+				},
+			},
+			Texts: []string{"hello world"},
+			Html:  []string{"<b>hello world</b>"},
+		},
+		{
+			TestName:  "unstable extensible event",
+			EventType: "org.example.custom",
+			Content: map[string]any{
+				"m.text":                  "hello world",
+				"org.matrix.msc1767.html": "<b>hello world</b>",
+			},
+			Texts: []string{"hello world"},
+			Html:  []string{"<b>hello world</b>"},
+		},
+		{
+			TestName:  "body on an unknown event type",
+			EventType: "org.example.custom",
+			Content: map[string]any{
+				"body":           "not rendered",
+				"formatted_body": "<b>not rendered</b>",
+			},
+		},
+		{
+			TestName:  "state event",
+			EventType: "m.room.avatar",
+			StateKey:  internal.Pointer(""),
+			Content: map[string]any{
+				"body": "not rendered",
+				"url":  "mxc://example.org/avatar",
+			},
+			MediaUrls: []string{"mxc://example.org/avatar"},
+		},
+		{
+			TestName:  "member avatar",
+			EventType: "m.room.member",
+			StateKey:  internal.Pointer("@alice:example.org"),
+			Content: map[string]any{
+				"membership":  "join",
+				"displayname": "Alice",
+				"avatar_url":  "mxc://example.org/avatar",
+			},
+			MediaUrls: []string{"mxc://example.org/avatar"},
+		},
+		{
+			TestName:  "avatar on a non-member state event",
+			EventType: "org.example.custom",
+			StateKey:  internal.Pointer(""),
+			Content:   map[string]any{"avatar_url": "mxc://example.org/avatar"},
+		},
+		{
+			TestName:  "image pack",
+			EventType: "im.ponies.room_emotes",
+			StateKey:  internal.Pointer("default"),
+			Content: map[string]any{
+				"pack": map[string]any{"display_name": "Cats", "avatar_url": "mxc://example.org/pack"},
+				"images": map[string]any{
+					"wave":  map[string]any{"url": "mxc://example.org/wave", "body": "waving cat"},
+					"smile": map[string]any{"url": "mxc://example.org/smile"},
+					"again": map[string]any{"url": "mxc://example.org/pack"},
+				},
+			},
+			MediaUrls: []string{"mxc://example.org/pack", "mxc://example.org/smile", "mxc://example.org/wave"},
+		},
+		// Fields with the wrong type are skipped, but the rest of the content is still extracted
+		{
+			TestName:  "malformed body",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":        "m.text",
+				"body":           5,
+				"formatted_body": "<b>buy my stuff</b>",
+			},
+			Html: []string{"<b>buy my stuff</b>"},
+		},
+		{
+			TestName:  "malformed file fields",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":  "m.file",
+				"body":     "buy my stuff",
+				"filename": []string{"stuff.txt"},
+				"url":      map[string]any{"mxc": "mxc://example.org/file"},
+				"info":     "not an object",
+				"file":     map[string]any{"url": true},
+			},
+			Texts: []string{"buy my stuff"},
+		},
+		{
+			TestName:  "malformed info",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype": "m.image",
+				"body":    "image.png",
+				"url":     "mxc://example.org/image",
+				"info": map[string]any{
+					"thumbnail_url":  5,
+					"thumbnail_file": map[string]any{"url": "mxc://example.org/thumbnail"},
+				},
+			},
+			Texts:     []string{"image.png"},
+			MediaUrls: []string{"mxc://example.org/image", "mxc://example.org/thumbnail"},
+		},
+		{
+			TestName:  "malformed new content",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":       "m.text",
+				"body":          "* buy my stuff",
+				"m.new_content": "buy my stuff",
+				"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": "$original"},
+			},
+			Texts: []string{"buy my stuff"},
+		},
+		{
+			TestName:  "malformed new content body",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":       "m.text",
+				"body":          "* hello world",
+				"m.new_content": map[string]any{"msgtype": "m.text", "body": 5, "formatted_body": "<b>buy my stuff</b>"},
+				"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": "$original"},
+			},
+			Texts: []string{"hello world"},
+			Html:  []string{"<b>buy my stuff</b>"},
+		},
+		{
+			TestName:  "malformed reaction key",
+			EventType: "m.reaction",
+			Content: map[string]any{
+				"m.relates_to": map[string]any{"rel_type": "m.annotation", "event_id": "$original", "key": 5},
+			},
+		},
+		{
+			TestName:  "malformed relation",
+			EventType: "m.room.message",
+			Content: map[string]any{
+				"msgtype":      "m.text",
+				"body":         "buy my stuff",
+				"m.relates_to": "not an object",
+			},
+			Texts: []string{"buy my stuff"},
+		},
+		{
+			TestName:  "object form extensible text",
+			EventType: "org.example.custom",
+			Content: map[string]any{
+				"m.text":                  map[string]any{"body": "not rendered"},
+				"org.matrix.msc1767.text": "buy my stuff",
+			},
+			Texts: []string{"buy my stuff"},
+		},
+		{
+			TestName:  "malformed extensible text blocks",
+			EventType: "org.example.custom",
+			Content: map[string]any{
+				"m.text": []any{
+					map[string]any{"body": 5},
+					"not a block",
+					map[string]any{"body": "<b>buy my stuff</b>", "mimetype": []string{"text/html"}},
+				},
+			},
+			Texts: []string{"<b>buy my stuff</b>"}, // the mimetype is invalid, so it's treated as plain text
+		},
+		{
+			TestName:  "malformed poll answers",
+			EventType: "m.poll.start",
+			Content: map[string]any{
+				"m.poll": map[string]any{
+					"question": map[string]any{"m.text": []any{map[string]any{"body": "What should I buy?"}}},
+					"answers":  map[string]any{"m.text": "not an array"},
+				},
+			},
+			Texts: []string{"What should I buy?"},
+		},
+		{
+			TestName:  "malformed image pack",
+			EventType: "im.ponies.room_emotes",
+			StateKey:  internal.Pointer("default"),
+			Content: map[string]any{
+				"pack": "not an object",
+				"images": map[string]any{
+					"wave":  map[string]any{"url": 5},
+					"smile": map[string]any{"url": "mxc://example.org/smile"},
+					"bad":   "not an object",
+				},
+			},
+			MediaUrls: []string{"mxc://example.org/smile"},
+		},
+	}
+
+	orEmpty := func(values []string) []string {
+		if values == nil {
+			return make([]string, 0) // ExtractContent never returns nil slices
+		}
+		return values
+	}
+	for _, tc := range testCases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			event := test.MustMakePDU(&test.BaseClientEvent{
+				RoomId:   "!foo:example.org",
+				EventId:  "$test",
+				Type:     tc.EventType,
+				StateKey: tc.StateKey,
+				Sender:   "@alice:example.org",
+				Content:  tc.Content,
+			})
+			content := ExtractContent(event)
+			assert.NotNil(t, content)
+			assert.Equal(t, orEmpty(tc.Texts), content.Texts)
+			assert.Equal(t, orEmpty(tc.Html), content.Html)
+			assert.Equal(t, orEmpty(tc.Quoted), content.Quoted)
+			assert.Equal(t, orEmpty(tc.MediaUrls), content.MediaUrls)
+		})
+	}
+}
+
+func TestContentText(t *testing.T) {
+	t.Parallel()
+
+	content := &Content{
+		Texts:  []string{"hello", "world"},
+		Html:   []string{"<b>hello</b>"},
+		Quoted: []string{"> <@alice:example.org> hi"},
+	}
+	assert.Equal(t, "hello\nworld", content.PlainText()) // reply fallbacks aren't written by the sender
+	assert.Equal(t, "hello\nworld\n<b>hello</b>\n> <@alice:example.org> hi", content.AllText())
+	assert.True(t, content.HasText())
+	assert.Equal(t, []string{"hello", "world"}, content.Texts) // not modified by AllText
+
+	content = &Content{MediaUrls: []string{"mxc://example.org/image"}}
+	assert.Equal(t, "", content.PlainText())
+	assert.Equal(t, "", content.AllText())
+	assert.False(t, content.HasText())
+}
@@ -30,8 +30,7 @@ func TestExtractHtmlRepresentationsNoHtml(t *testing.T) {
 func TestExtractHtmlRepresentationsWrongEventType(t *testing.T) {
 	t.Parallel()
 
-	// This test is temporary until extensible events support exists (at which point we shouldn't be checking types
-	// necessarily)
+	// Only the event types defined by the spec use `formatted_body`. Other event types need to use extensible events.
 
 	event := test.MustMakePDU(&test.BaseClientEvent{
 		RoomId:  "!foo:example.org",
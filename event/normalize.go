@@ -0,0 +1,230 @@
+package event
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Normalization - The steps NormalizeText should apply. Steps can be combined with `|`.
+type Normalization int
+
+const (
+	// NormalizeHtml strips HTML tags (and the contents of script/style tags), keeping the text and unescaping entities.
+	NormalizeHtml Normalization = 1 << iota
+	// NormalizeInvisible removes zero-width, bidi control, variation selector, and other invisible characters.
+	NormalizeInvisible
+	// NormalizeConfusables folds lookalike characters (Cyrillic and Greek homoglyphs, fullwidth and mathematical
+	// letters, etc) to their ASCII equivalents and drops combining marks.
+	NormalizeConfusables
+	// NormalizeLeetspeak replaces digits and symbols used as letters in words, like "fr33 m0ney" -> "free money".
+	NormalizeLeetspeak
+	// NormalizeWhitespace collapses runs of whitespace to a single space and trims the text.
+	NormalizeWhitespace
+
+	// NormalizeAll applies all the steps above.
+	NormalizeAll = NormalizeHtml | NormalizeInvisible | NormalizeConfusables | NormalizeLeetspeak | NormalizeWhitespace
+)
+
+// NormalizeText applies the requested normalization steps to the text so that spammers can't trivially evade
+// text-based filters. Steps are applied in the order they are declared. The returned text is intended for comparison
+// only, and should not be shown to users.
+func NormalizeText(text string, steps Normalization) string {
+	if steps&NormalizeHtml != 0 {
+		text = stripHtml(text)
+	}
+	if steps&NormalizeInvisible != 0 {
+		text = strings.Map(func(r rune) rune {
+			if isInvisible(r) {
+				return -1
+			}
+			return r
+		}, text)
+	}
+	if steps&NormalizeConfusables != 0 {
+		text = strings.Map(foldConfusable, text)
+	}
+	if steps&NormalizeLeetspeak != 0 {
+		text = undoLeetspeak(text)
+	}
+	if steps&NormalizeWhitespace != 0 {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	return text
+}
+
+// htmlBlockTags - Tags which separate the text around them, so get replaced with whitespace instead of being dropped.
+var htmlBlockTags = map[string]bool{
+	"br": true, "p": true, "div": true, "li": true, "tr": true, "td": true, "th": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "ul": true, "ol": true,
+}
+
+func stripHtml(text string) string {
+	b := strings.Builder{}
+	tokenizer := html.NewTokenizer(strings.NewReader(text))
+	skipDepth := 0 // inside <script> or <style>
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if !errors.Is(tokenizer.Err(), io.EOF) {
+				// "Should never happen" because we're reading from a string. Return the text unmodified rather than
+				// risk returning something which doesn't resemble the input.
+				return text
+			}
+			return b.String()
+		}
+		switch tokenType {
+		case html.TextToken:
+			if skipDepth == 0 {
+				b.Write(tokenizer.Text()) // unescapes entities for us
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tagName := string(name)
+			if tagName == "script" || tagName == "style" {
+				if tokenType == html.StartTagToken {
+					skipDepth++
+				} else if tokenType == html.EndTagToken && skipDepth > 0 {
+					skipDepth--
+				}
+			}
+			if htmlBlockTags[tagName] {
+				b.WriteRune(' ')
+			}
+		}
+	}
+}
+
+// invisibleRunes - Invisible characters which aren't covered by the "format" (Cf) Unicode category.
+var invisibleRunes = map[rune]bool{
+	'\u034F': true, // combining grapheme joiner
+	'\u115F': true, // hangul choseong filler
+	'\u1160': true, // hangul jungseong filler
+	'\u17B4': true, // khmer vowel inherent aq
+	'\u17B5': true, // khmer vowel inherent aa
+	'\u2800': true, // braille pattern blank
+	'\u3164': true, // hangul filler
+	'\uFFA0': true, // halfwidth hangul filler
+}
+
+func isInvisible(r rune) bool {
+	if invisibleRunes[r] {
+		return true
+	}
+	if (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF) {
+		return true // variation selectors
+	}
+	// Zero-width spaces/joiners, bidi controls, soft hyphens, tag characters, etc are all "format" characters.
+	return unicode.Is(unicode.Cf, r)
+}
+
+// confusables - Lookalike characters which can't be folded by range. This is not exhaustive, but covers the
+// characters commonly used to evade keyword lists.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'У': 'Y',
+	'Х': 'X', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J', 'Ԛ': 'Q', 'Ԝ': 'W', 'Ү': 'Y', 'Ӏ': 'I',
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y',
+	'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'ӏ': 'l', 'ɡ': 'g', 'һ': 'h',
+	'ѡ': 'w', 'ь': 'b',
+	// Greek
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P',
+	'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin lookalikes
+	'ı': 'i', 'ȷ': 'j', 'ℓ': 'l', 'ß': 's', 'ø': 'o', 'Ø': 'O', 'đ': 'd', 'Đ': 'D', 'ħ': 'h', 'ł': 'l', 'Ł': 'L',
+	// Precomposed letters with diacritics which are commonly used to avoid exact matches
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ù': 'u',
+	'ú': 'u', 'û': 'u', 'ü': 'u', 'ý': 'y', 'ÿ': 'y', 'ñ': 'n', 'ç': 'c',
+	'À': 'A', 'Á': 'A', 'Â': 'A', 'Ã': 'A', 'Ä': 'A', 'Å': 'A', 'È': 'E', 'É': 'E', 'Ê': 'E', 'Ë': 'E',
+	'Ì': 'I', 'Í': 'I', 'Î': 'I', 'Ï': 'I', 'Ò': 'O', 'Ó': 'O', 'Ô': 'O', 'Õ': 'O', 'Ö': 'O', 'Ù': 'U',
+	'Ú': 'U', 'Û': 'U', 'Ü': 'U', 'Ý': 'Y', 'Ñ': 'N', 'Ç': 'C',
+}
+
+func foldConfusable(r rune) rune {
+	if r < 0x80 {
+		return r // fast path: already ASCII
+	}
+	if unicode.Is(unicode.Mn, r) {
+		return -1 // combining marks, like those used in "zalgo" text
+	}
+	if folded, ok := confusables[r]; ok {
+		return folded
+	}
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E: // fullwidth ASCII
+		return r - 0xFEE0
+	case r >= 0x1D400 && r <= 0x1D6A3: // mathematical alphanumeric letters (bold, italic, script, etc)
+		n := (r - 0x1D400) % 52
+		if n < 26 {
+			return 'A' + n
+		}
+		return 'a' + (n - 26)
+	case r >= 0x1D7CE && r <= 0x1D7FF: // mathematical digits
+		return '0' + (r-0x1D7CE)%10
+	case r >= 0x24B6 && r <= 0x24CF: // circled uppercase letters
+		return 'A' + (r - 0x24B6)
+	case r >= 0x24D0 && r <= 0x24E9: // circled lowercase letters
+		return 'a' + (r - 0x24D0)
+	case r >= 0x1F130 && r <= 0x1F149: // squared uppercase letters
+		return 'A' + (r - 0x1F130)
+	case r >= 0x1F150 && r <= 0x1F169: // negative circled uppercase letters
+		return 'A' + (r - 0x1F150)
+	case r >= 0x1F170 && r <= 0x1F189: // negative squared uppercase letters
+		return 'A' + (r - 0x1F170)
+	}
+	return r
+}
+
+var leetDigits = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+}
+
+var leetSymbols = map[rune]rune{
+	'@': 'a', '$': 's',
+}
+
+// undoLeetspeak replaces digits in words which also contain letters, so "fr33" becomes "free" but "2026" is kept. Symbols
+// are only replaced between two letters, so "c@sh" becomes "cash" but "@alice" and "$50" are kept.
+func undoLeetspeak(text string) string {
+	b := strings.Builder{}
+	word := make([]rune, 0)
+	flush := func() {
+		hasLetter := false
+		for _, r := range word {
+			if unicode.IsLetter(r) {
+				hasLetter = true
+				break
+			}
+		}
+		if hasLetter {
+			for i, r := range word {
+				if replacement, ok := leetDigits[r]; ok {
+					word[i] = replacement
+				}
+			}
+			for i, r := range word {
+				replacement, ok := leetSymbols[r]
+				if ok && i > 0 && i < len(word)-1 && unicode.IsLetter(word[i-1]) && unicode.IsLetter(word[i+1]) {
+					word[i] = replacement
+				}
+			}
+		}
+		b.WriteString(string(word))
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			flush()
+			b.WriteRune(r)
+			continue
+		}
+		word = append(word, r)
+	}
+	flush()
+	return b.String()
+}
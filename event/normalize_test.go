@@ -0,0 +1,40 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeText(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		input    string
+		steps    Normalization
+		expected string
+	}{
+		{"no steps", "<b>fr33</b>\u200B  stuff", 0, "<b>fr33</b>\u200B  stuff"},
+		{"html", "<b>spammy</b> <i>sp</i>am<br>next &amp; line<script>alert(1)</script>", NormalizeHtml, "spammy spam next & line"},
+		{"html not really html", "i <3 you", NormalizeHtml, "i <3 you"},
+		{"invisible", "sp\u200Bam\u200Dmy \u202Espam\u202C\u2060 \u00ADhi\uFE0F", NormalizeInvisible, "spammy spam hi"},
+		{"confusables cyrillic", "сраm РАУ", NormalizeConfusables, "cpam PAY"},
+		{"confusables greek", "ΡΟΝΥ", NormalizeConfusables, "PONY"},
+		{"confusables fullwidth", "ｓｐａｍ！", NormalizeConfusables, "spam!"},
+		{"confusables math", "\U0001d42c\U0001d429\U0001d41a\U0001d426 \U0001d7d0", NormalizeConfusables, "spam 2"},
+		{"confusables circled", "ⓢⓟⓐⓜ", NormalizeConfusables, "spam"},
+		{"confusables combining marks", "s\u0336p\u0336a\u0301m\u0308", NormalizeConfusables, "spam"},
+		{"confusables accents", "späm", NormalizeConfusables, "spam"},
+		{"leetspeak", "fr33 m0n3y c@sh", NormalizeLeetspeak, "free money cash"},
+		{"leetspeak numbers", "in 2026 for $50 ask @alice", NormalizeLeetspeak, "in 2026 for $50 ask @alice"},
+		{"whitespace", "  spammy \n\t spam\u3000 ", NormalizeWhitespace, "spammy spam"},
+		{"all", "<p>Fr\u200B3е</p><p>сrуpt0</p>", NormalizeAll, "Free crypto"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.expected, NormalizeText(c.input, c.steps))
+		})
+	}
+}
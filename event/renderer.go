@@ -1,57 +1,40 @@
 package event
 
 import (
-	"encoding/json"
 	"fmt"
 	"slices"
 
 	"github.com/matrix-org/gomatrixserverlib"
 )
 
-type MessageEventContent struct {
-	Body          string `json:"body"`
-	Msgtype       string `json:"msgtype"`
-	FormattedBody string `json:"formatted_body"`
-	//Format string `json:"format"` // we don't really care what the format is
-}
-
-type reactionEventContent struct {
-	RelatesTo struct {
-		Key string `json:"key"`
-		// other fields are part of a relationship, but we aren't concerned about them
-	} `json:"m.relates_to"`
-}
-
+// RenderToText - Renders the event as lines of text describing what the sender said or did, using the content
+// returned by ExtractContent. Returns nil if the event has nothing to render.
 func RenderToText(event gomatrixserverlib.PDU) ([]string, error) {
-	switch event.Type() {
-	case "m.room.message":
-		content := &MessageEventContent{}
-		err := json.Unmarshal(event.Content(), &content)
-		if err != nil {
-			return nil, err
-		}
-		if !slices.Contains([]string{"m.text", "m.notice", "m.emote"}, content.Msgtype) {
-			return nil, nil
-		}
-		prefix := fmt.Sprintf("%s says: ", event.SenderID())
-		if content.Msgtype == "m.emote" {
-			prefix = fmt.Sprintf("%s says: /me ", event.SenderID())
-		}
-		renders := []string{prefix + content.Body}
-		if content.FormattedBody != "" {
-			renders = append(renders, prefix+content.FormattedBody)
+	if event.StateKey() != nil {
+		return nil, nil // not renderable
+	}
+	content := ExtractContent(event)
+	if !content.HasText() {
+		return nil, nil
+	}
+
+	if event.Type() == "m.reaction" {
+		renders := make([]string, 0, len(content.Texts))
+		for _, text := range content.Texts {
+			renders = append(renders, fmt.Sprintf("%s reacted with %s", event.SenderID(), text))
 		}
 		return renders, nil
-	case "m.reaction":
-		content := &reactionEventContent{}
-		err := json.Unmarshal(event.Content(), &content)
-		if err != nil {
-			return nil, err
-		}
-		if content.RelatesTo.Key == "" {
-			return nil, nil
+	}
+
+	prefix := fmt.Sprintf("%s says: ", event.SenderID())
+	if event.Type() == "m.room.message" {
+		if parseFields(event.Content()).string("msgtype") == "m.emote" {
+			prefix = fmt.Sprintf("%s says: /me ", event.SenderID())
 		}
-		return []string{fmt.Sprintf("%s reacted with %s", event.SenderID(), content.RelatesTo.Key)}, nil
 	}
-	return nil, nil // not renderable
+	renders := make([]string, 0, len(content.Texts)+len(content.Html))
+	for _, text := range slices.Concat(content.Texts, content.Html) {
+		renders = append(renders, prefix+text)
+	}
+	return renders, nil
 }
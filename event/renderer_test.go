@@ -215,3 +215,29 @@ func TestRenderEventUnknownType(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []string(nil), render)
 }
+
+func TestRenderEventEdit(t *testing.T) {
+	t.Parallel()
+
+	event := test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:  "!foo:example.org",
+		EventId: "$test",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"body":    "* hello world",
+			"msgtype": "m.text",
+			"m.new_content": map[string]any{
+				"body":    "buy my stuff",
+				"msgtype": "m.text",
+			},
+			"m.relates_to": map[string]any{
+				"rel_type": "m.replace",
+				"event_id": "$test1",
+			},
+		},
+	})
+	render, err := RenderToText(event)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@alice:example.org says: buy my stuff", "@alice:example.org says: hello world"}, render)
+}
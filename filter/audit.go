@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html"
 	"log"
+	"maps"
 	"slices"
 	"sync"
 	"time"
@@ -13,13 +14,16 @@ import (
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/storage"
 )
 
 type auditContext struct {
-	Event           gomatrixserverlib.PDU
-	IsSpam          bool
-	FilterResponses map[string][]string
-	CommunityId     string
+	Event                 gomatrixserverlib.PDU
+	IsSpam                bool
+	IsShadowMode          bool // when true, the community is not acting upon IsSpam
+	FilterResponses       map[string][]string
+	ShadowFilterResponses map[string][]string // responses from filters which did not contribute to IsSpam
+	CommunityId           string
 
 	lock     sync.Mutex // use a lock instead of a sync.Map because sync.Map doesn't support generics (and library support appears lacking in quality)
 	notifier notifiers.MatrixNotifier
@@ -27,12 +31,14 @@ type auditContext struct {
 
 func newAuditContext(notifier notifiers.MatrixNotifier, communityId string, event gomatrixserverlib.PDU) (*auditContext, error) {
 	return &auditContext{
-		Event:           event,
-		FilterResponses: make(map[string][]string),
-		CommunityId:     communityId,
+		Event:                 event,
+		FilterResponses:       make(map[string][]string),
+		ShadowFilterResponses: make(map[string][]string),
+		CommunityId:           communityId,
 
 		// Populated later
-		IsSpam: false,
+		IsSpam:       false,
+		IsShadowMode: false,
 
 		// Internal
 		lock:     sync.Mutex{},
@@ -43,10 +49,64 @@ func newAuditContext(notifier notifiers.MatrixNotifier, communityId string, even
 func (c *auditContext) AppendFilterResponse(filterName string, contentInfo *harms.ContentInfo) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.FilterResponses[filterName] = []string{contentInfo.Class().String()}
+	appendResponse(c.FilterResponses, filterName, contentInfo)
+}
+
+func (c *auditContext) AppendShadowFilterResponse(filterName string, contentInfo *harms.ContentInfo) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	appendResponse(c.ShadowFilterResponses, filterName, contentInfo)
+}
+
+func appendResponse(responses map[string][]string, filterName string, contentInfo *harms.ContentInfo) {
+	responses[filterName] = []string{contentInfo.Class().String()}
 	for _, h := range contentInfo.Harms() {
-		c.FilterResponses[filterName] = append(c.FilterResponses[filterName], string(h))
+		responses[filterName] = append(responses[filterName], string(h))
+	}
+}
+
+// wouldBeSpamByShadowFilters - Returns true if any of the shadowed filters flagged the event as spam. The caller must
+// hold the lock.
+func (c *auditContext) wouldBeSpamByShadowFilters() bool {
+	for _, resp := range c.ShadowFilterResponses {
+		if len(resp) > 0 && resp[0] == harms.ContentClassProhibited.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// ToDecision - Converts the audit context into a decision for the decision log. The filter responses are copied.
+func (c *auditContext) ToDecision(info *harms.ContentInfo, duration time.Duration) *storage.StoredDecision {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return &storage.StoredDecision{
+		EventId:                c.Event.EventID(),
+		CommunityId:            c.CommunityId,
+		RoomId:                 c.Event.RoomID().String(),
+		SenderUserId:           string(c.Event.SenderID()),
+		EventType:              c.Event.Type(),
+		FilterResponses:        maps.Clone(c.FilterResponses),
+		ShadowFilterResponses:  maps.Clone(c.ShadowFilterResponses),
+		ContentInfo:            info,
+		DurationMillis:         duration.Milliseconds(),
+		DecidedTimestampMillis: time.Now().UnixMilli(),
+	}
+}
+
+// WebhookPayloadType - Returns the structured webhook payload type describing the outcome of the check.
+func (c *auditContext) WebhookPayloadType() notifiers.WebhookPayloadType {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.IsSpam && !c.IsShadowMode {
+		return notifiers.WebhookPayloadTypeSpam
 	}
+	if c.IsSpam || c.wouldBeSpamByShadowFilters() {
+		return notifiers.WebhookPayloadTypeShadowSpam
+	}
+	return notifiers.WebhookPayloadTypeNotSpam
 }
 
 func (c *auditContext) Publish() error {
@@ -57,7 +117,8 @@ func (c *auditContext) Publish() error {
 	// have an idea of what happened.
 	log.Printf("[%s | %s | %s] Audit publish: %#v", c.Event.EventID(), c.Event.RoomID(), c.Event.SenderID(), c)
 
-	if !c.IsSpam {
+	wouldBeSpam := c.wouldBeSpamByShadowFilters()
+	if !c.IsSpam && !wouldBeSpam {
 		return nil // nothing to publish
 	}
 
@@ -75,6 +136,11 @@ func (c *auditContext) Publish() error {
 	wasHellban := c.FilterResponses[HellbanPrefilterName] != nil && slices.Contains(c.FilterResponses[HellbanPrefilterName], string(harms.SpamGeneral))
 
 	htmlAudit := "A user has had an event of theirs flagged as spam by policyserv:<br/>"
+	if c.IsSpam && c.IsShadowMode {
+		htmlAudit = "A user has had an event of theirs flagged as spam by policyserv, but the community is in shadow mode. <b>No action was taken.</b><br/>"
+	} else if !c.IsSpam {
+		htmlAudit = "A user's event would have been flagged as spam by policyserv filters in shadow mode. <b>No action was taken.</b><br/>"
+	}
 	htmlAudit += fmt.Sprintf("<b>User ID:</b> <code>%s</code><br/>", html.EscapeString(string(c.Event.SenderID())))
 	escapedRoomId := html.EscapeString(c.Event.RoomID().String())
 	htmlAudit += fmt.Sprintf("<b>Room ID:</b> <code>%s</code> (<a href=\"https://matrix.to/#/%s\">%s</a>)<br/>", escapedRoomId, escapedRoomId, escapedRoomId)
@@ -86,6 +152,13 @@ func (c *auditContext) Publish() error {
 	htmlAudit += fmt.Sprintf("<b>Event timestamp:</b> %s<br/>", c.Event.OriginServerTS().Time().Format(time.RFC1123Z))
 	htmlAudit += fmt.Sprintf("<b>Recorded time:</b> %s<br/>", time.Now().Format(time.RFC1123Z))
 	htmlAudit += fmt.Sprintf("<details><summary>Filter responses (click to expand)</summary><pre><code>%s</code></pre></details>", html.EscapeString(string(respsJson)))
+	if len(c.ShadowFilterResponses) > 0 {
+		shadowRespsJson, err := json.MarshalIndent(c.ShadowFilterResponses, "", "  ")
+		if err != nil {
+			return err // "should never happen"
+		}
+		htmlAudit += fmt.Sprintf("<details><summary>Shadow filter responses (click to expand)</summary><pre><code>%s</code></pre></details>", html.EscapeString(string(shadowRespsJson)))
+	}
 	htmlAudit += fmt.Sprintf("<details><summary>Event content (%d bytes; click to expand)</summary><pre><code>%s</code></pre></details>", len(contentJson), html.EscapeString(contentJson))
 	if wasHellban {
 		htmlAudit += "</details>" // close the details block from earlier
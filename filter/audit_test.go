@@ -0,0 +1,40 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditContextWebhookPayloadType(t *testing.T) {
+	t.Parallel()
+
+	event := test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:  "!foo:example.org",
+		EventId: "$test",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"body": "hello world",
+		},
+	})
+	newCtx := func(isSpam bool, isShadowMode bool, shadowInfo *harms.ContentInfo) *auditContext {
+		c, err := newAuditContext(test.NewMatrixNotifier(t), "test_community", event)
+		assert.NoError(t, err)
+		c.IsSpam = isSpam
+		c.IsShadowMode = isShadowMode
+		if shadowInfo != nil {
+			c.AppendShadowFilterResponse(FixedFilterName, shadowInfo)
+		}
+		return c
+	}
+
+	assert.Equal(t, notifiers.WebhookPayloadTypeSpam, newCtx(true, false, nil).WebhookPayloadType())
+	assert.Equal(t, notifiers.WebhookPayloadTypeShadowSpam, newCtx(true, true, nil).WebhookPayloadType())
+	assert.Equal(t, notifiers.WebhookPayloadTypeShadowSpam, newCtx(false, false, harms.ProhibitedContent(harms.SpamFlooding)).WebhookPayloadType())
+	assert.Equal(t, notifiers.WebhookPayloadTypeNotSpam, newCtx(false, false, harms.NeutralContent()).WebhookPayloadType())
+	assert.Equal(t, notifiers.WebhookPayloadTypeNotSpam, newCtx(false, true, nil).WebhookPayloadType())
+}
@@ -0,0 +1,25 @@
+package condition
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// JoinedWithin - Matches when the sender joined the room less than the given duration ago. Senders which policyserv
+// hasn't seen join the room are assumed to have joined long ago, and don't match.
+func JoinedWithin(db storage.PersistentStorage, duration time.Duration) Condition {
+	return newSimpleCondition(func(ctx context.Context, communityId string, roomId string, senderUserId string) bool {
+		joinedTs, err := db.GetRoomMemberJoinTimestamp(ctx, roomId, senderUserId)
+		if err != nil {
+			log.Printf("[%s | %s] Error getting join timestamp for %s: %s", communityId, roomId, senderUserId, err)
+			return false
+		}
+		if joinedTs <= 0 {
+			return false // not known to be joined
+		}
+		return time.Since(time.UnixMilli(joinedTs)) < duration
+	})
+}
@@ -0,0 +1,27 @@
+package condition
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinedWithin(t *testing.T) {
+	db := test.NewMemoryStorage(t)
+	defer db.Close()
+
+	roomId := "!room:example.org"
+	err := db.InsertRoomMemberJoin(context.Background(), roomId, "@new:example.org", time.Now().Add(-1*time.Minute).UnixMilli())
+	assert.NoError(t, err)
+	err = db.InsertRoomMemberJoin(context.Background(), roomId, "@old:example.org", time.Now().Add(-1*time.Hour).UnixMilli())
+	assert.NoError(t, err)
+
+	c := JoinedWithin(db, 10*time.Minute)
+	assert.True(t, c.Matches(context.Background(), "whatever", roomId, "@new:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", roomId, "@old:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", roomId, "@unknown:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "!other:example.org", "@new:example.org"))
+}
@@ -0,0 +1,22 @@
+package condition
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// RoomInSpace - Matches when the room is a child of the given space. Space children are learned from the space's
+// room state, so policyserv must be protecting the space room itself for this to match.
+func RoomInSpace(db storage.PersistentStorage, spaceRoomId string) Condition {
+	return newSimpleCondition(func(ctx context.Context, communityId string, roomId string, senderUserId string) bool {
+		children, err := db.GetSpaceChildren(ctx, spaceRoomId)
+		if err != nil {
+			log.Printf("[%s | %s] Error getting children of space %s: %s", communityId, roomId, spaceRoomId, err)
+			return false
+		}
+		return slices.Contains(children, roomId)
+	})
+}
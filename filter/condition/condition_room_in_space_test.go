@@ -0,0 +1,24 @@
+package condition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoomInSpace(t *testing.T) {
+	db := test.NewMemoryStorage(t)
+	defer db.Close()
+
+	err := db.SetSpaceChildren(context.Background(), "!space:example.org", []string{"!child:example.org"})
+	assert.NoError(t, err)
+
+	c := RoomInSpace(db, "!space:example.org")
+	assert.True(t, c.Matches(context.Background(), "whatever", "!child:example.org", "whatever"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "!other:example.org", "whatever"))
+
+	c = RoomInSpace(db, "!unknown_space:example.org")
+	assert.False(t, c.Matches(context.Background(), "whatever", "!child:example.org", "whatever"))
+}
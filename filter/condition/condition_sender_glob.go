@@ -0,0 +1,14 @@
+package condition
+
+import (
+	"context"
+
+	"github.com/ryanuber/go-glob"
+)
+
+// SenderGlob - Matches when the sender's user ID matches the glob, like `@*:example.org`.
+func SenderGlob(senderGlob string) Condition {
+	return newSimpleCondition(func(ctx context.Context, communityId string, roomId string, senderUserId string) bool {
+		return glob.Glob(senderGlob, senderUserId)
+	})
+}
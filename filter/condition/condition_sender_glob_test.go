@@ -0,0 +1,18 @@
+package condition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenderGlob(t *testing.T) {
+	c := SenderGlob("@*:example.org")
+	assert.True(t, c.Matches(context.Background(), "whatever", "whatever", "@alice:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "whatever", "@alice:example.com"))
+
+	c = SenderGlob("@alice:example.org")
+	assert.True(t, c.Matches(context.Background(), "whatever", "whatever", "@alice:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "whatever", "@bob:example.org"))
+}
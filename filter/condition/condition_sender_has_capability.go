@@ -0,0 +1,30 @@
+package condition
+
+import (
+	"context"
+	"log"
+
+	"github.com/matrix-org/policyserv/trust"
+)
+
+// SenderHasCapability - Matches when at least one of the trust sources grants the sender the capability in the room,
+// and none deny it. Errors from trust sources are logged and treated as a denial.
+func SenderHasCapability(sources []trust.Source, capability trust.Capability) Condition {
+	return newSimpleCondition(func(ctx context.Context, communityId string, roomId string, senderUserId string) bool {
+		has := false
+		for _, source := range sources {
+			res, err := source.HasCapability(ctx, senderUserId, roomId, capability)
+			if err != nil {
+				log.Printf("[%s | %s] Error checking %T for %s capability on %s: %s", communityId, roomId, source, capability, senderUserId, err)
+				return false
+			}
+			if res == trust.TristateFalse {
+				return false // deny wins
+			}
+			if res == trust.TristateTrue {
+				has = true
+			}
+		}
+		return has
+	})
+}
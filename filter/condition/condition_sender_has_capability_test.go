@@ -0,0 +1,29 @@
+package condition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matrix-org/policyserv/test"
+	"github.com/matrix-org/policyserv/trust"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenderHasCapability(t *testing.T) {
+	db := test.NewMemoryStorage(t)
+	defer db.Close()
+
+	allowAlice, err := trust.NewSelfDirectedSource(db, []string{"@alice:example.org"}, nil)
+	assert.NoError(t, err)
+	denyBob, err := trust.NewSelfDirectedSource(db, []string{"@bob:example.org"}, []string{"@bob:*"})
+	assert.NoError(t, err)
+
+	c := SenderHasCapability([]trust.Source{allowAlice, denyBob}, trust.CapabilityMedia)
+	assert.True(t, c.Matches(context.Background(), "whatever", "!room:example.org", "@alice:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "!room:example.org", "@bob:example.org"))     // denied
+	assert.False(t, c.Matches(context.Background(), "whatever", "!room:example.org", "@charlie:example.org")) // no opinion
+
+	// No sources means nobody has the capability
+	c = SenderHasCapability(nil, trust.CapabilityMedia)
+	assert.False(t, c.Matches(context.Background(), "whatever", "!room:example.org", "@alice:example.org"))
+}
@@ -0,0 +1,20 @@
+package condition
+
+import (
+	"context"
+	"log"
+
+	"github.com/matrix-org/gomatrixserverlib/spec"
+)
+
+// SenderServerName - Matches when the sender's user ID is on the given server name. Invalid user IDs never match.
+func SenderServerName(serverName string) Condition {
+	return newSimpleCondition(func(ctx context.Context, communityId string, roomId string, senderUserId string) bool {
+		userId, err := spec.NewUserID(senderUserId, false)
+		if err != nil {
+			log.Printf("[%s | %s] Failed to parse sender '%s' for server name condition: %s", communityId, roomId, senderUserId, err)
+			return false
+		}
+		return string(userId.Domain()) == serverName
+	})
+}
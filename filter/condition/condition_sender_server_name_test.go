@@ -0,0 +1,16 @@
+package condition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenderServerName(t *testing.T) {
+	c := SenderServerName("example.org")
+	assert.True(t, c.Matches(context.Background(), "whatever", "whatever", "@alice:example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "whatever", "@alice:example.com"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "whatever", "@alice:sub.example.org"))
+	assert.False(t, c.Matches(context.Background(), "whatever", "whatever", "not a user ID"))
+}
@@ -16,13 +16,19 @@ type InstancedAIExecutorFilter[ConfigT any] struct {
 }
 
 func NewInstancedAIExecutorFilter[ConfigT any](name string, set *Set, config ConfigT, aiProvider ai.Provider[ConfigT], inRoomIds []string) InstancedEventFilter {
-	instanced := &InstancedAIExecutorFilter[ConfigT]{
+	instanced := NewUnrestrictedAIExecutorFilter(name, set, config, aiProvider)
+	return NewConditionalFilter(set, instanced, condition.AnyIn(condition.RoomId, inRoomIds))
+}
+
+// NewUnrestrictedAIExecutorFilter - Like NewInstancedAIExecutorFilter, but runs in every room. This is used when the
+// community is paying for (or has been allowed to use) the AI provider itself.
+func NewUnrestrictedAIExecutorFilter[ConfigT any](name string, set *Set, config ConfigT, aiProvider ai.Provider[ConfigT]) *InstancedAIExecutorFilter[ConfigT] {
+	return &InstancedAIExecutorFilter[ConfigT]{
 		name:       name,
 		set:        set,
 		config:     config,
 		aiProvider: aiProvider,
 	}
-	return NewConditionalFilter(set, instanced, condition.AnyIn(condition.RoomId, inRoomIds))
 }
 
 func (f *InstancedAIExecutorFilter[ConfigT]) Name() string {
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"context"
+	"io"
 	"log"
 
 	"github.com/matrix-org/policyserv/filter/condition"
@@ -72,3 +73,11 @@ func (c *ConditionalFilter) CheckText(ctx context.Context, input string) (*harms
 	// We don't have enough information to pass to the condition's Matches function, so run the filter unconditionally.
 	return textFilter.CheckText(ctx, input)
 }
+
+// Close - Implements io.Closer. Closes the downstream filter, if it supports being closed.
+func (c *ConditionalFilter) Close() error {
+	if closable, ok := c.downstream.(io.Closer); ok {
+		return closable.Close()
+	}
+	return nil
+}
@@ -2,11 +2,11 @@ package filter
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"regexp"
 
+	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 )
@@ -27,6 +27,9 @@ func (d *DensityFilter) MakeFor(set *Set) (Instanced, error) {
 		set:              set,
 		maxDensity:       internal.Dereference(set.communityConfig.DensityFilterMaxDensity),
 		minTriggerLength: internal.Dereference(set.communityConfig.DensityFilterMinTriggerLength),
+		// Invisible characters don't take up any space, so shouldn't count towards density. The other steps would
+		// change the amount of whitespace, which is what we're measuring.
+		normalization: set.normalizationFor(DensityFilterName, event.NormalizeInvisible),
 	}, nil
 }
 
@@ -34,6 +37,7 @@ type InstancedDensityFilter struct {
 	set              *Set
 	maxDensity       float64
 	minTriggerLength int
+	normalization    event.Normalization
 }
 
 func (f *InstancedDensityFilter) Name() string {
@@ -44,18 +48,13 @@ func (f *InstancedDensityFilter) CheckEvent(ctx context.Context, input *EventInp
 	eventId := input.Event.EventID()
 	roomId := input.Event.RoomID().String()
 
-	if input.Event.Type() != "m.room.message" {
+	if input.Event.StateKey() != nil {
 		return harms.NeutralContent(), nil
 	}
 
-	content := &bodyOnly{}
-	err := json.Unmarshal(input.Event.Content(), &content)
-	if err != nil {
-		// Probably not a string
-		return nil, err
-	}
+	content := event.ExtractContent(input.Event)
 
-	return f.checkTextWithLogging(ctx, content.Body, fmt.Sprintf("%s | %s", eventId, roomId))
+	return f.checkTextWithLogging(ctx, content.PlainText(), fmt.Sprintf("%s | %s", eventId, roomId))
 }
 
 func (f *InstancedDensityFilter) CheckText(ctx context.Context, text string) (*harms.ContentInfo, error) {
@@ -63,6 +62,7 @@ func (f *InstancedDensityFilter) CheckText(ctx context.Context, text string) (*h
 }
 
 func (f *InstancedDensityFilter) checkTextWithLogging(ctx context.Context, text string, logPrefix string) (*harms.ContentInfo, error) {
+	text = event.NormalizeText(text, f.normalization)
 	if len(text) < f.minTriggerLength {
 		// no-op
 		return harms.NeutralContent(), nil
@@ -80,7 +80,3 @@ func (f *InstancedDensityFilter) checkTextWithLogging(ctx context.Context, text
 
 	return harms.NeutralContent(), nil
 }
-
-type bodyOnly struct {
-	Body string `json:"body"`
-}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/matrix-org/gomatrixserverlib/spec"
 	"github.com/matrix-org/policyserv/frequency"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
@@ -22,24 +23,36 @@ type FrequencyFilter struct {
 }
 
 func (f *FrequencyFilter) MakeFor(set *Set) (Instanced, error) {
-	// The rate limit is set per second over a one minute window, so capture one minute of data.
-	counter, err := frequency.NewCounter(set.pubsub, fmt.Sprintf("ff.%s", set.communityId), 60*time.Second)
+	// The rate limits are set per second over a one minute window, so capture one minute of data.
+	counter, err := frequency.NewCounter(counterBackendFor(set), set.pubsub, fmt.Sprintf("ff.%s", set.communityId), 60*time.Second)
 	if err != nil {
 		return nil, err
 	}
 	return &InstancedFrequencyFilter{
-		set:        set,
-		counter:    counter,
-		eventTypes: internal.Dereference(set.communityConfig.FrequencyFilterEventTypes),
-		rateLimit:  internal.Dereference(set.communityConfig.FrequencyFilterRateLimit),
+		set:             set,
+		counter:         counter,
+		eventTypes:      internal.Dereference(set.communityConfig.FrequencyFilterEventTypes),
+		rateLimit:       internal.Dereference(set.communityConfig.FrequencyFilterRateLimit),
+		roomRateLimit:   internal.Dereference(set.communityConfig.FrequencyFilterRoomRateLimit),
+		originRateLimit: internal.Dereference(set.communityConfig.FrequencyFilterOriginRateLimit),
 	}, nil
 }
 
+// counterBackendFor - Returns the instance's frequency counter backend, if configured.
+func counterBackendFor(set *Set) string {
+	if set.instanceConfig == nil {
+		return "" // use the default
+	}
+	return set.instanceConfig.FrequencyCounterBackend
+}
+
 type InstancedFrequencyFilter struct {
-	set        *Set
-	counter    *frequency.Counter
-	eventTypes []string
-	rateLimit  float64
+	set             *Set
+	counter         frequency.Counter
+	eventTypes      []string
+	rateLimit       float64 // per sender
+	roomRateLimit   float64 // per room
+	originRateLimit float64 // per sender's server
 }
 
 func (f *InstancedFrequencyFilter) Name() string {
@@ -62,20 +75,43 @@ func (f *InstancedFrequencyFilter) CheckEvent(ctx context.Context, input *EventI
 		return harms.NeutralContent(), nil // no opinion
 	}
 
-	// First, increment the counter for this user
-	err := f.counter.Increment(string(input.Event.SenderID()))
-	if err != nil {
-		return nil, errors.Join(fmt.Errorf("failed to increment event count for user %s", input.Event.SenderID()), err)
+	// Each key is counted independently. User IDs, room IDs, and server names can't collide with each other because
+	// of their sigils, so they share a counter.
+	limits := make(map[string]float64)
+	if f.rateLimit > 0 {
+		limits[string(input.Event.SenderID())] = f.rateLimit
+	}
+	if f.roomRateLimit > 0 {
+		limits[input.Event.RoomID().String()] = f.roomRateLimit
+	}
+	if f.originRateLimit > 0 {
+		userId, err := spec.NewUserID(string(input.Event.SenderID()), true)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to parse sender %s", input.Event.SenderID()), err)
+		}
+		limits[string(userId.Domain())] = f.originRateLimit
 	}
 
-	// Then, figure out if they exceed the rate limit (adding 1 to account for the current event)
-	eventsLastMinute, err := f.counter.Get(string(input.Event.SenderID()))
-	if err != nil {
-		return nil, errors.Join(fmt.Errorf("failed to get event count for user %s", input.Event.SenderID()), err)
+	exceeded := false
+	for entity, limit := range limits {
+		// Capture the current value before incrementing, in case the increment is picked up quickly by the counter
+		eventsLastMinute, err := f.counter.Get(entity)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to get event count for %s", entity), err)
+		}
+		err = f.counter.Increment(entity)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to increment event count for %s", entity), err)
+		}
+
+		// Then, figure out if they exceed the rate limit (adding 1 to account for the current event)
+		rate := float64(eventsLastMinute+1) / float64(60)
+		log.Printf("[%s | %s] Rate for %s is %f (limit: %f)", input.Event.EventID(), input.Event.RoomID().String(), entity, rate, limit)
+		if rate > limit {
+			exceeded = true // keep going so the other entities are still counted
+		}
 	}
-	rate := float64(eventsLastMinute+1) / float64(60)
-	log.Printf("[%s | %s] Rate for user %s is %f (limit: %f)", input.Event.EventID(), input.Event.RoomID().String(), input.Event.SenderID(), rate, f.rateLimit)
-	if rate > f.rateLimit {
+	if exceeded {
 		return harms.ProhibitedContent(harms.SpamFlooding), nil
 	}
 	return harms.NeutralContent(), nil
@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/frequency"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/storage"
@@ -79,3 +81,55 @@ func TestFrequencyFilter(t *testing.T) {
 	// Allow the goroutines to settle before concluding the test
 	time.Sleep(100 * time.Millisecond)
 }
+
+func TestFrequencyFilterRoomAndOriginKeys(t *testing.T) {
+	t.Parallel()
+
+	cnf := &SetConfig{
+		CommunityId: storage.NextId(),
+		CommunityConfig: &config.CommunityConfig{
+			FrequencyFilterEventTypes:      &[]string{"m.room.message"},
+			FrequencyFilterRateLimit:       internal.Pointer(0.0),        // disabled
+			FrequencyFilterRoomRateLimit:   internal.Pointer(2.0 / 60.0), // 2 messages per minute
+			FrequencyFilterOriginRateLimit: internal.Pointer(1.0 / 60.0), // 1 message per minute
+		},
+		InstanceConfig: &config.InstanceConfig{
+			FrequencyCounterBackend: frequency.BackendMemory, // avoids needing to wait for the pubsub layer to settle
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{FrequencyFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	makeEvent := func(sender string, roomId string) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  roomId,
+			Type:    "m.room.message",
+			Sender:  sender,
+			Content: map[string]any{
+				"body": "doesn't matter",
+			},
+		})
+	}
+
+	// Different users on the same server are limited together
+	AssertCheckEvent(t, set, makeEvent("@alice:one.example.org", "!room1:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("@bob:one.example.org", "!room2:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+
+	// Different servers in the same room are limited together
+	AssertCheckEvent(t, set, makeEvent("@alice:two.example.org", "!room3:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("@alice:three.example.org", "!room3:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("@alice:four.example.org", "!room3:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+
+	// Unrelated servers and rooms are unaffected
+	AssertCheckEvent(t, set, makeEvent("@alice:five.example.org", "!room4:example.org"), harms.NeutralContent())
+}
@@ -1,22 +1,26 @@
 package filter
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	cache "github.com/Code-Hex/go-generics-cache"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
 )
 
 const HellbanPrefilterName = "HellbanPrefilter"
 const HellbanPostfilterName = "HellbanPostfilter"
 
+// HellbanStrikeResetTime - How long a user must go without being hellbanned before their strikes are reset. Expired
+// hellbans are kept in storage for this long.
+const HellbanStrikeResetTime = 24 * time.Hour
+
 func init() {
 	mustRegister(HellbanPrefilterName, &HellbanPrefilter{})
 	mustRegister(HellbanPostfilterName, &HellbanPostfilter{})
@@ -26,7 +30,7 @@ type HellbanPrefilter struct {
 }
 
 func (h *HellbanPrefilter) MakeFor(set *Set) (Instanced, error) {
-	return newPrefilterHellban(set, time.Duration(internal.Dereference(set.communityConfig.HellbanPostfilterMinutes))*time.Minute)
+	return newPrefilterHellban(set)
 }
 
 type HellbanPostfilter struct {
@@ -42,15 +46,19 @@ type InstancedHellbanFilter struct {
 	// If userIdsCache is set, the instanced filter will run as a prefilter. If it's nil, the filter will be a
 	// postfilter (checks to see if an event is spam so far, then hellbans as needed).
 	userIdsCache *cache.Cache[string, bool] // we don't really use the boolean value, but need to specify it
-	forTime      time.Duration
+
+	// Used by the postfilter only
+	forTime    time.Duration
+	maxForTime time.Duration
 
 	unsubscribeFn func() error
 }
 
-func newPrefilterHellban(set *Set, forTime time.Duration) (*InstancedHellbanFilter, error) {
+func newPrefilterHellban(set *Set) (*InstancedHellbanFilter, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
+	// Subscribe before loading so we don't miss changes which happen in between
 	ch, err := set.pubsub.Subscribe(ctx, pubsub.TopicHellban)
 	if err != nil {
 		return nil, err
@@ -58,15 +66,26 @@ func newPrefilterHellban(set *Set, forTime time.Duration) (*InstancedHellbanFilt
 	f := &InstancedHellbanFilter{
 		set: set,
 		userIdsCache: cache.New[string, bool](
-			cache.WithJanitorInterval[string, bool](forTime),
+			cache.WithJanitorInterval[string, bool](1 * time.Minute),
 		),
-		forTime: forTime,
 		unsubscribeFn: func() error {
 			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 			defer cancel()
 			return set.pubsub.Unsubscribe(ctx, ch)
 		},
 	}
+
+	// Load the hellbans which are already active, so a restart doesn't forget them
+	hellbans, err := set.storage.GetActiveHellbans(ctx, set.communityId)
+	if err != nil {
+		_ = f.unsubscribeFn()
+		return nil, err
+	}
+	for _, hellban := range hellbans {
+		f.cacheHellban(hellban.UserId, hellban)
+	}
+	log.Printf("[%s] Loaded %d active hellbans", set.communityId, len(hellbans))
+
 	go func(ch <-chan string, f *InstancedHellbanFilter) {
 		keepLoop := true
 		for keepLoop {
@@ -85,26 +104,51 @@ func newPrefilterHellban(set *Set, forTime time.Duration) (*InstancedHellbanFilt
 					continue // `for` loop
 				}
 
-				communityId, userId := mustDecodeHellban(encoded)
+				communityId, userId, err := decodeHellbanChange(encoded)
+				if err != nil {
+					log.Printf("Failed to decode hellban change `%s`: %s", encoded, err)
+					continue // `for` loop
+				}
 				if communityId != f.set.communityId {
 					continue // `for` loop
 				}
 
-				// Double check that the user isn't already hellbanned, otherwise we'll effectively permaban
-				// them when they try to resend events too early.
-				if _, ok := f.userIdsCache.Get(userId); !ok {
-					f.userIdsCache.Set(userId, true, cache.WithExpiration(f.forTime))
-					log.Printf("Added hellbanned user '%s' to cache", userId)
+				// The notification only tells us *who* changed, so look up the current state of their hellban
+				ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+				hellban, err := f.set.storage.GetHellban(ctx, communityId, userId)
+				cancel()
+				if err != nil {
+					// We keep the old value rather than dropping it
+					log.Printf("[%s] Non-fatal error reloading hellban for '%s': %s", communityId, userId, err)
+					continue // `for` loop
 				}
+				f.cacheHellban(userId, hellban)
 			}
 		}
 	}(ch, f)
 	return f, nil
 }
 
+// cacheHellban - Updates the prefilter's cache for the user. A nil or expired hellban removes the user from the cache.
+func (f *InstancedHellbanFilter) cacheHellban(userId string, hellban *storage.StoredHellban) {
+	now := time.Now()
+	if hellban == nil || !hellban.IsActive(now) {
+		if _, ok := f.userIdsCache.Get(userId); ok {
+			f.userIdsCache.Delete(userId)
+			log.Printf("Removed hellbanned user '%s' from cache", userId)
+		}
+		return
+	}
+	expiresAt := time.UnixMilli(hellban.ExpiresTimestampMillis)
+	f.userIdsCache.Set(userId, true, cache.WithExpiration(expiresAt.Sub(now)))
+	log.Printf("Added hellbanned user '%s' to cache until %s", userId, expiresAt.Format(time.RFC1123Z))
+}
+
 func newPostfilterHellban(set *Set) (*InstancedHellbanFilter, error) {
 	return &InstancedHellbanFilter{
-		set: set,
+		set:        set,
+		forTime:    time.Duration(internal.Dereference(set.communityConfig.HellbanPostfilterMinutes)) * time.Minute,
+		maxForTime: time.Duration(internal.Dereference(set.communityConfig.HellbanPostfilterMaxMinutes)) * time.Minute,
 	}, nil
 }
 
@@ -133,7 +177,12 @@ func (f *InstancedHellbanFilter) CheckEvent(ctx context.Context, input *EventInp
 		// The community manager/filter set group will only call this filter if the event was prohibited, so we can
 		// safely make the assumption that the event is spammy.
 		log.Printf("[%s | %s | %s] Sender '%s' sent a spammy event", eventId, roomId, mode, senderUserId)
-		err := f.set.pubsub.Publish(ctx, pubsub.TopicHellban, mustEncodeHellban(f.set.communityId, senderUserId))
+		if f.set.IsShadowMode() || f.set.isShadowFilter(mode) {
+			// Hellbans persist beyond this event, so we can't place them when nothing is meant to be acted upon
+			log.Printf("[%s | %s | %s] Not hellbanning '%s' because of shadow mode", eventId, roomId, mode, senderUserId)
+			return harms.ProhibitedContent(harms.SpamFlooding), nil
+		}
+		err := f.hellban(ctx, senderUserId)
 		if err != nil {
 			return nil, err
 		}
@@ -144,6 +193,47 @@ func (f *InstancedHellbanFilter) CheckEvent(ctx context.Context, input *EventInp
 	return harms.NeutralContent(), nil
 }
 
+// hellban - Stores a new hellban for the user, unless they're already hellbanned. Prefilters are notified by the
+// database when a hellban changes.
+func (f *InstancedHellbanFilter) hellban(ctx context.Context, userId string) error {
+	now := time.Now()
+	existing, err := f.set.storage.GetHellban(ctx, f.set.communityId, userId)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.IsActive(now) {
+		// We don't extend active hellbans, otherwise we'll effectively permaban users when they try to resend events
+		// too early.
+		return nil
+	}
+
+	strikes := 1
+	if existing != nil && now.Sub(time.UnixMilli(existing.ExpiresTimestampMillis)) < HellbanStrikeResetTime {
+		strikes = existing.Strikes + 1
+	}
+	hellban := &storage.StoredHellban{
+		CommunityId:            f.set.communityId,
+		UserId:                 userId,
+		ExpiresTimestampMillis: now.Add(hellbanDuration(f.forTime, f.maxForTime, strikes)).UnixMilli(),
+		Strikes:                strikes,
+	}
+	log.Printf("[%s] Hellbanning '%s' until %s (strike %d)", f.set.communityId, userId, time.UnixMilli(hellban.ExpiresTimestampMillis).Format(time.RFC1123Z), strikes)
+	return f.set.storage.UpsertHellban(ctx, hellban)
+}
+
+// hellbanDuration - Returns how long a user with the given number of strikes should be hellbanned for. The duration
+// doubles with each strike, up to maxForTime. If maxForTime is not greater than forTime, the duration doesn't escalate.
+func hellbanDuration(forTime time.Duration, maxForTime time.Duration, strikes int) time.Duration {
+	duration := forTime
+	for i := 1; i < strikes && duration < maxForTime; i++ {
+		duration *= 2
+	}
+	if duration > maxForTime && maxForTime > forTime {
+		duration = maxForTime
+	}
+	return duration
+}
+
 func (f *InstancedHellbanFilter) Close() error {
 	if f.unsubscribeFn == nil {
 		return nil
@@ -153,32 +243,19 @@ func (f *InstancedHellbanFilter) Close() error {
 	return f.unsubscribeFn()
 }
 
-func mustEncodeHellban(communityId string, userId string) string {
-	// We use a CSV so we can extend the values in the future if needed, without having to change the
-	// topic/channel name. It's also slightly more compact than JSON.
-
-	// This is primarily for tests because not all of them set a community ID on their filter sets.
-	if communityId == "" {
-		communityId = "default"
-	}
-
-	buf := bytes.NewBuffer(nil)
-	w := csv.NewWriter(buf)
-	err := w.Write([]string{communityId, userId})
-	if err != nil {
-		panic(err)
-	}
-	w.Flush()
-	return buf.String()
+// hellbanChange - The payload sent over pubsub.TopicHellban by the `ps_hellban_change` trigger.
+type hellbanChange struct {
+	CommunityId string `json:"community_id"`
+	UserId      string `json:"user_id"`
 }
 
-func mustDecodeHellban(value string) (string, string) {
-	row, err := csv.NewReader(strings.NewReader(value)).Read()
-	if err != nil {
-		panic(err)
+func decodeHellbanChange(value string) (string, string, error) {
+	change := hellbanChange{}
+	if err := json.Unmarshal([]byte(value), &change); err != nil {
+		return "", "", err
 	}
-	if len(row) < 2 {
-		panic("hellban decode failed: expected at least two values, got: " + value)
+	if change.CommunityId == "" || change.UserId == "" {
+		return "", "", fmt.Errorf("expected a community ID and user ID, got: %s", value)
 	}
-	return row[0], row[1]
+	return change.CommunityId, change.UserId, nil
 }
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -10,39 +11,36 @@ import (
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/media"
 	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/stretchr/testify/assert"
 )
 
-const fastHellbanPrefilterName = "test_fast_hellban_prefilter"
-
-func init() {
-	mustRegister(fastHellbanPrefilterName, &TestFastHellbanPrefilter{})
-}
-
-type TestFastHellbanPrefilter struct{}
-
-func (t *TestFastHellbanPrefilter) MakeFor(set *Set) (Instanced, error) {
-	return newPrefilterHellban(set, 10*time.Second)
-}
-
 // Dev note: It's important that tests here (and across the filters package generally) use distinct
 // community IDs to avoid interfering with each other.
 
-func TestHellbanPrefilterDoesntEternallyExtend(t *testing.T) {
-	// Here we test that the prefilter doesn't extend the hellban for a user indefinitely
-	// when given multiple notifications to add such a spammy user to the cache.
-	//
-	// We use the special TestFastHellbanPrefilter to keep our test time down - it
-	// is functionally the same as creating the prefilter normally, though without
-	// needing to override the config (like in other tests)
+// mustEncodeHellbanChange - Returns the payload the `ps_hellban_change` trigger would send. The memory storage used by
+// tests doesn't have triggers, so tests need to publish the change themselves.
+func mustEncodeHellbanChange(communityId string, userId string) string {
+	b, err := json.Marshal(hellbanChange{CommunityId: communityId, UserId: userId})
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func TestHellbanPostfilterDoesntEternallyExtend(t *testing.T) {
+	// Here we test that the postfilter doesn't extend the hellban for a user indefinitely when the user
+	// keeps sending spammy events.
 
 	ctx := context.Background()
 	cnf := &SetConfig{
-		CommunityId:     "TestHellbanPrefilterDoesntEternallyExtend",
-		CommunityConfig: &config.CommunityConfig{},
+		CommunityId: "TestHellbanPostfilterDoesntEternallyExtend",
+		CommunityConfig: &config.CommunityConfig{
+			HellbanPostfilterMinutes: internal.Pointer(10),
+		},
 		Groups: []*SetGroupConfig{{
-			EnabledNames:          []string{fastHellbanPrefilterName},
+			EnabledNames:          []string{HellbanPostfilterName},
 			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
 		}},
 	}
@@ -54,24 +52,9 @@ func TestHellbanPrefilterDoesntEternallyExtend(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, set)
 
-	// Publish a bunch of times, a few seconds apart. Because the prefilter will hellban for 10 seconds,
-	// we try to set about 6 seconds worth of notifications. so we can more easily detect if the first
-	// one expires on time.
 	spammerUserId := "@spam:example.org"
-	for range 6 {
-		assert.NoError(t, ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellban(cnf.CommunityId, spammerUserId)))
-		time.Sleep(1 * time.Second)
-	}
-
-	// Now wait a few seconds to ensure the prefilter has had a chance to expire the first notification, but
-	// not so long that the last one (~6 seconds after the first) would also expire.
-	// A few extra seconds are added here to avoid test flakes.
-	time.Sleep(6 * time.Second)
-
-	// Now, the spammer should be able to send an event without being hellbanned.
-
-	neutralEvent1 := test.MustMakePDU(&test.BaseClientEvent{
-		EventId: "$neutral1",
+	spammyEvent1 := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$spam1",
 		RoomId:  "!foo:example.org",
 		Type:    "org.example.event_type_does_not_matter",
 		Sender:  spammerUserId,
@@ -80,7 +63,19 @@ func TestHellbanPrefilterDoesntEternallyExtend(t *testing.T) {
 		},
 	})
 
-	AssertCheckEvent(t, set, neutralEvent1, harms.NeutralContent())
+	AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamFlooding))
+	first, err := memStorage.GetHellban(ctx, cnf.CommunityId, spammerUserId)
+	assert.NoError(t, err)
+	assert.NotNil(t, first)
+
+	// Send a few more spammy events a little while apart. The hellban should be unchanged.
+	for range 3 {
+		time.Sleep(10 * time.Millisecond)
+		AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamFlooding))
+	}
+	last, err := memStorage.GetHellban(ctx, cnf.CommunityId, spammerUserId)
+	assert.NoError(t, err)
+	assert.Equal(t, first, last)
 }
 
 func TestHellbanPrefilter(t *testing.T) {
@@ -106,11 +101,16 @@ func TestHellbanPrefilter(t *testing.T) {
 
 	spammerUserId := "@spam:example.org"
 	neutralUserId := "@neutral:example.org"
-	err = ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellban(cnf.CommunityId, spammerUserId))
+	expires := time.Now().Add(10 * time.Minute).UnixMilli()
+	err = memStorage.UpsertHellban(ctx, &storage.StoredHellban{CommunityId: cnf.CommunityId, UserId: spammerUserId, ExpiresTimestampMillis: expires, Strikes: 1})
+	assert.NoError(t, err)
+	err = ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellbanChange(cnf.CommunityId, spammerUserId))
 	assert.NoError(t, err)
 
-	// While we're here, also test that the prefilter ignores publishes for other communities
-	err = ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellban("unrelated_community", neutralUserId))
+	// While we're here, also test that the prefilter ignores changes for other communities
+	err = memStorage.UpsertHellban(ctx, &storage.StoredHellban{CommunityId: "unrelated_community", UserId: neutralUserId, ExpiresTimestampMillis: expires, Strikes: 1})
+	assert.NoError(t, err)
+	err = ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellbanChange("unrelated_community", neutralUserId))
 	assert.NoError(t, err)
 
 	// This isn't great, but we need to ensure the prefilter has enough time to actually add
@@ -142,14 +142,77 @@ func TestHellbanPrefilter(t *testing.T) {
 
 	AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamFlooding))
 	AssertCheckEvent(t, set, neutralEvent1, harms.NeutralContent())
+
+	// Lifting the hellban should allow the spammer through again
+	err = memStorage.DeleteHellban(ctx, cnf.CommunityId, spammerUserId)
+	assert.NoError(t, err)
+	err = ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellbanChange(cnf.CommunityId, spammerUserId))
+	assert.NoError(t, err)
+	time.Sleep(1 * time.Second) // same as above
+	AssertCheckEvent(t, set, spammyEvent1, harms.NeutralContent())
+}
+
+func TestHellbanPrefilterLoadsStoredHellbans(t *testing.T) {
+	// A newly created prefilter (for example, after a restart) should know about hellbans which were created earlier
+	ctx := context.Background()
+
+	cnf := &SetConfig{
+		CommunityId: "TestHellbanPrefilterLoadsStoredHellbans",
+		CommunityConfig: &config.CommunityConfig{
+			HellbanPostfilterMinutes: internal.Pointer(10),
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{HellbanPrefilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	activeUserId := "@active:example.org"
+	expiredUserId := "@expired:example.org"
+	err := memStorage.UpsertHellban(ctx, &storage.StoredHellban{CommunityId: cnf.CommunityId, UserId: activeUserId, ExpiresTimestampMillis: time.Now().Add(10 * time.Minute).UnixMilli(), Strikes: 1})
+	assert.NoError(t, err)
+	err = memStorage.UpsertHellban(ctx, &storage.StoredHellban{CommunityId: cnf.CommunityId, UserId: expiredUserId, ExpiresTimestampMillis: time.Now().Add(-1 * time.Minute).UnixMilli(), Strikes: 1})
+	assert.NoError(t, err)
+
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	activeEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$active",
+		RoomId:  "!foo:example.org",
+		Type:    "org.example.event_type_does_not_matter",
+		Sender:  activeUserId,
+		Content: map[string]any{
+			"body": "doesn't matter",
+		},
+	})
+	expiredEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$expired",
+		RoomId:  "!foo:example.org",
+		Type:    "org.example.event_type_does_not_matter",
+		Sender:  expiredUserId,
+		Content: map[string]any{
+			"body": "doesn't matter",
+		},
+	})
+
+	AssertCheckEvent(t, set, activeEvent, harms.ProhibitedContent(harms.SpamFlooding))
+	AssertCheckEvent(t, set, expiredEvent, harms.NeutralContent())
 }
 
 func TestHellbanPostfilter(t *testing.T) {
 	ctx := context.Background()
 
 	cnf := &SetConfig{
-		CommunityId:     "TestHellbanPostfilter",
-		CommunityConfig: &config.CommunityConfig{},
+		CommunityId: "TestHellbanPostfilter",
+		CommunityConfig: &config.CommunityConfig{
+			HellbanPostfilterMinutes: internal.Pointer(10),
+		},
 		Groups: []*SetGroupConfig{{
 			EnabledNames:          []string{FixedFilterName},
 			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything starts as neutral by default in the test
@@ -171,9 +234,7 @@ func TestHellbanPostfilter(t *testing.T) {
 	fixedFilter.Set = set
 
 	spammerUserId := "@spam:example.org"
-	subCh, err := ps.Subscribe(ctx, pubsub.TopicHellban)
-	assert.NoError(t, err)
-	assert.NotNil(t, subCh)
+	neutralUserId := "@neutral:example.org"
 
 	spammyEvent1 := test.MustMakePDU(&test.BaseClientEvent{
 		EventId: "$spam1",
@@ -188,7 +249,7 @@ func TestHellbanPostfilter(t *testing.T) {
 		EventId: "$neutral1",
 		RoomId:  "!foo:example.org",
 		Type:    "org.example.event_type_does_not_matter",
-		Sender:  "@neutral:example.org",
+		Sender:  neutralUserId,
 		Content: map[string]any{
 			"body": "doesn't matter",
 		},
@@ -200,24 +261,98 @@ func TestHellbanPostfilter(t *testing.T) {
 		Medias: make([]*media.Item, 0),
 	}
 	fixedFilter.ReturnInfo = harms.ProhibitedContent(harms.SpamGeneral)
+	before := time.Now()
 	AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamGeneral, harms.SpamFlooding))
-	select {
-	case recv := <-subCh:
-		assert.Equal(t, mustEncodeHellban(cnf.CommunityId, spammerUserId), recv)
-	case <-time.After(5 * time.Second): // if after a little bit we haven't heard anything, fail
-		assert.Fail(t, "didn't receive a subscription event")
-	}
+	hellban, err := memStorage.GetHellban(ctx, cnf.CommunityId, spammerUserId)
+	assert.NoError(t, err)
+	assert.NotNil(t, hellban)
+	assert.Equal(t, 1, hellban.Strikes)
+	assert.GreaterOrEqual(t, hellban.ExpiresTimestampMillis, before.Add(10*time.Minute).UnixMilli())
+	assert.LessOrEqual(t, hellban.ExpiresTimestampMillis, time.Now().Add(10*time.Minute).UnixMilli())
 
 	// Neutral events shouldn't cause a hellban
 	fixedFilter.Expect.Event = neutralEvent1
 	fixedFilter.ReturnInfo = harms.NeutralContent()
 	AssertCheckEvent(t, set, neutralEvent1, harms.NeutralContent())
-	select {
-	case <-subCh:
-		assert.Fail(t, "should not have received a subscription event")
-	case <-time.After(1 * time.Second): // we use 1 second for the same reason as the prefilter above
-		// passing case - we want this to happen
+	hellban, err = memStorage.GetHellban(ctx, cnf.CommunityId, neutralUserId)
+	assert.NoError(t, err)
+	assert.Nil(t, hellban)
+}
+
+func TestHellbanPostfilterEscalates(t *testing.T) {
+	ctx := context.Background()
+
+	cnf := &SetConfig{
+		CommunityId: "TestHellbanPostfilterEscalates",
+		CommunityConfig: &config.CommunityConfig{
+			HellbanPostfilterMinutes:    internal.Pointer(10),
+			HellbanPostfilterMaxMinutes: internal.Pointer(60),
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{HellbanPostfilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	repeatUserId := "@repeat:example.org"
+	reformedUserId := "@reformed:example.org"
+	makeEvent := func(sender string) *test.BaseClientEvent {
+		return &test.BaseClientEvent{
+			EventId: "$spam",
+			RoomId:  "!foo:example.org",
+			Type:    "org.example.event_type_does_not_matter",
+			Sender:  sender,
+			Content: map[string]any{
+				"body": "doesn't matter",
+			},
+		}
 	}
+
+	// The repeat offender's last hellban only just expired, so they get a third strike (40 minutes)
+	err = memStorage.UpsertHellban(ctx, &storage.StoredHellban{CommunityId: cnf.CommunityId, UserId: repeatUserId, ExpiresTimestampMillis: time.Now().Add(-1 * time.Minute).UnixMilli(), Strikes: 2})
+	assert.NoError(t, err)
+	// The reformed user's last hellban was a long time ago, so they start again at one strike
+	err = memStorage.UpsertHellban(ctx, &storage.StoredHellban{CommunityId: cnf.CommunityId, UserId: reformedUserId, ExpiresTimestampMillis: time.Now().Add(-1 * HellbanStrikeResetTime).UnixMilli(), Strikes: 5})
+	assert.NoError(t, err)
+
+	before := time.Now()
+	AssertCheckEvent(t, set, test.MustMakePDU(makeEvent(repeatUserId)), harms.ProhibitedContent(harms.SpamFlooding))
+	AssertCheckEvent(t, set, test.MustMakePDU(makeEvent(reformedUserId)), harms.ProhibitedContent(harms.SpamFlooding))
+
+	hellban, err := memStorage.GetHellban(ctx, cnf.CommunityId, repeatUserId)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, hellban.Strikes)
+	assert.GreaterOrEqual(t, hellban.ExpiresTimestampMillis, before.Add(40*time.Minute).UnixMilli())
+	assert.Less(t, hellban.ExpiresTimestampMillis, before.Add(41*time.Minute).UnixMilli())
+
+	hellban, err = memStorage.GetHellban(ctx, cnf.CommunityId, reformedUserId)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hellban.Strikes)
+	assert.GreaterOrEqual(t, hellban.ExpiresTimestampMillis, before.Add(10*time.Minute).UnixMilli())
+	assert.Less(t, hellban.ExpiresTimestampMillis, before.Add(11*time.Minute).UnixMilli())
+}
+
+func TestHellbanDuration(t *testing.T) {
+	t.Parallel()
+
+	// No escalation
+	assert.Equal(t, 10*time.Minute, hellbanDuration(10*time.Minute, 0, 1))
+	assert.Equal(t, 10*time.Minute, hellbanDuration(10*time.Minute, 0, 5))
+	assert.Equal(t, 10*time.Minute, hellbanDuration(10*time.Minute, 5*time.Minute, 5))
+
+	// Escalation, with a cap
+	assert.Equal(t, 10*time.Minute, hellbanDuration(10*time.Minute, 60*time.Minute, 1))
+	assert.Equal(t, 20*time.Minute, hellbanDuration(10*time.Minute, 60*time.Minute, 2))
+	assert.Equal(t, 40*time.Minute, hellbanDuration(10*time.Minute, 60*time.Minute, 3))
+	assert.Equal(t, 60*time.Minute, hellbanDuration(10*time.Minute, 60*time.Minute, 4))
+	assert.Equal(t, 60*time.Minute, hellbanDuration(10*time.Minute, 60*time.Minute, 100))
 }
 
 func TestHellbanFiltersCombined(t *testing.T) {
@@ -252,9 +387,6 @@ func TestHellbanFiltersCombined(t *testing.T) {
 	fixedFilter.Set = set
 
 	spammerUserId := "@spam:example.org"
-	subCh, err := ps.Subscribe(ctx, pubsub.TopicHellban)
-	assert.NoError(t, err)
-	assert.NotNil(t, subCh)
 
 	spammyEvent1 := test.MustMakePDU(&test.BaseClientEvent{
 		EventId: "$spam1",
@@ -269,12 +401,12 @@ func TestHellbanFiltersCombined(t *testing.T) {
 	// The rough sequence of events should be:
 	// 1. Event passes through prefilter untouched (no-op)
 	// 2. Event hits fixed filter, which flags it as spam
-	// 3. Event gets processed by postfilter as spammy
-	// 4. Prefilter picks up the postfilter's hellban designation
+	// 3. Event gets processed by postfilter as spammy, storing a hellban
+	// 4. Prefilter picks up the postfilter's hellban (the database would normally notify it)
 	// 5. Sending the event again, event hits prefilter as spammy
 	// 6. Fixed filter declares it as spam still
-	// 7. The postfilter will still be triggered due to set config, but the prefilter should ignore the double hellban.
-	//    We don't test this here, but it'll be tested in the prefilter test.
+	// 7. The postfilter will still be triggered due to set config, but shouldn't extend the hellban. We don't test
+	//    this here, but it'll be tested in the postfilter test.
 	//
 	// We don't test a no-op event through this because those are tested individually
 	// at each filter's specific test. The round-tripping is to ensure the cache is
@@ -290,14 +422,12 @@ func TestHellbanFiltersCombined(t *testing.T) {
 
 	// Invoke steps 1 through 3
 	AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamGeneral, harms.SpamFlooding, harms.PolicyservMedia))
-	select {
-	case recv := <-subCh:
-		assert.Equal(t, mustEncodeHellban(cnf.CommunityId, spammerUserId), recv)
-	case <-time.After(5 * time.Second): // if after a little bit we haven't heard anything, fail
-		assert.Fail(t, "didn't receive a subscription event")
-	}
+	hellban, err := memStorage.GetHellban(ctx, cnf.CommunityId, spammerUserId)
+	assert.NoError(t, err)
+	assert.NotNil(t, hellban)
 
-	// We need to wait a bit to ensure the cache populates, per prefilter test
+	// Step 4: simulate the database trigger, then wait a bit to ensure the cache populates, per prefilter test
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicHellban, mustEncodeHellbanChange(cnf.CommunityId, spammerUserId)))
 	time.Sleep(1 * time.Second)
 
 	// Step 6 prep
@@ -310,25 +440,96 @@ func TestHellbanFiltersCombined(t *testing.T) {
 	// Note: "media" shouldn't appear here because of the RunOnClasses config. We expect Flooding from the prefilter.
 	AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamFlooding))
 
-	// Step 7 states that we should (probably) get a subscription event
-	select {
-	case recv := <-subCh:
-		assert.Equal(t, mustEncodeHellban(cnf.CommunityId, spammerUserId), recv)
-	case <-time.After(5 * time.Second): // if after a little bit we haven't heard anything, fail
-		assert.Fail(t, "didn't receive a subscription event")
-	}
+	// Step 7: the hellban is unchanged
+	again, err := memStorage.GetHellban(ctx, cnf.CommunityId, spammerUserId)
+	assert.NoError(t, err)
+	assert.Equal(t, hellban, again)
 }
 
-func TestHellbanEncodingReversible(t *testing.T) {
+func TestHellbanChangeDecoding(t *testing.T) {
 	t.Parallel()
 
-	communityId := "TestHellbanEncodingReversible"
-	userId := "@spammer:example.org"
+	communityId := "TestHellbanChangeDecoding"
+	userId := "@spammer,\"quoted\":example.org"
 
-	encoded := mustEncodeHellban(communityId, userId)
-	assert.NotEmpty(t, encoded)
-
-	decodedCommunityId, decodedUserId := mustDecodeHellban(encoded)
+	decodedCommunityId, decodedUserId, err := decodeHellbanChange(mustEncodeHellbanChange(communityId, userId))
+	assert.NoError(t, err)
 	assert.Equal(t, communityId, decodedCommunityId)
 	assert.Equal(t, userId, decodedUserId)
+
+	_, _, err = decodeHellbanChange("not json")
+	assert.Error(t, err)
+	_, _, err = decodeHellbanChange(`{"community_id":"TestHellbanChangeDecoding"}`)
+	assert.ErrorContains(t, err, "expected a community ID and user ID")
+}
+
+func TestHellbanPostfilterShadowMode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		communityConfig *config.CommunityConfig
+	}{{
+		name: "community shadow mode",
+		communityConfig: &config.CommunityConfig{
+			HellbanPostfilterMinutes: internal.Pointer(10),
+			ShadowModeEnabled:        internal.Pointer(true),
+		},
+	}, {
+		name: "shadowed postfilter",
+		communityConfig: &config.CommunityConfig{
+			HellbanPostfilterMinutes: internal.Pointer(10),
+			ShadowFilterNames:        &[]string{HellbanPostfilterName},
+		},
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			cnf := &SetConfig{
+				CommunityId:     "TestHellbanPostfilterShadowMode",
+				CommunityConfig: c.communityConfig,
+				Groups: []*SetGroupConfig{{
+					EnabledNames:          []string{FixedFilterName},
+					CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+				}, {
+					EnabledNames:          []string{HellbanPostfilterName},
+					CheckedContentClasses: []harms.ContentClass{harms.ContentClassProhibited},
+				}},
+			}
+			memStorage := test.NewMemoryStorage(t)
+			defer memStorage.Close()
+			ps := test.NewMemoryPubsub(t)
+			defer ps.Close()
+			set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+			assert.NoError(t, err)
+			assert.NotNil(t, set)
+
+			spammyEvent := test.MustMakePDU(&test.BaseClientEvent{
+				EventId: "$spam1",
+				RoomId:  "!foo:example.org",
+				Type:    "org.example.event_type_does_not_matter",
+				Sender:  "@spam:example.org",
+				Content: map[string]any{
+					"body": "doesn't matter",
+				},
+			})
+			fixedFilter := set.groups[0].filters[0].(*FixedInstancedFilter)
+			fixedFilter.T = t
+			fixedFilter.Set = set
+			fixedFilter.Expect = &EventInput{
+				Event:  spammyEvent,
+				Medias: make([]*media.Item, 0),
+			}
+			fixedFilter.ReturnInfo = harms.ProhibitedContent(harms.SpamGeneral)
+
+			info, err := set.CheckEvent(ctx, spammyEvent, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, harms.ContentClassProhibited, info.Class())
+
+			// The event is still flagged, but nothing is persisted against the user
+			hellban, err := memStorage.GetHellban(ctx, cnf.CommunityId, "@spam:example.org")
+			assert.NoError(t, err)
+			assert.Nil(t, hellban)
+		})
+	}
 }
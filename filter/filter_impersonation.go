@@ -0,0 +1,244 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	cache "github.com/Code-Hex/go-generics-cache"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/event"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/trust"
+)
+
+const ImpersonationFilterName = "ImpersonationFilter"
+
+// impersonationNormalization - The normalization steps applied to display names before comparing them. HTML is left
+// alone because display names aren't HTML.
+const impersonationNormalization = event.NormalizeInvisible | event.NormalizeConfusables | event.NormalizeLeetspeak | event.NormalizeWhitespace
+
+// impersonationCacheDuration - How long a room's protected members are cached for. Changes to the room's members
+// invalidate the cache sooner, so this mostly limits how long changes to other trust data (like a community's protected
+// user globs applying to a newly joined user) take to apply.
+const impersonationCacheDuration = 10 * time.Minute
+
+func init() {
+	mustRegister(ImpersonationFilterName, &ImpersonationFilter{})
+}
+
+type ImpersonationFilter struct {
+}
+
+func (f *ImpersonationFilter) MakeFor(set *Set) (Instanced, error) {
+	communitySource, err := trust.NewSelfDirectedSource(set.storage, internal.Dereference(set.communityConfig.ImpersonationFilterProtectedUserGlobs), nil)
+	if err != nil {
+		return nil, err
+	}
+	creatorSource, err := trust.NewCreatorSource(set.storage)
+	if err != nil {
+		return nil, err
+	}
+	powerLevelsSource, err := trust.NewPowerLevelsSource(set.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	// Protected members are cached per room, so we need to know when to forget them
+	ch, err := set.pubsub.Subscribe(ctx, pubsub.TopicRoomMembers)
+	if err != nil {
+		return nil, err
+	}
+	instanced := &InstancedImpersonationFilter{
+		set:          set,
+		checkAvatars: internal.Dereference(set.communityConfig.ImpersonationFilterCheckAvatars),
+		trustSources: []trust.Source{communitySource, creatorSource, powerLevelsSource},
+		protectedCache: cache.New[string, []*protectedIdentity](
+			cache.WithJanitorInterval[string, []*protectedIdentity](1 * time.Minute),
+		),
+		unsubscribeFn: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			return set.pubsub.Unsubscribe(ctx, ch)
+		},
+	}
+	go func(ch <-chan string, f *InstancedImpersonationFilter) {
+		keepLoop := true
+		for keepLoop {
+			select {
+			case roomId, stillOpen := <-ch:
+				if roomId == pubsub.ClosingValue {
+					keepLoop = false
+					break // `select`
+				}
+				if roomId == "" { // sometimes when closing we also get an empty string over the channel
+					if !stillOpen {
+						keepLoop = false
+						break // `select`
+					}
+					continue // `for` loop
+				}
+				f.protectedCache.Delete(roomId)
+			}
+		}
+	}(ch, instanced)
+	return instanced, nil
+}
+
+type InstancedImpersonationFilter struct {
+	set          *Set
+	checkAvatars bool
+	trustSources []trust.Source
+
+	protectedCache *cache.Cache[string, []*protectedIdentity] // room ID -> protected members
+	unsubscribeFn  func() error
+}
+
+// protectedIdentity - What a protected member looks like to other users, normalized for comparison.
+type protectedIdentity struct {
+	userId    string
+	names     []string // the display name, localpart, and user ID
+	avatarUrl string
+}
+
+type memberProfileContent struct {
+	Membership  string `json:"membership"`
+	DisplayName string `json:"displayname"`
+	AvatarUrl   string `json:"avatar_url"`
+}
+
+func (f *InstancedImpersonationFilter) Name() string {
+	return ImpersonationFilterName
+}
+
+func (f *InstancedImpersonationFilter) Close() error {
+	return f.unsubscribeFn()
+}
+
+func (f *InstancedImpersonationFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
+	eventId := input.Event.EventID()
+	roomId := input.Event.RoomID().String()
+	userId := string(input.Event.SenderID())
+
+	// Joins and profile changes are both join events sent by the user themselves
+	if input.Event.Type() != "m.room.member" || !input.Event.StateKeyEquals(userId) {
+		return harms.NeutralContent(), nil
+	}
+	content := &memberProfileContent{}
+	err := json.Unmarshal(input.Event.Content(), &content)
+	if err != nil {
+		return nil, err
+	}
+	if content.Membership != spec.Join {
+		return harms.NeutralContent(), nil
+	}
+	displayName := normalizeDisplayName(content.DisplayName)
+	avatarUrl := ""
+	if f.checkAvatars {
+		avatarUrl = content.AvatarUrl
+	}
+	if displayName == "" && avatarUrl == "" {
+		return harms.NeutralContent(), nil // nothing to impersonate with
+	}
+
+	isProtected, err := f.isProtected(ctx, userId, roomId)
+	if err != nil {
+		return nil, err
+	}
+	if isProtected {
+		return harms.NeutralContent(), nil // protected users can't impersonate each other (or themselves)
+	}
+
+	protected, err := f.protectedIdentities(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range protected {
+		sameName := displayName != "" && slices.Contains(identity.names, displayName)
+		sameAvatar := avatarUrl != "" && avatarUrl == identity.avatarUrl
+		if sameName || sameAvatar {
+			log.Printf("[%s | %s] %s appears to be impersonating %s (same name: %t, same avatar: %t)", eventId, roomId, userId, identity.userId, sameName, sameAvatar)
+			return harms.ProhibitedContent(harms.SpamImpersonation), nil
+		}
+	}
+
+	return harms.NeutralContent(), nil
+}
+
+// protectedIdentities - Returns the room's protected members, from the cache if possible. Working this out means
+// checking the trust of every member, so it's only done when the room's members change (or the cache expires).
+func (f *InstancedImpersonationFilter) protectedIdentities(ctx context.Context, roomId string) ([]*protectedIdentity, error) {
+	if fromCache, ok := f.protectedCache.Get(roomId); ok {
+		return fromCache, nil
+	}
+
+	members, err := f.set.storage.GetRoomMembers(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	protected := make([]*protectedIdentity, 0)
+	for _, member := range members {
+		isProtected, err := f.isProtected(ctx, member.UserId, roomId)
+		if err != nil {
+			return nil, err
+		}
+		if !isProtected {
+			continue
+		}
+		names := make([]string, 0, 3)
+		for _, name := range []string{member.DisplayName, localpart(member.UserId), member.UserId} {
+			if name = normalizeDisplayName(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		protected = append(protected, &protectedIdentity{
+			userId:    member.UserId,
+			names:     names,
+			avatarUrl: member.AvatarUrl,
+		})
+	}
+	f.protectedCache.Set(roomId, protected, cache.WithExpiration(impersonationCacheDuration))
+	return protected, nil
+}
+
+// isProtected - Returns true if the user is a moderator, creator, or otherwise trusted user whose identity shouldn't
+// be used by anyone else.
+func (f *InstancedImpersonationFilter) isProtected(ctx context.Context, userId string, roomId string) (bool, error) {
+	isProtected := false
+	for _, source := range f.trustSources {
+		has, err := source.HasCapability(ctx, userId, roomId, trust.CapabilityProtectedIdentity)
+		if err != nil {
+			return false, err
+		}
+		if has == trust.TristateTrue {
+			isProtected = true
+			// there may still be a deny in the array, so we continue
+		} else if has == trust.TristateFalse {
+			return false, nil // deny wins
+		}
+	}
+	return isProtected, nil
+}
+
+// normalizeDisplayName - Returns the display name (or user ID) in a form where lookalikes compare equal. For example,
+// "Mоdеratоr" (with Cyrillic characters) and "moderator" are considered the same name.
+func normalizeDisplayName(name string) string {
+	return strings.ToLower(event.NormalizeText(name, impersonationNormalization))
+}
+
+// localpart - Returns the user ID's localpart, which clients commonly show for users without a display name. Invalid
+// user IDs are returned as-is.
+func localpart(userId string) string {
+	parsed, err := spec.NewUserID(userId, true)
+	if err != nil {
+		return userId
+	}
+	return parsed.Local()
+}
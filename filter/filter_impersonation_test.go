@@ -0,0 +1,122 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/matrix-org/policyserv/trust"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonationFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	roomId := "!foo:example.org"
+	cnf := &SetConfig{
+		CommunityConfig: &config.CommunityConfig{
+			ImpersonationFilterCheckAvatars:       internal.Pointer(true),
+			ImpersonationFilterProtectedUserGlobs: &[]string{"@helper:example.org"},
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{ImpersonationFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	// Populate trust sources and room members
+	plSource, err := trust.NewPowerLevelsSource(memStorage)
+	assert.NoError(t, err)
+	err = plSource.ImportData(ctx, roomId, test.MustMakePDU(&test.BaseClientEvent{
+		Type:     "m.room.power_levels",
+		StateKey: internal.Pointer(""),
+		Sender:   "@mod:example.org",
+		Content: map[string]any{
+			"state_default": 50,
+			"users_default": 0,
+			"users": map[string]any{
+				"@mod:example.org": 100,
+			},
+		},
+	}))
+	assert.NoError(t, err)
+	err = memStorage.SetRoomMembers(ctx, roomId, []*storage.StoredRoomMember{
+		{UserId: "@mod:example.org", DisplayName: "Moderator Alice", AvatarUrl: "mxc://example.org/alice"},
+		{UserId: "@helper:example.org", DisplayName: "Helpful Bob"},
+		{UserId: "@regular:example.org", DisplayName: "Just Carol", AvatarUrl: "mxc://example.org/carol"},
+		{UserId: "@spammer:example.org", DisplayName: "Moderator Alice"}, // a previous profile shouldn't count
+	})
+	assert.NoError(t, err)
+
+	makeMember := func(sender string, stateKey string, content map[string]any) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId:  "$member",
+			RoomId:   roomId,
+			Type:     "m.room.member",
+			Sender:   sender,
+			StateKey: internal.Pointer(stateKey),
+			Content:  content,
+		})
+	}
+	type testCase struct {
+		event    gomatrixserverlib.PDU
+		expected *harms.ContentInfo
+	}
+	cases := map[string]testCase{
+		"same display name":                   {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "Moderator Alice"}), harms.ProhibitedContent(harms.SpamImpersonation)},
+		"confusable display name":             {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "mоdеrаtоr\u200B  аlicе"}), harms.ProhibitedContent(harms.SpamImpersonation)}, // Cyrillic lookalikes
+		"leetspeak display name":              {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "M0d3rat0r Al1ce"}), harms.ProhibitedContent(harms.SpamImpersonation)},
+		"user ID as display name":             {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "@mod:example.org"}), harms.ProhibitedContent(harms.SpamImpersonation)},
+		"localpart as display name":           {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "MOD"}), harms.ProhibitedContent(harms.SpamImpersonation)},
+		"same avatar":                         {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "Someone", "avatar_url": "mxc://example.org/alice"}), harms.ProhibitedContent(harms.SpamImpersonation)},
+		"globbed protected user":              {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "Helpful Bob"}), harms.ProhibitedContent(harms.SpamImpersonation)},
+		"unprotected user":                    {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "Just Carol", "avatar_url": "mxc://example.org/carol"}), harms.NeutralContent()},
+		"different name":                      {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "Moderator Dave"}), harms.NeutralContent()},
+		"no profile":                          {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join"}), harms.NeutralContent()},
+		"moderator themselves":                {makeMember("@mod:example.org", "@mod:example.org", map[string]any{"membership": "join", "displayname": "Moderator Alice"}), harms.NeutralContent()},
+		"protected user using moderator name": {makeMember("@helper:example.org", "@helper:example.org", map[string]any{"membership": "join", "displayname": "Moderator Alice"}), harms.NeutralContent()},
+		"leave":                               {makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "leave", "displayname": "Moderator Alice"}), harms.NeutralContent()},
+		"invite":                              {makeMember("@mod:example.org", "@spammer:example.org", map[string]any{"membership": "invite", "displayname": "Moderator Alice"}), harms.NeutralContent()},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			AssertCheckEvent(t, set, c.event, c.expected)
+		})
+	}
+
+	// Avatar checks can be disabled
+	cnf.CommunityConfig.ImpersonationFilterCheckAvatars = internal.Pointer(false)
+	set, err = NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	AssertCheckEvent(t, set, cases["same avatar"].event, harms.NeutralContent())
+
+	// Protected members are cached until the room's members change
+	renamed := makeMember("@spammer:example.org", "@spammer:example.org", map[string]any{"membership": "join", "displayname": "Moderator Eve"})
+	AssertCheckEvent(t, set, renamed, harms.NeutralContent())
+	err = memStorage.SetRoomMembers(ctx, roomId, []*storage.StoredRoomMember{
+		{UserId: "@mod:example.org", DisplayName: "Moderator Eve"},
+	})
+	assert.NoError(t, err)
+	AssertCheckEvent(t, set, renamed, harms.NeutralContent()) // still cached
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicRoomMembers, "!unrelated:example.org"))
+	time.Sleep(1 * time.Second) // give the filter a moment to receive the change
+	AssertCheckEvent(t, set, renamed, harms.NeutralContent())
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicRoomMembers, roomId))
+	time.Sleep(1 * time.Second)
+	AssertCheckEvent(t, set, renamed, harms.ProhibitedContent(harms.SpamImpersonation))
+}
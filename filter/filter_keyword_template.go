@@ -3,7 +3,6 @@ package filter
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -32,7 +31,11 @@ func (k *KeywordTemplateFilter) MakeFor(set *Set) (Instanced, error) {
 	templates := make([]*pslib.KeywordTemplate, 0)
 
 	for _, templateName := range enabledTemplates {
-		raw, err := set.storage.GetKeywordTemplate(ctx, templateName)
+		// Community templates take precedence over instance-wide ones
+		raw, err := set.storage.GetCommunityKeywordTemplate(ctx, set.communityId, templateName)
+		if errors.Is(err, sql.ErrNoRows) {
+			raw, err = set.storage.GetKeywordTemplate(ctx, templateName)
+		}
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				continue // skip this template
@@ -48,16 +51,18 @@ func (k *KeywordTemplateFilter) MakeFor(set *Set) (Instanced, error) {
 	}
 
 	return &InstancedKeywordTemplateFilter{
-		set:          set,
-		templates:    templates,
-		useFullEvent: internal.Dereference(set.communityConfig.KeywordTemplateFilterUseFullEvent),
+		set:           set,
+		templates:     templates,
+		useFullEvent:  internal.Dereference(set.communityConfig.KeywordTemplateFilterUseFullEvent),
+		normalization: set.normalizationFor(KeywordTemplateFilterName, event.NormalizeAll),
 	}, nil
 }
 
 type InstancedKeywordTemplateFilter struct {
-	set          *Set
-	templates    []*pslib.KeywordTemplate
-	useFullEvent bool
+	set           *Set
+	templates     []*pslib.KeywordTemplate
+	useFullEvent  bool
+	normalization event.Normalization
 }
 
 func (f *InstancedKeywordTemplateFilter) Name() string {
@@ -65,22 +70,19 @@ func (f *InstancedKeywordTemplateFilter) Name() string {
 }
 
 func (f *InstancedKeywordTemplateFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
-	if input.Event.Type() != "m.room.message" {
+	// Return early on state events
+	if input.Event.StateKey() != nil {
+		return harms.NeutralContent(), nil
+	}
+
+	content := event.ExtractContent(input.Event)
+	if !content.HasText() {
 		return harms.NeutralContent(), nil
 	}
 
-	var toScan string
+	toScan := content.AllText()
 	if f.useFullEvent {
 		toScan = string(input.Event.JSON())
-	} else {
-		content := &event.MessageEventContent{}
-		err := json.Unmarshal(input.Event.Content(), &content)
-		if err != nil {
-			// Probably not a string
-			return nil, err
-		}
-
-		toScan = content.Body + " " + content.FormattedBody
 	}
 
 	return f.checkTextWithLogging(ctx, toScan, fmt.Sprintf("%s | %s", input.Event.EventID(), input.Event.RoomID().String()))
@@ -91,6 +93,7 @@ func (f *InstancedKeywordTemplateFilter) CheckText(ctx context.Context, text str
 }
 
 func (f *InstancedKeywordTemplateFilter) checkTextWithLogging(ctx context.Context, text string, logPrefix string) (*harms.ContentInfo, error) {
+	text = event.NormalizeText(text, f.normalization)
 	harmIds := make([]harms.Harm, 0)
 	for _, tmpl := range f.templates {
 		log.Printf("[%s] Checking template '%s'", logPrefix, tmpl.Name)
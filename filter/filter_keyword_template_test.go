@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
@@ -155,3 +156,51 @@ func TestKeywordTemplateFilterWithFullEvent(t *testing.T) {
 
 	AssertCheckEvent(t, set, spammyEvent, harms.ProhibitedContent("org.example.keyword.spam"))
 }
+
+func TestKeywordTemplateFilterPrefersCommunityTemplates(t *testing.T) {
+	ctx := context.Background()
+	cnf := &SetConfig{
+		CommunityId: "TestKeywordTemplateFilterPrefersCommunityTemplates",
+		CommunityConfig: &config.CommunityConfig{
+			KeywordTemplateFilterTemplateNames: &[]string{"shared", "instance_only"},
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{KeywordTemplateFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	makeTemplate := func(name string, keyword string, harm string) *storage.StoredKeywordTemplate {
+		return &storage.StoredKeywordTemplate{
+			Name: name,
+			Body: `{{ if StringContains .BodyRaw "` + keyword + `" }}` + harm + `{{ end }}`,
+		}
+	}
+	assert.NoError(t, memStorage.UpsertKeywordTemplate(ctx, makeTemplate("shared", "instance", "org.example.instance")))
+	assert.NoError(t, memStorage.UpsertKeywordTemplate(ctx, makeTemplate("instance_only", "fallback", "org.example.fallback")))
+	assert.NoError(t, memStorage.UpsertCommunityKeywordTemplate(ctx, cnf.CommunityId, makeTemplate("shared", "community", "org.example.community")))
+	assert.NoError(t, memStorage.UpsertCommunityKeywordTemplate(ctx, "another_community", makeTemplate("instance_only", "fallback", "org.example.wrong_community")))
+
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	makeEvent := func(body string) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$event",
+			RoomId:  "!foo:example.org",
+			Type:    "m.room.message",
+			Content: map[string]any{
+				"body": body,
+			},
+		})
+	}
+
+	AssertCheckEvent(t, set, makeEvent("community"), harms.ProhibitedContent("org.example.community"))
+	AssertCheckEvent(t, set, makeEvent("instance"), harms.NeutralContent()) // the community's template replaces the instance's
+	AssertCheckEvent(t, set, makeEvent("fallback"), harms.ProhibitedContent("org.example.fallback"))
+}
@@ -1,9 +1,12 @@
 package filter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"strings"
 
+	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 )
@@ -18,17 +21,29 @@ type KeywordFilter struct {
 }
 
 func (k *KeywordFilter) MakeFor(set *Set) (Instanced, error) {
+	normalization := set.normalizationFor(KeywordFilterName, event.NormalizeAll)
+	keywords := make([]string, 0)
+	for _, keyword := range internal.Dereference(set.communityConfig.KeywordFilterKeywords) {
+		// Keywords are normalized the same way as the text so they can still match each other
+		keyword = event.NormalizeText(keyword, normalization)
+		if keyword == "" {
+			continue // would match everything
+		}
+		keywords = append(keywords, keyword)
+	}
 	return &InstancedKeywordFilter{
-		set:          set,
-		keywords:     internal.Dereference(set.communityConfig.KeywordFilterKeywords),
-		useFullEvent: internal.Dereference(set.communityConfig.KeywordFilterUseFullEvent),
+		set:           set,
+		keywords:      keywords,
+		useFullEvent:  internal.Dereference(set.communityConfig.KeywordFilterUseFullEvent),
+		normalization: normalization,
 	}, nil
 }
 
 type InstancedKeywordFilter struct {
-	set          *Set
-	keywords     []string
-	useFullEvent bool
+	set           *Set
+	keywords      []string
+	useFullEvent  bool
+	normalization event.Normalization
 }
 
 func (f *InstancedKeywordFilter) Name() string {
@@ -36,14 +51,32 @@ func (f *InstancedKeywordFilter) Name() string {
 }
 
 func (f *InstancedKeywordFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
-	toScan := string(input.Event.Content())
+	if !f.useFullEvent && input.Event.StateKey() == nil {
+		// Check what a client will render rather than the raw content, so edits are covered.
+		text, err := scannableText(input)
+		if err != nil {
+			return nil, err
+		}
+		return f.CheckText(ctx, text)
+	}
+
+	toScan := input.Event.Content()
 	if f.useFullEvent {
-		toScan = string(input.Event.JSON())
+		toScan = input.Event.JSON()
 	}
-	return f.CheckText(ctx, toScan)
+	if f.normalization != 0 {
+		// Normalization needs to see the characters rather than their JSON escape sequences, like `\u003c` for `<`.
+		var err error
+		toScan, err = unescapeJson(toScan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f.CheckText(ctx, string(toScan))
 }
 
 func (f *InstancedKeywordFilter) CheckText(ctx context.Context, text string) (*harms.ContentInfo, error) {
+	text = event.NormalizeText(text, f.normalization)
 	for _, k := range f.keywords {
 		if strings.Contains(text, k) {
 			return harms.ProhibitedContent(harms.SpamGeneral), nil
@@ -52,3 +85,20 @@ func (f *InstancedKeywordFilter) CheckText(ctx context.Context, text string) (*h
 
 	return harms.NeutralContent(), nil
 }
+
+// unescapeJson re-encodes the JSON without escaping HTML characters or unicode characters which don't need escaping.
+func unescapeJson(b []byte) ([]byte, error) {
+	var val any
+	err := json.Unmarshal(b, &val)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
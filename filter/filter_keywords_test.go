@@ -3,6 +3,7 @@ package filter
 import (
 	"testing"
 
+	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
@@ -91,3 +92,111 @@ func TestKeywordsFilterWithFullEvent(t *testing.T) {
 
 	AssertCheckEvent(t, set, spammyEvent, harms.ProhibitedContent(harms.SpamGeneral))
 }
+
+func TestKeywordsFilterWithTextNormalization(t *testing.T) {
+	cnf := &SetConfig{
+		CommunityConfig: &config.CommunityConfig{
+			// "<br>" normalizes to an empty keyword, which should be ignored rather than matching everything
+			KeywordFilterKeywords:        &[]string{"spammy spam", "free crypto", "<br>"},
+			TextNormalizationFilterNames: &[]string{KeywordFilterName}, // this is what we're testing
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{KeywordFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	makeEvent := func(content map[string]any) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  "!foo:example.org",
+			Type:    "m.room.message",
+			Content: content,
+		})
+	}
+	homoglyphEvent := makeEvent(map[string]any{"body": "sраmmу  sраm"}) // Cyrillic lookalikes and extra whitespace
+	invisibleEvent := makeEvent(map[string]any{"body": "spam\u200Bmy sp\u200Dam"})
+	leetEvent := makeEvent(map[string]any{"body": "get fr33 crypt0 now"})
+	htmlEvent := makeEvent(map[string]any{"body": "not applicable", "formatted_body": "<b>free</b> <i>cry</i>pto"})
+	neutralEvent := makeEvent(map[string]any{"body": "this is not spam, nor is it spammy", "formatted_body": "line<br>break"})
+
+	AssertCheckTextAndEvent(t, set, homoglyphEvent, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckTextAndEvent(t, set, invisibleEvent, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckTextAndEvent(t, set, leetEvent, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, htmlEvent, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckTextAndEvent(t, set, neutralEvent, harms.NeutralContent())
+
+	// The same events should be allowed when normalization isn't enabled for the filter
+	cnf.CommunityConfig.TextNormalizationFilterNames = &[]string{"SomeOtherFilter"}
+	set, err = NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	AssertCheckTextAndEvent(t, set, homoglyphEvent, harms.NeutralContent())
+	AssertCheckTextAndEvent(t, set, invisibleEvent, harms.NeutralContent())
+	AssertCheckTextAndEvent(t, set, leetEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, htmlEvent, harms.NeutralContent())
+}
+
+func TestKeywordsFilterWithEditsAndReplies(t *testing.T) {
+	cnf := &SetConfig{
+		CommunityConfig: &config.CommunityConfig{
+			KeywordFilterKeywords: &[]string{"spammy spam"},
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{KeywordFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	makeEvent := func(eventType string, content map[string]any) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  "!foo:example.org",
+			Type:    eventType,
+			Content: content,
+		})
+	}
+	// Spammers send a benign message, then edit it to contain spam (without changing the fallback)
+	spammyEdit := makeEvent("m.room.message", map[string]any{
+		"body":          "* hello world",
+		"m.new_content": map[string]any{"body": "spammy spam"},
+		"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": "$original"},
+	})
+	spammyPoll := makeEvent("m.poll.start", map[string]any{
+		"m.poll": map[string]any{
+			"question": map[string]any{"m.text": []any{map[string]any{"body": "What's your favourite?"}}},
+			"answers": []any{
+				map[string]any{"m.id": "1", "m.text": []any{map[string]any{"body": "Cats"}}},
+				map[string]any{"m.id": "2", "m.text": []any{map[string]any{"body": "spammy spam"}}},
+			},
+		},
+	})
+	// Reply fallbacks can be written to say anything, and are rendered by clients without reply support, so they're
+	// still checked
+	spammyReply := makeEvent("m.room.message", map[string]any{
+		"body":         "> <@someone:example.org> spammy spam\n\nhello",
+		"m.relates_to": map[string]any{"m.in_reply_to": map[string]any{"event_id": "$original"}},
+	})
+	// Events we can't extract text from are checked in full
+	spammyCustom := makeEvent("org.example.custom", map[string]any{
+		"org.example.text": "spammy spam",
+	})
+
+	AssertCheckEvent(t, set, spammyEdit, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, spammyPoll, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, spammyReply, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, spammyCustom, harms.ProhibitedContent(harms.SpamGeneral))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"regexp"
 
+	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/ryanuber/go-glob"
@@ -27,6 +28,9 @@ func (l *LinkFilter) MakeFor(set *Set) (Instanced, error) {
 		set:             set,
 		allowedUrlGlobs: internal.Dereference(set.communityConfig.LinkFilterAllowedUrlGlobs),
 		deniedUrlGlobs:  internal.Dereference(set.communityConfig.LinkFilterDeniedUrlGlobs),
+		// Leetspeak and whitespace normalization would change the URLs themselves, so we only remove the characters
+		// which are used to hide a URL from the deny list.
+		normalization: set.normalizationFor(LinkFilterName, event.NormalizeInvisible|event.NormalizeConfusables),
 	}, nil
 }
 
@@ -34,6 +38,7 @@ type InstancedLinkFilter struct {
 	set             *Set
 	allowedUrlGlobs []string
 	deniedUrlGlobs  []string
+	normalization   event.Normalization
 }
 
 func (f *InstancedLinkFilter) Name() string {
@@ -41,8 +46,11 @@ func (f *InstancedLinkFilter) Name() string {
 }
 
 func (f *InstancedLinkFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
-	content := string(input.Event.Content())
-	return f.CheckText(ctx, content)
+	text, err := scannableText(input)
+	if err != nil {
+		return nil, err
+	}
+	return f.CheckText(ctx, text)
 }
 
 func (f *InstancedLinkFilter) CheckText(ctx context.Context, text string) (*harms.ContentInfo, error) {
@@ -52,6 +60,7 @@ func (f *InstancedLinkFilter) CheckText(ctx context.Context, text string) (*harm
 	}
 
 	// Find all of the URLs in the text
+	text = event.NormalizeText(text, f.normalization)
 	urls := urlRegex.FindAllString(text, -1)
 
 	// No URLs found, so nothing to check.
@@ -140,6 +140,79 @@ func TestLinkFilterDenyListOnly(t *testing.T) {
 		},
 	})
 
+	// Links in events we can't extract text from, or in reply fallbacks, are still found
+	deniedCustomEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$denied2",
+		RoomId:  "!foo:example.org",
+		Sender:  "@user:example.org",
+		Type:    "org.example.custom",
+		Content: map[string]any{
+			"org.example.link": "https://denied.example.org/path",
+		},
+	})
+	deniedReplyEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$denied3",
+		RoomId:  "!foo:example.org",
+		Sender:  "@user:example.org",
+		Type:    "m.room.message",
+		Content: map[string]any{
+			"msgtype":      "m.text",
+			"body":         "> <@someone:example.org> https://denied.example.org/path\n\nhello",
+			"m.relates_to": map[string]any{"m.in_reply_to": map[string]any{"event_id": "$original"}},
+		},
+	})
+
 	AssertCheckTextAndEvent(t, set, deniedEvent, harms.ProhibitedContent(harms.SpamGeneral))
 	AssertCheckTextAndEvent(t, set, allowedEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, deniedCustomEvent, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, deniedReplyEvent, harms.ProhibitedContent(harms.SpamGeneral))
+}
+
+func TestLinkFilterWithTextNormalization(t *testing.T) {
+	t.Parallel()
+
+	cnf := &SetConfig{
+		CommunityConfig: &config.CommunityConfig{
+			LinkFilterDeniedUrlGlobs:     &[]string{"*denied.example.org/*"},
+			TextNormalizationFilterNames: &[]string{LinkFilterName}, // this is what we're testing
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{LinkFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	// Event with a zero-width space and Cyrillic lookalikes in the URL
+	disguisedEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$disguised1",
+		RoomId:  "!foo:example.org",
+		Sender:  "@user:example.org",
+		Type:    "m.room.message",
+		Content: map[string]any{
+			"msgtype": "m.text",
+			"body":    "https://d\u200Beniеd.ехample.org/page",
+		},
+	})
+
+	// Event with digits in the URL, which shouldn't be changed by normalization
+	allowedEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$allowed1",
+		RoomId:  "!foo:example.org",
+		Sender:  "@user:example.org",
+		Type:    "m.room.message",
+		Content: map[string]any{
+			"msgtype": "m.text",
+			"body":    "https://d3nied.example.org/page",
+		},
+	})
+
+	AssertCheckTextAndEvent(t, set, disguisedEvent, harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckTextAndEvent(t, set, allowedEvent, harms.NeutralContent())
 }
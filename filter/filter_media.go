@@ -3,6 +3,7 @@ package filter
 import (
 	"context"
 	"encoding/json"
+	"slices"
 
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
@@ -53,8 +54,13 @@ func (f *InstancedMediaFilter) CheckEvent(ctx context.Context, input *EventInput
 		return nil, err
 	}
 
+	msgtypes := []string{content.Msgtype}
+	if content.NewContent != nil {
+		// Edits can replace a text message with media
+		msgtypes = append(msgtypes, content.NewContent.Msgtype)
+	}
 	for _, mediaType := range f.mediaTypes {
-		if mediaType == content.Msgtype {
+		if slices.Contains(msgtypes, mediaType) {
 			return harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia), nil
 		}
 	}
@@ -63,5 +69,6 @@ func (f *InstancedMediaFilter) CheckEvent(ctx context.Context, input *EventInput
 }
 
 type msgtypeOnly struct {
-	Msgtype string `json:"msgtype"`
+	Msgtype    string       `json:"msgtype"`
+	NewContent *msgtypeOnly `json:"m.new_content"`
 }
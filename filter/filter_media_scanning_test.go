@@ -10,6 +10,7 @@ import (
 	"github.com/matrix-org/policyserv/content"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/media"
+	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -202,3 +203,79 @@ func TestMediaScanningFilterGracefullyHandlesScannerError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, cached)
 }
+
+func TestMediaScanningFilterWithLocalHashes(t *testing.T) {
+	t.Parallel()
+
+	cnf := &SetConfig{
+		CommunityId:     storage.NextId(),
+		CommunityConfig: &config.CommunityConfig{},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{MediaScanningFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	scanner, err := content.NewLocalHashScanner(memStorage, cnf.CommunityId, []string{"shock"}, 8)
+	assert.NoError(t, err)
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), scanner)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	bannedBytes := test.MustMakeImage(t, 400, 300, 0)
+	repostBytes := test.MustMakeImage(t, 200, 150, 0) // same image, but resized
+	otherBytes := test.MustMakeImage(t, 400, 300, 1)
+	fileBytes := []byte("not an image")
+	downloader := test.MustMakeMediaDownloader(t).
+		Set("example.org", "repost", repostBytes).
+		Set("example.org", "other", otherBytes).
+		Set("example.org", "file", fileBytes)
+
+	// Ban the image by perceptual hash, and the other media in a bank which isn't enabled
+	ctx := context.Background()
+	err = memStorage.UpsertMediaHash(ctx, &storage.StoredMediaHash{
+		CommunityId: cnf.CommunityId,
+		Bank:        "shock",
+		Kind:        storage.MediaHashKindPHash,
+		Value:       content.HashMedia(bannedBytes)[storage.MediaHashKindPHash],
+	})
+	assert.NoError(t, err)
+	for _, b := range [][]byte{otherBytes, fileBytes} {
+		err = memStorage.UpsertMediaHash(ctx, &storage.StoredMediaHash{
+			CommunityId: cnf.CommunityId,
+			Bank:        "disabled",
+			Kind:        storage.MediaHashKindSha256,
+			Value:       content.HashMedia(b)[storage.MediaHashKindSha256],
+		})
+		assert.NoError(t, err)
+	}
+
+	assertCheckMedia := func(mxcUri string, expected *harms.ContentInfo) {
+		event := test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  "!foo:example.org",
+			Type:    "m.room.message",
+			Content: map[string]any{"msgtype": "m.image", "body": "image.png", "url": mxcUri},
+		})
+		info, err := set.CheckEvent(ctx, event, downloader)
+		assert.NoError(t, err)
+		test.AssertEqualContentInfo(t, expected, info)
+	}
+	assertCheckMedia("mxc://example.org/repost", harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia))
+	assertCheckMedia("mxc://example.org/other", harms.NeutralContent())
+	assertCheckMedia("mxc://example.org/file", harms.NeutralContent())
+
+	// Files can be banned by SHA-256 too
+	err = memStorage.UpsertMediaHash(ctx, &storage.StoredMediaHash{
+		CommunityId: cnf.CommunityId,
+		Bank:        "shock",
+		Kind:        storage.MediaHashKindSha256,
+		Value:       content.HashMedia(fileBytes)[storage.MediaHashKindSha256],
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, memStorage.DeleteMediaClassifications(ctx, cnf.CommunityId)) // as the API would
+	assertCheckMedia("mxc://example.org/file", harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia))
+}
@@ -43,6 +43,17 @@ func TestMediaFilter(t *testing.T) {
 			"msgtype": "m.image",
 		},
 	})
+	spammyEdit := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$spam3",
+		RoomId:  "!foo:example.org",
+		Type:    "m.room.message",
+		Content: map[string]any{
+			"msgtype":       "m.text",
+			"body":          "* doesn't matter",
+			"m.new_content": map[string]any{"msgtype": "m.image", "body": "doesn't matter"},
+			"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": "$neutral2"},
+		},
+	})
 	neutralEvent1 := test.MustMakePDU(&test.BaseClientEvent{
 		EventId: "$neutral1",
 		RoomId:  "!foo:example.org",
@@ -70,6 +81,7 @@ func TestMediaFilter(t *testing.T) {
 
 	AssertCheckEvent(t, set, spammyEvent1, harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia))
 	AssertCheckEvent(t, set, spammyEvent2, harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia))
+	AssertCheckEvent(t, set, spammyEdit, harms.ProhibitedContent(harms.SpamGeneral, harms.PolicyservMedia))
 	AssertCheckEvent(t, set, neutralEvent1, harms.NeutralContent())
 	AssertCheckEvent(t, set, neutralEvent2, harms.NeutralContent())
 	AssertCheckEvent(t, set, noopEvent1, harms.NeutralContent())
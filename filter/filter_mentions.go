@@ -7,12 +7,17 @@ import (
 
 	goSet "github.com/deckarep/golang-set"
 	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 )
 
 const MentionsFilterName = "MentionsFilter"
 
+// mentionsNormalization - The text normalization steps used when counting mentions. HTML is kept because pills (links
+// to users) are counted as mentions, and leetspeak is kept because user IDs and display names often contain digits.
+const mentionsNormalization = event.NormalizeInvisible | event.NormalizeConfusables | event.NormalizeWhitespace
+
 func init() {
 	mustRegister(MentionsFilterName, &MentionsFilter{})
 }
@@ -25,6 +30,7 @@ func (m *MentionsFilter) MakeFor(set *Set) (Instanced, error) {
 		set:           set,
 		maxMentions:   internal.Dereference(set.communityConfig.MentionFilterMaxMentions),
 		minNameLength: internal.Dereference(set.communityConfig.MentionFilterMinPlaintextLength),
+		normalization: set.normalizationFor(MentionsFilterName, mentionsNormalization),
 	}, nil
 }
 
@@ -32,33 +38,43 @@ type InstancedMentionsFilter struct {
 	set           *Set
 	maxMentions   int
 	minNameLength int
+	normalization event.Normalization
 }
 
 func (f *InstancedMentionsFilter) Name() string {
 	return MentionsFilterName
 }
 
-func (f *InstancedMentionsFilter) CountMentionsToLimit(ctx context.Context, event gomatrixserverlib.PDU, limit int) (int, error) {
-	roomId := event.RoomID().String()
+func (f *InstancedMentionsFilter) CountMentionsToLimit(ctx context.Context, pdu gomatrixserverlib.PDU, limit int) (int, error) {
+	roomId := pdu.RoomID().String()
 
-	// Return early on non-message events
-	if event.Type() != "m.room.message" {
+	// Return early on state events
+	if pdu.StateKey() != nil {
 		return 0, nil
 	}
 
 	content := &mentionsContent{}
-	err := json.Unmarshal(event.Content(), &content)
+	err := json.Unmarshal(pdu.Content(), &content)
 	if err != nil {
 		return 0, err
 	}
+	text := event.ExtractContent(pdu)
+	if !text.HasText() {
+		return 0, nil // clients won't render anything, so won't render any mentions either
+	}
 
 	rawUserIds, rawDisplayNames, err := f.set.storage.GetUserIdsAndDisplayNamesByRoomId(ctx, roomId)
 	if err != nil {
 		return 0, err
 	}
 
+	// Display names are normalized like the message so lookalike characters and invisible characters don't hide a
+	// mention, and don't make a mention out of nothing either.
+	body := f.normalize(text.PlainText())
+	formattedBody := f.normalize(strings.Join(text.Html, "\n"))
 	displayNames := goSet.NewSet()
 	for _, displayName := range rawDisplayNames {
+		displayName = f.normalize(displayName)
 		if len(displayName) > 0 && len(displayName) >= f.minNameLength {
 			displayNames.Add(displayName)
 		}
@@ -86,9 +102,9 @@ func (f *InstancedMentionsFilter) CountMentionsToLimit(ctx context.Context, even
 	// names and not the total list of display names.
 	loopIter := func(i interface{}) bool {
 		userIdOrDisplayName := i.(string)
-		if strings.Contains(content.Body, userIdOrDisplayName) {
+		if strings.Contains(body, userIdOrDisplayName) {
 			numMentionedUserIds++
-		} else if strings.Contains(content.FormattedBody, userIdOrDisplayName) {
+		} else if strings.Contains(formattedBody, userIdOrDisplayName) {
 			numMentionedUserIds++
 		}
 		return numMentionedUserIds >= limit
@@ -105,6 +121,10 @@ func (f *InstancedMentionsFilter) CountMentionsToLimit(ctx context.Context, even
 	return numMentionedUserIds, nil
 }
 
+func (f *InstancedMentionsFilter) normalize(text string) string {
+	return event.NormalizeText(text, f.normalization)
+}
+
 func (f *InstancedMentionsFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
 	numMentionedUserIds, err := f.CountMentionsToLimit(ctx, input.Event, f.maxMentions)
 	if err != nil {
@@ -122,6 +142,4 @@ type mentionsContent struct {
 	Mentions struct {
 		UserIDs []string `json:"user_ids"`
 	} `json:"m.mentions"`
-	Body          string `json:"body"`
-	FormattedBody string `json:"formatted_body"`
 }
@@ -24,7 +24,7 @@ type MentionsFrequencyFilter struct {
 
 func (f *MentionsFrequencyFilter) MakeFor(set *Set) (Instanced, error) {
 	// The rate limit is set per second over a one minute window, so capture one minute of data.
-	counter, err := frequency.NewCounter(set.pubsub, fmt.Sprintf("fm.%s", set.communityId), 60*time.Second)
+	counter, err := frequency.NewCounter(counterBackendFor(set), set.pubsub, fmt.Sprintf("fm.%s", set.communityId), 60*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -38,13 +38,14 @@ func (f *MentionsFrequencyFilter) MakeFor(set *Set) (Instanced, error) {
 			set:           set,
 			maxMentions:   int(math.Ceil((rateLimit * 60) + 1)), // plus one to ensure we will automatically exceed the rate limit
 			minNameLength: internal.Dereference(set.communityConfig.MentionFrequencyFilterMinPlaintextLength),
+			normalization: set.normalizationFor(MentionsFrequencyFilterName, mentionsNormalization),
 		},
 	}, nil
 }
 
 type InstancedMentionsFrequencyFilter struct {
 	set            *Set
-	counter        *frequency.Counter
+	counter        frequency.Counter
 	rateLimit      float64
 	mentionsFilter *InstancedMentionsFilter
 }
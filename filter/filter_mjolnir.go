@@ -2,8 +2,13 @@ package filter
 
 import (
 	"context"
+	"slices"
 
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/ryanuber/go-glob"
 )
 
 const MjolnirFilterName = "MjolnirFilter"
@@ -19,12 +24,14 @@ func (m *MjolnirFilter) MakeFor(set *Set) (Instanced, error) {
 	return &InstancedMjolnirFilter{
 		set:          set,
 		policyRoomId: set.instanceConfig.MjolnirFilterRoomID,
+		policyLists:  internal.Dereference(set.communityConfig.MjolnirFilterPolicyLists),
 	}, nil
 }
 
 type InstancedMjolnirFilter struct {
 	set          *Set
 	policyRoomId string
+	policyLists  []*config.PolicyList
 }
 
 func (f *InstancedMjolnirFilter) Name() string {
@@ -37,14 +44,70 @@ func (f *InstancedMjolnirFilter) CheckEvent(ctx context.Context, input *EventInp
 		return harms.NeutralContent(), nil
 	}
 
-	banned, err := f.set.storage.IsUserBannedInList(ctx, f.policyRoomId, string(input.Event.SenderID()))
-	if err != nil {
-		return nil, err
+	eventHarms := make([]harms.Harm, 0)
+	if f.policyRoomId != "" {
+		banned, err := f.set.storage.IsUserBannedInList(ctx, f.policyRoomId, string(input.Event.SenderID()))
+		if err != nil {
+			return nil, err
+		}
+		if banned {
+			eventHarms = append(eventHarms, harms.OtherGeneral)
+		}
 	}
 
-	if banned {
-		return harms.ProhibitedContent(harms.OtherGeneral), nil
+	for _, list := range f.policyLists {
+		matched, err := f.matchesList(ctx, list, input)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			harm := harms.Harm(list.Harm)
+			if harm == "" {
+				harm = harms.OtherGeneral
+			}
+			eventHarms = append(eventHarms, harm)
+		}
 	}
 
+	if len(eventHarms) > 0 {
+		return harms.ProhibitedContent(eventHarms...), nil
+	}
 	return harms.NeutralContent(), nil
 }
+
+func (f *InstancedMjolnirFilter) matchesList(ctx context.Context, list *config.PolicyList, input *EventInput) (bool, error) {
+	recommendations := list.Recommendations
+	if len(recommendations) == 0 {
+		recommendations = []string{"m.ban"}
+	}
+
+	userId, err := spec.NewUserID(string(input.Event.SenderID()), true)
+	if err != nil {
+		return false, err
+	}
+
+	rules, err := f.set.storage.GetListRules(ctx, list.RoomId)
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range rules {
+		if !slices.Contains(recommendations, rule.Recommendation) {
+			continue
+		}
+		entity := ""
+		switch rule.EntityType {
+		case "m.policy.rule.user":
+			entity = userId.String()
+		case "m.policy.rule.server":
+			entity = string(userId.Domain())
+		case "m.policy.rule.room":
+			entity = input.Event.RoomID().String()
+		default:
+			continue
+		}
+		if glob.Glob(rule.Entity, entity) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"testing"
 
+	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,9 +37,9 @@ func TestMjolnirFilter(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, set)
 
-	err = memStorage.SetListBanRules(ctx, mjolnirRoomId, map[string]string{
-		"@alice*:example.org": "m.policy.rule.user",
-		"*.example.org":       "m.policy.rule.server",
+	err = memStorage.SetListRules(ctx, mjolnirRoomId, []*storage.StoredListRule{
+		{EntityType: "m.policy.rule.user", Entity: "@alice*:example.org", Recommendation: "m.ban"},
+		{EntityType: "m.policy.rule.server", Entity: "*.example.org", Recommendation: "m.ban"},
 	})
 	assert.NoError(t, err)
 
@@ -92,3 +94,67 @@ func TestMjolnirFilter(t *testing.T) {
 	AssertCheckEvent(t, set, neutralEvent2, harms.NeutralContent())
 	AssertCheckEvent(t, set, noopEvent1, harms.NeutralContent())
 }
+
+func TestMjolnirFilterCommunityPolicyLists(t *testing.T) {
+	ctx := context.Background()
+
+	spamListRoomId := "!spam_list:example.org"
+	roomListRoomId := "!room_list:example.org"
+	cnf := &SetConfig{
+		CommunityConfig: &config.CommunityConfig{
+			MjolnirFilterEnabled: internal.Pointer(true),
+			MjolnirFilterPolicyLists: &[]*config.PolicyList{{
+				RoomId: spamListRoomId,
+				Harm:   string(harms.SpamGeneral),
+			}, {
+				RoomId:          roomListRoomId,
+				Recommendations: []string{"m.ban", "org.example.takedown"},
+			}},
+		},
+		InstanceConfig: &config.InstanceConfig{
+			// No instance-wide list
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{MjolnirFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	err = memStorage.SetListRules(ctx, spamListRoomId, []*storage.StoredListRule{
+		{EntityType: "m.policy.rule.user", Entity: "@spammer*:example.org", Recommendation: "m.ban"},
+		{EntityType: "m.policy.rule.server", Entity: "spam.example.org", Recommendation: "m.ban"},
+		{EntityType: "m.policy.rule.user", Entity: "@carol:example.org", Recommendation: "org.example.takedown"}, // not acted upon
+	})
+	assert.NoError(t, err)
+	err = memStorage.SetListRules(ctx, roomListRoomId, []*storage.StoredListRule{
+		{EntityType: "m.policy.rule.room", Entity: "!bad*:example.org", Recommendation: "org.example.takedown"},
+		{EntityType: "m.policy.rule.user", Entity: "@spammer1:example.org", Recommendation: "m.ban"},
+	})
+	assert.NoError(t, err)
+
+	makeEvent := func(sender string, roomId string) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  roomId,
+			Type:    "m.room.message",
+			Sender:  sender,
+			Content: map[string]any{
+				"body": "doesn't matter",
+			},
+		})
+	}
+
+	AssertCheckEvent(t, set, makeEvent("@spammer2:example.org", "!foo:example.org"), harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, makeEvent("@alice:spam.example.org", "!foo:example.org"), harms.ProhibitedContent(harms.SpamGeneral))
+	AssertCheckEvent(t, set, makeEvent("@alice:example.org", "!bad_room:example.org"), harms.ProhibitedContent(harms.OtherGeneral))
+	AssertCheckEvent(t, set, makeEvent("@spammer1:example.org", "!foo:example.org"), harms.ProhibitedContent(harms.SpamGeneral, harms.OtherGeneral))
+	AssertCheckEvent(t, set, makeEvent("@carol:example.org", "!foo:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("@alice:example.org", "!foo:example.org"), harms.NeutralContent())
+}
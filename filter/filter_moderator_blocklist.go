@@ -0,0 +1,189 @@
+package filter
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/policyserv/event"
+	"github.com/matrix-org/policyserv/fingerprint"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+const ModeratorBlocklistFilterName = "ModeratorBlocklistFilter"
+
+func init() {
+	mustRegister(ModeratorBlocklistFilterName, &ModeratorBlocklistFilter{})
+}
+
+type ModeratorBlocklistFilter struct {
+}
+
+func (m *ModeratorBlocklistFilter) MakeFor(set *Set) (Instanced, error) {
+	return newModeratorBlocklistFilter(set)
+}
+
+// blockedFingerprint - A blocked fingerprint, parsed for comparison.
+type blockedFingerprint struct {
+	fingerprint uint64
+	expires     time.Time
+}
+
+type InstancedModeratorBlocklistFilter struct {
+	set         *Set
+	maxDistance int
+	minLength   int
+
+	lock         sync.RWMutex
+	fingerprints []*blockedFingerprint
+	mediaUris    map[string]time.Time // MXC URI -> expiry
+
+	unsubscribeFn func() error
+}
+
+func newModeratorBlocklistFilter(set *Set) (*InstancedModeratorBlocklistFilter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Subscribe before loading so we don't miss changes which happen in between
+	ch, err := set.pubsub.Subscribe(ctx, pubsub.TopicBlockedContent)
+	if err != nil {
+		return nil, err
+	}
+	f := &InstancedModeratorBlocklistFilter{
+		set:         set,
+		maxDistance: internal.Dereference(set.communityConfig.ModeratorBlocklistFilterMaxDistance),
+		minLength:   internal.Dereference(set.communityConfig.ModeratorBlocklistFilterMinLength),
+		unsubscribeFn: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			return set.pubsub.Unsubscribe(ctx, ch)
+		},
+	}
+	err = f.reload(ctx)
+	if err != nil {
+		_ = f.unsubscribeFn()
+		return nil, err
+	}
+	go func(ch <-chan string, f *InstancedModeratorBlocklistFilter) {
+		keepLoop := true
+		for keepLoop {
+			select {
+			case communityId, stillOpen := <-ch:
+				if communityId == pubsub.ClosingValue {
+					log.Println("Closing blocked content listener")
+					keepLoop = false
+					break // `select`
+				}
+				if communityId == "" { // sometimes when closing we also get an empty string over the channel
+					if !stillOpen {
+						keepLoop = false
+						break // `select`
+					}
+					continue // `for` loop
+				}
+				if communityId != f.set.communityId {
+					continue // `for` loop
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+				err := f.reload(ctx)
+				cancel()
+				if err != nil {
+					// We keep the old blocklist rather than dropping it entirely
+					log.Printf("[%s] Non-fatal error reloading blocked contents: %s", f.set.communityId, err)
+				}
+			}
+		}
+	}(ch, f)
+	return f, nil
+}
+
+// reload - Replaces the in-memory blocklist with the community's stored blocked contents.
+func (f *InstancedModeratorBlocklistFilter) reload(ctx context.Context) error {
+	stored, err := f.set.storage.GetActiveBlockedContents(ctx, f.set.communityId)
+	if err != nil {
+		return err
+	}
+	fingerprints := make([]*blockedFingerprint, 0)
+	mediaUris := make(map[string]time.Time)
+	for _, b := range stored {
+		expires := time.UnixMilli(b.ExpiresTimestampMillis)
+		switch b.Kind {
+		case storage.ContentKindFingerprint:
+			fp, err := fingerprint.Parse(b.Value)
+			if err != nil {
+				log.Printf("[%s] Skipping invalid blocked fingerprint '%s': %s", f.set.communityId, b.Value, err)
+				continue
+			}
+			fingerprints = append(fingerprints, &blockedFingerprint{fingerprint: fp, expires: expires})
+		case storage.ContentKindMediaUri:
+			mediaUris[b.Value] = expires
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.fingerprints = fingerprints
+	f.mediaUris = mediaUris
+	log.Printf("[%s] Loaded %d blocked contents", f.set.communityId, len(stored))
+	return nil
+}
+
+func (f *InstancedModeratorBlocklistFilter) isFingerprintBlocked(fp uint64) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	// We double check expiration because the blocklist is only reloaded when it changes
+	now := time.Now()
+	for _, blocked := range f.fingerprints {
+		if blocked.expires.After(now) && fingerprint.Distance(fp, blocked.fingerprint) <= f.maxDistance {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *InstancedModeratorBlocklistFilter) isMediaBlocked(uri string) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	expires, ok := f.mediaUris[uri]
+	return ok && expires.After(time.Now())
+}
+
+func (f *InstancedModeratorBlocklistFilter) Name() string {
+	return ModeratorBlocklistFilterName
+}
+
+func (f *InstancedModeratorBlocklistFilter) Close() error {
+	return f.unsubscribeFn()
+}
+
+func (f *InstancedModeratorBlocklistFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
+	eventId := input.Event.EventID()
+	roomId := input.Event.RoomID().String()
+
+	content := event.ExtractContent(input.Event)
+	for _, url := range content.MediaUrls {
+		if f.isMediaBlocked(url) {
+			log.Printf("[%s | %s] Media '%s' was previously removed by a moderator", eventId, roomId, url)
+			return harms.ProhibitedContent(harms.OtherGeneral), nil
+		}
+	}
+
+	// This must match how homeserver.recordRecentContents fingerprints events
+	text := content.PlainText()
+	if text == "" || fingerprint.NormalizedLength(text) < f.minLength {
+		return harms.NeutralContent(), nil
+	}
+	if f.isFingerprintBlocked(fingerprint.Simhash(text)) {
+		log.Printf("[%s | %s] Message is similar to one previously removed by a moderator", eventId, roomId)
+		return harms.ProhibitedContent(harms.OtherGeneral), nil
+	}
+	return harms.NeutralContent(), nil
+}
@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/fingerprint"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeratorBlocklistFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cnf := &SetConfig{
+		CommunityId: "TestModeratorBlocklistFilter",
+		CommunityConfig: &config.CommunityConfig{
+			ModeratorBlocklistFilterMaxDistance: internal.Pointer(6),
+			ModeratorBlocklistFilterMinLength:   internal.Pointer(10),
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{ModeratorBlocklistFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	const spam = "Earn $5000 a week from home!! Message me now to find out how, limited spots available"
+	block := func(communityId string, kind storage.ContentKind, value string, expires time.Time) {
+		err := memStorage.UpsertBlockedContents(ctx, []*storage.StoredBlockedContent{{
+			CommunityId:            communityId,
+			Kind:                   kind,
+			Value:                  value,
+			EventId:                "$removed",
+			ExpiresTimestampMillis: expires.UnixMilli(),
+		}})
+		assert.NoError(t, err)
+	}
+
+	// Blocked contents which exist before the set is created should be loaded immediately
+	block(cnf.CommunityId, storage.ContentKindFingerprint, fingerprint.Format(fingerprint.Simhash(spam)), time.Now().Add(1*time.Hour))
+	block(cnf.CommunityId, storage.ContentKindFingerprint, fingerprint.Format(fingerprint.Simhash("this expired a while ago, so should be allowed")), time.Now().Add(-1*time.Hour))
+
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	makeEvent := func(content map[string]any) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  "!foo:example.org",
+			Type:    "m.room.message",
+			Sender:  "@alice:example.org",
+			Content: content,
+		})
+	}
+	mutatedSpamEvent := makeEvent(map[string]any{"body": "earn $5000 a week from home! message me now to find out how... limited spots available!!"})
+	unrelatedEvent := makeEvent(map[string]any{"body": "Has anyone tried the new release yet? It seems much faster"})
+	expiredEvent := makeEvent(map[string]any{"body": "this expired a while ago, so should be allowed"})
+	imageEvent := makeEvent(map[string]any{"body": "image.png", "msgtype": "m.image", "url": "mxc://example.org/image"})
+	thumbnailEvent := makeEvent(map[string]any{"body": "video.mp4", "msgtype": "m.video", "url": "mxc://example.org/video", "info": map[string]any{"thumbnail_url": "mxc://example.org/thumbnail"}})
+	AssertCheckEvent(t, set, mutatedSpamEvent, harms.ProhibitedContent(harms.OtherGeneral))
+	AssertCheckEvent(t, set, unrelatedEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, expiredEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, imageEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, thumbnailEvent, harms.NeutralContent())
+	// Fields with the wrong type shouldn't stop the rest of the event being checked
+	malformedEvent := makeEvent(map[string]any{"body": 5, "msgtype": "m.video", "url": 5, "info": map[string]any{"thumbnail_url": "mxc://example.org/thumbnail"}})
+	AssertCheckEvent(t, set, malformedEvent, harms.NeutralContent())
+
+	// Block some media, including for an unrelated community
+	block(cnf.CommunityId, storage.ContentKindMediaUri, "mxc://example.org/thumbnail", time.Now().Add(1*time.Hour))
+	block("unrelated_community", storage.ContentKindMediaUri, "mxc://example.org/image", time.Now().Add(1*time.Hour))
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicBlockedContent, "unrelated_community"))
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicBlockedContent, cnf.CommunityId))
+
+	// Like the override prefilter tests, we need to give the filter a moment to reload
+	time.Sleep(1 * time.Second)
+
+	AssertCheckEvent(t, set, imageEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, thumbnailEvent, harms.ProhibitedContent(harms.OtherGeneral))
+	AssertCheckEvent(t, set, malformedEvent, harms.ProhibitedContent(harms.OtherGeneral))
+	AssertCheckEvent(t, set, mutatedSpamEvent, harms.ProhibitedContent(harms.OtherGeneral))
+}
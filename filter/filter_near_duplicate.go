@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/event"
+	"github.com/matrix-org/policyserv/fingerprint"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+)
+
+const NearDuplicateFilterName = "NearDuplicateFilter"
+
+func init() {
+	mustRegister(NearDuplicateFilterName, &NearDuplicateFilter{})
+}
+
+type NearDuplicateFilter struct {
+}
+
+func (f *NearDuplicateFilter) MakeFor(set *Set) (Instanced, error) {
+	window := time.Duration(internal.Dereference(set.communityConfig.NearDuplicateFilterWindowSeconds)) * time.Second
+	if window <= 0 {
+		return nil, fmt.Errorf("near duplicate filter window must be greater than zero")
+	}
+	tracker, err := fingerprint.NewTracker(counterBackendFor(set), set.pubsub, fmt.Sprintf("nd.%s", set.communityId), window)
+	if err != nil {
+		return nil, err
+	}
+	return &InstancedNearDuplicateFilter{
+		set:         set,
+		tracker:     tracker,
+		maxSenders:  internal.Dereference(set.communityConfig.NearDuplicateFilterMaxSenders),
+		maxRooms:    internal.Dereference(set.communityConfig.NearDuplicateFilterMaxRooms),
+		maxDistance: internal.Dereference(set.communityConfig.NearDuplicateFilterMaxDistance),
+		minLength:   internal.Dereference(set.communityConfig.NearDuplicateFilterMinLength),
+	}, nil
+}
+
+type InstancedNearDuplicateFilter struct {
+	set         *Set
+	tracker     fingerprint.Tracker
+	maxSenders  int
+	maxRooms    int
+	maxDistance int
+	minLength   int
+}
+
+func (f *InstancedNearDuplicateFilter) Name() string {
+	return NearDuplicateFilterName
+}
+
+func (f *InstancedNearDuplicateFilter) Close() error {
+	return f.tracker.Close()
+}
+
+func (f *InstancedNearDuplicateFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
+	if input.Event.StateKey() != nil {
+		return harms.NeutralContent(), nil
+	}
+
+	content := event.ExtractContent(input.Event)
+	text := content.PlainText()
+	if fingerprint.NormalizedLength(text) < f.minLength {
+		// Short messages like "hi" are sent by lots of people legitimately
+		return harms.NeutralContent(), nil
+	}
+
+	sender := string(input.Event.SenderID())
+	roomId := input.Event.RoomID().String()
+	fp := fingerprint.Simhash(text)
+
+	// Capture the similar sightings before adding our own, in case it gets picked up quickly by the tracker
+	similar, err := f.tracker.Similar(fp, f.maxDistance)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to get similar fingerprints for %s", input.Event.EventID()), err)
+	}
+	err = f.tracker.Add(&fingerprint.Sighting{
+		Fingerprint: fp,
+		Sender:      sender,
+		RoomId:      roomId,
+		Timestamp:   time.Now(),
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to add fingerprint for %s", input.Event.EventID()), err)
+	}
+
+	// Count the distinct senders and rooms, including the current event
+	senders := map[string]bool{sender: true}
+	rooms := map[string]bool{roomId: true}
+	for _, sighting := range similar {
+		senders[sighting.Sender] = true
+		rooms[sighting.RoomId] = true
+	}
+
+	log.Printf("[%s | %s] Fingerprint %016x seen from %d senders in %d rooms", input.Event.EventID(), roomId, fp, len(senders), len(rooms))
+	if f.maxSenders > 0 && len(senders) > f.maxSenders {
+		return harms.ProhibitedContent(harms.SpamFlooding), nil
+	}
+	if f.maxRooms > 0 && len(rooms) > f.maxRooms {
+		return harms.ProhibitedContent(harms.SpamFlooding), nil
+	}
+	return harms.NeutralContent(), nil
+}
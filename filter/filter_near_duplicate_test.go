@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/frequency"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearDuplicateFilter(t *testing.T) {
+	t.Parallel()
+
+	cnf := &SetConfig{
+		CommunityId: storage.NextId(),
+		CommunityConfig: &config.CommunityConfig{
+			NearDuplicateFilterMaxSenders:    internal.Pointer(2),
+			NearDuplicateFilterMaxRooms:      internal.Pointer(2),
+			NearDuplicateFilterWindowSeconds: internal.Pointer(60),
+			NearDuplicateFilterMaxDistance:   internal.Pointer(6),
+			NearDuplicateFilterMinLength:     internal.Pointer(10),
+		},
+		InstanceConfig: &config.InstanceConfig{
+			FrequencyCounterBackend: frequency.BackendMemory, // avoids needing to wait for the pubsub layer to settle
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{NearDuplicateFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	makeEvent := func(eventType string, sender string, roomId string, body string) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$test",
+			RoomId:  roomId,
+			Type:    eventType,
+			Sender:  sender,
+			Content: map[string]any{
+				"body": body,
+			},
+		})
+	}
+	const spam = "Earn $5000 a week from home!! Message me now to find out how, limited spots available"
+	const mutatedSpam = "earn $5000 a week from home! message me now to find out how... limited spots available!!"
+
+	// Unrelated messages, short messages, and other event types don't count
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@alice:example.org", "!room1:example.org", "Has anyone tried the new release yet? It seems much faster"), harms.NeutralContent())
+	for _, sender := range []string{"@alice:example.org", "@bob:example.org", "@charlie:example.org"} {
+		AssertCheckEvent(t, set, makeEvent("m.room.message", sender, "!room1:example.org", "hello!"), harms.NeutralContent())
+		AssertCheckEvent(t, set, makeEvent("org.example.custom", sender, "!room1:example.org", spam), harms.NeutralContent())
+	}
+
+	// Two senders are allowed, but the third is not, even with slightly mutated text
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@spam1:example.org", "!room1:example.org", spam), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@spam2:example.org", "!room1:example.org", mutatedSpam), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@spam3:example.org", "!room1:example.org", spam), harms.ProhibitedContent(harms.SpamFlooding))
+
+	// A single sender posting across too many rooms is caught by the room limit
+	const otherSpam = "Join our totally legitimate crypto giveaway at the link in my profile"
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@spam4:example.org", "!room1:example.org", otherSpam), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@spam4:example.org", "!room2:example.org", otherSpam), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeEvent("m.room.message", "@spam4:example.org", "!room3:example.org", otherSpam), harms.ProhibitedContent(harms.SpamFlooding))
+}
@@ -0,0 +1,45 @@
+package filter
+
+import (
+	"errors"
+
+	"github.com/matrix-org/policyserv/ai"
+	"github.com/matrix-org/policyserv/internal"
+)
+
+const OpenAIChatFilterName = "OpenAIChatFilter"
+
+func init() {
+	mustRegister(OpenAIChatFilterName, &OpenAIChatFilter{})
+}
+
+// OpenAIChatFilter - Classifies events with any OpenAI-compatible chat completions endpoint, using the same API key
+// and endpoint resolution as OpenAIOmniFilter.
+type OpenAIChatFilter struct {
+}
+
+var ErrOpenAIChatFilterNoModel = errors.New("openai_chat_filter_model must be set to use the OpenAI chat filter")
+
+func (o *OpenAIChatFilter) MakeFor(set *Set) (Instanced, error) {
+	if internal.Dereference(set.communityConfig.OpenAIChatFilterModel) == "" {
+		return nil, ErrOpenAIChatFilterNoModel
+	}
+	client, err := openAIClientFor(set, internal.Dereference(set.communityConfig.OpenAIChatFilterEnabled))
+	if err != nil {
+		return nil, err
+	}
+	provider, err := ai.NewOpenAIChatModeration(client.apiKey, client.options...)
+	if err != nil {
+		return nil, err
+	}
+	providerConfig := &ai.OpenAIChatModerationConfig{
+		OpenAIModerationCategoryConfig: openAICategoryConfigFor(set.communityConfig),
+		FailSecure:                     internal.Dereference(set.communityConfig.OpenAIFilterFailSecure),
+		Model:                          internal.Dereference(set.communityConfig.OpenAIChatFilterModel),
+		Prompt:                         internal.Dereference(set.communityConfig.OpenAIChatFilterPrompt),
+	}
+	if !client.restrictToAllowedRooms {
+		return NewUnrestrictedAIExecutorFilter(OpenAIChatFilterName, set, providerConfig, provider), nil
+	}
+	return NewInstancedAIExecutorFilter(OpenAIChatFilterName, set, providerConfig, provider, set.instanceConfig.OpenAIAllowedRoomIds), nil
+}
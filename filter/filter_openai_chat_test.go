@@ -0,0 +1,64 @@
+package filter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matrix-org/policyserv/ai"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIChatFilter(t *testing.T) {
+	t.Parallel()
+
+	apiKey := "not_a_real_key"
+	model := "llama3"
+	mockApi := test.MakeOpenAIChatServer(t, apiKey, model)
+	defer mockApi.Close()
+
+	// Unlike the omni filter, we can run the whole filter because the community chooses the (mock) endpoint
+	cnf := &SetConfig{
+		InstanceConfig: &config.InstanceConfig{
+			OpenAIAllowedDomains: []string{mockApi.Listener.Addr().String()},
+		},
+		CommunityConfig: &config.CommunityConfig{
+			OpenAIFilterFailSecure:  internal.Pointer(true),
+			OpenAIFilterApiKey:      internal.Pointer(apiKey),
+			OpenAIFilterBaseUrl:     internal.Pointer(mockApi.URL),
+			OpenAIChatFilterEnabled: internal.Pointer(true),
+			OpenAIChatFilterModel:   internal.Pointer(model),
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{OpenAIChatFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	instanced, ok := set.groups[0].filters[0].(*InstancedAIExecutorFilter[*ai.OpenAIChatModerationConfig])
+	assert.True(t, ok)
+	assert.Equal(t, OpenAIChatFilterName, instanced.Name())
+	assert.Equal(t, &ai.OpenAIChatModerationConfig{FailSecure: true, Model: model}, instanced.config)
+
+	ret, err := instanced.CheckEvent(context.Background(), &EventInput{Event: test.MustMakeKeywordEvent(test.KeywordSpammy)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.HarassmentGeneral), ret)
+	ret, err = instanced.CheckEvent(context.Background(), &EventInput{Event: test.MustMakeKeywordEvent(test.KeywordNeutral)})
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), ret)
+
+	// The filter can't be created without a model
+	cnf.CommunityConfig.OpenAIChatFilterModel = nil
+	_, err = NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.ErrorIs(t, err, ErrOpenAIChatFilterNoModel)
+}
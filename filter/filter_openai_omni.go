@@ -1,12 +1,20 @@
 package filter
 
 import (
+	"errors"
+	"net/url"
+	"slices"
+
 	"github.com/matrix-org/policyserv/ai"
+	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/internal"
+	"github.com/openai/openai-go/v3/option"
 )
 
 const OpenAIOmniFilterName = "OpenAIOmniFilter"
 
+var ErrOpenAIBaseUrlDomainNotAllowed = errors.New("openai_filter_base_url: domain not allowed")
+
 func init() {
 	mustRegister(OpenAIOmniFilterName, &OpenAIOmniFilter{})
 }
@@ -15,13 +23,96 @@ type OpenAIOmniFilter struct {
 }
 
 func (o *OpenAIOmniFilter) MakeFor(set *Set) (Instanced, error) {
-	provider, err := ai.NewOpenAIOmniModeration(set.instanceConfig)
+	client, err := openAIClientFor(set, internal.Dereference(set.communityConfig.OpenAIFilterEnabled))
+	if err != nil {
+		return nil, err
+	}
+	var cache ai.MediaScoreCache
+	if !client.communityEndpoint {
+		// Scores are shared with other communities, so can't come from an endpoint the community controls
+		cache = set.storage
+	}
+	provider, err := ai.NewOpenAIOmniModeration(client.apiKey, cache, client.options...)
 	if err != nil {
 		return nil, err
 	}
 	providerConfig := &ai.OpenAIOmniModerationConfig{
-		FailSecure: internal.Dereference(set.communityConfig.OpenAIFilterFailSecure),
+		OpenAIModerationCategoryConfig: openAICategoryConfigFor(set.communityConfig),
+		FailSecure:                     internal.Dereference(set.communityConfig.OpenAIFilterFailSecure),
+		MaxMediaBytes:                  set.instanceConfig.OpenAIMaxMediaBytes,
+	}
+	if !client.restrictToAllowedRooms {
+		return NewUnrestrictedAIExecutorFilter(OpenAIOmniFilterName, set, providerConfig, provider), nil
 	}
 	instanced := NewInstancedAIExecutorFilter(OpenAIOmniFilterName, set, providerConfig, provider, set.instanceConfig.OpenAIAllowedRoomIds)
 	return instanced, nil
 }
+
+type openAIClient struct {
+	apiKey  string
+	options []option.RequestOption
+	// restrictToAllowedRooms - When true, the filter only runs in the instance's OpenAIAllowedRoomIds.
+	restrictToAllowedRooms bool
+	// communityEndpoint - When true, the community chose the endpoint.
+	communityEndpoint bool
+}
+
+// openAIClientFor - Determines which API key and endpoint a community's AI filter uses. The instance's API key is never
+// sent to an endpoint chosen by the community.
+func openAIClientFor(set *Set, communityEnabled bool) (*openAIClient, error) {
+	communityApiKey := internal.Dereference(set.communityConfig.OpenAIFilterApiKey)
+	communityBaseUrl := internal.Dereference(set.communityConfig.OpenAIFilterBaseUrl)
+	if !communityEnabled {
+		// The community's own settings only apply once the community enables the filter. Until then, the filter only
+		// runs where the instance would run it anyway.
+		communityApiKey = ""
+		communityBaseUrl = ""
+	}
+	if communityBaseUrl != "" {
+		if err := ValidateOpenAIBaseUrl(communityBaseUrl, set.instanceConfig.OpenAIAllowedDomains); err != nil {
+			return nil, err
+		}
+		return &openAIClient{
+			apiKey:            communityApiKey,
+			options:           []option.RequestOption{option.WithBaseURL(communityBaseUrl)},
+			communityEndpoint: true,
+		}, nil
+	}
+
+	options := make([]option.RequestOption, 0)
+	if set.instanceConfig.OpenAIBaseUrl != "" {
+		options = append(options, option.WithBaseURL(set.instanceConfig.OpenAIBaseUrl))
+	}
+	if communityApiKey != "" {
+		return &openAIClient{apiKey: communityApiKey, options: options}, nil
+	}
+	return &openAIClient{
+		apiKey:  set.instanceConfig.OpenAIApiKey,
+		options: options,
+		// Communities can only use the instance's API key everywhere if the instance allows it. Otherwise, the filter
+		// is gated by the instance's allowed room IDs.
+		restrictToAllowedRooms: !(communityEnabled && set.instanceConfig.OpenAIAllowCommunities),
+	}, nil
+}
+
+func openAICategoryConfigFor(communityConfig *config.CommunityConfig) ai.OpenAIModerationCategoryConfig {
+	return ai.OpenAIModerationCategoryConfig{
+		Categories:         internal.Dereference(communityConfig.OpenAIFilterCategories),
+		CategoryThresholds: internal.Dereference(communityConfig.OpenAIFilterCategoryThresholds),
+	}
+}
+
+// ValidateOpenAIBaseUrl - Ensures a community-supplied endpoint is on a domain the instance allows.
+func ValidateOpenAIBaseUrl(target string, allowedDomains []string) error {
+	baseUrl, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if baseUrl.Scheme != "https" && baseUrl.Scheme != "http" {
+		return errors.New("openai_filter_base_url: must be an http or https URL")
+	}
+	if !slices.Contains(allowedDomains, baseUrl.Host) {
+		return ErrOpenAIBaseUrlDomainNotAllowed
+	}
+	return nil
+}
@@ -70,3 +70,86 @@ func TestOpenAIOmniFilter(t *testing.T) {
 	// correct API key is making it.
 	assert.IsType(t, &ai.OpenAIOmniModeration{}, instanced.aiProvider)
 }
+
+func TestOpenAIOmniFilterCommunityConfig(t *testing.T) {
+	t.Parallel()
+
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	makeSet := func(instanceConfig *config.InstanceConfig, communityConfig *config.CommunityConfig) (*Set, error) {
+		return NewSet(&SetConfig{
+			InstanceConfig:  instanceConfig,
+			CommunityConfig: communityConfig,
+			Groups: []*SetGroupConfig{{
+				EnabledNames:          []string{OpenAIOmniFilterName},
+				CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+			}},
+		}, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	}
+	instanceConfig := &config.InstanceConfig{
+		OpenAIAllowedRoomIds: []string{"!allowed:example.org"},
+		OpenAIApiKey:         "instance key",
+		OpenAIAllowedDomains: []string{"llm.example.org"},
+		OpenAIMaxMediaBytes:  1024,
+	}
+
+	// Communities using their own API key aren't restricted to the instance's allowed rooms, and their categories are
+	// carried through
+	set, err := makeSet(instanceConfig, &config.CommunityConfig{
+		OpenAIFilterEnabled:            internal.Pointer(true),
+		OpenAIFilterApiKey:             internal.Pointer("community key"),
+		OpenAIFilterCategories:         &[]string{"hate"},
+		OpenAIFilterCategoryThresholds: &map[string]float64{"hate": 0.7},
+	})
+	assert.NoError(t, err)
+	instanced, ok := set.groups[0].filters[0].(*InstancedAIExecutorFilter[*ai.OpenAIOmniModerationConfig])
+	assert.True(t, ok)
+	assert.Equal(t, &ai.OpenAIOmniModerationConfig{
+		OpenAIModerationCategoryConfig: ai.OpenAIModerationCategoryConfig{
+			Categories:         []string{"hate"},
+			CategoryThresholds: map[string]float64{"hate": 0.7},
+		},
+		MaxMediaBytes: 1024, // from the instance config
+	}, instanced.config)
+
+	// Communities can only use the instance's API key everywhere when the instance allows it
+	set, err = makeSet(instanceConfig, &config.CommunityConfig{OpenAIFilterEnabled: internal.Pointer(true)})
+	assert.NoError(t, err)
+	assert.IsType(t, &ConditionalFilter{}, set.groups[0].filters[0])
+	set, err = makeSet(&config.InstanceConfig{
+		OpenAIApiKey:           "instance key",
+		OpenAIAllowCommunities: true,
+	}, &config.CommunityConfig{OpenAIFilterEnabled: internal.Pointer(true)})
+	assert.NoError(t, err)
+	assert.IsType(t, &InstancedAIExecutorFilter[*ai.OpenAIOmniModerationConfig]{}, set.groups[0].filters[0])
+
+	// Communities which set an API key without enabling the filter are treated like any other community
+	set, err = makeSet(instanceConfig, &config.CommunityConfig{
+		OpenAIFilterApiKey:  internal.Pointer("community key"),
+		OpenAIFilterBaseUrl: internal.Pointer("https://llm.example.org/v1"),
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &ConditionalFilter{}, set.groups[0].filters[0])
+
+	// Community endpoints must be on an allowed domain, and never receive the instance's API key
+	_, err = makeSet(instanceConfig, &config.CommunityConfig{
+		OpenAIFilterEnabled: internal.Pointer(true),
+		OpenAIFilterApiKey:  internal.Pointer("community key"),
+		OpenAIFilterBaseUrl: internal.Pointer("https://evil.example.org/v1"),
+	})
+	assert.ErrorIs(t, err, ErrOpenAIBaseUrlDomainNotAllowed)
+	_, err = makeSet(instanceConfig, &config.CommunityConfig{
+		OpenAIFilterEnabled: internal.Pointer(true),
+		OpenAIFilterBaseUrl: internal.Pointer("https://llm.example.org/v1"),
+	})
+	assert.ErrorContains(t, err, "api key not set") // the instance key is never used for community endpoints
+	set, err = makeSet(instanceConfig, &config.CommunityConfig{
+		OpenAIFilterEnabled: internal.Pointer(true),
+		OpenAIFilterApiKey:  internal.Pointer("community key"),
+		OpenAIFilterBaseUrl: internal.Pointer("https://llm.example.org/v1"),
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &InstancedAIExecutorFilter[*ai.OpenAIOmniModerationConfig]{}, set.groups[0].filters[0])
+}
@@ -0,0 +1,164 @@
+package filter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+const OverridePrefilterName = "OverridePrefilter"
+
+func init() {
+	mustRegister(OverridePrefilterName, &OverridePrefilter{})
+}
+
+type OverridePrefilter struct {
+}
+
+func (o *OverridePrefilter) MakeFor(set *Set) (Instanced, error) {
+	return newOverridePrefilter(set)
+}
+
+type InstancedOverrideFilter struct {
+	set *Set
+
+	lock      sync.RWMutex
+	overrides map[storage.OverrideKind]map[string]bool // we don't really use the boolean value, but need to specify it
+
+	unsubscribeFn func() error
+}
+
+func newOverridePrefilter(set *Set) (*InstancedOverrideFilter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Subscribe before loading so we don't miss changes which happen in between
+	ch, err := set.pubsub.Subscribe(ctx, pubsub.TopicOverride)
+	if err != nil {
+		return nil, err
+	}
+	f := &InstancedOverrideFilter{
+		set: set,
+		unsubscribeFn: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			return set.pubsub.Unsubscribe(ctx, ch)
+		},
+	}
+	err = f.reload(ctx)
+	if err != nil {
+		_ = f.unsubscribeFn()
+		return nil, err
+	}
+	go func(ch <-chan string, f *InstancedOverrideFilter) {
+		keepLoop := true
+		for keepLoop {
+			select {
+			case communityId, stillOpen := <-ch:
+				if communityId == pubsub.ClosingValue {
+					log.Println("Closing override listener")
+					keepLoop = false
+					break // `select`
+				}
+				if communityId == "" { // sometimes when closing we also get an empty string over the channel
+					if !stillOpen {
+						keepLoop = false
+						break // `select`
+					}
+					continue // `for` loop
+				}
+				if communityId != f.set.communityId {
+					continue // `for` loop
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+				err := f.reload(ctx)
+				cancel()
+				if err != nil {
+					// We keep the old overrides rather than dropping them all
+					log.Printf("[%s] Non-fatal error reloading overrides: %s", f.set.communityId, err)
+				}
+			}
+		}
+	}(ch, f)
+	return f, nil
+}
+
+// reload - Replaces the in-memory overrides with the community's stored overrides.
+func (f *InstancedOverrideFilter) reload(ctx context.Context) error {
+	stored, err := f.set.storage.GetOverrides(ctx, f.set.communityId)
+	if err != nil {
+		return err
+	}
+	overrides := make(map[storage.OverrideKind]map[string]bool)
+	for _, o := range stored {
+		if _, ok := overrides[o.Kind]; !ok {
+			overrides[o.Kind] = make(map[string]bool)
+		}
+		overrides[o.Kind][o.Value] = true
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.overrides = overrides
+	log.Printf("[%s] Loaded %d overrides", f.set.communityId, len(stored))
+	return nil
+}
+
+func (f *InstancedOverrideFilter) isOverridden(kind storage.OverrideKind, value string) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.overrides[kind][value]
+}
+
+func (f *InstancedOverrideFilter) Name() string {
+	return OverridePrefilterName
+}
+
+func (f *InstancedOverrideFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
+	eventId := input.Event.EventID()
+	roomId := input.Event.RoomID().String()
+
+	if f.isOverridden(storage.OverrideKindEventId, eventId) {
+		log.Printf("[%s | %s] Event is allowed by override", eventId, roomId)
+		return harms.AllowedContent(), nil
+	}
+	if senderUserId := string(input.Event.SenderID()); f.isOverridden(storage.OverrideKindUserId, senderUserId) {
+		log.Printf("[%s | %s] Sender '%s' is allowed by override", eventId, roomId, senderUserId)
+		return harms.AllowedContent(), nil
+	}
+	if hash := ContentHash(input.Event); f.isOverridden(storage.OverrideKindContentHash, hash) {
+		log.Printf("[%s | %s] Content hash '%s' is allowed by override", eventId, roomId, hash)
+		return harms.AllowedContent(), nil
+	}
+
+	return harms.NeutralContent(), nil // no opinions when not overridden
+}
+
+func (f *InstancedOverrideFilter) Close() error {
+	log.Println("Closing override pubsub channel")
+	return f.unsubscribeFn()
+}
+
+// ContentHash - Returns the hash used by content_hash overrides. This is the hex-encoded SHA-256 hash of the event's
+// `body` if it has one, otherwise of the event's content as received.
+func ContentHash(event gomatrixserverlib.PDU) string {
+	toHash := event.Content()
+	bodyOnly := struct {
+		Body string `json:"body"`
+	}{}
+	if err := json.Unmarshal(event.Content(), &bodyOnly); err == nil && bodyOnly.Body != "" {
+		toHash = []byte(bodyOnly.Body)
+	}
+	hash := sha256.Sum256(toHash)
+	return hex.EncodeToString(hash[:])
+}
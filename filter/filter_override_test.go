@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverridePrefilter(t *testing.T) {
+	ctx := context.Background()
+
+	cnf := &SetConfig{
+		CommunityId:     "TestOverridePrefilter",
+		CommunityConfig: &config.CommunityConfig{},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{OverridePrefilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	// Overrides which exist before the set is created should be loaded immediately
+	err := memStorage.UpsertOverride(ctx, &storage.StoredOverride{
+		CommunityId: cnf.CommunityId,
+		Kind:        storage.OverrideKindEventId,
+		Value:       "$allowed_event",
+	})
+	assert.NoError(t, err)
+
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	allowedEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$allowed_event",
+		RoomId:  "!foo:example.org",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"body": "doesn't matter",
+		},
+	})
+	allowedSenderEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$allowed_sender",
+		RoomId:  "!foo:example.org",
+		Type:    "m.room.message",
+		Sender:  "@bob:example.org",
+		Content: map[string]any{
+			"body": "doesn't matter",
+		},
+	})
+	allowedBodyEvent := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$allowed_body",
+		RoomId:  "!foo:example.org",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"body": "this was a false positive",
+		},
+	})
+	AssertCheckEvent(t, set, allowedEvent, harms.AllowedContent())
+	AssertCheckEvent(t, set, allowedSenderEvent, harms.NeutralContent())
+	AssertCheckEvent(t, set, allowedBodyEvent, harms.NeutralContent())
+
+	// Add more overrides, including one for an unrelated community
+	for _, o := range []*storage.StoredOverride{{
+		CommunityId: cnf.CommunityId,
+		Kind:        storage.OverrideKindUserId,
+		Value:       "@bob:example.org",
+	}, {
+		CommunityId: cnf.CommunityId,
+		Kind:        storage.OverrideKindContentHash,
+		Value:       ContentHash(allowedBodyEvent),
+	}} {
+		assert.NoError(t, memStorage.UpsertOverride(ctx, o))
+	}
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicOverride, "unrelated_community"))
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicOverride, cnf.CommunityId))
+
+	// Like the hellban prefilter tests, we need to give the filter a moment to reload
+	time.Sleep(1 * time.Second)
+
+	AssertCheckEvent(t, set, allowedSenderEvent, harms.AllowedContent())
+	AssertCheckEvent(t, set, allowedBodyEvent, harms.AllowedContent())
+
+	// Removing an override should also be picked up
+	assert.NoError(t, memStorage.DeleteOverride(ctx, cnf.CommunityId, storage.OverrideKindUserId, "@bob:example.org"))
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicOverride, cnf.CommunityId))
+	time.Sleep(1 * time.Second)
+	AssertCheckEvent(t, set, allowedSenderEvent, harms.NeutralContent())
+}
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	withBody := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$with_body",
+		RoomId:  "!foo:example.org",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"body":    "hello world",
+			"msgtype": "m.text",
+		},
+	})
+	sameBody := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$same_body",
+		RoomId:  "!bar:example.org",
+		Type:    "m.room.message",
+		Sender:  "@bob:example.org",
+		Content: map[string]any{
+			"body":    "hello world",
+			"msgtype": "m.notice",
+		},
+	})
+	withoutBody := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$without_body",
+		RoomId:  "!foo:example.org",
+		Type:    "org.example.custom",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"hello": "world",
+		},
+	})
+
+	// sha256("hello world")
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", ContentHash(withBody))
+	assert.Equal(t, ContentHash(withBody), ContentHash(sameBody))
+	assert.NotEqual(t, ContentHash(withBody), ContentHash(withoutBody))
+}
@@ -0,0 +1,383 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/frequency"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/trust"
+)
+
+const RaidPrefilterName = "RaidPrefilter"
+
+// raidCommunityEntity - The frequency counter entity for joins across the whole community. Room IDs always start with
+// `!`, so this can't collide with them.
+const raidCommunityEntity = "*"
+
+func init() {
+	mustRegister(RaidPrefilterName, &RaidPrefilter{})
+}
+
+type RaidPrefilter struct {
+}
+
+func (r *RaidPrefilter) MakeFor(set *Set) (Instanced, error) {
+	return newRaidPrefilter(set)
+}
+
+type InstancedRaidPrefilter struct {
+	set                *Set
+	counter            frequency.Counter
+	roomJoinLimit      int
+	communityJoinLimit int
+	raidTime           time.Duration
+	lockdownUntrusted  bool
+	trustSources       []trust.Source
+
+	startLock sync.Mutex // held while automatically starting a raid, so concurrent joins only start it once
+	lock      sync.RWMutex
+	raids     map[string]*storage.StoredRaid // roomId (or empty string for the community) -> raid
+
+	unsubscribeFn func() error
+}
+
+func newRaidPrefilter(set *Set) (*InstancedRaidPrefilter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	communitySource, err := trust.NewSelfDirectedSource(set.storage, internal.Dereference(set.communityConfig.RaidPrefilterTrustedUserGlobs), nil)
+	if err != nil {
+		return nil, err
+	}
+	creatorSource, err := trust.NewCreatorSource(set.storage)
+	if err != nil {
+		return nil, err
+	}
+	powerLevelsSource, err := trust.NewPowerLevelsSource(set.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The limits are set per minute, so capture one minute of data.
+	counter, err := frequency.NewCounter(counterBackendFor(set), set.pubsub, fmt.Sprintf("raid.%s", set.communityId), 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribe before loading so we don't miss changes which happen in between
+	ch, err := set.pubsub.Subscribe(ctx, pubsub.TopicRaid)
+	if err != nil {
+		_ = counter.Close()
+		return nil, err
+	}
+	f := &InstancedRaidPrefilter{
+		set:                set,
+		counter:            counter,
+		roomJoinLimit:      internal.Dereference(set.communityConfig.RaidPrefilterRoomJoinsPerMinute),
+		communityJoinLimit: internal.Dereference(set.communityConfig.RaidPrefilterCommunityJoinsPerMinute),
+		raidTime:           time.Duration(internal.Dereference(set.communityConfig.RaidPrefilterMinutes)) * time.Minute,
+		lockdownUntrusted:  internal.Dereference(set.communityConfig.RaidPrefilterLockdownUntrusted),
+		trustSources:       []trust.Source{communitySource, creatorSource, powerLevelsSource},
+		raids:              make(map[string]*storage.StoredRaid),
+		unsubscribeFn: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			return set.pubsub.Unsubscribe(ctx, ch)
+		},
+	}
+	err = f.reload(ctx)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	go func(ch <-chan string, f *InstancedRaidPrefilter) {
+		keepLoop := true
+		for keepLoop {
+			select {
+			case communityId, stillOpen := <-ch:
+				if communityId == pubsub.ClosingValue {
+					log.Println("Closing raid listener")
+					keepLoop = false
+					break // `select`
+				}
+				if communityId == "" { // sometimes when closing we also get an empty string over the channel
+					if !stillOpen {
+						keepLoop = false
+						break // `select`
+					}
+					continue // `for` loop
+				}
+				if communityId != f.set.communityId {
+					continue // `for` loop
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+				err := f.reload(ctx)
+				cancel()
+				if err != nil {
+					// We keep the old raids rather than dropping them entirely
+					log.Printf("[%s] Non-fatal error reloading raids: %s", f.set.communityId, err)
+				}
+			}
+		}
+	}(ch, f)
+	return f, nil
+}
+
+// reload - Replaces the in-memory raids with the community's stored active raids.
+func (f *InstancedRaidPrefilter) reload(ctx context.Context) error {
+	stored, err := f.set.storage.GetActiveRaids(ctx, f.set.communityId)
+	if err != nil {
+		return err
+	}
+	raids := make(map[string]*storage.StoredRaid)
+	for _, raid := range stored {
+		raids[raid.RoomId] = raid
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.raids = raids
+	log.Printf("[%s] Loaded %d active raids", f.set.communityId, len(stored))
+	return nil
+}
+
+// activeRaidsFor - Returns the raids affecting the room, including community-wide raids.
+func (f *InstancedRaidPrefilter) activeRaidsFor(roomId string) []*storage.StoredRaid {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	// We double check expiration because raids are only reloaded when they change
+	now := time.Now()
+	raids := make([]*storage.StoredRaid, 0)
+	for _, key := range []string{roomId, ""} {
+		if raid, ok := f.raids[key]; ok && raid.IsActive(now) {
+			raids = append(raids, raid)
+		}
+	}
+	return raids
+}
+
+func (f *InstancedRaidPrefilter) Name() string {
+	return RaidPrefilterName
+}
+
+func (f *InstancedRaidPrefilter) Close() error {
+	return errors.Join(f.counter.Close(), f.unsubscribeFn())
+}
+
+func (f *InstancedRaidPrefilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
+	eventId := input.Event.EventID()
+	roomId := input.Event.RoomID().String()
+	userId := string(input.Event.SenderID())
+
+	isJoin := false
+	if input.Event.Type() == "m.room.member" && input.Event.StateKeyEquals(userId) {
+		membership, err := input.Event.Membership()
+		if err != nil {
+			return nil, err
+		}
+		isJoin = membership == spec.Join
+	}
+	countsJoins := f.roomJoinLimit > 0 || f.communityJoinLimit > 0
+
+	// Most of the time there's no raid and nothing to count, so avoid hitting the database for every event
+	if !(isJoin && countsJoins) && len(f.activeRaidsFor(roomId)) == 0 {
+		return harms.NeutralContent(), nil
+	}
+
+	joinedTimestamp, err := f.set.storage.GetRoomMemberJoinTimestamp(ctx, roomId, userId)
+	if err != nil {
+		return nil, err
+	}
+	isNewJoin := isJoin && joinedTimestamp == 0
+	if isNewJoin && countsJoins {
+		err = f.countJoin(ctx, eventId, roomId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Counting the join may have started a raid, so we look again
+	raids := f.activeRaidsFor(roomId)
+	if len(raids) == 0 {
+		return harms.NeutralContent(), nil
+	}
+
+	isTrusted, err := f.isTrusted(ctx, userId, roomId)
+	if err != nil {
+		return nil, err
+	}
+	if isTrusted {
+		return harms.NeutralContent(), nil
+	}
+	for _, raid := range raids {
+		if isNewJoin || joinedTimestamp >= raid.StartedTimestampMillis {
+			log.Printf("[%s | %s] %s joined during a raid", eventId, roomId, userId)
+			return harms.ProhibitedContent(harms.SpamFlooding), nil
+		}
+	}
+	if f.lockdownUntrusted {
+		log.Printf("[%s | %s] %s is not trusted to participate during a raid", eventId, roomId, userId)
+		return harms.ProhibitedContent(harms.SpamFlooding), nil
+	}
+	return harms.NeutralContent(), nil
+}
+
+// countJoin - Records a new join to the room, and starts a raid if the room or community is receiving more joins than
+// the community allows.
+func (f *InstancedRaidPrefilter) countJoin(ctx context.Context, eventId string, roomId string) error {
+	limits := make(map[string]int)
+	if f.roomJoinLimit > 0 {
+		limits[roomId] = f.roomJoinLimit
+	}
+	if f.communityJoinLimit > 0 {
+		limits[raidCommunityEntity] = f.communityJoinLimit
+	}
+
+	for entity, limit := range limits {
+		// Capture the current value before incrementing, in case the increment is picked up quickly by the counter
+		joinsLastMinute, err := f.counter.Get(entity)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to get join count for %s", entity), err)
+		}
+		err = f.counter.Increment(entity)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to increment join count for %s", entity), err)
+		}
+
+		// Then, figure out if they exceed the limit (adding 1 to account for the current join)
+		log.Printf("[%s | %s] Joins in the last minute for %s: %d (limit: %d)", eventId, roomId, entity, joinsLastMinute+1, limit)
+		if joinsLastMinute+1 > limit {
+			raidRoomId := roomId
+			if entity == raidCommunityEntity {
+				raidRoomId = ""
+			}
+			err = f.startRaid(ctx, raidRoomId, joinsLastMinute+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// startRaid - Stores a new raid for the room (or community, if roomId is empty), unless one is already active, and
+// notifies the community's moderators. Other filter sets are notified by the database when a raid changes.
+func (f *InstancedRaidPrefilter) startRaid(ctx context.Context, roomId string, joins int) error {
+	f.startLock.Lock()
+	defer f.startLock.Unlock()
+
+	// Check storage rather than our in-memory copy, as another worker may have started the raid already
+	now := time.Now()
+	existing, err := f.set.storage.GetActiveRaids(ctx, f.set.communityId)
+	if err != nil {
+		return err
+	}
+	for _, raid := range existing {
+		if raid.RoomId == roomId && raid.IsActive(now) {
+			// We don't extend active raids, otherwise a slow but steady raid would never end
+			return nil
+		}
+	}
+
+	raid := &storage.StoredRaid{
+		CommunityId:            f.set.communityId,
+		RoomId:                 roomId,
+		StartedTimestampMillis: now.UnixMilli(),
+		ExpiresTimestampMillis: now.Add(f.raidTime).UnixMilli(),
+		IsManual:               false,
+	}
+	log.Printf("[%s] Starting raid for '%s' until %s (%d joins in the last minute)", f.set.communityId, roomId, time.UnixMilli(raid.ExpiresTimestampMillis).Format(time.RFC1123Z), joins)
+	err = f.set.storage.UpsertRaid(ctx, raid)
+	if err != nil {
+		return err
+	}
+
+	// Update our own copy straight away rather than waiting for the database to tell us
+	f.lock.Lock()
+	f.raids[roomId] = raid
+	f.lock.Unlock()
+
+	f.notifyRaid(raid, joins)
+	return nil
+}
+
+// notifyRaid - Tells the community's moderators that a raid has started. Failures are logged rather than returned
+// because the raid is already in place.
+func (f *InstancedRaidPrefilter) notifyRaid(raid *storage.StoredRaid, joins int) {
+	NotifyRaid(f.set.notifier, raid, joins, f.lockdownUntrusted)
+}
+
+// NotifyRaid - Tells the community's moderators that a raid has started. joins is the number of joins in the last
+// minute, and is ignored for manual raids. Failures are logged rather than returned because the raid is already in
+// place.
+func NotifyRaid(notifier notifiers.MatrixNotifier, raid *storage.StoredRaid, joins int, lockdownUntrusted bool) {
+	scope := "all rooms in the community"
+	if raid.RoomId != "" {
+		escapedRoomId := html.EscapeString(raid.RoomId)
+		scope = fmt.Sprintf("<code>%s</code> (<a href=\"https://matrix.to/#/%s\">%s</a>)", escapedRoomId, escapedRoomId, escapedRoomId)
+	}
+	expires := time.UnixMilli(raid.ExpiresTimestampMillis).Format(time.RFC1123Z)
+	var htmlText string
+	if raid.IsManual {
+		htmlText = fmt.Sprintf("A moderator started a join raid and policyserv has locked down %s.<br/>", scope)
+	} else {
+		htmlText = fmt.Sprintf("policyserv detected a join raid and has locked down %s.<br/>", scope)
+		htmlText += fmt.Sprintf("<b>Joins in the last minute:</b> %d<br/>", joins)
+	}
+	htmlText += fmt.Sprintf("<b>Lockdown ends:</b> %s<br/>", expires)
+	htmlText += "Events from users who join during the raid will be treated as spam"
+	if lockdownUntrusted {
+		htmlText += ", as will events from any user who isn't trusted"
+	}
+	htmlText += ". Moderators can end the raid early using the raids API."
+
+	plainScope := "all rooms in the community"
+	if raid.RoomId != "" {
+		plainScope = raid.RoomId
+	}
+	var plainText string
+	if raid.IsManual {
+		plainText = fmt.Sprintf("A moderator started a join raid and policyserv has locked down %s until %s.", plainScope, expires)
+	} else {
+		plainText = fmt.Sprintf("policyserv detected a join raid (%d joins in the last minute) and has locked down %s until %s.", joins, plainScope, expires)
+	}
+
+	msgId, err := notifier.Send(raid.CommunityId, plainText, htmlText)
+	if err != nil {
+		log.Printf("[%s] Failed to send raid notification: %s", raid.CommunityId, err)
+		return
+	}
+	log.Printf("[%s] Sent raid notification as %s", raid.CommunityId, msgId)
+}
+
+// isTrusted - Returns true if the user is a moderator, creator, or otherwise trusted user who should be able to keep
+// participating during a raid.
+func (f *InstancedRaidPrefilter) isTrusted(ctx context.Context, userId string, roomId string) (bool, error) {
+	isTrusted := false
+	for _, source := range f.trustSources {
+		has, err := source.HasCapability(ctx, userId, roomId, trust.CapabilityRaidBypass)
+		if err != nil {
+			return false, err
+		}
+		if has == trust.TristateTrue {
+			isTrusted = true
+			// there may still be a deny in the array, so we continue
+		} else if has == trust.TristateFalse {
+			return false, nil // deny wins
+		}
+	}
+	return isTrusted, nil
+}
@@ -0,0 +1,234 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/matrix-org/policyserv/trust"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaidPrefilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	roomId := "!foo:example.org"
+	otherRoomId := "!bar:example.org"
+	cnf := &SetConfig{
+		CommunityId: storage.NextId(), // use a real community ID to ensure we don't overflow in the pubsub layer
+		CommunityConfig: &config.CommunityConfig{
+			RaidPrefilterRoomJoinsPerMinute: internal.Pointer(2),
+			RaidPrefilterMinutes:            internal.Pointer(30),
+			RaidPrefilterLockdownUntrusted:  internal.Pointer(true),
+			RaidPrefilterTrustedUserGlobs:   &[]string{"@helper:example.org"},
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{RaidPrefilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything is neutral by default in the test
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	notifier := test.NewMatrixNotifier(t)
+	set, err := NewSet(cnf, memStorage, ps, notifier, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	// Populate trust sources and existing members
+	plSource, err := trust.NewPowerLevelsSource(memStorage)
+	assert.NoError(t, err)
+	err = plSource.ImportData(ctx, roomId, test.MustMakePDU(&test.BaseClientEvent{
+		Type:     "m.room.power_levels",
+		StateKey: internal.Pointer(""),
+		Sender:   "@mod:example.org",
+		Content: map[string]any{
+			"state_default": 50,
+			"users_default": 0,
+			"users": map[string]any{
+				"@mod:example.org": 100,
+			},
+		},
+	}))
+	assert.NoError(t, err)
+	for _, userId := range []string{"@mod:example.org", "@helper:example.org", "@regular:example.org"} {
+		err = memStorage.InsertRoomMemberJoin(ctx, roomId, userId, time.Now().Add(-1*time.Hour).UnixMilli())
+		assert.NoError(t, err)
+	}
+
+	makeJoin := func(userId string) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId:  "$join",
+			RoomId:   roomId,
+			Type:     "m.room.member",
+			Sender:   userId,
+			StateKey: internal.Pointer(userId),
+			Content:  map[string]any{"membership": "join"},
+		})
+	}
+	makeMessage := func(roomId string, userId string) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			EventId: "$message",
+			RoomId:  roomId,
+			Type:    "m.room.message",
+			Sender:  userId,
+			Content: map[string]any{"body": "hello world"},
+		})
+	}
+
+	raidNotifications := func() []string {
+		// The notifier also receives audit messages for prohibited events, so only count the raid notifications
+		sent := make([]string, 0)
+		for _, msg := range notifier.SentTo(cnf.CommunityId) {
+			if strings.Contains(msg, "join raid") {
+				sent = append(sent, msg)
+			}
+		}
+		return sent
+	}
+
+	// Joins below the limit are fine, as are messages and profile changes from existing members
+	AssertCheckEvent(t, set, makeJoin("@spam1:example.org"), harms.NeutralContent())
+	time.Sleep(100 * time.Millisecond) // give the counter a moment to settle
+	AssertCheckEvent(t, set, makeJoin("@regular:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeMessage(roomId, "@regular:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeJoin("@spam2:example.org"), harms.NeutralContent())
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, raidNotifications())
+
+	// The next join exceeds the limit, starting a raid
+	AssertCheckEvent(t, set, makeJoin("@spam3:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+	raids, err := memStorage.GetActiveRaids(ctx, cnf.CommunityId)
+	assert.NoError(t, err)
+	assert.Len(t, raids, 1)
+	assert.Equal(t, roomId, raids[0].RoomId)
+	assert.False(t, raids[0].IsManual)
+	assert.Len(t, raidNotifications(), 1)
+
+	// Further joins are blocked, but don't restart the raid or notify again
+	time.Sleep(100 * time.Millisecond)
+	AssertCheckEvent(t, set, makeJoin("@spam4:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+	raids, err = memStorage.GetActiveRaids(ctx, cnf.CommunityId)
+	assert.NoError(t, err)
+	assert.Len(t, raids, 1)
+	assert.Len(t, raidNotifications(), 1)
+
+	// Users who joined during the raid are blocked, as are untrusted users because of the lockdown. The homeserver
+	// records the join even though it was prohibited.
+	err = memStorage.InsertRoomMemberJoin(ctx, roomId, "@spam1:example.org", raids[0].StartedTimestampMillis)
+	assert.NoError(t, err)
+	AssertCheckEvent(t, set, makeMessage(roomId, "@spam1:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+	AssertCheckEvent(t, set, makeMessage(roomId, "@regular:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+	AssertCheckEvent(t, set, makeMessage(roomId, "@mod:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeMessage(roomId, "@helper:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, set, makeMessage(otherRoomId, "@regular:example.org"), harms.NeutralContent()) // not raided
+
+	// Without the lockdown, existing members can continue participating
+	cnf.CommunityConfig.RaidPrefilterLockdownUntrusted = internal.Pointer(false)
+	unlockedSet, err := NewSet(cnf, memStorage, ps, notifier, nil)
+	assert.NoError(t, err)
+	AssertCheckEvent(t, unlockedSet, makeMessage(roomId, "@regular:example.org"), harms.NeutralContent())
+	AssertCheckEvent(t, unlockedSet, makeMessage(roomId, "@spam1:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+
+	// Raids changed elsewhere (like by moderators) should be picked up. Memory storage doesn't have triggers, so we
+	// publish the change ourselves.
+	err = memStorage.DeleteRaid(ctx, cnf.CommunityId, roomId)
+	assert.NoError(t, err)
+	err = memStorage.UpsertRaid(ctx, &storage.StoredRaid{
+		CommunityId:            cnf.CommunityId,
+		RoomId:                 "", // the whole community
+		StartedTimestampMillis: time.Now().UnixMilli(),
+		ExpiresTimestampMillis: time.Now().Add(10 * time.Minute).UnixMilli(),
+		IsManual:               true,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicRaid, "unrelated_community"))
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicRaid, cnf.CommunityId))
+
+	// Like the override prefilter tests, we need to give the filter a moment to reload
+	time.Sleep(1 * time.Second)
+
+	AssertCheckEvent(t, set, makeMessage(otherRoomId, "@regular:example.org"), harms.ProhibitedContent(harms.SpamFlooding))
+	AssertCheckEvent(t, unlockedSet, makeMessage(roomId, "@spam1:example.org"), harms.NeutralContent()) // joined before the new raid
+
+	// Ending the raid unlocks the community
+	err = memStorage.DeleteRaid(ctx, cnf.CommunityId, "")
+	assert.NoError(t, err)
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicRaid, cnf.CommunityId))
+	time.Sleep(1 * time.Second)
+	AssertCheckEvent(t, set, makeMessage(otherRoomId, "@regular:example.org"), harms.NeutralContent())
+}
+
+func TestRaidPrefilterManualWithoutLimits(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	roomId := "!foo:example.org"
+	cnf := &SetConfig{
+		CommunityId: storage.NextId(),
+		CommunityConfig: &config.CommunityConfig{
+			// No join limits, so raids can only be started manually
+			RaidPrefilterLockdownUntrusted: internal.Pointer(true),
+		},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{RaidPrefilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	message := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$message",
+		RoomId:  roomId,
+		Type:    "m.room.message",
+		Sender:  "@regular:example.org",
+		Content: map[string]any{"body": "hello world"},
+	})
+	join := test.MustMakePDU(&test.BaseClientEvent{
+		EventId:  "$join",
+		RoomId:   roomId,
+		Type:     "m.room.member",
+		Sender:   "@new:example.org",
+		StateKey: internal.Pointer("@new:example.org"),
+		Content:  map[string]any{"membership": "join"},
+	})
+
+	// Without a raid, nothing is affected and joins don't start one
+	AssertCheckEvent(t, set, message, harms.NeutralContent())
+	for i := 0; i < 5; i++ {
+		AssertCheckEvent(t, set, join, harms.NeutralContent())
+	}
+	raids, err := memStorage.GetActiveRaids(ctx, cnf.CommunityId)
+	assert.NoError(t, err)
+	assert.Empty(t, raids)
+
+	// A manual raid still applies
+	err = memStorage.UpsertRaid(ctx, &storage.StoredRaid{
+		CommunityId:            cnf.CommunityId,
+		RoomId:                 roomId,
+		StartedTimestampMillis: time.Now().UnixMilli(),
+		ExpiresTimestampMillis: time.Now().Add(10 * time.Minute).UnixMilli(),
+		IsManual:               true,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, ps.Publish(ctx, pubsub.TopicRaid, cnf.CommunityId))
+	time.Sleep(1 * time.Second) // give the filter a moment to reload
+	AssertCheckEvent(t, set, join, harms.ProhibitedContent(harms.SpamFlooding))
+	AssertCheckEvent(t, set, message, harms.ProhibitedContent(harms.SpamFlooding))
+}
@@ -2,9 +2,9 @@ package filter
 
 import (
 	"context"
-	"encoding/json"
 	"strings"
 
+	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 )
@@ -35,18 +35,21 @@ func (f *InstancedTrimLengthFilter) Name() string {
 }
 
 func (f *InstancedTrimLengthFilter) CheckEvent(ctx context.Context, input *EventInput) (*harms.ContentInfo, error) {
-	// Return early on non-message events
-	if input.Event.Type() != "m.room.message" {
+	// Return early on state events
+	if input.Event.StateKey() != nil {
 		return harms.NeutralContent(), nil
 	}
 
-	content := &bodyOnly{}
-	err := json.Unmarshal(input.Event.Content(), &content)
-	if err != nil {
-		return nil, err
-	}
+	content := event.ExtractContent(input.Event)
 
-	return f.CheckText(ctx, content.Body)
+	// Each text is checked separately because joining them would hide the whitespace between them
+	for _, text := range content.Texts {
+		info, err := f.CheckText(ctx, text)
+		if err != nil || info.Class() == harms.ContentClassProhibited {
+			return info, err
+		}
+	}
+	return harms.NeutralContent(), nil
 }
 
 func (f *InstancedTrimLengthFilter) CheckText(ctx context.Context, text string) (*harms.ContentInfo, error) {
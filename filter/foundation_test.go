@@ -12,6 +12,8 @@ import (
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -58,8 +60,8 @@ func TestMatrixFoundationIntents(t *testing.T) {
 	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, set)
-	assert.NoError(t, memStorage.SetListBanRules(context.Background(), mjolnirRoomId, map[string]string{
-		"@banned*:example.org": "m.policy.rule.user",
+	assert.NoError(t, memStorage.SetListRules(context.Background(), mjolnirRoomId, []*storage.StoredListRule{
+		{EntityType: "m.policy.rule.user", Entity: "@banned*:example.org", Recommendation: "m.ban"},
 	}))
 	assert.NoError(t, memStorage.SetUserIdsAndDisplayNamesByRoomId(context.Background(), foundationRoomId, foundationMentionIds, foundationMentionNames))
 
@@ -67,6 +69,14 @@ func TestMatrixFoundationIntents(t *testing.T) {
 		t.Run(fmt.Sprintf("%d (%s)", i, run.Event.EventID()), func(t *testing.T) {
 			AssertCheckEvent(t, set, run.Event, run.Expected)
 
+			// The memory storage doesn't have the database's triggers, so tell the hellban prefilter about any hellbans
+			// ourselves.
+			hellbans, err := memStorage.GetActiveHellbans(context.Background(), cnf.CommunityId)
+			assert.NoError(t, err)
+			for _, hellban := range hellbans {
+				assert.NoError(t, ps.Publish(context.Background(), pubsub.TopicHellban, mustEncodeHellbanChange(hellban.CommunityId, hellban.UserId)))
+			}
+
 			// Give things some time to settle before moving on to the next test case. This is primarily important for the
 			// hellban test cases to ensure the cause event creates a hellban before the effect event.
 			time.Sleep(100 * time.Millisecond)
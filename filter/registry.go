@@ -21,6 +21,12 @@ func findByName(name string) (CanBeInstanced, error) {
 	return f, nil
 }
 
+// IsRegistered - Returns true if a filter with the given name exists.
+func IsRegistered(name string) bool {
+	_, exists := filters[name]
+	return exists
+}
+
 func mustRegister(name string, f CanBeInstanced) {
 	if _, exists := filters[name]; exists {
 		panic(fmt.Errorf("filter already registered with name %s", name))
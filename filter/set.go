@@ -2,16 +2,20 @@ package filter
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"slices"
+	"time"
 
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/content"
+	"github.com/matrix-org/policyserv/event"
+	"github.com/matrix-org/policyserv/filter/condition"
 	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/media"
 	"github.com/matrix-org/policyserv/notifiers"
 	"github.com/matrix-org/policyserv/pubsub"
@@ -24,6 +28,8 @@ type SetConfig struct {
 	CommunityConfig *config.CommunityConfig
 	InstanceConfig  *config.InstanceConfig
 	CommunityId     string
+	// FilterConditions are applied to filters by name, in addition to any conditions on the group. May be nil.
+	FilterConditions map[string]condition.Condition
 }
 
 type Set struct {
@@ -51,10 +57,19 @@ func NewSet(config *SetConfig, storage storage.PersistentStorage, pubsub pubsub.
 		instanceConfig:  config.InstanceConfig,
 		communityId:     config.CommunityId,
 	}
+	shadowFilterNames := make([]string, 0)
+	if config.CommunityConfig != nil {
+		shadowFilterNames = internal.Dereference(config.CommunityConfig.ShadowFilterNames)
+		// Configs stored before validation rejected it may still try to shadow the filter which protects policyserv
+		shadowFilterNames = slices.DeleteFunc(slices.Clone(shadowFilterNames), func(name string) bool {
+			return name == ProtectLocalUserFilterName
+		})
+	}
 	for i, groupCnf := range config.Groups {
 		set.groups[i] = &setGroup{
 			filters:               make([]Instanced, 0),
 			checkedContentClasses: groupCnf.CheckedContentClasses,
+			shadowFilterNames:     shadowFilterNames,
 		}
 		for _, name := range groupCnf.EnabledNames {
 			f, err := findByName(name)
@@ -65,6 +80,12 @@ func NewSet(config *SetConfig, storage storage.PersistentStorage, pubsub pubsub.
 			if err != nil {
 				return nil, errors.Join(fmt.Errorf("error making filter for: %s", name), err)
 			}
+			if cond, ok := config.FilterConditions[name]; ok && cond != nil {
+				instanced = NewConditionalFilter(set, instanced, cond)
+			}
+			if groupCnf.Condition != nil {
+				instanced = NewConditionalFilter(set, instanced, groupCnf.Condition)
+			}
 			set.groups[i].filters = append(set.groups[i].filters, instanced)
 		}
 	}
@@ -75,6 +96,7 @@ func NewSet(config *SetConfig, storage storage.PersistentStorage, pubsub pubsub.
 // Note: the mediaDownloader may be nil to prevent parsing and downloading of media. This should only be done in test environments.
 func (s *Set) CheckEvent(ctx context.Context, event gomatrixserverlib.PDU, mediaDownloader media.Downloader) (*harms.ContentInfo, error) {
 	log.Printf("[%s | %s | %s] Checking event", event.EventID(), event.RoomID().String(), s.communityId)
+	startTime := time.Now()
 
 	if !event.SenderID().IsUserID() || event.SenderID().ToUserID() == nil {
 		log.Printf("[%s | %s] Skipping event and flagging as spam because sender is not a user", event.EventID(), event.RoomID().String())
@@ -87,6 +109,7 @@ func (s *Set) CheckEvent(ctx context.Context, event gomatrixserverlib.PDU, media
 	if err != nil {
 		return nil, err
 	}
+	auditCtx.IsShadowMode = s.IsShadowMode()
 	for i, group := range s.groups {
 		input := &EventInput{
 			Event:        event,
@@ -96,26 +119,15 @@ func (s *Set) CheckEvent(ctx context.Context, event gomatrixserverlib.PDU, media
 
 		if mediaDownloader != nil {
 			// Extract media items from event, if possible.
-			// TODO: In future, we'll also want to capture custom emoji and similar
-			eventContent := &mediaUrlsOnly{}
-			err = json.Unmarshal(input.Event.Content(), &eventContent)
-			if err != nil {
-				// Probably not a string
-				return nil, err
-			}
-			tryAppendMedia := func(url string) {
-				if len(url) == 0 {
-					return // the field we're trying to parse probably wasn't present on the event
-				}
+			for _, url := range extractMediaUrls(input.Event) {
 				m, err := media.NewItem(url, mediaDownloader)
 				if err != nil {
 					log.Printf("[%s | %s] Non-fatal error creating new media object for '%s': %s", event.EventID(), event.RoomID().String(), url, err)
+					continue
 				}
 				log.Printf("[%s | %s] Discovered media on event: %s", event.EventID(), event.RoomID().String(), m)
 				input.Medias = append(input.Medias, m)
 			}
-			tryAppendMedia(eventContent.Url)
-			tryAppendMedia(eventContent.Info.ThumbnailUrl)
 		} else {
 			log.Printf("[%s | %s] Skipping media extraction as mediaDownloader is nil", event.EventID(), event.RoomID().String())
 		}
@@ -132,15 +144,61 @@ func (s *Set) CheckEvent(ctx context.Context, event gomatrixserverlib.PDU, media
 
 	info := harms.NewContentInfo(contentClass, harmIds...)
 	auditCtx.IsSpam = info.Class() == harms.ContentClassProhibited
+	decision := auditCtx.ToDecision(info, time.Since(startTime))
 	go func(auditCtx *auditContext, s *Set) { // run the audit publishing async to avoid blocking the hot path any more than required
 		err := auditCtx.Publish()
 		if err != nil {
 			log.Printf("[%s | %s] Non-fatal error publishing audit: %s", auditCtx.Event.EventID(), auditCtx.Event.RoomID().String(), err)
 		}
+
+		// We use a new context because the caller's context is likely to be cancelled shortly after we return
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+		defer cancel()
+		err = s.storage.InsertDecision(ctx, decision)
+		if err != nil {
+			log.Printf("[%s | %s] Non-fatal error recording decision: %s", auditCtx.Event.EventID(), auditCtx.Event.RoomID().String(), err)
+		}
+
+		// We send the decision after recording it so the payload includes the decision's ID
+		msgId, err := s.notifier.SendDecision(decision, auditCtx.WebhookPayloadType())
+		if err != nil {
+			log.Printf("[%s | %s] Non-fatal error sending decision webhook: %s", auditCtx.Event.EventID(), auditCtx.Event.RoomID().String(), err)
+		} else {
+			log.Printf("[%s | %s] Decision webhook queued: %s", auditCtx.Event.EventID(), auditCtx.Event.RoomID().String(), msgId)
+		}
 	}(auditCtx, s)
 	return info, nil
 }
 
+// IsShadowMode - Returns true if the community is in shadow mode. Events are still checked (and audited) as normal,
+// but callers should not act upon the result.
+func (s *Set) IsShadowMode() bool {
+	if s.communityConfig == nil {
+		return false
+	}
+	return internal.Dereference(s.communityConfig.ShadowModeEnabled)
+}
+
+// isShadowFilter - Returns true if the community has named the filter as a shadow filter.
+func (s *Set) isShadowFilter(filterName string) bool {
+	if s.communityConfig == nil {
+		return false
+	}
+	return slices.Contains(internal.Dereference(s.communityConfig.ShadowFilterNames), filterName)
+}
+
+// normalizationFor - Returns the text normalization steps the named filter should apply, or zero if the community
+// hasn't opted the filter into text normalization. Each filter decides which steps make sense for the text it checks.
+func (s *Set) normalizationFor(filterName string, steps event.Normalization) event.Normalization {
+	if s.communityConfig == nil {
+		return 0
+	}
+	if !slices.Contains(internal.Dereference(s.communityConfig.TextNormalizationFilterNames), filterName) {
+		return 0
+	}
+	return steps
+}
+
 func (s *Set) CheckText(ctx context.Context, text string) (*harms.ContentInfo, error) {
 	log.Printf("[CheckText | %s] Checking text", s.communityId)
 	contentClass := harms.ContentClassNeutral
@@ -177,9 +235,7 @@ func (s *Set) Close() error {
 	return nil
 }
 
-type mediaUrlsOnly struct {
-	Url  string `json:"url"`
-	Info struct {
-		ThumbnailUrl string `json:"thumbnail_url"`
-	}
+// extractMediaUrls - Returns the media URLs a client may render for the event, per event.ExtractContent.
+func extractMediaUrls(pdu gomatrixserverlib.PDU) []string {
+	return event.ExtractContent(pdu).MediaUrls
 }
@@ -7,6 +7,7 @@ import (
 	"log"
 	"slices"
 
+	"github.com/matrix-org/policyserv/filter/condition"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/metrics"
 )
@@ -17,11 +18,15 @@ type SetGroupConfig struct {
 
 	// Which content classes are checked by this set group.
 	CheckedContentClasses []harms.ContentClass
+
+	// Optional condition to apply to all filters in this group. If nil, the filters run unconditionally.
+	Condition condition.Condition
 }
 
 type setGroup struct {
 	filters               []Instanced
 	checkedContentClasses []harms.ContentClass
+	shadowFilterNames     []string // filters which run, but don't contribute to the group's outcome
 }
 
 // checkEvent - If the group is meant to be run against the content class/info, processes the event through the group's
@@ -49,8 +54,17 @@ func (g *setGroup) checkEvent(ctx context.Context, infoSoFar *harms.ContentInfo,
 				err = fmt.Errorf("developer error: filter %s returned nil content info", filter.Name())
 			}
 		}
+		logPrefix := fmt.Sprintf("%s | %s", input.Event.EventID(), input.Event.RoomID().String())
+		if g.isShadowed(filter) {
+			input.auditContext.AppendShadowFilterResponse(filter.Name(), info)
+			metrics.RecordShadowFilterClassification(input.Event.RoomID().String(), filter.Name(), info)
+			g.logFilterClassifications(logPrefix+" | shadow", filter, info, err)
+			// Shadowed filters never affect the outcome, even when they error
+			ch <- setGroupRet{filter, harms.NeutralContent(), nil}
+			return
+		}
 		input.auditContext.AppendFilterResponse(filter.Name(), info)
-		g.logFilterClassifications(fmt.Sprintf("%s | %s", input.Event.EventID(), input.Event.RoomID().String()), filter, info, err)
+		g.logFilterClassifications(logPrefix, filter, info, err)
 		ch <- setGroupRet{filter, info, err}
 	})
 }
@@ -78,11 +92,21 @@ func (g *setGroup) checkText(ctx context.Context, infoSoFar *harms.ContentInfo,
 				err = fmt.Errorf("developer error: filter %s returned nil content info", filter.Name())
 			}
 		}
+		if g.isShadowed(filter) {
+			g.logFilterClassifications("CheckText | shadow", filter, info, err)
+			ch <- setGroupRet{filter, harms.NeutralContent(), nil}
+			return
+		}
 		g.logFilterClassifications("CheckText", filter, info, err)
 		ch <- setGroupRet{filter, info, err}
 	})
 }
 
+// isShadowed - Returns true if the filter's results should be recorded, but not used.
+func (g *setGroup) isShadowed(filter Instanced) bool {
+	return slices.Contains(g.shadowFilterNames, filter.Name())
+}
+
 func (g *setGroup) logFilterClassifications(prefix string, filter Instanced, info *harms.ContentInfo, err error) {
 	log.Printf("[%s] Filter %T returned %s %v", prefix, filter, info.Class(), info.Harms())
 	if err != nil {
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/matrix-org/policyserv/harms"
@@ -59,3 +60,52 @@ func TestSetGroupCheck(t *testing.T) {
 	assert.NoError(t, err)
 	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.SpamGeneral, harms.SpamFlooding), info)
 }
+
+func TestSetGroupCheckShadowFilter(t *testing.T) {
+	event := test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:  "!foo:example.org",
+		EventId: "$test",
+		Type:    "m.room.message",
+		Content: make(map[string]any),
+	})
+	auditCtx, err := newAuditContext(test.NewMatrixNotifier(t), "default", event)
+	assert.NoError(t, err)
+	assert.NotNil(t, auditCtx)
+	input := &EventInput{
+		Event:        event,
+		auditContext: auditCtx,
+	}
+	sg := &setGroup{
+		filters: []Instanced{&FixedInstancedFilter{
+			T:          t,
+			Expect:     input,
+			ExpectText: "hello world",
+			ReturnInfo: harms.ProhibitedContent(harms.SpamGeneral, harms.SpamFlooding),
+			ReturnErr:  nil,
+		}},
+		checkedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+		shadowFilterNames:     []string{FixedFilterName},
+	}
+
+	// The filter runs, but doesn't affect the outcome
+	info, err := sg.checkEvent(context.Background(), harms.NeutralContent(), input)
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), info)
+	info, err = sg.checkText(context.Background(), harms.NeutralContent(), "hello world")
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), info)
+
+	// ... though the audit context still knows what the filter said
+	assert.Empty(t, auditCtx.FilterResponses)
+	assert.Equal(t, map[string][]string{
+		FixedFilterName: {harms.ContentClassProhibited.String(), string(harms.SpamGeneral), string(harms.SpamFlooding)},
+	}, auditCtx.ShadowFilterResponses)
+	assert.True(t, auditCtx.wouldBeSpamByShadowFilters())
+
+	// Errors from shadowed filters are also ignored
+	sg.filters[0].(*FixedInstancedFilter).ReturnInfo = nil
+	sg.filters[0].(*FixedInstancedFilter).ReturnErr = errors.New("shadow error")
+	info, err = sg.checkEvent(context.Background(), harms.NeutralContent(), input)
+	assert.NoError(t, err)
+	test.AssertEqualContentInfo(t, harms.NeutralContent(), info)
+}
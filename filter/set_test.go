@@ -14,6 +14,7 @@ import (
 
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/filter/condition"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/media"
@@ -67,6 +68,32 @@ func TestNewSet(t *testing.T) {
 	assert.Equal(t, f.Set, set)
 }
 
+func TestNewSetWithGroupCondition(t *testing.T) {
+	cnf := &SetConfig{
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{FixedFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+			Condition:             condition.RoomId("!foo:example.org"),
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	// The filter should be wrapped by a ConditionalFilter, but otherwise look the same
+	f, ok := set.groups[0].filters[0].(*ConditionalFilter)
+	assert.True(t, ok)
+	assert.NotNil(t, f)
+	assert.Equal(t, FixedFilterName, f.Name())
+	_, ok = f.downstream.(*FixedInstancedFilter)
+	assert.True(t, ok)
+}
+
 func TestNewSetUnknownFilter(t *testing.T) {
 	cnf := &SetConfig{
 		Groups: []*SetGroupConfig{{
@@ -325,7 +352,7 @@ func TestCallsWebhook(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	notifier, err := notifiers.NewWebhookMatrixNotifier(memStorage, 5, []string{parsedUrl.Host})
+	notifier, err := notifiers.NewWebhookMatrixNotifier(memStorage, ps, 5, []string{parsedUrl.Host}, time.Second)
 	assert.NoError(t, err)
 	assert.NotNil(t, notifier)
 	set, err := NewSet(cnf, memStorage, ps, notifier, nil)
@@ -411,7 +438,7 @@ func TestCallsWebhookErrorNonFatal(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	notifier, err := notifiers.NewWebhookMatrixNotifier(memStorage, 5, []string{parsedUrl.Host})
+	notifier, err := notifiers.NewWebhookMatrixNotifier(memStorage, ps, 5, []string{parsedUrl.Host}, time.Second)
 	assert.NoError(t, err)
 	assert.NotNil(t, notifier)
 	set, err := NewSet(cnf, memStorage, ps, notifier, nil)
@@ -528,3 +555,162 @@ func TestExtractsMedia(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
 }
+
+func TestExtractsAllMedia(t *testing.T) {
+	t.Parallel()
+
+	// Tests that media items are extracted from everywhere a client might render them, without duplicates.
+
+	cnf := &SetConfig{
+		CommunityConfig: &config.CommunityConfig{},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{FixedFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral}, // everything starts as neutral
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	set, err := NewSet(cnf, memStorage, ps, test.NewMatrixNotifier(t), nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	downloader := test.MustMakeMediaDownloader(t)
+
+	event := test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:  "!foo:example.org",
+		EventId: "$test",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"msgtype":        "m.text",
+			"body":           "* look",
+			"format":         "org.matrix.custom.html",
+			"formatted_body": "* look <img src=\"mxc://example.org/inline\" /><img src=\"https://example.org/not_mxc.png\" /><img src=\"mxc://example.org\" />",
+			"m.new_content": map[string]any{
+				"msgtype": "m.image",
+				"body":    "look",
+				"file": map[string]any{
+					"url": "mxc://example.org/encrypted",
+				},
+				"info": map[string]any{
+					"thumbnail_file": map[string]any{
+						"url": "mxc://example.org/encrypted_thumbnail",
+					},
+				},
+			},
+			"m.relates_to": map[string]any{
+				"rel_type": "m.replace",
+				"event_id": "$original",
+			},
+		},
+	})
+
+	fixedFilter := set.groups[0].filters[0].(*FixedInstancedFilter)
+	fixedFilter.T = t
+	fixedFilter.Set = set
+	fixedFilter.Expect = &EventInput{
+		Event: event,
+		Medias: []*media.Item{
+			{Origin: "example.org", MediaId: "encrypted"},
+			{Origin: "example.org", MediaId: "encrypted_thumbnail"},
+			{Origin: "example.org", MediaId: "inline"},
+			// the non-MXC image is skipped because clients won't render it, and the MXC URI without a media ID is invalid
+		},
+	}
+	fixedFilter.ReturnInfo = harms.ProhibitedContent(harms.SpamFlooding)
+
+	res, err := set.CheckEvent(context.Background(), event, downloader)
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+
+	// Member avatars are media too
+	event = test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:   "!foo:example.org",
+		EventId:  "$test",
+		Type:     "m.room.member",
+		StateKey: internal.Pointer("@alice:example.org"),
+		Sender:   "@alice:example.org",
+		Content: map[string]any{
+			"membership": "join",
+			"avatar_url": "mxc://example.org/avatar",
+		},
+	})
+	fixedFilter.Expect = &EventInput{
+		Event:  event,
+		Medias: []*media.Item{{Origin: "example.org", MediaId: "avatar"}},
+	}
+	res, err = set.CheckEvent(context.Background(), event, downloader)
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+}
+
+func TestSetRecordsDecision(t *testing.T) {
+	t.Parallel()
+
+	cnf := &SetConfig{
+		CommunityId:     "test_community",
+		CommunityConfig: &config.CommunityConfig{},
+		Groups: []*SetGroupConfig{{
+			EnabledNames:          []string{FixedFilterName},
+			CheckedContentClasses: []harms.ContentClass{harms.ContentClassNeutral},
+		}},
+	}
+	memStorage := test.NewMemoryStorage(t)
+	defer memStorage.Close()
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	notifier := test.NewMatrixNotifier(t)
+	set, err := NewSet(cnf, memStorage, ps, notifier, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, set)
+
+	event := test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:  "!foo:example.org",
+		EventId: "$test",
+		Type:    "m.room.message",
+		Sender:  "@alice:example.org",
+		Content: map[string]any{
+			"body": "hello world",
+		},
+	})
+	fixedFilter := set.groups[0].filters[0].(*FixedInstancedFilter)
+	fixedFilter.T = t
+	fixedFilter.Expect = &EventInput{
+		Event:  event,
+		Medias: make([]*media.Item, 0),
+	}
+	fixedFilter.ReturnInfo = harms.ProhibitedContent(harms.SpamFlooding)
+
+	AssertCheckEvent(t, set, event, harms.ProhibitedContent(harms.SpamFlooding))
+
+	// The decision is recorded async, so wait for it
+	query := &storage.DecisionQuery{CommunityId: "test_community", Limit: 10}
+	var decisions []*storage.StoredDecision
+	assert.Eventually(t, func() bool {
+		decisions, err = memStorage.GetDecisions(context.Background(), query)
+		return err == nil && len(decisions) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	decision := decisions[0]
+	assert.Equal(t, "$test", decision.EventId)
+	assert.Equal(t, "test_community", decision.CommunityId)
+	assert.Equal(t, "!foo:example.org", decision.RoomId)
+	assert.Equal(t, "@alice:example.org", decision.SenderUserId)
+	assert.Equal(t, "m.room.message", decision.EventType)
+	assert.Equal(t, map[string][]string{
+		FixedFilterName: {harms.ContentClassProhibited.String(), string(harms.SpamFlooding)},
+	}, decision.FilterResponses)
+	assert.Empty(t, decision.ShadowFilterResponses)
+	test.AssertEqualContentInfo(t, harms.ProhibitedContent(harms.SpamFlooding), decision.ContentInfo)
+	assert.GreaterOrEqual(t, decision.DurationMillis, int64(0))
+	assert.InDelta(t, time.Now().UnixMilli(), decision.DecidedTimestampMillis, float64(time.Minute.Milliseconds()))
+
+	// The decision is also sent as a structured webhook payload
+	assert.Eventually(t, func() bool {
+		return len(notifier.DecisionTypesSentTo("test_community")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []notifiers.WebhookPayloadType{notifiers.WebhookPayloadTypeSpam}, notifier.DecisionTypesSentTo("test_community"))
+}
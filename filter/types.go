@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/event"
 	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/media"
 )
@@ -20,6 +21,20 @@ type EventInput struct {
 	auditContext *auditContext
 }
 
+// scannableText - Returns the text of the event which text-based filters should search. For non-state events, this is
+// the text a client will render (per event.ExtractContent), so edits and polls are covered. State events and events
+// without any text we know how to extract (like custom event types) have their whole content returned instead.
+func scannableText(input *EventInput) (string, error) {
+	if input.Event.StateKey() != nil {
+		return string(input.Event.Content()), nil
+	}
+	content := event.ExtractContent(input.Event)
+	if !content.HasText() {
+		return string(input.Event.Content()), nil
+	}
+	return content.AllText(), nil
+}
+
 // Instanced - A Set-specific filter.
 type Instanced interface {
 	// Name - The name of the filter for logging and metrics.
@@ -0,0 +1,95 @@
+package fingerprint
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// shingleSize - The number of characters in each shingle. Smaller shingles are more tolerant of small edits, but
+// cause unrelated text to look more similar.
+const shingleSize = 4
+
+// Simhash - Computes a 64-bit locality-sensitive fingerprint of the text. Similar text produces fingerprints with a
+// small Distance between them, so slightly mutated copies of the same message can still be matched.
+func Simhash(text string) uint64 {
+	runes := []rune(normalize(text))
+	if len(runes) == 0 {
+		return 0
+	}
+
+	weights := [64]int{}
+	addShingle := func(shingle string) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(shingle)) // "never" fails
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(runes) <= shingleSize {
+		addShingle(string(runes))
+	} else {
+		for i := 0; i+shingleSize <= len(runes); i++ {
+			addShingle(string(runes[i : i+shingleSize]))
+		}
+	}
+
+	fingerprint := uint64(0)
+	for i, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << i
+		}
+	}
+	return fingerprint
+}
+
+// Distance - The number of bits which differ between two fingerprints. Zero means the fingerprints are identical.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format - Returns the fingerprint as a fixed-length hex string, suitable for storage.
+func Format(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+// Parse - Parses a fingerprint previously returned by Format.
+func Parse(val string) (uint64, error) {
+	return strconv.ParseUint(val, 16, 64)
+}
+
+// NormalizedLength - The length of the text after normalization, in characters. Used to skip text which is too short
+// to fingerprint meaningfully.
+func NormalizedLength(text string) int {
+	return len([]rune(normalize(text)))
+}
+
+// normalize - Lowercases the text, drops punctuation and symbols, and collapses whitespace so trivial edits don't
+// affect the fingerprint.
+func normalize(text string) string {
+	b := strings.Builder{}
+	lastWasSpace := true // trims leading whitespace
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsSpace(r) {
+			if !lastWasSpace {
+				b.WriteRune(' ')
+				lastWasSpace = true
+			}
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			continue
+		}
+		b.WriteRune(r)
+		lastWasSpace = false
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
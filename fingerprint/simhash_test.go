@@ -0,0 +1,60 @@
+package fingerprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimhash(t *testing.T) {
+	t.Parallel()
+
+	original := Simhash("Earn $5000 a week from home!! Message me now to find out how, limited spots available")
+
+	// Case, punctuation, and whitespace don't matter
+	assert.Equal(t, original, Simhash("earn 5000 a week   from home message me now to find out how limited spots available"))
+
+	// Small edits are close, but not identical
+	mutated := Simhash("Earn $5000 a week from home!! Message me today to find out how, limited spots available")
+	assert.NotEqual(t, original, mutated)
+	assert.LessOrEqual(t, Distance(original, mutated), 10)
+
+	// Unrelated text is far away
+	unrelated := Simhash("Has anyone tried the new release yet? It seems much faster than the last one")
+	assert.Greater(t, Distance(original, unrelated), 16)
+
+	// Very short and empty text still produce fingerprints
+	assert.Equal(t, Simhash("Hi!"), Simhash("hi"))
+	assert.Equal(t, uint64(0), Simhash(" !? "))
+}
+
+func TestDistance(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 0, Distance(0b1011, 0b1011))
+	assert.Equal(t, 2, Distance(0b1011, 0b1110))
+	assert.Equal(t, 64, Distance(0, ^uint64(0)))
+}
+
+func TestNormalizedLength(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 0, NormalizedLength("  !!! "))
+	assert.Equal(t, 11, NormalizedLength("  Hello,   World! "))
+	assert.Equal(t, 5, NormalizedLength("héllo"))
+}
+
+func TestFormatAndParse(t *testing.T) {
+	t.Parallel()
+
+	for _, fp := range []uint64{0, 1, 0xdeadbeef, ^uint64(0)} {
+		formatted := Format(fp)
+		assert.Len(t, formatted, 16)
+		parsed, err := Parse(formatted)
+		assert.NoError(t, err)
+		assert.Equal(t, fp, parsed)
+	}
+
+	_, err := Parse("not hex")
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package fingerprint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/policyserv/frequency"
+	"github.com/matrix-org/policyserv/pubsub"
+)
+
+// Sighting - A fingerprint seen in a room, sent by a user.
+type Sighting struct {
+	Fingerprint uint64    `json:"fingerprint"`
+	Sender      string    `json:"sender"`
+	RoomId      string    `json:"room_id"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Tracker - Remembers the fingerprints seen within a sliding window.
+type Tracker interface {
+	Close() error
+	Add(sighting *Sighting) error
+	// Similar returns the sightings within the window which are at most `maxDistance` away from the fingerprint.
+	Similar(fingerprint uint64, maxDistance int) ([]*Sighting, error)
+}
+
+// NewTracker creates a new tracker using the given backend, which is one of the frequency counter backends. Trackers
+// with the same `name` share their sightings, so the name should be unique to the caller (and community, if applicable).
+func NewTracker(backend string, pubsub pubsub.Client, name string, window time.Duration) (Tracker, error) {
+	switch backend {
+	case "", frequency.BackendPubsub:
+		return NewPubsubTracker(pubsub, name, window)
+	case frequency.BackendMemory:
+		return NewMemoryTracker(window), nil
+	default:
+		return nil, fmt.Errorf("unknown fingerprint tracker backend: %s", backend)
+	}
+}
+
+// windowedSightings - The sightings recorded within the window, used by all tracker backends.
+type windowedSightings struct {
+	lock      *sync.Mutex
+	sightings []*Sighting
+	window    time.Duration
+}
+
+func newWindowedSightings(window time.Duration) *windowedSightings {
+	return &windowedSightings{
+		lock:      new(sync.Mutex),
+		sightings: make([]*Sighting, 0),
+		window:    window,
+	}
+}
+
+func (w *windowedSightings) add(sighting *Sighting) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.sightings = append(w.sightings, sighting)
+}
+
+func (w *windowedSightings) similar(fingerprint uint64, maxDistance int) []*Sighting {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// We double check expiration because the cleanup job might not have run yet
+	matches := make([]*Sighting, 0)
+	for _, sighting := range w.sightings {
+		if time.Since(sighting.Timestamp) < w.window && Distance(fingerprint, sighting.Fingerprint) <= maxDistance {
+			matches = append(matches, sighting)
+		}
+	}
+	return matches
+}
+
+func (w *windowedSightings) cleanup() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	kept := make([]*Sighting, 0, len(w.sightings))
+	for _, sighting := range w.sightings {
+		if time.Since(sighting.Timestamp) < w.window {
+			kept = append(kept, sighting)
+		}
+	}
+	w.sightings = kept
+}
+
+// len - The number of sightings being tracked. Used by tests.
+func (w *windowedSightings) len() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.sightings)
+}
+
+// startCleanup - Periodically removes expired sightings until the returned function is called.
+func (w *windowedSightings) startCleanup(name string) (stop func()) {
+	ticker := time.NewTicker(w.window)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				log.Printf("Cleaning up %s", name)
+				w.cleanup()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// PubsubTracker - A Tracker which shares sightings with all other processes using the same tracker name. Like
+// frequency.PubsubCounter, a process which has just started will miss sightings until its first window has elapsed.
+type PubsubTracker struct {
+	pubsub      pubsub.Client
+	pubsubId    string
+	pubsubStop  func()
+	cleanupStop func()
+	sightings   *windowedSightings
+}
+
+// NewPubsubTracker creates a new cross-process tracker. The `name` must be less than 60 characters.
+func NewPubsubTracker(pubsub pubsub.Client, name string, window time.Duration) (*PubsubTracker, error) {
+	if len(name) >= 60 {
+		return nil, fmt.Errorf("name must be less than 60 characters")
+	}
+	// The pubsub ID is the same on every process so that they all see each other's sightings. This must be less
+	// than 64 characters.
+	// 	+59 from caller-supplied name
+	//  +4  from our other templating
+	//  =63
+	tracker := &PubsubTracker{
+		pubsub:    pubsub,
+		pubsubId:  fmt.Sprintf("fpt.%s", name),
+		sightings: newWindowedSightings(window),
+	}
+	return tracker, tracker.start()
+}
+
+func (t *PubsubTracker) start() error {
+	ch, err := t.pubsub.Subscribe(context.Background(), t.pubsubId)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting %s", t.pubsubId)
+
+	t.pubsubStop = func() {
+		err := t.pubsub.Unsubscribe(context.Background(), ch)
+		if err != nil {
+			log.Printf("Failed to unsubscribe from %s: %s", t.pubsubId, err)
+		}
+	}
+	t.cleanupStop = t.sightings.startCleanup(t.pubsubId)
+
+	go func(ch <-chan string, t *PubsubTracker) {
+		for {
+			select {
+			case val, ok := <-ch:
+				if !ok || val == pubsub.ClosingValue {
+					return // closed
+				}
+				sighting := &Sighting{}
+				err := json.Unmarshal([]byte(val), sighting)
+				if err != nil {
+					log.Printf("Failed to unmarshal value `%s` on %s: %s", val, t.pubsubId, err)
+					continue
+				}
+				t.sightings.add(sighting)
+			}
+		}
+	}(ch, t)
+
+	return nil
+}
+
+func (t *PubsubTracker) Close() error {
+	t.cleanupStop()
+	t.pubsubStop()
+	return nil
+}
+
+func (t *PubsubTracker) Add(sighting *Sighting) error {
+	b, err := json.Marshal(sighting)
+	if err != nil {
+		return err
+	}
+
+	// We'll pick up our echo on the subscribe
+	return t.pubsub.Publish(context.Background(), t.pubsubId, string(b))
+}
+
+func (t *PubsubTracker) Similar(fingerprint uint64, maxDistance int) ([]*Sighting, error) {
+	return t.sightings.similar(fingerprint, maxDistance), nil
+}
+
+// MemoryTracker - A Tracker which only remembers sightings from the local process.
+type MemoryTracker struct {
+	cleanupStop func()
+	sightings   *windowedSightings
+}
+
+// NewMemoryTracker creates a new process-local tracker.
+func NewMemoryTracker(window time.Duration) *MemoryTracker {
+	tracker := &MemoryTracker{
+		sightings: newWindowedSightings(window),
+	}
+	tracker.cleanupStop = tracker.sightings.startCleanup("memory fingerprint tracker")
+	return tracker
+}
+
+func (t *MemoryTracker) Close() error {
+	t.cleanupStop()
+	return nil
+}
+
+func (t *MemoryTracker) Add(sighting *Sighting) error {
+	t.sightings.add(sighting)
+	return nil
+}
+
+func (t *MemoryTracker) Similar(fingerprint uint64, maxDistance int) ([]*Sighting, error) {
+	return t.sightings.similar(fingerprint, maxDistance), nil
+}
@@ -0,0 +1,78 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/frequency"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerLongName(t *testing.T) {
+	t.Parallel()
+
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	tr, err := NewPubsubTracker(ps, strings.Repeat("x", 60), 60*time.Second)
+	assert.Nil(t, tr)
+	assert.ErrorContains(t, err, "name must be less than 60 characters")
+}
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	for _, backend := range []string{frequency.BackendPubsub, frequency.BackendMemory} {
+		tr, err := NewTracker(backend, ps, "TestTracker_"+backend, 60*time.Second)
+		assert.NoError(t, err)
+		assert.NotNil(t, tr)
+
+		assert.NoError(t, tr.Add(&Sighting{Fingerprint: 0b1111, Sender: "@alice:example.org", RoomId: "!a:example.org", Timestamp: time.Now()}))
+		assert.NoError(t, tr.Add(&Sighting{Fingerprint: 0b0111, Sender: "@bob:example.org", RoomId: "!a:example.org", Timestamp: time.Now()}))
+		assert.NoError(t, tr.Add(&Sighting{Fingerprint: 0b0000, Sender: "@charlie:example.org", RoomId: "!a:example.org", Timestamp: time.Now()}))
+		// Expired sightings are ignored, even before cleanup runs
+		assert.NoError(t, tr.Add(&Sighting{Fingerprint: 0b1111, Sender: "@dave:example.org", RoomId: "!a:example.org", Timestamp: time.Now().Add(-61 * time.Second)}))
+
+		// Give it a moment to settle
+		time.Sleep(250 * time.Millisecond)
+
+		similar, err := tr.Similar(0b1111, 0)
+		assert.NoError(t, err, backend)
+		assert.Len(t, similar, 1, backend)
+		assert.Equal(t, "@alice:example.org", similar[0].Sender, backend)
+
+		similar, err = tr.Similar(0b1111, 1)
+		assert.NoError(t, err, backend)
+		assert.Len(t, similar, 2, backend)
+
+		similar, err = tr.Similar(0b1111, 4)
+		assert.NoError(t, err, backend)
+		assert.Len(t, similar, 3, backend)
+
+		assert.NoError(t, tr.Close())
+	}
+}
+
+func TestTrackerUnknownBackend(t *testing.T) {
+	t.Parallel()
+
+	tr, err := NewTracker("nope", nil, "TestTrackerUnknownBackend", 60*time.Second)
+	assert.Nil(t, tr)
+	assert.ErrorContains(t, err, "unknown fingerprint tracker backend: nope")
+}
+
+func TestWindowedSightingsCleanup(t *testing.T) {
+	t.Parallel()
+
+	w := newWindowedSightings(time.Minute)
+	w.add(&Sighting{Fingerprint: 1, Timestamp: time.Now()})
+	w.add(&Sighting{Fingerprint: 2, Timestamp: time.Now().Add(-2 * time.Minute)})
+	assert.Equal(t, 2, w.len())
+	w.cleanup()
+	assert.Equal(t, 1, w.len())
+}
@@ -17,9 +17,9 @@ func TestCounterLongName(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	c, err := NewCounter(ps, strings.Repeat("x", 32), 60*time.Second)
+	c, err := NewPubsubCounter(ps, strings.Repeat("x", 60), 60*time.Second)
 	assert.Nil(t, c)
-	assert.ErrorContains(t, err, "name must be less than 31 characters")
+	assert.ErrorContains(t, err, "name must be less than 60 characters")
 }
 
 func TestCounter(t *testing.T) {
@@ -28,7 +28,7 @@ func TestCounter(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	c, err := NewCounter(ps, "TestCounter_1", 60*time.Second)
+	c, err := NewPubsubCounter(ps, "TestCounter_1", 60*time.Second)
 	assert.NoError(t, err)
 	assert.NotNil(t, c)
 	defer c.Close()
@@ -61,7 +61,7 @@ func TestCounterOldEntries(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	c, err := NewCounter(ps, "TestCounter_2", 1000*time.Millisecond) // short window to avoid long test delays
+	c, err := NewPubsubCounter(ps, "TestCounter_2", 1000*time.Millisecond) // short window to avoid long test delays
 	assert.NoError(t, err)
 	assert.NotNil(t, c)
 	defer c.Close()
@@ -74,8 +74,8 @@ func TestCounterOldEntries(t *testing.T) {
 
 	// Allow the entries to settle before we test that they actually made it (1 key and 10 entries)
 	time.Sleep(100 * time.Millisecond)
-	assert.Equal(t, 1, len(c.values))
-	assert.Equal(t, 10, len(c.values[entity]))
+	assert.Equal(t, 1, c.values.len())
+	assert.Equal(t, 10, len(c.values.values[entity]))
 
 	// Wait for the entries to expire/exceed the window (with some buffer)
 	time.Sleep(1100 * time.Millisecond)
@@ -86,7 +86,7 @@ func TestCounterOldEntries(t *testing.T) {
 	assert.Equal(t, 0, rate)
 }
 
-func manualIncrement(t *testing.T, c *Counter, entity string, ts time.Time) {
+func manualIncrement(t *testing.T, c *PubsubCounter, entity string, ts time.Time) {
 	// XXX: It's not great that we inject this way, but it does effectively test that the counter receives data
 	// over the wire properly.
 	r := record{
@@ -105,7 +105,7 @@ func TestCounterNewEntries(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	c, err := NewCounter(ps, "TestCounter_3", 60*time.Second)
+	c, err := NewPubsubCounter(ps, "TestCounter_3", 60*time.Second)
 	assert.NoError(t, err)
 	assert.NotNil(t, c)
 	defer c.Close()
@@ -130,7 +130,7 @@ func TestCounterCleanup(t *testing.T) {
 	ps := test.NewMemoryPubsub(t)
 	defer ps.Close()
 
-	c, err := NewCounter(ps, "TestCounter_4", 500*time.Millisecond) // short window to avoid long test delays
+	c, err := NewPubsubCounter(ps, "TestCounter_4", 500*time.Millisecond) // short window to avoid long test delays
 	assert.NoError(t, err)
 	assert.NotNil(t, c)
 	defer c.Close()
@@ -142,18 +142,105 @@ func TestCounterCleanup(t *testing.T) {
 
 	// Allow the entries to settle before we test that they actually made it
 	time.Sleep(100 * time.Millisecond)
-	assert.Equal(t, 3, len(c.values))
+	assert.Equal(t, 3, c.values.len())
 
 	// Wait for the first cleanup job to run (with some buffer)
 	time.Sleep(1250 * time.Millisecond)
 
 	// We should just have user3 values left
-	assert.Equal(t, 1, len(c.values))
-	assert.Contains(t, c.values, "@user3:example.org")
+	assert.Equal(t, 1, c.values.len())
+	assert.Contains(t, c.values.values, "@user3:example.org")
 
 	// Now wait for the second cleanup job to run (with some buffer)
 	time.Sleep(1250 * time.Millisecond)
 
 	// We should have no values left
-	assert.Equal(t, 0, len(c.values))
+	assert.Equal(t, 0, c.values.len())
+}
+
+func TestCounterSharedAcrossProcesses(t *testing.T) {
+	t.Parallel()
+
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	// Two counters with the same name simulate two policyserv processes behind a load balancer
+	c1, err := NewPubsubCounter(ps, "TestCounter_5", 60*time.Second)
+	assert.NoError(t, err)
+	defer c1.Close()
+	c2, err := NewPubsubCounter(ps, "TestCounter_5", 60*time.Second)
+	assert.NoError(t, err)
+	defer c2.Close()
+	other, err := NewPubsubCounter(ps, "TestCounter_6", 60*time.Second)
+	assert.NoError(t, err)
+	defer other.Close()
+
+	entity := "@user1:example.org"
+	assert.NoError(t, c1.Increment(entity))
+	assert.NoError(t, c2.Increment(entity))
+	assert.NoError(t, c2.Increment(entity))
+
+	// Give it a moment to settle
+	time.Sleep(250 * time.Millisecond)
+
+	// Both processes should see all of the increments
+	for _, c := range []Counter{c1, c2} {
+		rate, err := c.Get(entity)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, rate)
+	}
+
+	// ... but differently named counters should not
+	rate, err := other.Get(entity)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rate)
+}
+
+func TestMemoryCounter(t *testing.T) {
+	t.Parallel()
+
+	c := NewMemoryCounter(500 * time.Millisecond) // short window to avoid long test delays
+	defer c.Close()
+
+	entity := "@user1:example.org"
+	assert.NoError(t, c.Increment(entity))
+	assert.NoError(t, c.Increment(entity))
+
+	// Memory counters don't need to settle
+	rate, err := c.Get(entity)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rate)
+
+	// Wait for the entries to expire and be cleaned up (with some buffer)
+	time.Sleep(1250 * time.Millisecond)
+	rate, err = c.Get(entity)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rate)
+	assert.Equal(t, 0, c.values.len())
+}
+
+func TestNewCounterBackends(t *testing.T) {
+	t.Parallel()
+
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+
+	c, err := NewCounter("", ps, "TestCounter_7", 60*time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &PubsubCounter{}, c)
+	_ = c.Close()
+
+	c, err = NewCounter(BackendPubsub, ps, "TestCounter_8", 60*time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &PubsubCounter{}, c)
+	_ = c.Close()
+
+	c, err = NewCounter(BackendMemory, ps, "TestCounter_9", 60*time.Second)
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryCounter{}, c)
+	_ = c.Close()
+
+	c, err = NewCounter("redis", ps, "TestCounter_10", 60*time.Second)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "unknown frequency counter backend: redis")
 }
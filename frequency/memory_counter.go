@@ -0,0 +1,34 @@
+package frequency
+
+import (
+	"time"
+)
+
+// MemoryCounter - A Counter which only counts increments from the local process.
+type MemoryCounter struct {
+	cleanupStop func()
+	values      *windowedValues
+}
+
+// NewMemoryCounter creates a new process-local counter.
+func NewMemoryCounter(window time.Duration) *MemoryCounter {
+	counter := &MemoryCounter{
+		values: newWindowedValues(window),
+	}
+	counter.cleanupStop = counter.values.startCleanup("memory counter")
+	return counter
+}
+
+func (c *MemoryCounter) Close() error {
+	c.cleanupStop()
+	return nil
+}
+
+func (c *MemoryCounter) Increment(entity string) error {
+	c.values.add(entity, time.Now())
+	return nil
+}
+
+func (c *MemoryCounter) Get(entity string) (int, error) {
+	return c.values.count(entity), nil
+}
@@ -0,0 +1,106 @@
+package frequency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/pubsub"
+)
+
+type record struct {
+	Entity    string    `json:"entity"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PubsubCounter - A Counter which shares increments with all other processes using the same counter name. Every
+// process keeps its own copy of the window, so a process which has just started will undercount until its first
+// window has elapsed.
+type PubsubCounter struct {
+	pubsub      pubsub.Client
+	pubsubId    string
+	pubsubStop  func()
+	cleanupStop func()
+	values      *windowedValues
+}
+
+// NewPubsubCounter creates a new cross-process counter. The `name` must be less than 60 characters.
+func NewPubsubCounter(pubsub pubsub.Client, name string, window time.Duration) (*PubsubCounter, error) {
+	if len(name) >= 60 {
+		return nil, fmt.Errorf("name must be less than 60 characters")
+	}
+	// The pubsub ID is the same on every process so that they all see each other's increments. This must be less
+	// than 64 characters.
+	// 	+59 from caller-supplied name
+	//  +4  from our other templating
+	//  =63
+	counter := &PubsubCounter{
+		pubsub:   pubsub,
+		pubsubId: fmt.Sprintf("ctr.%s", name),
+		values:   newWindowedValues(window),
+	}
+	return counter, counter.start()
+}
+
+func (c *PubsubCounter) start() error {
+	ch, err := c.pubsub.Subscribe(context.Background(), c.pubsubId)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting %s", c.pubsubId)
+
+	c.pubsubStop = func() {
+		err := c.pubsub.Unsubscribe(context.Background(), ch)
+		if err != nil {
+			log.Printf("Failed to unsubscribe from %s: %s", c.pubsubId, err)
+		}
+	}
+	c.cleanupStop = c.values.startCleanup(c.pubsubId)
+
+	go func(ch <-chan string, c *PubsubCounter) {
+		for {
+			select {
+			case val, ok := <-ch:
+				if !ok || val == pubsub.ClosingValue {
+					return // closed
+				}
+				rec := record{}
+				err := json.Unmarshal([]byte(val), &rec)
+				if err != nil {
+					log.Printf("Failed to unmarshal value `%s` on %s: %s", val, c.pubsubId, err)
+					continue
+				}
+				c.values.add(rec.Entity, rec.Timestamp)
+				log.Printf("Incremented %s (at %s) on %s", rec.Entity, rec.Timestamp.Format(time.RFC1123Z), c.pubsubId)
+			}
+		}
+	}(ch, c)
+
+	return nil
+}
+
+func (c *PubsubCounter) Close() error {
+	c.cleanupStop()
+	c.pubsubStop()
+	return nil
+}
+
+func (c *PubsubCounter) Increment(entity string) error {
+	rec := record{
+		Entity:    entity,
+		Timestamp: time.Now(),
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	// We'll pick up our echo on the subscribe
+	return c.pubsub.Publish(context.Background(), c.pubsubId, string(b))
+}
+
+func (c *PubsubCounter) Get(entity string) (int, error) {
+	return c.values.count(entity), nil
+}
@@ -1,6 +1,10 @@
 package harms
 
-import "slices"
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
 
 // Harm - A harm identifier.
 type Harm string
@@ -24,6 +28,16 @@ func (c ContentClass) String() string {
 	return [...]string{"Neutral", "Allowed", "Prohibited"}[c]
 }
 
+// ParseContentClass - Parses a content class from its String() representation. The comparison is case-insensitive.
+func ParseContentClass(val string) (ContentClass, error) {
+	for _, c := range []ContentClass{ContentClassNeutral, ContentClassAllowed, ContentClassProhibited} {
+		if strings.EqualFold(c.String(), val) {
+			return c, nil
+		}
+	}
+	return ContentClassNeutral, fmt.Errorf("unknown content class: %s", val)
+}
+
 // ContentInfo - Carries harm and class information for a given piece of content.
 type ContentInfo struct {
 	class ContentClass
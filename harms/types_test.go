@@ -12,6 +12,23 @@ func TestContentClassString(t *testing.T) {
 	assert.Equal(t, "Allowed", ContentClassAllowed.String())
 }
 
+func TestParseContentClass(t *testing.T) {
+	c, err := ParseContentClass("neutral")
+	assert.NoError(t, err)
+	assert.Equal(t, ContentClassNeutral, c)
+
+	c, err = ParseContentClass("Allowed")
+	assert.NoError(t, err)
+	assert.Equal(t, ContentClassAllowed, c)
+
+	c, err = ParseContentClass("PROHIBITED")
+	assert.NoError(t, err)
+	assert.Equal(t, ContentClassProhibited, c)
+
+	_, err = ParseContentClass("spammy")
+	assert.Error(t, err)
+}
+
 //goland:noinspection GoBoolExpressions (GoLand wants to simplify these tests to assert.True(t, true), which isn't helpful)
 func TestContentClassOrder(t *testing.T) {
 	assert.True(t, ContentClassNeutral < ContentClassAllowed)
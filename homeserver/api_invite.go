@@ -0,0 +1,155 @@
+package homeserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/fclient"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/metrics"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// auditRoomJoinDelay - How long to wait after accepting an invite before joining the audit room. This gives the
+// inviting server time to persist the invite, otherwise our join may be rejected.
+const auditRoomJoinDelay = 5 * time.Second
+
+func httpInvite(server *Homeserver, w http.ResponseWriter, r *http.Request) {
+	metrics.RecordHttpRequest(r.Method, "httpInvite")
+	t := metrics.StartRequestTimer(r.Method, "httpInvite")
+	defer t.ObserveDuration()
+
+	if r.Method != http.MethodPut {
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusMethodNotAllowed)
+		MatrixHttpError(w, http.StatusMethodNotAllowed, "M_UNKNOWN", "Method not allowed")
+		return
+	}
+
+	fedReq, fedErr := fclient.VerifyHTTPRequest(r, time.Now(), server.ServerName, server.isSelf, server.keyRing)
+	if !fedErr.Is2xx() {
+		b, err := json.Marshal(fedErr.JSON)
+		if err != nil {
+			log.Println("Error marshalling fedErr:", err)
+			defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusInternalServerError)
+			MatrixHttpError(w, http.StatusInternalServerError, "M_UNKNOWN", "Unable to marshal error response")
+			return
+		}
+
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", fedErr.Code)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(fedErr.Code)
+		_, _ = w.Write(b)
+		return
+	}
+
+	req := fclient.InviteV2Request{}
+	err := json.Unmarshal(fedReq.Content(), &req)
+	if err != nil {
+		log.Println("Error unmarshalling invite:", err)
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusBadRequest)
+		MatrixHttpError(w, http.StatusBadRequest, "M_BAD_JSON", "Unable to parse invite")
+		return
+	}
+
+	// Ensure the invite is for us, and sent by the server which is asking us to accept it
+	event := req.Event()
+	membership, err := event.Membership()
+	sender := event.SenderID().ToUserID()
+	if err != nil || membership != spec.Invite || event.Type() != spec.MRoomMember || !event.StateKeyEquals(server.localActor.String()) ||
+		event.RoomID().String() != r.PathValue("roomId") || event.EventID() != r.PathValue("eventId") ||
+		sender == nil || sender.Domain() != fedReq.Origin() {
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusBadRequest)
+		MatrixHttpError(w, http.StatusBadRequest, "M_INVALID_PARAM", "Invalid invite event")
+		return
+	}
+
+	// Only the sender's server has signed the invite so far, so we can't verify all of the event's signatures
+	redacted, err := gomatrixserverlib.MustGetRoomVersion(req.RoomVersion()).RedactEventJSON(event.JSON())
+	if err == nil {
+		var results []gomatrixserverlib.VerifyJSONResult
+		results, err = server.keyRing.VerifyJSONs(r.Context(), []gomatrixserverlib.VerifyJSONRequest{{
+			ServerName:           sender.Domain(),
+			Message:              redacted,
+			AtTS:                 event.OriginServerTS(),
+			ValidityCheckingFunc: gomatrixserverlib.StrictValiditySignatureCheck,
+		}})
+		if err == nil {
+			err = results[0].Error
+		}
+	}
+	if err != nil {
+		log.Printf("Signature verification failed for invite %s: %s", event.EventID(), err)
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusForbidden)
+		MatrixHttpError(w, http.StatusForbidden, "M_FORBIDDEN", "The invite must be signed by the server it originated on")
+		return
+	}
+
+	// We only accept invites to rooms a community has configured as its audit room. Protected rooms are joined through
+	// the API instead.
+	roomId := event.RoomID().String()
+	communities, err := server.storage.GetCommunitiesByAuditRoomId(r.Context(), roomId)
+	if err != nil {
+		log.Println("Error getting communities by audit room:", err)
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusInternalServerError)
+		MatrixHttpError(w, http.StatusInternalServerError, "M_UNKNOWN", "Unable to get communities")
+		return
+	}
+	if len(communities) == 0 {
+		log.Printf("Rejecting invite to %s from %s: not an audit room", roomId, sender)
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusForbidden)
+		MatrixHttpError(w, http.StatusForbidden, "M_FORBIDDEN", "This server only accepts invites to community audit rooms")
+		return
+	}
+
+	server.auditRoomsLock.Lock()
+	room, err := server.storage.GetAuditRoom(r.Context(), roomId)
+	if err == nil {
+		if room == nil {
+			room = &storage.StoredAuditRoom{
+				RoomId:       roomId,
+				Servers:      make([]string, 0),
+				PrevEventIds: make([]string, 0),
+			}
+		}
+		// If we were already in the room then we've since been kicked, so we'll need to rejoin
+		room.RoomVersion = string(req.RoomVersion())
+		room.Via = string(fedReq.Origin())
+		room.MemberEventId = ""
+		err = server.storage.UpsertAuditRoom(r.Context(), room)
+	}
+	server.auditRoomsLock.Unlock()
+	if err != nil {
+		log.Println("Error upserting audit room:", err)
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusInternalServerError)
+		MatrixHttpError(w, http.StatusInternalServerError, "M_UNKNOWN", "Unable to store invite")
+		return
+	}
+
+	b, err := json.Marshal(fclient.RespInviteV2{
+		Event: event.Sign(string(server.ServerName), server.KeyId, server.signingKey).JSON(),
+	})
+	if err != nil {
+		defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusInternalServerError)
+		MatrixHttpError(w, http.StatusInternalServerError, "M_UNKNOWN", "Unable to marshal response")
+		return
+	}
+
+	log.Printf("Accepted invite to audit room %s from %s", roomId, sender)
+	go func() {
+		// If this fails, we'll try again when sending the first audit message
+		time.Sleep(auditRoomJoinDelay)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if _, err := server.JoinAuditRoom(ctx, roomId); err != nil {
+			log.Printf("Non-fatal error joining audit room %s: %s", roomId, err)
+		}
+	}()
+
+	defer metrics.RecordHttpResponse(r.Method, "httpInvite", http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
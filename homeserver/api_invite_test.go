@@ -0,0 +1,106 @@
+package homeserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/fclient"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeInviteRequestForTest(t *testing.T, hs *Homeserver, roomId string, originName string, stateKey string) (*http.Request, gomatrixserverlib.PDU) {
+	event := makeAuditRoomEventForTest(t, hs, gomatrixserverlib.ProtoEvent{
+		SenderID:   "@alice:" + originName,
+		RoomID:     roomId,
+		Type:       spec.MRoomMember,
+		StateKey:   &stateKey,
+		PrevEvents: []string{"$prev"},
+		Depth:      6,
+	}, map[string]any{"membership": spec.Invite})
+	invite, err := fclient.NewInviteV2Request(event, nil)
+	assert.NoError(t, err)
+
+	req := hs.MustMakeFederationRequest(t, http.MethodPut, "/_matrix/federation/v2/invite/"+roomId+"/"+event.EventID(), invite, originName)
+	req.SetPathValue("roomId", roomId)
+	req.SetPathValue("eventId", event.EventID())
+	return req, event
+}
+
+func TestHttpInvite(t *testing.T) {
+	t.Parallel()
+
+	db := test.NewMemoryStorage(t)
+	hs := NewMockServerForTest(t, db, NoConfigChanges)
+
+	roomId := "!audit:origin.example.org"
+	community, err := db.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	community.Config.AuditRoomId = internal.Pointer(roomId)
+	err = db.UpsertCommunity(context.Background(), community)
+	assert.NoError(t, err)
+
+	res := httptest.NewRecorder()
+	req, event := makeInviteRequestForTest(t, hs, roomId, "origin.example.org", hs.localActor.String())
+	httpInvite(hs, res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+
+	// The invite is returned with our signature added
+	resp := fclient.RespInviteV2{}
+	err = json.Unmarshal(res.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	signed, err := gomatrixserverlib.MustGetRoomVersion(gomatrixserverlib.RoomVersionV10).NewEventFromUntrustedJSON(resp.Event)
+	assert.NoError(t, err)
+	assert.Equal(t, event.EventID(), signed.EventID())
+	err = gomatrixserverlib.VerifyEventSignatures(context.Background(), signed, hs.keyRing, func(roomId spec.RoomID, senderId spec.SenderID) (*spec.UserID, error) {
+		return senderId.ToUserID(), nil
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, string(resp.Event), string(hs.ServerName))
+
+	// We remember the invite so we can join through the inviting server
+	room, err := db.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.NotNil(t, room)
+	assert.Equal(t, "origin.example.org", room.Via)
+	assert.Equal(t, string(gomatrixserverlib.RoomVersionV10), room.RoomVersion)
+	assert.Empty(t, room.MemberEventId)
+}
+
+func TestHttpInviteRejected(t *testing.T) {
+	t.Parallel()
+
+	db := test.NewMemoryStorage(t)
+	hs := NewMockServerForTest(t, db, NoConfigChanges)
+
+	// Rooms which aren't configured as an audit room are rejected
+	roomId := "!not_audit:origin.example.org"
+	res := httptest.NewRecorder()
+	req, _ := makeInviteRequestForTest(t, hs, roomId, "origin.example.org", hs.localActor.String())
+	httpInvite(hs, res, req)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	test.AssertApiError(t, res, "M_FORBIDDEN", "This server only accepts invites to community audit rooms")
+
+	// Invites for other users are rejected, even in audit rooms
+	community, err := db.CreateCommunity(context.Background(), "Test Community")
+	assert.NoError(t, err)
+	community.Config.AuditRoomId = internal.Pointer(roomId)
+	err = db.UpsertCommunity(context.Background(), community)
+	assert.NoError(t, err)
+	res = httptest.NewRecorder()
+	req, _ = makeInviteRequestForTest(t, hs, roomId, "origin.example.org", "@someone_else:policy.example.org")
+	httpInvite(hs, res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	test.AssertApiError(t, res, "M_INVALID_PARAM", "Invalid invite event")
+
+	room, err := db.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.Nil(t, room)
+}
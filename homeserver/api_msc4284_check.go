@@ -83,6 +83,15 @@ func httpMSC4284Check(server *Homeserver, w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if res.ShadowMode {
+		// Record what we would have said, but always tell the server the event is fine
+		recordShadowModeRecommendation(event, res)
+		defer metrics.RecordHttpResponse(r.Method, "httpMSC4284Check", http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(msc4284NeutralResponse)
+		return
+	}
+
 	if res.ContentInfo.Class() == harms.ContentClassProhibited {
 		redactIfNeeded(r.Context(), server, fedReq.Origin(), event)
 	}
@@ -96,6 +105,17 @@ func httpMSC4284Check(server *Homeserver, w http.ResponseWriter, r *http.Request
 	}
 }
 
+// recordShadowModeRecommendation - Logs and records metrics for the recommendation we would have made if the room's
+// community wasn't in shadow mode.
+func recordShadowModeRecommendation(event gomatrixserverlib.PDU, res *queue.PoolResult) {
+	recommendation := "ok"
+	if res.ContentInfo.Class() == harms.ContentClassProhibited {
+		recommendation = "spam"
+	}
+	log.Printf("[%s | %s] Shadow mode: would have recommended %s", event.EventID(), event.RoomID().String(), recommendation)
+	metrics.RecordShadowModeRecommendation(event.RoomID().String(), recommendation)
+}
+
 func decodeRoom(name string, server *Homeserver, w http.ResponseWriter, r *http.Request) (*fclient.FederationRequest, *storage.StoredRoom) {
 	if r.Method != http.MethodPost {
 		defer metrics.RecordHttpResponse(r.Method, name, http.StatusMethodNotAllowed)
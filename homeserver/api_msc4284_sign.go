@@ -91,7 +91,10 @@ func handlePolicySignRequest(server *Homeserver, w http.ResponseWriter, r *http.
 		return
 	}
 
-	if res.ContentInfo.Class() == harms.ContentClassProhibited {
+	if res.ShadowMode {
+		// Sign the event regardless of what the filters said
+		recordShadowModeRecommendation(event, res)
+	} else if res.ContentInfo.Class() == harms.ContentClassProhibited {
 		log.Printf("🚫 [%s] refusing to sign in %s", event.EventID(), event.RoomID().String())
 		refuseToSign(w, r, stable, res.ContentInfo.Harms())
 		redactIfNeeded(r.Context(), server, fedReq.Origin(), event)
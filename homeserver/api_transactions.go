@@ -80,7 +80,24 @@ func httpTransactionReceive(server *Homeserver, w http.ResponseWriter, r *http.R
 			continue
 		}
 		if room == nil {
-			log.Println("Non-fatal error getting room: room not found")
+			// We don't protect audit rooms, but we do need to keep up with them to send messages
+			var event gomatrixserverlib.PDU
+			event, err = server.receiveAuditRoomEvent(r.Context(), header.RoomId, eventRaw)
+			if event == nil {
+				if err != nil {
+					log.Println("Non-fatal error receiving audit room event:", err)
+				} else {
+					log.Println("Non-fatal error getting room: room not found")
+				}
+				continue
+			}
+			resp.PDUs[event.EventID()] = fclient.PDUResult{}
+			if err != nil {
+				log.Printf("Could not receive audit room event %s - ignoring event. %s", event.EventID(), err.Error())
+				resp.PDUs[event.EventID()] = fclient.PDUResult{
+					Error: err.Error(),
+				}
+			}
 			continue
 		}
 		roomVersion := gomatrixserverlib.MustGetRoomVersion(gomatrixserverlib.RoomVersion(room.RoomVersion))
@@ -138,7 +155,7 @@ func httpTransactionReceive(server *Homeserver, w http.ResponseWriter, r *http.R
 				return
 			}
 
-			if res.ContentInfo.Class() == harms.ContentClassProhibited {
+			if res.ContentInfo.Class() == harms.ContentClassProhibited && !res.ShadowMode {
 				redactIfNeeded(ctx, server, "not_a_real_server_to_always_fail_the_included_sender_check", event)
 			}
 		}()
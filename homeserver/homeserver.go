@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	cache "github.com/Code-Hex/go-generics-cache"
@@ -70,6 +71,7 @@ type Homeserver struct {
 	securityContacts       []config.SupportContact
 	supportUrl             string
 	sendTxnSingleflight    *singleflight.Group
+	auditRoomsLock         sync.Mutex // held while reading and updating the DAG position of audit rooms
 }
 
 func NewHomeserver(config *Config, storage storage.PersistentStorage, pool *queue.Pool, pubsubClient pubsub.Client) (*Homeserver, error) {
@@ -178,6 +180,7 @@ func (h *Homeserver) BindTo(mux *http.ServeMux) error {
 	mux.Handle("/_matrix/key/v2/server", h.httpRequestHandler(httpSelfKey))
 	mux.Handle("/_matrix/federation/v1/send/{txnId}", h.httpRequestHandler(httpTransactionReceive))
 	mux.Handle("/_matrix/federation/v1/user/devices/{userId}", h.httpRequestHandler(httpUserDevices))
+	mux.Handle("/_matrix/federation/v2/invite/{roomId}/{eventId}", h.httpRequestHandler(httpInvite))
 	mux.Handle("/_matrix/policy/unstable/org.matrix.msc4284/event/{eventId}/check", h.httpRequestHandler(httpMSC4284Check))
 	mux.Handle("/_matrix/policy/unstable/org.matrix.msc4284/sign", h.httpRequestHandler(httpMSC4284Sign))
 	mux.Handle("/_matrix/policy/v1/sign", h.httpRequestHandler(httpPolicySign))
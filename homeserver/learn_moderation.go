@@ -0,0 +1,212 @@
+package homeserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/event"
+	"github.com/matrix-org/policyserv/fingerprint"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/queue"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/trust"
+)
+
+// RecentContentRetention - How long the fingerprints and media URIs of received events are kept for. Moderators need to
+// redact the event (or ban its sender) within this time for the content to be learned.
+const RecentContentRetention = 24 * time.Hour
+
+// learnFromModerationIfNeeded records the content of regular events so it can be blocked later, and blocks previously
+// recorded content when a moderator redacts an event or bans its sender.
+func (h *Homeserver) learnFromModerationIfNeeded(basedOnResult *queue.PoolResult, event gomatrixserverlib.PDU) {
+	if basedOnResult.Err != nil || basedOnResult.ContentInfo.Class() == harms.ContentClassProhibited {
+		return // the event probably won't make it into the room
+	}
+
+	if !canLearnFromModeration(event) {
+		return // checked before touching the database, as most state events are irrelevant
+	}
+
+	// Like queueLearnStateIfNeeded, we don't want to be tied to our caller's timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	roomId := event.RoomID().String()
+	room, err := h.storage.GetRoom(ctx, roomId)
+	if err != nil {
+		log.Printf("[%s | %s] Error getting room to learn from moderation: %s", event.EventID(), roomId, err)
+		return
+	}
+	if room == nil {
+		return // not a protected room
+	}
+	communityConfig, err := h.getCommunityConfig(ctx, room.CommunityId)
+	if err != nil {
+		log.Printf("[%s | %s] Error getting community config to learn from moderation: %s", event.EventID(), roomId, err)
+		return
+	}
+	blockFor := time.Duration(internal.Dereference(communityConfig.ModeratorBlocklistFilterMinutes)) * time.Minute
+	if blockFor <= 0 {
+		return // the community doesn't want to learn from its moderators
+	}
+
+	if event.Type() == "m.room.redaction" {
+		err = h.learnFromRedaction(ctx, room, event, blockFor)
+	} else if event.Type() == "m.room.member" && event.StateKey() != nil {
+		err = h.learnFromBan(ctx, room, event, blockFor)
+	} else if event.StateKey() == nil {
+		err = h.recordRecentContents(ctx, room, communityConfig, event)
+	}
+	if err != nil {
+		log.Printf("[%s | %s] Error learning from moderation: %s", event.EventID(), roomId, err)
+	}
+}
+
+// canLearnFromModeration returns whether the event is a redaction, a ban, or a regular (non-state) event whose content
+// can be recorded. Nothing is learned from other events.
+func canLearnFromModeration(event gomatrixserverlib.PDU) bool {
+	if event.Type() == "m.room.redaction" || event.StateKey() == nil {
+		return true
+	}
+	if event.Type() != "m.room.member" {
+		return false
+	}
+	membership, err := event.Membership()
+	return err == nil && membership == spec.Ban
+}
+
+func (h *Homeserver) getCommunityConfig(ctx context.Context, communityId string) (*config.CommunityConfig, error) {
+	community, err := h.storage.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	if community == nil {
+		return nil, fmt.Errorf("community %s not found", communityId)
+	}
+	b, err := json.Marshal(community.Config)
+	if err != nil {
+		return nil, err
+	}
+	return config.NewCommunityConfigForJSON(b)
+}
+
+// recordRecentContents stores the event's fingerprint and media URIs, if it has any, so they can be blocked if a
+// moderator removes the event later. We don't store the event's content itself.
+func (h *Homeserver) recordRecentContents(ctx context.Context, room *storage.StoredRoom, communityConfig *config.CommunityConfig, pdu gomatrixserverlib.PDU) error {
+	contents := make([]*storage.StoredRecentContent, 0)
+	addContent := func(kind storage.ContentKind, value string) {
+		contents = append(contents, &storage.StoredRecentContent{
+			EventId:                 pdu.EventID(),
+			CommunityId:             room.CommunityId,
+			RoomId:                  room.RoomId,
+			Sender:                  string(pdu.SenderID()),
+			Kind:                    kind,
+			Value:                   value,
+			ReceivedTimestampMillis: time.Now().UnixMilli(),
+		})
+	}
+
+	content := event.ExtractContent(pdu)
+	for _, url := range content.MediaUrls {
+		addContent(storage.ContentKindMediaUri, url)
+	}
+	// This must match how the moderator blocklist filter fingerprints events
+	text := content.PlainText()
+	if text != "" && fingerprint.NormalizedLength(text) >= internal.Dereference(communityConfig.ModeratorBlocklistFilterMinLength) {
+		addContent(storage.ContentKindFingerprint, fingerprint.Format(fingerprint.Simhash(text)))
+	}
+
+	if len(contents) == 0 {
+		return nil // nothing worth recording
+	}
+	return h.storage.InsertRecentContents(ctx, contents)
+}
+
+// learnFromRedaction blocks the redacted event's content if the redaction was sent by a moderator.
+func (h *Homeserver) learnFromRedaction(ctx context.Context, room *storage.StoredRoom, redaction gomatrixserverlib.PDU, blockFor time.Duration) error {
+	contents, err := h.storage.GetRecentContentsForEvent(ctx, redaction.Redacts())
+	if err != nil {
+		return err
+	}
+	if len(contents) == 0 {
+		return nil // we don't know what the event contained (or it didn't contain anything we can block)
+	}
+	if contents[0].RoomId != room.RoomId {
+		return nil // "should never happen", but don't let a redaction in one room affect another
+	}
+	if contents[0].Sender == string(redaction.SenderID()) {
+		return nil // users removing their own events aren't moderating them
+	}
+	isModerator, err := h.isModerator(ctx, room.RoomId, string(redaction.SenderID()))
+	if err != nil || !isModerator {
+		return err
+	}
+
+	log.Printf("[%s | %s] Moderator %s redacted %s - blocking its content", redaction.EventID(), room.RoomId, redaction.SenderID(), redaction.Redacts())
+	return h.blockContents(ctx, room.CommunityId, contents, blockFor)
+}
+
+// learnFromBan blocks the recent content sent by the banned user, if the ban was sent by a moderator.
+func (h *Homeserver) learnFromBan(ctx context.Context, room *storage.StoredRoom, event gomatrixserverlib.PDU, blockFor time.Duration) error {
+	membership, err := event.Membership()
+	if err != nil {
+		return err
+	}
+	if membership != spec.Ban {
+		return nil // not a ban
+	}
+	bannedUserId := *event.StateKey()
+	if bannedUserId == string(event.SenderID()) {
+		return nil // "should never happen"
+	}
+	isModerator, err := h.isModerator(ctx, room.RoomId, string(event.SenderID()))
+	if err != nil || !isModerator {
+		return err
+	}
+
+	contents, err := h.storage.GetRecentContentsForSender(ctx, room.CommunityId, bannedUserId)
+	if err != nil {
+		return err
+	}
+	log.Printf("[%s | %s] Moderator %s banned %s - blocking %d recent contents", event.EventID(), room.RoomId, event.SenderID(), bannedUserId, len(contents))
+	return h.blockContents(ctx, room.CommunityId, contents, blockFor)
+}
+
+// isModerator returns whether the user has a moderator-like power level in the room, per the room's learned power levels.
+func (h *Homeserver) isModerator(ctx context.Context, roomId string, userId string) (bool, error) {
+	source, err := trust.NewPowerLevelsSource(h.storage)
+	if err != nil {
+		return false, err
+	}
+	return source.IsUserAboveDefault(ctx, roomId, userId)
+}
+
+func (h *Homeserver) blockContents(ctx context.Context, communityId string, contents []*storage.StoredRecentContent, blockFor time.Duration) error {
+	if len(contents) == 0 {
+		return nil
+	}
+	expires := time.Now().Add(blockFor).UnixMilli()
+	blocked := make([]*storage.StoredBlockedContent, 0, len(contents))
+	for _, c := range contents {
+		blocked = append(blocked, &storage.StoredBlockedContent{
+			CommunityId:            communityId,
+			Kind:                   c.Kind,
+			Value:                  c.Value,
+			EventId:                c.EventId,
+			ExpiresTimestampMillis: expires,
+		})
+	}
+	err := h.storage.UpsertBlockedContents(ctx, blocked)
+	if err != nil {
+		return errors.Join(fmt.Errorf("error blocking %d contents", len(blocked)), err)
+	}
+	return nil
+}
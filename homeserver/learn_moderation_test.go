@@ -0,0 +1,167 @@
+package homeserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/queue"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/matrix-org/policyserv/trust"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLearnFromModerationIfNeeded(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	hs := NewMockServerForTest(t, test.NewMemoryStorage(t), nil)
+	roomId := "!test:example.org"
+	communityId := "TestLearnFromModerationIfNeeded"
+	assert.NoError(t, hs.storage.UpsertCommunity(ctx, &storage.StoredCommunity{
+		CommunityId: communityId,
+		Config: &config.CommunityConfig{
+			ModeratorBlocklistFilterMinutes:   internal.Pointer(60),
+			ModeratorBlocklistFilterMinLength: internal.Pointer(10),
+		},
+	}))
+	assert.NoError(t, hs.storage.UpsertRoom(ctx, &storage.StoredRoom{
+		RoomId:      roomId,
+		RoomVersion: "10",
+		CommunityId: communityId,
+	}))
+	source, err := trust.NewPowerLevelsSource(hs.storage)
+	assert.NoError(t, err)
+	assert.NoError(t, source.ImportData(ctx, roomId, test.MustMakePDU(&test.BaseClientEvent{
+		RoomId:   roomId,
+		Type:     "m.room.power_levels",
+		StateKey: internal.Pointer(""),
+		Content: map[string]any{
+			"state_default": 50,
+			"users_default": 0,
+			"users": map[string]any{
+				"@mod:example.org": 50,
+			},
+		},
+	})))
+
+	neutral := &queue.PoolResult{ContentInfo: harms.NeutralContent()}
+	learn := func(event gomatrixserverlib.PDU) {
+		hs.learnFromModerationIfNeeded(neutral, event)
+	}
+	makeMessage := func(eventId string, sender string, content map[string]any) gomatrixserverlib.PDU {
+		return MakeSignedPDUForTest(t, hs, &test.BaseClientEvent{
+			EventId: eventId,
+			RoomId:  roomId,
+			Type:    "m.room.message",
+			Sender:  sender,
+			Content: content,
+		})
+	}
+	makeRedaction := func(sender string, redacts string) gomatrixserverlib.PDU {
+		return MakeSignedPDUForTest(t, hs, &test.BaseClientEvent{
+			EventId: "$redaction",
+			RoomId:  roomId,
+			Type:    "m.room.redaction",
+			Sender:  sender,
+			Redacts: redacts,
+			Content: map[string]any{},
+		})
+	}
+	assertBlocked := func(expectedValues ...string) {
+		blocked, err := hs.storage.GetActiveBlockedContents(ctx, communityId)
+		assert.NoError(t, err)
+		values := make([]string, 0)
+		for _, b := range blocked {
+			values = append(values, b.Value)
+		}
+		assert.ElementsMatch(t, expectedValues, values)
+	}
+
+	// Spammy events are not recorded, and short messages don't get fingerprints
+	hs.learnFromModerationIfNeeded(&queue.PoolResult{ContentInfo: harms.ProhibitedContent(harms.SpamGeneral)}, makeMessage("$spammy", "@alice:example.org", map[string]any{"body": "this was already blocked by a filter"}))
+	learn(makeMessage("$short", "@alice:example.org", map[string]any{"body": "hi"}))
+	for _, eventId := range []string{"$spammy", "$short"} {
+		contents, err := hs.storage.GetRecentContentsForEvent(ctx, eventId)
+		assert.NoError(t, err)
+		assert.Empty(t, contents, eventId)
+	}
+
+	// Regular events are recorded
+	learn(makeMessage("$text", "@alice:example.org", map[string]any{"body": "Earn $5000 a week from home!! Message me now"}))
+	learn(makeMessage("$image", "@alice:example.org", map[string]any{"body": "image.png", "msgtype": "m.image", "url": "mxc://example.org/image"}))
+	learn(makeMessage("$other", "@bob:example.org", map[string]any{"body": "something else entirely, but long enough", "url": "mxc://example.org/other"}))
+	contents, err := hs.storage.GetRecentContentsForEvent(ctx, "$image")
+	assert.NoError(t, err)
+	assert.Len(t, contents, 1) // the body is too short to fingerprint
+	assert.Equal(t, storage.ContentKindMediaUri, contents[0].Kind)
+	assert.Equal(t, "mxc://example.org/image", contents[0].Value)
+	contents, err = hs.storage.GetRecentContentsForEvent(ctx, "$text")
+	assert.NoError(t, err)
+	assert.Len(t, contents, 1)
+	assert.Equal(t, storage.ContentKindFingerprint, contents[0].Kind)
+
+	// Fields with the wrong type don't stop the rest of the event being recorded
+	learn(makeMessage("$malformed", "@bob:example.org", map[string]any{"body": 5, "msgtype": "m.image", "url": "mxc://example.org/malformed"}))
+	malformedContents, err := hs.storage.GetRecentContentsForEvent(ctx, "$malformed")
+	assert.NoError(t, err)
+	assert.Len(t, malformedContents, 1)
+	assert.Equal(t, "mxc://example.org/malformed", malformedContents[0].Value)
+
+	// Users redacting their own events, or non-moderators redacting events, don't block anything
+	learn(makeRedaction("@alice:example.org", "$text"))
+	learn(makeRedaction("@bob:example.org", "$text"))
+	assertBlocked()
+
+	// Moderators redacting events does block the content
+	learn(makeRedaction("@mod:example.org", "$text"))
+	assertBlocked(contents[0].Value)
+
+	// Banning a user blocks all their recent content
+	learn(MakeSignedPDUForTest(t, hs, &test.BaseClientEvent{
+		RoomId:   roomId,
+		Type:     "m.room.member",
+		StateKey: internal.Pointer("@alice:example.org"),
+		Sender:   "@mod:example.org",
+		Content: map[string]any{
+			"membership": "ban",
+		},
+	}))
+	assertBlocked(contents[0].Value, "mxc://example.org/image")
+
+	// Non-moderators can't ban users, but don't let them teach us anything if they somehow do
+	learn(MakeSignedPDUForTest(t, hs, &test.BaseClientEvent{
+		RoomId:   roomId,
+		Type:     "m.room.member",
+		StateKey: internal.Pointer("@bob:example.org"),
+		Sender:   "@alice:example.org",
+		Content: map[string]any{
+			"membership": "ban",
+		},
+	}))
+	assertBlocked(contents[0].Value, "mxc://example.org/image")
+}
+
+func TestCanLearnFromModeration(t *testing.T) {
+	t.Parallel()
+
+	makeEvent := func(eventType string, stateKey *string, content map[string]any) gomatrixserverlib.PDU {
+		return test.MustMakePDU(&test.BaseClientEvent{
+			RoomId:   "!test:example.org",
+			Type:     eventType,
+			StateKey: stateKey,
+			Sender:   "@mod:example.org",
+			Content:  content,
+		})
+	}
+
+	assert.True(t, canLearnFromModeration(makeEvent("m.room.message", nil, map[string]any{"body": "hello"})))
+	assert.True(t, canLearnFromModeration(makeEvent("m.room.redaction", nil, map[string]any{"redacts": "$spam"})))
+	assert.True(t, canLearnFromModeration(makeEvent("m.room.member", internal.Pointer("@alice:example.org"), map[string]any{"membership": "ban"})))
+	assert.False(t, canLearnFromModeration(makeEvent("m.room.member", internal.Pointer("@alice:example.org"), map[string]any{"membership": "join"})))
+	assert.False(t, canLearnFromModeration(makeEvent("m.room.name", internal.Pointer(""), map[string]any{"name": "Test"})))
+}
@@ -20,7 +20,7 @@ type minimalPolicyRule struct {
 }
 
 func (p *PolicyRulesLearner) CanLearn(ctx context.Context, room *storage.StoredRoom, event gomatrixserverlib.PDU) (bool, error) {
-	if event.Type() != "m.policy.rule.user" && event.Type() != "m.policy.rule.room" {
+	if event.Type() != "m.policy.rule.user" && event.Type() != "m.policy.rule.room" && event.Type() != "m.policy.rule.server" {
 		return false, nil // wrong event type
 	}
 	if event.StateKey() == nil {
@@ -31,8 +31,8 @@ func (p *PolicyRulesLearner) CanLearn(ctx context.Context, room *storage.StoredR
 	if err != nil {
 		return false, err
 	}
-	if content.Recommendation != "m.ban" {
-		return false, nil // not a ban rule
+	if len(content.Recommendation) == 0 {
+		return false, nil // no recommendation (probably a removed rule)
 	}
 	if len(content.Entity) == 0 {
 		return false, nil // no entity specified
@@ -41,7 +41,7 @@ func (p *PolicyRulesLearner) CanLearn(ctx context.Context, room *storage.StoredR
 }
 
 func (p *PolicyRulesLearner) LearnFrom(ctx context.Context, room *storage.StoredRoom, roomState []gomatrixserverlib.PDU) error {
-	entityBans := make(map[string]string)
+	rules := make([]*storage.StoredListRule, 0)
 	for _, pdu := range roomState {
 		ok, err := p.CanLearn(ctx, room, pdu)
 		if err != nil {
@@ -55,11 +55,15 @@ func (p *PolicyRulesLearner) LearnFrom(ctx context.Context, room *storage.Stored
 		if err != nil {
 			return errors.Join(fmt.Errorf("error parsing recommendation for %s / %s / %s", pdu.Type(), pdu.EventID(), pdu.RoomID()), err)
 		}
-		entityBans[content.Entity] = pdu.Type()
+		rules = append(rules, &storage.StoredListRule{
+			EntityType:     pdu.Type(),
+			Entity:         content.Entity,
+			Recommendation: content.Recommendation,
+		})
 	}
-	err := p.storage.SetListBanRules(ctx, room.RoomId, entityBans)
+	err := p.storage.SetListRules(ctx, room.RoomId, rules)
 	if err != nil {
-		return errors.Join(fmt.Errorf("error storing list ban rules for %s", room.RoomId), err)
+		return errors.Join(fmt.Errorf("error storing list rules for %s", room.RoomId), err)
 	}
 	return nil
 }
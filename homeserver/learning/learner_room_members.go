@@ -36,12 +36,13 @@ func (r *RoomMembersLearner) CanLearn(ctx context.Context, room *storage.StoredR
 	return true, nil
 }
 
-type displayNameOnly struct {
+type memberProfile struct {
 	DisplayName string `json:"displayname,omitempty"`
+	AvatarUrl   string `json:"avatar_url,omitempty"`
 }
 
 func (r *RoomMembersLearner) LearnFrom(ctx context.Context, room *storage.StoredRoom, roomState []gomatrixserverlib.PDU) error {
-	userDisplayNames := make(map[string]string)
+	members := make([]*storage.StoredRoomMember, 0)
 	for _, pdu := range roomState {
 		ok, err := r.CanLearn(ctx, room, pdu)
 		if err != nil {
@@ -51,26 +52,26 @@ func (r *RoomMembersLearner) LearnFrom(ctx context.Context, room *storage.Stored
 			continue // not an event we care about
 		}
 
-		// Pull out the display name for mentions detection
-		content := displayNameOnly{}
+		// Pull out the display name for mentions detection, and the avatar for impersonation detection
+		content := memberProfile{}
 		err = json.Unmarshal(pdu.Content(), &content)
 		if err != nil {
-			return errors.Join(fmt.Errorf("error parsing displayname for %s / %s / %s", pdu.SenderID(), pdu.EventID(), pdu.RoomID()), err)
+			return errors.Join(fmt.Errorf("error parsing profile for %s / %s / %s", pdu.SenderID(), pdu.EventID(), pdu.RoomID()), err)
 		}
-		trimmed := strings.TrimSpace(content.DisplayName)
-		if len(trimmed) > 0 {
-			userDisplayNames[string(pdu.SenderID())] = content.DisplayName
+		if len(strings.TrimSpace(content.DisplayName)) == 0 {
+			content.DisplayName = "" // not a useful display name
+		}
+		if len(content.DisplayName) > 0 || len(content.AvatarUrl) > 0 {
+			members = append(members, &storage.StoredRoomMember{
+				UserId:      string(pdu.SenderID()),
+				DisplayName: content.DisplayName,
+				AvatarUrl:   content.AvatarUrl,
+			})
 		}
 	}
 
-	// Process the display names and user IDs which are joined in the room
-	userIds := make([]string, 0)
-	displayNames := make([]string, 0)
-	for k, v := range userDisplayNames {
-		userIds = append(userIds, k)
-		displayNames = append(displayNames, v)
-	}
-	err := r.storage.SetUserIdsAndDisplayNamesByRoomId(ctx, room.RoomId, userIds, displayNames)
+	// Process the profiles of the users which are joined in the room
+	err := r.storage.SetRoomMembers(ctx, room.RoomId, members)
 	if err != nil {
 		return errors.Join(fmt.Errorf("error storing displaynames for %s", room.RoomId), err)
 	}
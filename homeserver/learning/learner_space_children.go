@@ -0,0 +1,62 @@
+package learning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// SpaceChildrenLearner learns the child rooms of a space from its m.space.child state events. This is used by
+// conditions which scope filters to rooms within a space.
+type SpaceChildrenLearner struct {
+	storage storage.PersistentStorage
+}
+
+func (s *SpaceChildrenLearner) CanLearn(ctx context.Context, room *storage.StoredRoom, event gomatrixserverlib.PDU) (bool, error) {
+	if event.Type() != "m.space.child" {
+		return false, nil // not a space child event
+	}
+	if event.StateKey() == nil || *event.StateKey() == "" {
+		return false, nil // not a (valid) state event
+	}
+	return true, nil
+}
+
+type viaOnly struct {
+	Via []string `json:"via,omitempty"`
+}
+
+func (s *SpaceChildrenLearner) LearnFrom(ctx context.Context, room *storage.StoredRoom, roomState []gomatrixserverlib.PDU) error {
+	childRoomIds := make([]string, 0)
+	for _, pdu := range roomState {
+		ok, err := s.CanLearn(ctx, room, pdu)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue // not an event we care about
+		}
+
+		// Per the spec, children without a `via` are not considered children of the space
+		content := viaOnly{}
+		err = json.Unmarshal(pdu.Content(), &content)
+		if err != nil {
+			return errors.Join(fmt.Errorf("error parsing via for %s / %s", pdu.EventID(), pdu.RoomID()), err)
+		}
+		if len(content.Via) == 0 {
+			continue
+		}
+		childRoomIds = append(childRoomIds, *pdu.StateKey())
+	}
+
+	err := s.storage.SetSpaceChildren(ctx, room.RoomId, childRoomIds)
+	if err != nil {
+		return errors.Join(fmt.Errorf("error storing space children for %s", room.RoomId), err)
+	}
+
+	return nil
+}
@@ -27,6 +27,7 @@ func NewRoomStateLearner(storage storage.PersistentStorage) (EventStateLearner,
 	learners := []EventStateLearner{
 		&RoomMembersLearner{storage: storage},
 		&PolicyRulesLearner{storage: storage},
+		&SpaceChildrenLearner{storage: storage},
 		mustConstruct(trust.NewPowerLevelsSource(storage)),
 		mustConstruct(trust.NewCreatorSource(storage)),
 	}
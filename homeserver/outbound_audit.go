@@ -0,0 +1,245 @@
+package homeserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// auditRoomMaxPrevEvents - The most prev_events we'll reference in an audit message. The spec allows up to 20, but we
+// only need enough to merge the forward extremities we've seen.
+const auditRoomMaxPrevEvents = 10
+
+// JoinAuditRoom - Joins an audit room policyserv has been invited to, if not already joined. Unlike JoinRoom, the room
+// is not protected: policyserv only learns enough about the room to be able to send messages to it.
+func (h *Homeserver) JoinAuditRoom(ctx context.Context, roomId string) (*storage.StoredAuditRoom, error) {
+	h.auditRoomsLock.Lock()
+	defer h.auditRoomsLock.Unlock()
+
+	return h.joinAuditRoom(ctx, roomId)
+}
+
+// joinAuditRoom - Same as JoinAuditRoom, but the caller must hold the audit rooms lock.
+func (h *Homeserver) joinAuditRoom(ctx context.Context, roomId string) (*storage.StoredAuditRoom, error) {
+	room, err := h.storage.GetAuditRoom(ctx, roomId)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error looking up audit room %s", roomId), err)
+	}
+	if room == nil {
+		return nil, fmt.Errorf("not invited to audit room %s", roomId)
+	}
+	if room.MemberEventId != "" {
+		return room, nil // already joined
+	}
+
+	parsedRoomId, err := spec.NewRoomID(roomId)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error parsing room ID %s", roomId), err)
+	}
+	join, err := h.performJoin(ctx, parsedRoomId, room.Via)
+	if err != nil {
+		return nil, err
+	}
+
+	room.RoomVersion = string(join.JoinEvent.Version())
+	room.MemberEventId = join.JoinEvent.EventID()
+	room.PrevEventIds = []string{join.JoinEvent.EventID()}
+	room.Depth = join.JoinEvent.Depth()
+	room.Servers = []string{room.Via}
+	if join.StateSnapshot != nil {
+		for _, pdu := range join.StateSnapshot.GetStateEvents().UntrustedEvents(join.JoinEvent.Version()) {
+			if pdu.StateKey() == nil {
+				continue
+			}
+			switch pdu.Type() {
+			case spec.MRoomCreate:
+				room.CreateEventId = pdu.EventID()
+			case spec.MRoomPowerLevels:
+				room.PowerLevelsEventId = pdu.EventID()
+			case spec.MRoomMember:
+				membership, err := pdu.Membership()
+				if err != nil || membership != spec.Join {
+					continue
+				}
+				userId, err := spec.NewUserID(*pdu.StateKey(), true)
+				if err != nil {
+					continue
+				}
+				if server := string(userId.Domain()); !h.isSelf(userId.Domain()) && !slices.Contains(room.Servers, server) {
+					room.Servers = append(room.Servers, server)
+				}
+			}
+		}
+	}
+	if room.CreateEventId == "" || room.PowerLevelsEventId == "" {
+		return nil, fmt.Errorf("join to audit room %s is missing create or power levels state", roomId)
+	}
+
+	err = h.storage.UpsertAuditRoom(ctx, room)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error upserting audit room %s", roomId), err)
+	}
+
+	log.Printf("Joined audit room %s (v:%s)", roomId, room.RoomVersion)
+	return room, nil
+}
+
+// SendNotice - Sends an `m.notice` message as the local actor to the audit room, joining it first if needed. The
+// message is sent directly to every server we know to be in the room. Servers which miss the message will fetch it
+// when they receive a later event referencing it. Returns the event ID of the message.
+func (h *Homeserver) SendNotice(ctx context.Context, roomId string, plainText string, htmlText string) (string, error) {
+	event, servers, err := h.buildNotice(ctx, roomId, plainText, htmlText)
+	if err != nil {
+		return "", err
+	}
+
+	errs := make([]error, 0)
+	for _, server := range servers {
+		_, err = h.client.SendTransaction(ctx, gomatrixserverlib.Transaction{
+			TransactionID:  gomatrixserverlib.TransactionID("audit_" + strconv.FormatInt(time.Now().UnixNano(), 36)),
+			Origin:         h.ServerName,
+			Destination:    spec.ServerName(server),
+			OriginServerTS: spec.Timestamp(time.Now().UnixMilli()),
+			PDUs:           []json.RawMessage{event.JSON()},
+			EDUs:           make([]gomatrixserverlib.EDU, 0),
+		})
+		if err != nil {
+			log.Printf("[%s | %s] Non-fatal error sending audit message to %s: %s", event.EventID(), roomId, server, err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(servers) {
+		return "", errors.Join(fmt.Errorf("error sending audit message to %s", roomId), errors.Join(errs...))
+	}
+	return event.EventID(), nil
+}
+
+// buildNotice - Creates and signs the notice event, advancing our position in the room. Returns the event and the
+// servers to send it to.
+func (h *Homeserver) buildNotice(ctx context.Context, roomId string, plainText string, htmlText string) (gomatrixserverlib.PDU, []string, error) {
+	h.auditRoomsLock.Lock()
+	defer h.auditRoomsLock.Unlock()
+
+	room, err := h.joinAuditRoom(ctx, roomId)
+	if err != nil {
+		return nil, nil, err
+	}
+	verImpl, err := gomatrixserverlib.GetRoomVersion(gomatrixserverlib.RoomVersion(room.RoomVersion))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authEvents := []string{room.PowerLevelsEventId, room.MemberEventId}
+	if !verImpl.DomainlessRoomIDs() {
+		// The create event is implied by the room ID in rooms with domainless room IDs
+		authEvents = append([]string{room.CreateEventId}, authEvents...)
+	}
+	proto := gomatrixserverlib.ProtoEvent{
+		SenderID:   h.localActor.String(),
+		RoomID:     room.RoomId,
+		Type:       "m.room.message",
+		PrevEvents: room.PrevEventIds,
+		AuthEvents: authEvents,
+		Depth:      room.Depth + 1,
+	}
+	if err = proto.SetContent(map[string]interface{}{
+		"msgtype":        "m.notice",
+		"body":           plainText,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": htmlText,
+	}); err != nil {
+		return nil, nil, err
+	}
+	if err = proto.SetUnsigned(struct{}{}); err != nil {
+		return nil, nil, err
+	}
+	event, err := verImpl.NewEventBuilderFromProtoEvent(&proto).Build(time.Now(), h.ServerName, h.KeyId, h.signingKey)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("error building audit message"), err)
+	}
+
+	// Store our new position before sending so concurrent messages don't reuse the same prev_events
+	room.PrevEventIds = []string{event.EventID()}
+	room.Depth = event.Depth()
+	err = h.storage.UpsertAuditRoom(ctx, room)
+	if err != nil {
+		return nil, nil, errors.Join(fmt.Errorf("error upserting audit room %s", roomId), err)
+	}
+	return event, room.Servers, nil
+}
+
+// receiveAuditRoomEvent - Parses, verifies, and learns from an event sent to an audit room over federation. Events in
+// audit rooms are not checked by filters: we only track them so our own messages stay connected to the room's DAG.
+// Returns nil (with or without an error) if the event isn't in an audit room or can't be parsed. If the event is
+// returned alongside an error, the event failed verification.
+func (h *Homeserver) receiveAuditRoomEvent(ctx context.Context, roomId string, eventRaw json.RawMessage) (gomatrixserverlib.PDU, error) {
+	room, err := h.storage.GetAuditRoom(ctx, roomId)
+	if err != nil || room == nil || room.RoomVersion == "" {
+		return nil, err
+	}
+	roomVersion, err := gomatrixserverlib.GetRoomVersion(gomatrixserverlib.RoomVersion(room.RoomVersion))
+	if err != nil {
+		return nil, err
+	}
+	event, err := roomVersion.NewEventFromUntrustedJSON(eventRaw)
+	if err != nil {
+		return nil, err
+	}
+	if err = gomatrixserverlib.VerifyEventSignatures(ctx, event, h.keyRing, func(roomId spec.RoomID, senderId spec.SenderID) (*spec.UserID, error) {
+		return senderId.ToUserID(), nil
+	}); err != nil {
+		return event, err
+	}
+
+	h.auditRoomsLock.Lock()
+	defer h.auditRoomsLock.Unlock()
+
+	// Re-read the room now that we hold the lock, in case we sent a message in the meantime
+	room, err = h.storage.GetAuditRoom(ctx, roomId)
+	if err != nil || room == nil {
+		return event, err
+	}
+
+	if sender := event.SenderID().ToUserID(); sender != nil && !h.isSelf(sender.Domain()) && !slices.Contains(room.Servers, string(sender.Domain())) {
+		room.Servers = append(room.Servers, string(sender.Domain()))
+	}
+	if event.StateKeyEquals("") && event.Type() == spec.MRoomPowerLevels {
+		room.PowerLevelsEventId = event.EventID()
+	}
+	if event.StateKeyEquals(h.localActor.String()) && event.Type() == spec.MRoomMember {
+		if membership, err := event.Membership(); err == nil {
+			if membership == spec.Join {
+				room.MemberEventId = event.EventID()
+			} else {
+				// We've been kicked or banned, so we'll need to rejoin (if possible) before the next message
+				room.MemberEventId = ""
+			}
+		}
+	}
+	if event.Depth() >= room.Depth {
+		// The event replaces any of our current prev_events it references
+		prevEventIds := []string{event.EventID()}
+		for _, eventId := range room.PrevEventIds {
+			if !slices.Contains(event.PrevEventIDs(), eventId) && len(prevEventIds) < auditRoomMaxPrevEvents {
+				prevEventIds = append(prevEventIds, eventId)
+			}
+		}
+		room.PrevEventIds = prevEventIds
+		room.Depth = event.Depth()
+	}
+
+	err = h.storage.UpsertAuditRoom(ctx, room)
+	if err != nil {
+		return event, errors.Join(fmt.Errorf("error upserting audit room %s", roomId), err)
+	}
+	return event, nil
+}
@@ -0,0 +1,214 @@
+package homeserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeAuditRoomEventForTest - Builds a real (hashed and signed) event from the sender's server, which is injected into
+// the homeserver's keyring.
+func makeAuditRoomEventForTest(t *testing.T, hs *Homeserver, proto gomatrixserverlib.ProtoEvent, content map[string]any) gomatrixserverlib.PDU {
+	sender := spec.NewUserIDOrPanic(proto.SenderID, false)
+	origin := sender.Domain()
+	keyId, privateKey := CreateAndInjectOriginForTest(t, hs, string(origin))
+	err := proto.SetContent(content)
+	assert.NoError(t, err)
+	err = proto.SetUnsigned(struct{}{})
+	assert.NoError(t, err)
+	if proto.AuthEvents == nil {
+		proto.AuthEvents = []string{"$create", "$pl"}
+	}
+	event, err := gomatrixserverlib.MustGetRoomVersion(gomatrixserverlib.RoomVersionV10).NewEventBuilderFromProtoEvent(&proto).Build(time.Now(), origin, keyId, privateKey)
+	assert.NoError(t, err)
+	return event
+}
+
+func makeJoinedAuditRoomForTest(t *testing.T, hs *Homeserver, roomId string, servers []string) *storage.StoredAuditRoom {
+	room := &storage.StoredAuditRoom{
+		RoomId:             roomId,
+		RoomVersion:        string(gomatrixserverlib.RoomVersionV10),
+		Via:                servers[0],
+		Servers:            servers,
+		CreateEventId:      "$create",
+		PowerLevelsEventId: "$pl",
+		MemberEventId:      "$member",
+		PrevEventIds:       []string{"$prev"},
+		Depth:              5,
+	}
+	err := hs.storage.UpsertAuditRoom(context.Background(), room)
+	assert.NoError(t, err)
+	return room
+}
+
+func TestSendNotice(t *testing.T) {
+	t.Parallel()
+
+	hs := NewMockServerForTest(t, test.NewMemoryStorage(t), func(c *Config) {
+		c.SkipVerify = true // our httptest server will have an unknown authority
+	})
+
+	lock := sync.Mutex{}
+	received := make([]gomatrixserverlib.PDU, 0)
+	localhost := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+
+		txn := &gomatrixserverlib.Transaction{}
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err) // "should never happen"
+		err = json.Unmarshal(b, txn)
+		assert.NoError(t, err) // "should never happen"
+		assert.Equal(t, 0, len(txn.EDUs))
+		assert.Equal(t, 1, len(txn.PDUs))
+
+		event, err := gomatrixserverlib.MustGetRoomVersion(gomatrixserverlib.RoomVersionV10).NewEventFromUntrustedJSON(txn.PDUs[0])
+		assert.NoError(t, err)
+		lock.Lock()
+		received = append(received, event)
+		lock.Unlock()
+
+		_, _ = w.Write([]byte(`{"pdus": {}}`))
+	}))
+	defer localhost.Close()
+	parsed, err := url.Parse(localhost.URL)
+	assert.NoError(t, err) // "should never happen"
+	localhostName := fmt.Sprintf("127.0.0.1:%s", parsed.Port())
+
+	roomId := "!audit:example.org"
+	makeJoinedAuditRoomForTest(t, hs, roomId, []string{localhostName})
+
+	eventId, err := hs.SendNotice(context.Background(), roomId, "plain", "<b>html</b>")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, eventId)
+
+	// The message is sent as a real event from our local actor
+	assert.Len(t, received, 1)
+	event := received[0]
+	assert.Equal(t, eventId, event.EventID())
+	assert.Equal(t, roomId, event.RoomID().String())
+	assert.Equal(t, hs.localActor.String(), string(event.SenderID()))
+	assert.Equal(t, "m.room.message", event.Type())
+	assert.JSONEq(t, `{"msgtype":"m.notice","body":"plain","format":"org.matrix.custom.html","formatted_body":"<b>html</b>"}`, string(event.Content()))
+	assert.Equal(t, []string{"$prev"}, event.PrevEventIDs())
+	assert.Equal(t, []string{"$create", "$pl", "$member"}, event.AuthEventIDs())
+	assert.Equal(t, int64(6), event.Depth())
+	err = gomatrixserverlib.VerifyEventSignatures(context.Background(), event, hs.keyRing, func(roomId spec.RoomID, senderId spec.SenderID) (*spec.UserID, error) {
+		return senderId.ToUserID(), nil
+	})
+	assert.NoError(t, err)
+
+	// The next message follows on from the first
+	room, err := hs.storage.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{eventId}, room.PrevEventIds)
+	assert.Equal(t, int64(6), room.Depth)
+}
+
+func TestSendNoticeNotInvited(t *testing.T) {
+	t.Parallel()
+
+	hs := NewMockServerForTest(t, test.NewMemoryStorage(t), NoConfigChanges)
+
+	eventId, err := hs.SendNotice(context.Background(), "!audit:example.org", "plain", "<b>html</b>")
+	assert.EqualError(t, err, "not invited to audit room !audit:example.org")
+	assert.Empty(t, eventId)
+}
+
+func TestReceiveAuditRoomEvent(t *testing.T) {
+	t.Parallel()
+
+	hs := NewMockServerForTest(t, test.NewMemoryStorage(t), NoConfigChanges)
+
+	roomId := "!audit:example.org"
+	makeJoinedAuditRoomForTest(t, hs, roomId, []string{"example.org"})
+
+	// Events in rooms we don't know about aren't handled
+	unknown := makeAuditRoomEventForTest(t, hs, gomatrixserverlib.ProtoEvent{
+		SenderID:   "@alice:other.example.org",
+		RoomID:     "!unknown:example.org",
+		Type:       "m.room.message",
+		PrevEvents: []string{"$prev"},
+		Depth:      6,
+	}, map[string]any{"body": "hello"})
+	event, err := hs.receiveAuditRoomEvent(context.Background(), "!unknown:example.org", unknown.JSON())
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+
+	// A message from a new server is added to our prev events, and we learn about the server
+	message := makeAuditRoomEventForTest(t, hs, gomatrixserverlib.ProtoEvent{
+		SenderID:   "@alice:other.example.org",
+		RoomID:     roomId,
+		Type:       "m.room.message",
+		PrevEvents: []string{"$prev"},
+		Depth:      6,
+	}, map[string]any{"body": "hello"})
+	event, err = hs.receiveAuditRoomEvent(context.Background(), roomId, message.JSON())
+	assert.NoError(t, err)
+	assert.Equal(t, message.EventID(), event.EventID())
+	room, err := hs.storage.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.org", "other.example.org"}, room.Servers)
+	assert.Equal(t, []string{message.EventID()}, room.PrevEventIds)
+	assert.Equal(t, int64(6), room.Depth)
+
+	// A concurrent event at the same depth becomes another prev event
+	concurrent := makeAuditRoomEventForTest(t, hs, gomatrixserverlib.ProtoEvent{
+		SenderID:   "@bob:example.org",
+		RoomID:     roomId,
+		Type:       "m.room.message",
+		PrevEvents: []string{"$prev"},
+		Depth:      6,
+	}, map[string]any{"body": "hello"})
+	_, err = hs.receiveAuditRoomEvent(context.Background(), roomId, concurrent.JSON())
+	assert.NoError(t, err)
+	room, err = hs.storage.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{concurrent.EventID(), message.EventID()}, room.PrevEventIds)
+
+	// New power levels are used as auth events for our messages
+	stateKey := ""
+	powerLevels := makeAuditRoomEventForTest(t, hs, gomatrixserverlib.ProtoEvent{
+		SenderID:   "@bob:example.org",
+		RoomID:     roomId,
+		Type:       spec.MRoomPowerLevels,
+		StateKey:   &stateKey,
+		PrevEvents: []string{concurrent.EventID(), message.EventID()},
+		Depth:      7,
+	}, map[string]any{"users": map[string]any{"@bob:example.org": 100}})
+	_, err = hs.receiveAuditRoomEvent(context.Background(), roomId, powerLevels.JSON())
+	assert.NoError(t, err)
+	room, err = hs.storage.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.Equal(t, powerLevels.EventID(), room.PowerLevelsEventId)
+	assert.Equal(t, []string{powerLevels.EventID()}, room.PrevEventIds)
+	assert.Equal(t, int64(7), room.Depth)
+
+	// Being kicked means we'll need to rejoin
+	ownStateKey := hs.localActor.String()
+	kick := makeAuditRoomEventForTest(t, hs, gomatrixserverlib.ProtoEvent{
+		SenderID:   "@bob:example.org",
+		RoomID:     roomId,
+		Type:       spec.MRoomMember,
+		StateKey:   &ownStateKey,
+		PrevEvents: []string{powerLevels.EventID()},
+		Depth:      8,
+	}, map[string]any{"membership": spec.Leave})
+	_, err = hs.receiveAuditRoomEvent(context.Background(), roomId, kick.JSON())
+	assert.NoError(t, err)
+	room, err = hs.storage.GetAuditRoom(context.Background(), roomId)
+	assert.NoError(t, err)
+	assert.Empty(t, room.MemberEventId)
+}
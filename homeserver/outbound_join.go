@@ -43,9 +43,41 @@ func (h *Homeserver) JoinRoom(ctx context.Context, roomId string, via string, co
 		return room, nil
 	}
 
+	join, err := h.performJoin(ctx, parsedRoomId, via)
+	if err != nil {
+		return nil, err
+	}
+
+	room = &storage.StoredRoom{
+		RoomId:                         join.JoinEvent.RoomID().String(),
+		RoomVersion:                    string(join.JoinEvent.Version()),
+		ModeratorUserId:                "",
+		LastCachedStateTimestampMillis: 0,
+		CommunityId:                    communityId,
+	}
+	err = h.storage.UpsertRoom(ctx, room)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error upserting room %s", join.JoinEvent.RoomID()), err)
+	}
+
+	log.Printf("Joined %s (v:%s)", join.JoinEvent.RoomID().String(), join.JoinEvent.Version())
+
+	// Learn from the state we were given so we don't need to wait for the learn state task. This is especially useful
+	// for spaces, where the children are needed right away to sync the space's rooms.
+	if join.StateSnapshot != nil {
+		pdus := join.StateSnapshot.GetStateEvents().UntrustedEvents(join.JoinEvent.Version())
+		if err = h.stateLearner.LearnFrom(ctx, room, pdus); err != nil {
+			log.Printf("Non-fatal error learning initial state of %s: %s", room.RoomId, err)
+		}
+	}
+	return room, nil
+}
+
+// performJoin - Joins the room as the local actor over federation, without storing anything about the room.
+func (h *Homeserver) performJoin(ctx context.Context, roomId *spec.RoomID, via string) (*gomatrixserverlib.PerformJoinResponse, error) {
 	join, fedErr := gomatrixserverlib.PerformJoin(ctx, &internalJoinClient{upstream: h.client}, gomatrixserverlib.PerformJoinInput{
 		UserID:     &h.localActor,
-		RoomID:     parsedRoomId,
+		RoomID:     roomId,
 		ServerName: spec.ServerName(via),
 		Content: map[string]interface{}{
 			"membership": "join",
@@ -76,31 +108,17 @@ func (h *Homeserver) JoinRoom(ctx context.Context, roomId string, via string, co
 			}
 			return pdus, nil
 		},
-		UserIDQuerier: func(roomId spec.RoomID, senderId spec.SenderID) (*spec.UserID, error) {
+		UserIDQuerier: func(_ spec.RoomID, senderId spec.SenderID) (*spec.UserID, error) {
 			return senderId.ToUserID(), nil
 		},
 	})
 	if fedErr != nil && fedErr.Err != nil {
-		return nil, errors.Join(fmt.Errorf("error joining room %s", roomId), fedErr)
+		return nil, errors.Join(fmt.Errorf("error joining room %s", roomId.String()), fedErr)
 	}
 	if join == nil {
 		return nil, errors.New("join response was nil")
 	}
-
-	room = &storage.StoredRoom{
-		RoomId:                         join.JoinEvent.RoomID().String(),
-		RoomVersion:                    string(join.JoinEvent.Version()),
-		ModeratorUserId:                "",
-		LastCachedStateTimestampMillis: 0,
-		CommunityId:                    communityId,
-	}
-	err = h.storage.UpsertRoom(ctx, room)
-	if err != nil {
-		return nil, errors.Join(fmt.Errorf("error upserting room %s", join.JoinEvent.RoomID()), err)
-	}
-
-	log.Printf("Joined %s (v:%s)", join.JoinEvent.RoomID().String(), join.JoinEvent.Version())
-	return room, nil
+	return join, nil
 }
 
 // JoinRooms - Attempts to join rooms in order, retrying a number of times if required. This is a
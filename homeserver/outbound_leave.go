@@ -0,0 +1,78 @@
+package homeserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+)
+
+// LeaveRoom - Stops protecting the room and leaves it over federation. The room and everything learned about it is
+// removed from storage before leaving, so we stop signing events for the room even if the leave itself fails. Failing
+// to leave is therefore not treated as an error: the room may have been abandoned or the via server may be offline.
+func (h *Homeserver) LeaveRoom(ctx context.Context, roomId string, via string) error {
+	room, err := h.storage.GetRoom(ctx, roomId)
+	if err != nil {
+		return errors.Join(fmt.Errorf("error looking up room %s", roomId), err)
+	}
+	if room == nil {
+		log.Printf("Not joined to room %s", roomId)
+		return nil
+	}
+
+	// Note: the `ps_room_delete` trigger takes care of invalidating the room ID to community ID cache.
+	err = h.storage.DeleteRoom(ctx, roomId)
+	if err != nil {
+		return errors.Join(fmt.Errorf("error deleting room %s", roomId), err)
+	}
+
+	err = h.sendLeave(ctx, room.RoomId, gomatrixserverlib.RoomVersion(room.RoomVersion), via)
+	if err != nil {
+		log.Printf("Non-fatal error leaving room %s through %s: %s", roomId, via, err)
+		return nil
+	}
+
+	log.Printf("Left %s", roomId)
+	return nil
+}
+
+func (h *Homeserver) sendLeave(ctx context.Context, roomId string, roomVersion gomatrixserverlib.RoomVersion, via string) error {
+	res, err := h.client.MakeLeave(ctx, h.ServerName, spec.ServerName(via), roomId, h.localActor.String())
+	if err != nil {
+		return errors.Join(errors.New("error calling make_leave"), err)
+	}
+	if res.RoomVersion != "" {
+		roomVersion = res.RoomVersion
+	}
+	verImpl, err := gomatrixserverlib.GetRoomVersion(roomVersion)
+	if err != nil {
+		return err
+	}
+
+	stateKey := h.localActor.String()
+	proto := res.LeaveEvent
+	proto.SenderID = h.localActor.String()
+	proto.StateKey = &stateKey
+	proto.Type = spec.MRoomMember
+	if err = proto.SetContent(map[string]interface{}{"membership": spec.Leave}); err != nil {
+		return err
+	}
+	if err = proto.SetUnsigned(struct{}{}); err != nil {
+		return err
+	}
+
+	leave, err := verImpl.NewEventBuilderFromProtoEvent(&proto).Build(time.Now(), h.ServerName, h.KeyId, h.signingKey)
+	if err != nil {
+		return errors.Join(errors.New("error building leave event"), err)
+	}
+
+	err = h.client.SendLeave(ctx, h.ServerName, spec.ServerName(via), leave)
+	if err != nil {
+		return errors.Join(errors.New("error calling send_leave"), err)
+	}
+	return nil
+}
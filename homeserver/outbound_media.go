@@ -7,10 +7,12 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+
+	"github.com/matrix-org/policyserv/media"
 )
 
 // DownloadMedia - Implements `media.Downloader`
-func (h *Homeserver) DownloadMedia(ctx context.Context, origin string, mediaId string) ([]byte, error) {
+func (h *Homeserver) DownloadMedia(ctx context.Context, origin string, mediaId string, maxBytes int64) ([]byte, error) {
 	// TODO: Replace Client-Server API call with something a bit more sophisticated
 	path, err := url.JoinPath(h.mediaClientUrl, fmt.Sprintf("/_matrix/client/v1/media/download/%s/%s", url.PathEscape(origin), url.PathEscape(mediaId)))
 	if err != nil {
@@ -31,10 +33,22 @@ func (h *Homeserver) DownloadMedia(ctx context.Context, origin string, mediaId s
 		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
 	}
 
-	b, err := io.ReadAll(res.Body)
+	if maxBytes <= 0 {
+		return io.ReadAll(res.Body)
+	}
+
+	// Don't bother downloading media we already know is too large. Servers don't have to send a Content-Length though,
+	// so we also stop reading once we have one byte more than the limit.
+	if res.ContentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes is larger than the limit of %d", media.MediaTooLargeError, res.ContentLength, maxBytes)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxBytes+1))
 	if err != nil {
 		return nil, err
 	}
+	if int64(len(b)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than the limit of %d bytes", media.MediaTooLargeError, maxBytes)
+	}
 
 	return b, nil
 }
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/gomatrixserverlib/spec"
+	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/queue"
 )
 
@@ -54,7 +57,54 @@ func (h *Homeserver) RunFilters(ctx context.Context, event gomatrixserverlib.PDU
 
 		// We'd like to "learn" room state, if we can, so do that. We do this async to avoid blocking the filter request.
 		go h.queueLearnStateIfNeeded(ctx, res, event)
+
+		// Similarly, track when users join rooms so conditions can consider how long ago that was.
+		go h.recordMembershipIfNeeded(res, event)
+
+		// ... and let moderators teach us about content they remove.
+		go h.learnFromModerationIfNeeded(res, event)
 	}(event, resultCh, waitCh)
 
 	return h.pool.Submit(ctx, event, h, resultCh)
 }
+
+func (h *Homeserver) recordMembershipIfNeeded(basedOnResult *queue.PoolResult, event gomatrixserverlib.PDU) {
+	if event.Type() != "m.room.member" || event.StateKey() == nil {
+		return // not a membership event
+	}
+	if basedOnResult.Err != nil {
+		return // we don't know what we would have said about the event
+	}
+	isProhibited := basedOnResult.ContentInfo.Class() == harms.ContentClassProhibited
+	membership, err := event.Membership()
+	if err != nil {
+		log.Printf("[%s | %s] Error parsing membership: %s", event.EventID(), event.RoomID().String(), err)
+		return
+	}
+
+	// Like queueLearnStateIfNeeded, we don't want to be tied to our caller's timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	roomId := event.RoomID().String()
+	userId := *event.StateKey()
+	switch membership {
+	case spec.Join:
+		if !event.StateKeyEquals(string(event.SenderID())) {
+			return // "should never happen"
+		}
+		// Prohibited joins are recorded too. The join may still make it into the room, and the raid prefilter needs to
+		// know the user joined during a raid to keep blocking their later events.
+		err = h.storage.InsertRoomMemberJoin(ctx, roomId, userId, time.Now().UnixMilli())
+	case spec.Leave, spec.Ban:
+		if isProhibited {
+			return // the event probably won't make it into the room, so the user is still joined
+		}
+		err = h.storage.DeleteRoomMemberJoin(ctx, roomId, userId)
+	default:
+		return // not a membership we track
+	}
+	if err != nil {
+		log.Printf("[%s | %s] Error recording %s membership for %s: %s", event.EventID(), roomId, membership, userId, err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
+	"github.com/matrix-org/policyserv/harms"
 	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/queue"
 	"github.com/matrix-org/policyserv/storage"
@@ -71,3 +73,52 @@ func TestRunFiltersQueuesStateLearning(t *testing.T) {
 	assert.Equal(t, event.RoomID().String(), next.RoomId)
 	assert.NoError(t, txn.Commit()) // drain the queue ahead of the next test
 }
+
+func TestRecordMembershipIfNeeded(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	hs := NewMockServerForTest(t, test.NewMemoryStorage(t), nil)
+	roomId := "!test:example.org"
+	makeMember := func(userId string, membership string) gomatrixserverlib.PDU {
+		return MakeSignedPDUForTest(t, hs, &test.BaseClientEvent{
+			RoomId:   roomId,
+			Type:     "m.room.member",
+			StateKey: internal.Pointer(userId),
+			Sender:   userId,
+			Content: map[string]any{
+				"membership": membership,
+			},
+		})
+	}
+
+	// Failed checks are not recorded
+	hs.recordMembershipIfNeeded(&queue.PoolResult{Err: test.SimulatedError}, makeMember("@alice:example.org", "join"))
+	ts, err := hs.storage.GetRoomMemberJoinTimestamp(ctx, roomId, "@alice:example.org")
+	assert.NoError(t, err)
+	assert.Zero(t, ts)
+
+	// Spammy joins are recorded, so raids can tell when the user joined
+	hs.recordMembershipIfNeeded(&queue.PoolResult{ContentInfo: harms.ProhibitedContent(harms.SpamFlooding)}, makeMember("@alice:example.org", "join"))
+	ts, err = hs.storage.GetRoomMemberJoinTimestamp(ctx, roomId, "@alice:example.org")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Now().UnixMilli(), ts, float64(time.Minute.Milliseconds()))
+
+	// ... as are neutral ones, without moving the original join
+	hs.recordMembershipIfNeeded(&queue.PoolResult{ContentInfo: harms.NeutralContent()}, makeMember("@alice:example.org", "join"))
+	ts2, err := hs.storage.GetRoomMemberJoinTimestamp(ctx, roomId, "@alice:example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, ts, ts2)
+
+	// Spammy leaves don't clear the join
+	hs.recordMembershipIfNeeded(&queue.PoolResult{ContentInfo: harms.ProhibitedContent(harms.SpamGeneral)}, makeMember("@alice:example.org", "leave"))
+	ts2, err = hs.storage.GetRoomMemberJoinTimestamp(ctx, roomId, "@alice:example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, ts, ts2)
+
+	// Leaving clears the join
+	hs.recordMembershipIfNeeded(&queue.PoolResult{ContentInfo: harms.NeutralContent()}, makeMember("@alice:example.org", "leave"))
+	ts, err = hs.storage.GetRoomMemberJoinTimestamp(ctx, roomId, "@alice:example.org")
+	assert.NoError(t, err)
+	assert.Zero(t, ts)
+}
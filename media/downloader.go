@@ -1,7 +1,15 @@
 package media
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// MediaTooLargeError - Returned by Downloader implementations when the media is larger than the requested limit.
+var MediaTooLargeError = errors.New("media is too large")
 
 type Downloader interface {
-	DownloadMedia(ctx context.Context, origin string, mediaId string) ([]byte, error)
+	// DownloadMedia - Downloads the media. If maxBytes is positive, the download stops and a MediaTooLargeError is
+	// returned as soon as the media is known to be larger than maxBytes.
+	DownloadMedia(ctx context.Context, origin string, mediaId string, maxBytes int64) ([]byte, error)
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -28,18 +29,28 @@ func NewItem(mediaUrl string, downloader Downloader) (*Item, error) {
 	if parsed.Scheme != "mxc" {
 		return nil, errors.Join(InvalidMediaUrlError, errors.New("not an mxc uri"))
 	}
+	mediaId, hasSlash := strings.CutPrefix(parsed.Path, "/")
+	if parsed.Host == "" || !hasSlash || mediaId == "" {
+		return nil, errors.Join(InvalidMediaUrlError, errors.New("missing origin or media id"))
+	}
 
 	return &Item{
 		Origin:     parsed.Host,
-		MediaId:    parsed.Path[1:], // strip leading slash,
+		MediaId:    mediaId,
 		downloader: downloader,
 	}, nil
 }
 
 func (m *Item) Download() ([]byte, error) {
+	return m.DownloadLimited(0)
+}
+
+// DownloadLimited - Like Download, but returns a MediaTooLargeError without downloading the rest of the media if it's
+// larger than maxBytes. A maxBytes of zero or less means no limit.
+func (m *Item) DownloadLimited(maxBytes int64) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second) // 30s is somewhat arbitrary - we just don't want to wait forever
 	defer cancel()
-	return m.downloader.DownloadMedia(ctx, m.Origin, m.MediaId)
+	return m.downloader.DownloadMedia(ctx, m.Origin, m.MediaId, maxBytes)
 }
 
 func (m *Item) String() string {
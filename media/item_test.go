@@ -0,0 +1,31 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewItem(t *testing.T) {
+	t.Parallel()
+
+	item, err := NewItem("mxc://example.org/abc", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.org", item.Origin)
+	assert.Equal(t, "abc", item.MediaId)
+	assert.Equal(t, "mxc://example.org/abc", item.String())
+
+	for _, mediaUrl := range []string{
+		"https://example.org/abc",
+		"mxc://example.org",
+		"mxc://example.org/",
+		"mxc:///abc",
+		"mxc://",
+		"mxc:example.org",
+		"mxc://example.org:bad_port/abc",
+	} {
+		item, err = NewItem(mediaUrl, nil)
+		assert.ErrorIs(t, err, InvalidMediaUrlError, mediaUrl)
+		assert.Nil(t, item, mediaUrl)
+	}
+}
@@ -23,6 +23,16 @@ var EventClassifications = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "The total number of classifications used by filters",
 }, []string{"roomId", "classification"})
 
+var ShadowFilterClassifications = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "policyserv_shadow_filter_classifications",
+	Help: "The total number of classifications made by filters in shadow mode, which are not applied to events",
+}, []string{"roomId", "filterName", "classification"})
+
+var ShadowModeRecommendations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "policyserv_shadow_mode_recommendations",
+	Help: "The total number of recommendations which would have been made to servers if the community wasn't in shadow mode",
+}, []string{"roomId", "recommendation"})
+
 func RecordEventCheckRequest(roomId string) {
 	EventCheckRequests.With(prometheus.Labels{
 		"roomId": roomId,
@@ -52,3 +62,25 @@ func RecordSuccessfulEventCheck(roomId string, isFirstTimeCheck bool, info *harm
 		}
 	}
 }
+
+func RecordShadowFilterClassification(roomId string, filterName string, info *harms.ContentInfo) {
+	ShadowFilterClassifications.With(prometheus.Labels{
+		"roomId":         roomId,
+		"filterName":     filterName,
+		"classification": info.Class().String(),
+	}).Inc()
+	for _, h := range info.Harms() {
+		ShadowFilterClassifications.With(prometheus.Labels{
+			"roomId":         roomId,
+			"filterName":     filterName,
+			"classification": string(h),
+		}).Inc()
+	}
+}
+
+func RecordShadowModeRecommendation(roomId string, recommendation string) {
+	ShadowModeRecommendations.With(prometheus.Labels{
+		"roomId":         roomId,
+		"recommendation": recommendation,
+	}).Inc()
+}
@@ -0,0 +1 @@
+DROP TABLE room_member_joins;
@@ -0,0 +1,7 @@
+CREATE TABLE room_member_joins (
+    room_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    joined_ts BIGINT NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+COMMENT ON COLUMN room_member_joins.joined_ts IS 'When policyserv first saw the user join the room, in milliseconds. Not the origin_server_ts of the join event.';
@@ -0,0 +1,2 @@
+DROP INDEX space_children_child_room_id;
+DROP TABLE space_children;
@@ -0,0 +1,6 @@
+CREATE TABLE space_children (
+    space_room_id TEXT NOT NULL,
+    child_room_id TEXT NOT NULL,
+    PRIMARY KEY (space_room_id, child_room_id)
+);
+CREATE INDEX space_children_child_room_id ON space_children (child_room_id);
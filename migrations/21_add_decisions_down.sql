@@ -0,0 +1,3 @@
+DROP INDEX decisions_event_id;
+DROP INDEX decisions_community_id_id;
+DROP TABLE decisions;
@@ -0,0 +1,17 @@
+CREATE TABLE decisions (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    event_id TEXT NOT NULL,
+    community_id TEXT NOT NULL CONSTRAINT fk_decisions_community_id_communities_id REFERENCES communities(id),
+    room_id TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    filter_responses JSONB NOT NULL,
+    shadow_filter_responses JSONB NOT NULL,
+    classifications JSONB NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    decided_ts BIGINT NOT NULL
+);
+COMMENT ON COLUMN decisions.id IS 'Used for pagination. Decisions are returned newest first.';
+COMMENT ON COLUMN decisions.classifications IS 'Same format as media_classifications.classifications: the content class, followed by harms.';
+CREATE INDEX decisions_community_id_id ON decisions (community_id, id DESC);
+CREATE INDEX decisions_event_id ON decisions (event_id);
@@ -0,0 +1,3 @@
+DROP TRIGGER ps_override_change ON overrides;
+DROP FUNCTION notify_override_change;
+DROP TABLE overrides;
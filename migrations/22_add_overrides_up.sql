@@ -0,0 +1,24 @@
+CREATE TABLE overrides (
+    community_id TEXT NOT NULL CONSTRAINT fk_overrides_community_id_communities_id REFERENCES communities(id),
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_ts BIGINT NOT NULL,
+    PRIMARY KEY (community_id, kind, value)
+);
+COMMENT ON COLUMN overrides.kind IS 'One of event_id, user_id, or content_hash.';
+
+-- Filter sets keep the overrides in memory, so tell them when the community's overrides change
+CREATE OR REPLACE FUNCTION notify_override_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_override_changed', OLD.community_id);
+    ELSE
+        PERFORM pg_notify('policyserv_override_changed', NEW.community_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_override_change AFTER INSERT OR UPDATE OR DELETE ON overrides FOR EACH ROW EXECUTE FUNCTION notify_override_change();
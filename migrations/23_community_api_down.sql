@@ -0,0 +1,4 @@
+DROP INDEX rooms_community_id;
+DROP TRIGGER ps_community_keyword_template_change ON community_keyword_templates;
+DROP FUNCTION notify_community_keyword_template_change;
+DROP TABLE community_keyword_templates;
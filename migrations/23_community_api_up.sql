@@ -0,0 +1,20 @@
+CREATE TABLE community_keyword_templates (
+    community_id TEXT NOT NULL CONSTRAINT fk_community_keyword_templates_community_id_communities_id REFERENCES communities(id),
+    name TEXT NOT NULL,
+    body TEXT NOT NULL,
+    PRIMARY KEY (community_id, name)
+);
+COMMENT ON TABLE community_keyword_templates IS 'Same as keyword_templates, but only usable by (and take precedence for) the community.';
+
+-- Filter sets load templates when they're created, so treat template changes as config changes to recreate them
+CREATE OR REPLACE FUNCTION notify_community_keyword_template_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('policyserv_community_config_changed', NEW.community_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_community_keyword_template_change AFTER INSERT OR UPDATE ON community_keyword_templates FOR EACH ROW EXECUTE FUNCTION notify_community_keyword_template_change();
+
+CREATE INDEX rooms_community_id ON rooms (community_id);
@@ -0,0 +1,2 @@
+DROP TRIGGER ps_room_delete ON rooms;
+DROP FUNCTION notify_room_delete;
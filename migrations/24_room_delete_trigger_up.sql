@@ -0,0 +1,10 @@
+-- Deleting a room means it's no longer protected, so treat it like the room's community ID changing
+CREATE OR REPLACE FUNCTION notify_room_delete()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('policyserv_room_community_id_changed', OLD.room_id);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_room_delete AFTER DELETE ON rooms FOR EACH ROW EXECUTE FUNCTION notify_room_delete();
@@ -0,0 +1,2 @@
+ALTER TABLE rooms DROP COLUMN removed_from_space;
+ALTER TABLE communities DROP COLUMN space_room_id;
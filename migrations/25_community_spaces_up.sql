@@ -0,0 +1,4 @@
+ALTER TABLE communities ADD COLUMN space_room_id TEXT NOT NULL DEFAULT '';
+COMMENT ON COLUMN communities.space_room_id IS 'The space whose children are synced into the community. Empty to disable.';
+ALTER TABLE rooms ADD COLUMN removed_from_space BOOLEAN NOT NULL DEFAULT FALSE;
+COMMENT ON COLUMN rooms.removed_from_space IS 'Whether the room is not a child of its community''s space. Set by the space sync task.';
@@ -0,0 +1,4 @@
+DELETE FROM ban_rules WHERE recommendation != 'm.ban';
+ALTER TABLE ban_rules DROP CONSTRAINT ban_rules_pkey;
+ALTER TABLE ban_rules ADD PRIMARY KEY (room_id, entity_type, entity_id);
+ALTER TABLE ban_rules DROP COLUMN recommendation;
@@ -0,0 +1,4 @@
+-- Rules are now learned for any recommendation, not just bans. The same entity may appear with multiple recommendations.
+ALTER TABLE ban_rules ADD COLUMN recommendation TEXT NOT NULL DEFAULT 'm.ban';
+ALTER TABLE ban_rules DROP CONSTRAINT ban_rules_pkey;
+ALTER TABLE ban_rules ADD PRIMARY KEY (room_id, entity_type, entity_id, recommendation);
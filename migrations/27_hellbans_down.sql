@@ -0,0 +1,3 @@
+DROP TRIGGER ps_hellban_change ON hellbans;
+DROP FUNCTION notify_hellban_change;
+DROP TABLE hellbans;
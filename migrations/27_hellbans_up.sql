@@ -0,0 +1,24 @@
+CREATE TABLE hellbans (
+    community_id TEXT NOT NULL CONSTRAINT fk_hellbans_community_id_communities_id REFERENCES communities(id),
+    user_id TEXT NOT NULL,
+    expires_ts BIGINT NOT NULL,
+    strikes INT NOT NULL,
+    PRIMARY KEY (community_id, user_id)
+);
+CREATE INDEX hellbans_expires_ts ON hellbans(expires_ts);
+COMMENT ON COLUMN hellbans.strikes IS 'The number of automatic hellbans the user has received in a row. Expired hellbans are kept for a while to track this.';
+
+-- Hellban prefilters keep active hellbans in memory, so tell them when a user's hellban changes
+CREATE OR REPLACE FUNCTION notify_hellban_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_hellban_changed', json_build_object('community_id', OLD.community_id, 'user_id', OLD.user_id)::text);
+    ELSE
+        PERFORM pg_notify('policyserv_hellban_changed', json_build_object('community_id', NEW.community_id, 'user_id', NEW.user_id)::text);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_hellban_change AFTER INSERT OR UPDATE OR DELETE ON hellbans FOR EACH ROW EXECUTE FUNCTION notify_hellban_change();
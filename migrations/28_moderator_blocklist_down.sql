@@ -0,0 +1,4 @@
+DROP TRIGGER ps_blocked_content_change ON blocked_contents;
+DROP FUNCTION notify_blocked_content_change;
+DROP TABLE blocked_contents;
+DROP TABLE recent_contents;
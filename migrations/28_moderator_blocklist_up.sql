@@ -0,0 +1,41 @@
+CREATE TABLE recent_contents (
+    event_id TEXT NOT NULL,
+    community_id TEXT NOT NULL CONSTRAINT fk_recent_contents_community_id_communities_id REFERENCES communities(id),
+    room_id TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    received_ts BIGINT NOT NULL,
+    PRIMARY KEY (event_id, kind, value)
+);
+CREATE INDEX recent_contents_community_id_sender ON recent_contents(community_id, sender);
+CREATE INDEX recent_contents_received_ts ON recent_contents(received_ts);
+COMMENT ON TABLE recent_contents IS 'Fingerprints and media URIs of recently received events, kept so moderator redactions and bans can be learned from.';
+COMMENT ON COLUMN recent_contents.kind IS 'One of fingerprint or media_uri.';
+
+CREATE TABLE blocked_contents (
+    community_id TEXT NOT NULL CONSTRAINT fk_blocked_contents_community_id_communities_id REFERENCES communities(id),
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    expires_ts BIGINT NOT NULL,
+    PRIMARY KEY (community_id, kind, value)
+);
+CREATE INDEX blocked_contents_expires_ts ON blocked_contents(expires_ts);
+COMMENT ON COLUMN blocked_contents.kind IS 'One of fingerprint or media_uri.';
+COMMENT ON COLUMN blocked_contents.event_id IS 'The most recent event the content was learned from.';
+
+-- Filter sets keep the blocked contents in memory, so tell them when the community's blocked contents change
+CREATE OR REPLACE FUNCTION notify_blocked_content_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_blocked_content_changed', OLD.community_id);
+    ELSE
+        PERFORM pg_notify('policyserv_blocked_content_changed', NEW.community_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_blocked_content_change AFTER INSERT OR UPDATE OR DELETE ON blocked_contents FOR EACH ROW EXECUTE FUNCTION notify_blocked_content_change();
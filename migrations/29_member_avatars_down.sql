@@ -0,0 +1 @@
+ALTER TABLE displaynames DROP COLUMN avatar_url;
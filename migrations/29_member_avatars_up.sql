@@ -0,0 +1 @@
+ALTER TABLE displaynames ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
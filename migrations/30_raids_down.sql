@@ -0,0 +1,3 @@
+DROP TRIGGER ps_raid_change ON raids;
+DROP FUNCTION notify_raid_change;
+DROP TABLE raids;
@@ -0,0 +1,26 @@
+CREATE TABLE raids (
+    community_id TEXT NOT NULL CONSTRAINT fk_raids_community_id_communities_id REFERENCES communities(id),
+    room_id TEXT NOT NULL,
+    started_ts BIGINT NOT NULL,
+    expires_ts BIGINT NOT NULL,
+    is_manual BOOLEAN NOT NULL,
+    PRIMARY KEY (community_id, room_id)
+);
+CREATE INDEX raids_expires_ts ON raids(expires_ts);
+COMMENT ON COLUMN raids.room_id IS 'The raided room, or an empty string if the raid affects the whole community.';
+COMMENT ON COLUMN raids.is_manual IS 'Whether a moderator started the raid rather than the join rate exceeding the community''s limits.';
+
+-- Raid prefilters keep active raids in memory, so tell them when the community's raids change
+CREATE OR REPLACE FUNCTION notify_raid_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_raid_changed', OLD.community_id);
+    ELSE
+        PERFORM pg_notify('policyserv_raid_changed', NEW.community_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_raid_change AFTER INSERT OR UPDATE OR DELETE ON raids FOR EACH ROW EXECUTE FUNCTION notify_raid_change();
@@ -0,0 +1,13 @@
+CREATE TABLE media_hashes (
+    community_id TEXT NOT NULL CONSTRAINT fk_media_hashes_community_id_communities_id REFERENCES communities(id),
+    bank TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    mxc_uri TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_ts BIGINT NOT NULL,
+    PRIMARY KEY (community_id, bank, kind, value)
+);
+CREATE INDEX media_hashes_community_id_mxc_uri ON media_hashes(community_id, mxc_uri);
+COMMENT ON COLUMN media_hashes.kind IS 'One of sha256, phash, or dhash.';
+COMMENT ON COLUMN media_hashes.mxc_uri IS 'The media the hash was computed from, or an empty string if unknown.';
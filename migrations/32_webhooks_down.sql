@@ -0,0 +1,3 @@
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_destinations;
+ALTER TABLE communities DROP COLUMN webhook_secret;
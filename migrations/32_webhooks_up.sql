@@ -0,0 +1,26 @@
+ALTER TABLE communities ADD COLUMN webhook_secret TEXT;
+COMMENT ON COLUMN communities.webhook_secret IS 'Used to sign structured webhook payloads. Payloads are unsigned when null.';
+
+CREATE TABLE webhook_destinations (
+    id TEXT NOT NULL PRIMARY KEY,
+    community_id TEXT NOT NULL CONSTRAINT fk_webhook_destinations_community_id_communities_id REFERENCES communities(id),
+    url TEXT NOT NULL,
+    event_types JSONB NOT NULL,
+    created_ts BIGINT NOT NULL
+);
+CREATE INDEX webhook_destinations_community_id ON webhook_destinations(community_id);
+COMMENT ON COLUMN webhook_destinations.event_types IS 'JSON array of payload types to deliver. An empty array means all types.';
+
+CREATE TABLE webhook_deliveries (
+    id TEXT NOT NULL PRIMARY KEY,
+    destination_id TEXT NOT NULL CONSTRAINT fk_webhook_deliveries_destination_id_webhook_destinations_id REFERENCES webhook_destinations(id) ON DELETE CASCADE,
+    community_id TEXT NOT NULL CONSTRAINT fk_webhook_deliveries_community_id_communities_id REFERENCES communities(id),
+    url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL,
+    next_attempt_ts BIGINT NOT NULL,
+    last_error TEXT NOT NULL,
+    created_ts BIGINT NOT NULL
+);
+CREATE INDEX webhook_deliveries_next_attempt_ts ON webhook_deliveries(next_attempt_ts);
+COMMENT ON COLUMN webhook_deliveries.url IS 'The destination URL at the time the delivery was created.';
@@ -0,0 +1,2 @@
+DROP INDEX communities_audit_room_id;
+DROP TABLE audit_rooms;
@@ -0,0 +1,16 @@
+CREATE TABLE audit_rooms (
+    room_id TEXT NOT NULL PRIMARY KEY,
+    room_version TEXT NOT NULL,
+    via TEXT NOT NULL,
+    servers JSONB NOT NULL,
+    create_event_id TEXT NOT NULL,
+    power_levels_event_id TEXT NOT NULL,
+    member_event_id TEXT NOT NULL,
+    prev_event_ids JSONB NOT NULL,
+    depth BIGINT NOT NULL
+);
+COMMENT ON TABLE audit_rooms IS 'Rooms policyserv sends community audit messages to. These are not protected rooms.';
+COMMENT ON COLUMN audit_rooms.via IS 'The server which invited policyserv to the room.';
+COMMENT ON COLUMN audit_rooms.member_event_id IS 'Our own join event, or an empty string if we are not joined to the room.';
+
+CREATE INDEX communities_audit_room_id ON communities((config->>'audit_room_id'));
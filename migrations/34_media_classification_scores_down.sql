@@ -0,0 +1,8 @@
+DELETE FROM media_classifications WHERE model <> '';
+DROP INDEX media_classifications_mxc_uri_model;
+DROP INDEX media_classifications_mxc_uri_community_id;
+ALTER TABLE media_classifications DROP CONSTRAINT media_classifications_community_or_model;
+ALTER TABLE media_classifications ALTER COLUMN community_id SET NOT NULL;
+ALTER TABLE media_classifications ADD PRIMARY KEY (mxc_uri, community_id);
+ALTER TABLE media_classifications DROP COLUMN category_scores;
+ALTER TABLE media_classifications DROP COLUMN model;
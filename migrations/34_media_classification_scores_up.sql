@@ -0,0 +1,11 @@
+-- AI model scores don't depend on community config, so they are cached once per media item and model rather than per
+-- community. Those rows have no community, and per-community rows have no model.
+ALTER TABLE media_classifications ADD COLUMN model TEXT NOT NULL DEFAULT '';
+ALTER TABLE media_classifications ADD COLUMN category_scores JSONB NULL;
+ALTER TABLE media_classifications DROP CONSTRAINT media_classifications_pkey;
+ALTER TABLE media_classifications ALTER COLUMN community_id DROP NOT NULL;
+ALTER TABLE media_classifications ADD CONSTRAINT media_classifications_community_or_model CHECK ((model = '') = (community_id IS NOT NULL));
+CREATE UNIQUE INDEX media_classifications_mxc_uri_community_id ON media_classifications (mxc_uri, community_id) WHERE model = '';
+CREATE UNIQUE INDEX media_classifications_mxc_uri_model ON media_classifications (mxc_uri, model) WHERE model <> '';
+COMMENT ON COLUMN media_classifications.model IS 'The AI model which scored the media, or an empty string for per-community classifications.';
+COMMENT ON COLUMN media_classifications.category_scores IS 'The AI model''s score for each moderation category, keyed by category.';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS decisions_decided_ts;
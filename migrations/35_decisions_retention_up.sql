@@ -0,0 +1,2 @@
+CREATE INDEX decisions_decided_ts ON decisions (decided_ts);
+COMMENT ON INDEX decisions_decided_ts IS 'Used to clean up decisions older than the retention period.';
@@ -0,0 +1,17 @@
+DROP TRIGGER ps_blocked_content_insert ON blocked_contents;
+DROP TRIGGER ps_blocked_content_update ON blocked_contents;
+DROP TRIGGER ps_blocked_content_delete ON blocked_contents;
+
+CREATE OR REPLACE FUNCTION notify_blocked_content_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_blocked_content_changed', OLD.community_id);
+    ELSE
+        PERFORM pg_notify('policyserv_blocked_content_changed', NEW.community_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_blocked_content_change AFTER INSERT OR UPDATE OR DELETE ON blocked_contents FOR EACH ROW EXECUTE FUNCTION notify_blocked_content_change();
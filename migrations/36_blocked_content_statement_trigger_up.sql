@@ -0,0 +1,19 @@
+-- Notify once per statement rather than once per row, so filter sets don't reload for every blocked content
+DROP TRIGGER ps_blocked_content_change ON blocked_contents;
+
+CREATE OR REPLACE FUNCTION notify_blocked_content_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed_community_id TEXT;
+BEGIN
+    FOR changed_community_id IN SELECT DISTINCT community_id FROM changed_rows LOOP
+        PERFORM pg_notify('policyserv_blocked_content_changed', changed_community_id);
+    END LOOP;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+-- Transition tables can only be used by triggers for a single event
+CREATE TRIGGER ps_blocked_content_insert AFTER INSERT ON blocked_contents REFERENCING NEW TABLE AS changed_rows FOR EACH STATEMENT EXECUTE FUNCTION notify_blocked_content_change();
+CREATE TRIGGER ps_blocked_content_update AFTER UPDATE ON blocked_contents REFERENCING NEW TABLE AS changed_rows FOR EACH STATEMENT EXECUTE FUNCTION notify_blocked_content_change();
+CREATE TRIGGER ps_blocked_content_delete AFTER DELETE ON blocked_contents REFERENCING OLD TABLE AS changed_rows FOR EACH STATEMENT EXECUTE FUNCTION notify_blocked_content_change();
@@ -0,0 +1,2 @@
+DROP TRIGGER ps_webhook_destinations_change ON webhook_destinations;
+DROP FUNCTION notify_webhook_destinations_change;
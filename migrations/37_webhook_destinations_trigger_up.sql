@@ -0,0 +1,14 @@
+-- Webhook notifiers cache the destinations in memory, so tell them when the community's destinations change
+CREATE OR REPLACE FUNCTION notify_webhook_destinations_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_webhook_destinations_changed', OLD.community_id);
+    ELSE
+        PERFORM pg_notify('policyserv_webhook_destinations_changed', NEW.community_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_webhook_destinations_change AFTER INSERT OR UPDATE OR DELETE ON webhook_destinations FOR EACH ROW EXECUTE FUNCTION notify_webhook_destinations_change();
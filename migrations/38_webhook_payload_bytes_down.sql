@@ -0,0 +1,2 @@
+COMMENT ON COLUMN webhook_deliveries.payload IS NULL;
+ALTER TABLE webhook_deliveries ALTER COLUMN payload TYPE JSONB USING convert_from(payload, 'UTF8')::jsonb;
@@ -0,0 +1,3 @@
+-- Payloads are signed, so retries need to send the exact bytes. JSONB normalises the payload (and rejects \u0000).
+ALTER TABLE webhook_deliveries ALTER COLUMN payload TYPE BYTEA USING convert_to(payload::text, 'UTF8');
+COMMENT ON COLUMN webhook_deliveries.payload IS 'The JSON payload, exactly as it is signed and sent.';
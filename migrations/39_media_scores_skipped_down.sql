@@ -0,0 +1,4 @@
+DELETE FROM media_classifications WHERE model <> '' AND category_scores IS NULL;
+COMMENT ON COLUMN media_classifications.category_scores IS 'The AI model''s score for each moderation category, keyed by category.';
+ALTER TABLE media_classifications DROP COLUMN mime_type;
+ALTER TABLE media_classifications DROP COLUMN size_bytes;
@@ -0,0 +1,5 @@
+-- Media which is too large or not an image is skipped by AI models. Skips are cached with the media's size and type so
+-- the media isn't downloaded again, unless the limits change.
+ALTER TABLE media_classifications ADD COLUMN size_bytes BIGINT NULL;
+ALTER TABLE media_classifications ADD COLUMN mime_type TEXT NULL;
+COMMENT ON COLUMN media_classifications.category_scores IS 'The AI model''s score for each moderation category, keyed by category. Null if the model skipped the media.';
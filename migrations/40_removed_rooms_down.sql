@@ -0,0 +1 @@
+DROP TABLE removed_rooms;
@@ -0,0 +1,7 @@
+CREATE TABLE removed_rooms (
+    community_id TEXT NOT NULL CONSTRAINT fk_removed_rooms_community_id_communities_id REFERENCES communities(id),
+    room_id TEXT NOT NULL,
+    removed_ts BIGINT NOT NULL,
+    PRIMARY KEY (community_id, room_id)
+);
+COMMENT ON TABLE removed_rooms IS 'Rooms which were removed from (or moved out of) a community, so space syncs don''t join them again.';
@@ -0,0 +1,2 @@
+DROP TRIGGER ps_room_members_change ON displaynames;
+DROP FUNCTION notify_room_members_change;
@@ -0,0 +1,16 @@
+-- The impersonation filter caches each room's protected members in memory, so tell it when the room's members change.
+-- Postgres only delivers one notification per room for each transaction, so replacing all of a room's members only
+-- notifies once.
+CREATE OR REPLACE FUNCTION notify_room_members_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_room_members_changed', OLD.room_id);
+    ELSE
+        PERFORM pg_notify('policyserv_room_members_changed', NEW.room_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ps_room_members_change AFTER INSERT OR UPDATE OR DELETE ON displaynames FOR EACH ROW EXECUTE FUNCTION notify_room_members_change();
@@ -0,0 +1,10 @@
+DROP TRIGGER ps_community_keyword_template_change ON community_keyword_templates;
+CREATE TRIGGER ps_community_keyword_template_change AFTER INSERT OR UPDATE ON community_keyword_templates FOR EACH ROW EXECUTE FUNCTION notify_community_keyword_template_change();
+
+CREATE OR REPLACE FUNCTION notify_community_keyword_template_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('policyserv_community_config_changed', NEW.community_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
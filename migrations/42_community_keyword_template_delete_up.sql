@@ -0,0 +1,16 @@
+-- Deleting a template also needs to recreate the community's filter sets, so notify on DELETE too. NEW is null for
+-- deletes, so use OLD instead.
+CREATE OR REPLACE FUNCTION notify_community_keyword_template_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('policyserv_community_config_changed', OLD.community_id);
+    ELSE
+        PERFORM pg_notify('policyserv_community_config_changed', NEW.community_id);
+    END IF;
+    RETURN NULL; -- ignored for AFTER triggers
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER ps_community_keyword_template_change ON community_keyword_templates;
+CREATE TRIGGER ps_community_keyword_template_change AFTER INSERT OR UPDATE OR DELETE ON community_keyword_templates FOR EACH ROW EXECUTE FUNCTION notify_community_keyword_template_change();
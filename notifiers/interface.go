@@ -1,5 +1,9 @@
 package notifiers
 
+import (
+	"github.com/matrix-org/policyserv/storage"
+)
+
 // MatrixNotifier - Used to send notifications of activity to Matrix. Note that this accepts a "target"
 // which might not be a room ID depending on the implementation.
 type MatrixNotifier interface {
@@ -7,4 +11,8 @@ type MatrixNotifier interface {
 	// message for later delivery - the returned error represents a queue failure in this case rather than a delivery
 	// failure. Returns a "message ID" for logging purposes.
 	Send(communityId string, plainText string, htmlText string) (string, error)
+
+	// SendDecision - Sends a machine-readable copy of the decision to the decision's community, if possible. Like Send,
+	// the implementation might queue the decision for later delivery. Returns a "message ID" for logging purposes.
+	SendDecision(decision *storage.StoredDecision, payloadType WebhookPayloadType) (string, error)
 }
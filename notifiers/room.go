@@ -0,0 +1,111 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/panjf2000/ants/v2"
+)
+
+var ErrNoRoomNoticeSender = errors.New("no room notice sender configured")
+
+// RoomNoticeSender - Sends `m.notice` messages into rooms as policyserv's own user. This is implemented by the
+// homeserver, which can't be imported here.
+type RoomNoticeSender interface {
+	// SendNotice - Sends the message to the room, returning the event ID.
+	SendNotice(ctx context.Context, roomId string, plainText string, htmlText string) (string, error)
+}
+
+// RoomMatrixNotifier - Sends notices to the community's audit room (if configured) as real Matrix events, in addition
+// to the upstream notifier. Decisions are only sent to the upstream notifier.
+type RoomMatrixNotifier struct {
+	MatrixNotifier
+
+	storage    storage.PersistentStorage
+	pool       *ants.Pool
+	senderLock sync.RWMutex
+	sender     RoomNoticeSender
+}
+
+func NewRoomMatrixNotifier(upstream MatrixNotifier, storage storage.PersistentStorage, poolSize int) (*RoomMatrixNotifier, error) {
+	pool, err := ants.NewPool(poolSize, ants.WithOptions(ants.Options{
+		// Same options as the webhook notifier
+		ExpiryDuration:   1 * time.Minute,
+		PreAlloc:         false,
+		MaxBlockingTasks: 0, // no limit on submissions
+		Nonblocking:      false,
+		Logger:           log.Default(),
+		DisablePurge:     false,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &RoomMatrixNotifier{
+		MatrixNotifier: upstream,
+		storage:        storage,
+		pool:           pool,
+	}, nil
+}
+
+// SetSender - Sets the sender used for audit rooms. The sender is set after construction because the homeserver
+// depends (indirectly) on the notifier.
+func (n *RoomMatrixNotifier) SetSender(sender RoomNoticeSender) {
+	n.senderLock.Lock()
+	defer n.senderLock.Unlock()
+	n.sender = sender
+}
+
+// Send - Sends the notice to both the upstream notifier and the audit room. A failure to deliver to one doesn't stop
+// delivery to the other, and the errors from both are returned.
+func (n *RoomMatrixNotifier) Send(communityId string, plainText string, htmlText string) (string, error) {
+	msgId, upstreamErr := n.MatrixNotifier.Send(communityId, plainText, htmlText)
+	if msgId == "" {
+		msgId = storage.NextId() // so the audit room's logs can still be correlated
+	}
+	roomErr := n.sendToAuditRoom(msgId, communityId, plainText, htmlText)
+	return msgId, errors.Join(upstreamErr, roomErr)
+}
+
+func (n *RoomMatrixNotifier) sendToAuditRoom(msgId string, communityId string, plainText string, htmlText string) error {
+	// This context only covers the database call - it's not used for actual delivery
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	community, err := n.storage.GetCommunity(ctx, communityId)
+	if err != nil {
+		return err
+	}
+	if community == nil || community.Config == nil {
+		return nil // the upstream notifier will have complained already
+	}
+	roomId := internal.Dereference(community.Config.AuditRoomId)
+	if roomId == "" {
+		return nil
+	}
+
+	n.senderLock.RLock()
+	sender := n.sender
+	n.senderLock.RUnlock()
+	if sender == nil {
+		return ErrNoRoomNoticeSender
+	}
+
+	return n.pool.Submit(func() {
+		// We override the context here to ensure we don't spend forever trying to send a message. This is longer than
+		// the webhook timeout because we might need to join the room first.
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		eventId, err := sender.SendNotice(ctx, roomId, plainText, htmlText)
+		if err != nil {
+			log.Printf("[%s] Error sending notice to %s for community %s: %s", msgId, roomId, communityId, err)
+			return
+		}
+		log.Printf("[%s] Sent notice to %s for community %s as %s", msgId, roomId, communityId, eventId)
+	})
+}
@@ -0,0 +1,131 @@
+package notifiers_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentNotice struct {
+	roomId    string
+	plainText string
+	htmlText  string
+}
+
+type recordingNoticeSender struct {
+	lock sync.Mutex
+	sent []*sentNotice
+}
+
+func (s *recordingNoticeSender) SendNotice(ctx context.Context, roomId string, plainText string, htmlText string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sent = append(s.sent, &sentNotice{roomId: roomId, plainText: plainText, htmlText: htmlText})
+	return "$event", nil
+}
+
+func (s *recordingNoticeSender) Sent() []*sentNotice {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*sentNotice{}, s.sent...)
+}
+
+func TestRoomSend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	upstream := test.NewMatrixNotifier(t)
+	notifier, err := notifiers.NewRoomMatrixNotifier(upstream, db, 5)
+	assert.NoError(t, err)
+	assert.NotNil(t, notifier)
+	sender := &recordingNoticeSender{}
+	notifier.SetSender(sender)
+
+	withRoom, err := db.CreateCommunity(ctx, "With Room")
+	assert.NoError(t, err)
+	withRoom.Config.AuditRoomId = internal.Pointer("!audit:example.org")
+	err = db.UpsertCommunity(ctx, withRoom)
+	assert.NoError(t, err)
+	withoutRoom, err := db.CreateCommunity(ctx, "Without Room")
+	assert.NoError(t, err)
+
+	// Both communities receive the notice through the upstream notifier, but only the community with an audit room
+	// receives it in the room too
+	msgId, err := notifier.Send(withRoom.CommunityId, "plain", "<b>html</b>")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, msgId)
+	_, err = notifier.Send(withoutRoom.CommunityId, "plain", "<b>html</b>")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"plain"}, upstream.SentTo(withRoom.CommunityId))
+	assert.Equal(t, []string{"plain"}, upstream.SentTo(withoutRoom.CommunityId))
+	assert.Eventually(t, func() bool {
+		return len(sender.Sent()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, &sentNotice{roomId: "!audit:example.org", plainText: "plain", htmlText: "<b>html</b>"}, sender.Sent()[0])
+
+	// Decisions only go to the upstream notifier
+	_, err = notifier.SendDecision(&storage.StoredDecision{CommunityId: withRoom.CommunityId}, notifiers.WebhookPayloadTypeSpam)
+	assert.NoError(t, err)
+	assert.Equal(t, []notifiers.WebhookPayloadType{notifiers.WebhookPayloadTypeSpam}, upstream.DecisionTypesSentTo(withRoom.CommunityId))
+	assert.Len(t, sender.Sent(), 1)
+}
+
+func TestRoomSendWithoutSender(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	notifier, err := notifiers.NewRoomMatrixNotifier(test.NewMatrixNotifier(t), db, 5)
+	assert.NoError(t, err)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	community.Config.AuditRoomId = internal.Pointer("!audit:example.org")
+	err = db.UpsertCommunity(ctx, community)
+	assert.NoError(t, err)
+
+	_, err = notifier.Send(community.CommunityId, "plain", "<b>html</b>")
+	assert.ErrorIs(t, err, notifiers.ErrNoRoomNoticeSender)
+}
+
+type failingNotifier struct {
+	notifiers.MatrixNotifier
+}
+
+func (n *failingNotifier) Send(communityId string, plainText string, htmlText string) (string, error) {
+	return "", errors.New("webhook is down")
+}
+
+func TestRoomSendWhenUpstreamFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	notifier, err := notifiers.NewRoomMatrixNotifier(&failingNotifier{}, db, 5)
+	assert.NoError(t, err)
+	sender := &recordingNoticeSender{}
+	notifier.SetSender(sender)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	community.Config.AuditRoomId = internal.Pointer("!audit:example.org")
+	err = db.UpsertCommunity(ctx, community)
+	assert.NoError(t, err)
+
+	// The upstream error is returned, but the audit room still receives the notice
+	msgId, err := notifier.Send(community.CommunityId, "plain", "<b>html</b>")
+	assert.EqualError(t, err, "webhook is down")
+	assert.NotEmpty(t, msgId)
+	assert.Eventually(t, func() bool {
+		return len(sender.Sent()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
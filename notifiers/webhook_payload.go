@@ -0,0 +1,83 @@
+package notifiers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+type WebhookPayloadType string
+
+const (
+	// WebhookPayloadTypeSpam - The event was flagged as spam, and the community acted upon it.
+	WebhookPayloadTypeSpam WebhookPayloadType = "event.spam"
+	// WebhookPayloadTypeShadowSpam - The event was flagged as spam, but no action was taken. Either the community is in
+	// shadow mode, or only shadowed filters flagged the event.
+	WebhookPayloadTypeShadowSpam WebhookPayloadType = "event.shadow_spam"
+	// WebhookPayloadTypeNotSpam - The event was not flagged as spam.
+	WebhookPayloadTypeNotSpam WebhookPayloadType = "event.not_spam"
+	// WebhookPayloadTypeNotice - A human-readable notice, like a raid alert. These are the same messages sent to the
+	// legacy webhook_url.
+	WebhookPayloadTypeNotice WebhookPayloadType = "notice"
+)
+
+// WebhookPayloadTypes - All known payload types.
+var WebhookPayloadTypes = []WebhookPayloadType{
+	WebhookPayloadTypeSpam,
+	WebhookPayloadTypeShadowSpam,
+	WebhookPayloadTypeNotSpam,
+	WebhookPayloadTypeNotice,
+}
+
+// WebhookTimestampHeader - The header containing the time (in milliseconds) the payload was signed at.
+const WebhookTimestampHeader = "X-Policyserv-Timestamp"
+
+// WebhookSignatureHeader - The header containing the payload's signature, as `sha256=<hex>`. Only set if the community
+// has a webhook secret.
+const WebhookSignatureHeader = "X-Policyserv-Signature"
+
+// WebhookPayload - The JSON body sent to webhook destinations. Exactly one of Decision or Notice is set, depending on
+// the Type.
+type WebhookPayload struct {
+	// Id - Unique to the payload, but the same across retries and destinations. Receivers can use this to ignore
+	// duplicate deliveries.
+	Id              string             `json:"id"`
+	Type            WebhookPayloadType `json:"type"`
+	CommunityId     string             `json:"community_id"`
+	TimestampMillis int64              `json:"ts"`
+	Decision        *WebhookDecision   `json:"decision,omitempty"`
+	Notice          *WebhookNotice     `json:"notice,omitempty"`
+}
+
+// WebhookDecision - A decision in the same shape as the decisions API returns.
+type WebhookDecision struct {
+	*storage.StoredDecision
+	Class string       `json:"class"`
+	Harms []harms.Harm `json:"harms"`
+}
+
+type WebhookNotice struct {
+	Text string `json:"text"`
+	Html string `json:"html"`
+}
+
+// SignWebhookPayload - Returns the signature for the payload body, as used in WebhookSignatureHeader. The timestamp is
+// included in the signature so receivers can reject replayed payloads.
+func SignWebhookPayload(secret string, timestampMillis int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestampMillis, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isSubscribed - Returns whether the destination wants payloads of the given type. Destinations without any event
+// types receive everything.
+func isSubscribed(destination *storage.StoredWebhookDestination, payloadType WebhookPayloadType) bool {
+	return len(destination.EventTypes) == 0 || slices.Contains(destination.EventTypes, string(payloadType))
+}
@@ -5,14 +5,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"slices"
+	"strconv"
 	"testing"
 	"time"
 
+	cache "github.com/Code-Hex/go-generics-cache"
 	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/pubsub"
 	"github.com/matrix-org/policyserv/storage"
 	"github.com/panjf2000/ants/v2"
 )
@@ -20,15 +25,34 @@ import (
 var ErrWebhookNotHttps = errors.New("webhook must be https")
 var ErrWebhookDomainNotAllowed = errors.New("webhook domain not allowed")
 
+// webhookMaxAttempts - The number of times a structured payload is attempted before it is dropped.
+const webhookMaxAttempts = 10
+
+// webhookMaxBackoff - The longest we'll wait between attempts of a structured payload.
+const webhookMaxBackoff = 1 * time.Hour
+
+// webhookClaimDuration - How long a delivery is hidden from other processes while it's being attempted. This must be
+// longer than the request timeout.
+const webhookClaimDuration = 2 * time.Minute
+
+// webhookClaimBatchSize - The maximum number of deliveries a single RetryDeliveries call will attempt.
+const webhookClaimBatchSize = 100
+
+// webhookDestinationsCacheDuration - How long a community's destinations are cached for. Changes to the destinations
+// invalidate the cache sooner, so this is just in case that doesn't happen.
+const webhookDestinationsCacheDuration = 60 * time.Minute
+
 type WebhookMatrixNotifier struct {
 	MatrixNotifier
 
-	storage        storage.PersistentStorage
-	pool           *ants.Pool
-	allowedDomains []string
+	storage           storage.PersistentStorage
+	pool              *ants.Pool
+	allowedDomains    []string
+	retryInterval     time.Duration
+	destinationsCache *cache.Cache[string, []*storage.StoredWebhookDestination] // community ID -> destinations
 }
 
-func NewWebhookMatrixNotifier(storage storage.PersistentStorage, poolSize int, allowedDomains []string) (*WebhookMatrixNotifier, error) {
+func NewWebhookMatrixNotifier(db storage.PersistentStorage, pubsubClient pubsub.Client, poolSize int, allowedDomains []string, retryInterval time.Duration) (*WebhookMatrixNotifier, error) {
 	pool, err := ants.NewPool(poolSize, ants.WithOptions(ants.Options{
 		// Same options as the queue.Pool setup
 		ExpiryDuration:   1 * time.Minute,
@@ -45,13 +69,51 @@ func NewWebhookMatrixNotifier(storage storage.PersistentStorage, poolSize int, a
 	if err != nil {
 		return nil, err
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	destinationsCache := cache.New[string, []*storage.StoredWebhookDestination](
+		cache.WithJanitorInterval[string, []*storage.StoredWebhookDestination](15 * time.Minute),
+	)
+	ch, err := pubsubClient.Subscribe(ctx, pubsub.TopicWebhookDestinations)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for communityId := range ch {
+			if communityId == pubsub.ClosingValue {
+				return // stop getting values
+			}
+			destinationsCache.Delete(communityId)
+		}
+	}()
+
 	return &WebhookMatrixNotifier{
-		storage:        storage,
-		pool:           pool,
-		allowedDomains: allowedDomains,
+		storage:           db,
+		pool:              pool,
+		allowedDomains:    allowedDomains,
+		retryInterval:     retryInterval,
+		destinationsCache: destinationsCache,
 	}, nil
 }
 
+// ValidateWebhookUrl - Parses the target URL, ensuring it's a URL policyserv is allowed to send webhooks to.
+func ValidateWebhookUrl(target string, allowedDomains []string) (*url.URL, error) {
+	whUrl, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if !testing.Testing() {
+		if whUrl.Scheme != "https" {
+			return nil, ErrWebhookNotHttps
+		}
+	}
+	if !slices.Contains(allowedDomains, whUrl.Host) {
+		return nil, ErrWebhookDomainNotAllowed
+	}
+	return whUrl, nil
+}
+
 func (w *WebhookMatrixNotifier) Send(communityId string, plainText string, htmlText string) (string, error) {
 	// This context only covers database calls and queue setup - it's not used for actual delivery
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -61,28 +123,41 @@ func (w *WebhookMatrixNotifier) Send(communityId string, plainText string, htmlT
 	if err != nil {
 		return "", err
 	}
+	if community == nil {
+		return "", fmt.Errorf("community %s not found", communityId)
+	}
+
+	msgId := storage.NextId()
+	enqueueErr := w.enqueue(ctx, communityId, &WebhookPayload{
+		Id:              msgId,
+		Type:            WebhookPayloadTypeNotice,
+		CommunityId:     communityId,
+		TimestampMillis: time.Now().UnixMilli(),
+		Notice: &WebhookNotice{
+			Text: plainText,
+			Html: htmlText,
+		},
+	})
+	// The legacy webhook doesn't depend on the structured destinations, so still gets the notice if they fail
+	legacyErr := w.sendLegacy(msgId, community, plainText, htmlText)
+	return msgId, errors.Join(enqueueErr, legacyErr)
+}
+
+// sendLegacy - Posts the notice to the community's `webhook_url` in the Hookshot / Slack format, if it has one. The
+// request happens in the background.
+func (w *WebhookMatrixNotifier) sendLegacy(msgId string, community *storage.StoredCommunity, plainText string, htmlText string) error {
 	target := internal.Dereference(community.Config.WebhookUrl)
 	if target == "" {
-		msgId := storage.NextId()
-		log.Printf("[%s] No webhook configured for community %s", msgId, communityId)
-		return msgId, nil
+		log.Printf("[%s] No webhook configured for community %s", msgId, community.CommunityId)
+		return nil
 	}
 
-	whUrl, err := url.Parse(target)
+	whUrl, err := ValidateWebhookUrl(target, w.allowedDomains)
 	if err != nil {
-		return "", err
-	}
-	if !testing.Testing() {
-		if whUrl.Scheme != "https" {
-			return "", ErrWebhookNotHttps
-		}
-	}
-	if !slices.Contains(w.allowedDomains, whUrl.Host) {
-		return "", ErrWebhookDomainNotAllowed
+		return err
 	}
 
-	msgId := storage.NextId()
-	err = w.pool.Submit(func() {
+	return w.pool.Submit(func() {
 		// We override the context here to ensure we don't spend forever trying to send a message
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -117,5 +192,191 @@ func (w *WebhookMatrixNotifier) Send(communityId string, plainText string, htmlT
 		defer res.Body.Close()
 		log.Printf("[%s] Webhook response: %s", msgId, res.Status)
 	})
+}
+
+func (w *WebhookMatrixNotifier) SendDecision(decision *storage.StoredDecision, payloadType WebhookPayloadType) (string, error) {
+	// Like Send, this context only covers database calls and queue setup
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Note: this is called for every event, so we avoid looking up the community. The secret is looked up when the
+	// delivery is attempted.
+	msgId := storage.NextId()
+	err := w.enqueue(ctx, decision.CommunityId, &WebhookPayload{
+		Id:              msgId,
+		Type:            payloadType,
+		CommunityId:     decision.CommunityId,
+		TimestampMillis: time.Now().UnixMilli(),
+		Decision: &WebhookDecision{
+			StoredDecision: decision,
+			Class:          decision.ContentInfo.Class().String(),
+			Harms:          decision.ContentInfo.Harms(),
+		},
+	})
 	return msgId, err
 }
+
+// enqueue - Persists a delivery of the payload for each of the community's subscribed destinations, then attempts them
+// in the background. Deliveries which fail are picked up again by RetryDeliveries.
+func (w *WebhookMatrixNotifier) enqueue(ctx context.Context, communityId string, payload *WebhookPayload) error {
+	destinations, err := w.getDestinations(ctx, communityId)
+	if err != nil {
+		return err
+	}
+	destinations = slices.DeleteFunc(slices.Clone(destinations), func(d *storage.StoredWebhookDestination) bool {
+		return !isSubscribed(d, payload.Type)
+	})
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false) // same as the legacy webhook
+	err = encoder.Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, destination := range destinations {
+		delivery := &storage.StoredWebhookDelivery{
+			Id:            storage.NextId(),
+			DestinationId: destination.Id,
+			CommunityId:   communityId,
+			Url:           destination.Url,
+			Payload:       buf.Bytes(),
+			Attempts:      0,
+			// We attempt the delivery ourselves right away, so claim it to stop RetryDeliveries from also trying it
+			NextAttemptTimestampMillis: now.Add(webhookClaimDuration).UnixMilli(),
+			LastError:                  "",
+			CreatedTimestampMillis:     now.UnixMilli(),
+		}
+		err = w.storage.UpsertWebhookDelivery(ctx, delivery)
+		if err != nil {
+			return err
+		}
+		err = w.pool.Submit(func() {
+			w.attempt(delivery)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getDestinations - Returns the community's webhook destinations, from the cache if possible.
+func (w *WebhookMatrixNotifier) getDestinations(ctx context.Context, communityId string) ([]*storage.StoredWebhookDestination, error) {
+	if fromCache, ok := w.destinationsCache.Get(communityId); ok {
+		return fromCache, nil
+	}
+	destinations, err := w.storage.GetWebhookDestinations(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	w.destinationsCache.Set(communityId, destinations, cache.WithExpiration(webhookDestinationsCacheDuration))
+	return destinations, nil
+}
+
+// RetryDeliveries - Attempts structured payloads which are due to be retried, across all communities. The attempts
+// happen in the background.
+func (w *WebhookMatrixNotifier) RetryDeliveries(ctx context.Context) error {
+	now := time.Now()
+	deliveries, err := w.storage.ClaimWebhookDeliveries(ctx, now.UnixMilli(), now.Add(webhookClaimDuration).UnixMilli(), webhookClaimBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		err = w.pool.Submit(func() {
+			w.attempt(delivery)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt - Sends the delivery to its destination, removing it on success and rescheduling it (with backoff) on failure.
+func (w *WebhookMatrixNotifier) attempt(delivery *storage.StoredWebhookDelivery) {
+	// Like the legacy webhook, we don't want to spend forever trying to send a payload. This also covers the database
+	// calls, which is why it's a bit longer.
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+	defer cancel()
+
+	err := w.doAttempt(ctx, delivery)
+	if err == nil {
+		log.Printf("[%s] Webhook delivered to destination %s", delivery.Id, delivery.DestinationId)
+		if err = w.storage.DeleteWebhookDelivery(ctx, delivery.Id); err != nil {
+			log.Printf("[%s] Non-fatal error removing delivered webhook: %s", delivery.Id, err)
+		}
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		log.Printf("[%s] Dropping webhook for destination %s after %d attempts: %s", delivery.Id, delivery.DestinationId, delivery.Attempts, err)
+		if err = w.storage.DeleteWebhookDelivery(ctx, delivery.Id); err != nil {
+			log.Printf("[%s] Non-fatal error removing dropped webhook: %s", delivery.Id, err)
+		}
+		return
+	}
+
+	backoff := w.backoff(delivery.Attempts)
+	log.Printf("[%s] Failed to deliver webhook to destination %s (attempt %d), retrying in %s: %s", delivery.Id, delivery.DestinationId, delivery.Attempts, backoff, err)
+	delivery.NextAttemptTimestampMillis = time.Now().Add(backoff).UnixMilli()
+	if err = w.storage.UpsertWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("[%s] Non-fatal error rescheduling webhook: %s", delivery.Id, err)
+	}
+}
+
+func (w *WebhookMatrixNotifier) doAttempt(ctx context.Context, delivery *storage.StoredWebhookDelivery) error {
+	// We look up the community on every attempt so a rotated secret applies to retries too
+	community, err := w.storage.GetCommunity(ctx, delivery.CommunityId)
+	if err != nil {
+		return err
+	}
+	if community == nil {
+		return fmt.Errorf("community %s not found", delivery.CommunityId)
+	}
+
+	// The allowed domains may have changed since the destination was added
+	whUrl, err := ValidateWebhookUrl(delivery.Url, w.allowedDomains)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, whUrl.String(), bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestampMillis := time.Now().UnixMilli()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "policyserv")
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestampMillis, 10))
+	if secret := internal.Dereference(community.WebhookSecret); secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, timestampMillis, delivery.Payload))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024)) // drain (some of) the body so the connection can be reused
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	}
+	return nil
+}
+
+// backoff - Returns how long to wait before the next attempt, doubling the retry interval after each failed attempt.
+func (w *WebhookMatrixNotifier) backoff(attempts int) time.Duration {
+	backoff := w.retryInterval
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, webhookMaxBackoff)
+}
@@ -0,0 +1,358 @@
+package notifiers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
+	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/pubsub"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type receivedWebhook struct {
+	path      string
+	body      []byte
+	timestamp string
+	signature string
+}
+
+// makeWebhookServer - Starts a server which records the webhooks it receives, responding with the given status code.
+func makeWebhookServer(t *testing.T, statusCode *atomic.Int32) (*httptest.Server, func() []*receivedWebhook) {
+	lock := sync.Mutex{}
+	received := make([]*receivedWebhook, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, &receivedWebhook{
+			path:      r.URL.Path,
+			body:      body,
+			timestamp: r.Header.Get(notifiers.WebhookTimestampHeader),
+			signature: r.Header.Get(notifiers.WebhookSignatureHeader),
+		})
+		w.WriteHeader(int(statusCode.Load()))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []*receivedWebhook {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]*receivedWebhook{}, received...)
+	}
+}
+
+func makeWebhookNotifier(t *testing.T, db storage.PersistentStorage, ps pubsub.Client, server *httptest.Server) *notifiers.WebhookMatrixNotifier {
+	parsedUrl, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	notifier, err := notifiers.NewWebhookMatrixNotifier(db, ps, 5, []string{parsedUrl.Host}, time.Second)
+	assert.NoError(t, err)
+	assert.NotNil(t, notifier)
+	return notifier
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	t.Parallel()
+
+	// Same as `printf '1234.{}' | openssl dgst -sha256 -hmac secret`
+	assert.Equal(t, "sha256=3cd06c4748af5a8a8794bc7299eaec7826bb24c266c9b020469c97d6b477f788", notifiers.SignWebhookPayload("secret", 1234, []byte("{}")))
+}
+
+func TestWebhookSendDecision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	statusCode := &atomic.Int32{}
+	statusCode.Store(http.StatusOK)
+	server, received := makeWebhookServer(t, statusCode)
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	notifier := makeWebhookNotifier(t, db, ps, server)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	community.WebhookSecret = internal.Pointer("secret")
+	err = db.UpsertCommunity(ctx, community)
+	assert.NoError(t, err)
+	for _, destination := range []*storage.StoredWebhookDestination{
+		{Id: "all", Url: server.URL + "/all", EventTypes: []string{}},
+		{Id: "spam", Url: server.URL + "/spam", EventTypes: []string{string(notifiers.WebhookPayloadTypeSpam)}},
+		{Id: "notices", Url: server.URL + "/notices", EventTypes: []string{string(notifiers.WebhookPayloadTypeNotice)}},
+	} {
+		destination.CommunityId = community.CommunityId
+		err = db.UpsertWebhookDestination(ctx, destination)
+		assert.NoError(t, err)
+	}
+
+	decision := &storage.StoredDecision{
+		Id:              42,
+		EventId:         "$spam",
+		CommunityId:     community.CommunityId,
+		RoomId:          "!foo:example.org",
+		SenderUserId:    "@alice:example.org",
+		EventType:       "m.room.message",
+		FilterResponses: map[string][]string{"FixedFilter": {"Prohibited", string(harms.SpamFlooding)}},
+		ContentInfo:     harms.ProhibitedContent(harms.SpamFlooding),
+	}
+	msgId, err := notifier.SendDecision(decision, notifiers.WebhookPayloadTypeSpam)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, msgId)
+
+	// Only the destinations subscribed to spam receive the payload
+	assert.Eventually(t, func() bool {
+		return len(received()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	paths := make([]string, 0)
+	for _, r := range received() {
+		paths = append(paths, r.path)
+
+		// Every payload is signed with the community's secret
+		timestamp, err := strconv.ParseInt(r.timestamp, 10, 64)
+		assert.NoError(t, err)
+		assert.Equal(t, notifiers.SignWebhookPayload("secret", timestamp, r.body), r.signature)
+
+		payload := make(map[string]any)
+		err = json.Unmarshal(r.body, &payload)
+		assert.NoError(t, err)
+		assert.Equal(t, msgId, payload["id"])
+		assert.Equal(t, string(notifiers.WebhookPayloadTypeSpam), payload["type"])
+		assert.Equal(t, community.CommunityId, payload["community_id"])
+		assert.Nil(t, payload["notice"])
+		assert.Equal(t, map[string]any{
+			"id":                      float64(42),
+			"event_id":                "$spam",
+			"community_id":            community.CommunityId,
+			"room_id":                 "!foo:example.org",
+			"sender":                  "@alice:example.org",
+			"event_type":              "m.room.message",
+			"filter_responses":        map[string]any{"FixedFilter": []any{"Prohibited", string(harms.SpamFlooding)}},
+			"shadow_filter_responses": nil,
+			"duration_ms":             float64(0),
+			"decided_ts":              float64(0),
+			"class":                   "Prohibited",
+			"harms":                   []any{string(harms.SpamFlooding)},
+		}, payload["decision"])
+	}
+	assert.ElementsMatch(t, []string{"/all", "/spam"}, paths)
+
+	// Delivered payloads are removed
+	assert.Eventually(t, func() bool {
+		deliveries, err := db.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Hour).UnixMilli(), 0, 10)
+		return err == nil && len(deliveries) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebhookSendNotice(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	statusCode := &atomic.Int32{}
+	statusCode.Store(http.StatusOK)
+	server, received := makeWebhookServer(t, statusCode)
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	notifier := makeWebhookNotifier(t, db, ps, server)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	community.Config.WebhookUrl = internal.Pointer(server.URL + "/legacy")
+	err = db.UpsertCommunity(ctx, community)
+	assert.NoError(t, err)
+	err = db.UpsertWebhookDestination(ctx, &storage.StoredWebhookDestination{
+		Id:          "notices",
+		CommunityId: community.CommunityId,
+		Url:         server.URL + "/notices",
+		EventTypes:  []string{string(notifiers.WebhookPayloadTypeNotice)},
+	})
+	assert.NoError(t, err)
+
+	_, err = notifier.Send(community.CommunityId, "plain", "<b>html</b>")
+	assert.NoError(t, err)
+
+	// Both the legacy webhook and the structured destination receive the notice
+	assert.Eventually(t, func() bool {
+		return len(received()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, r := range received() {
+		if r.path == "/legacy" {
+			assert.JSONEq(t, `{"text":"plain","html":"<b>html</b>"}`, string(r.body))
+			assert.Empty(t, r.signature)
+			continue
+		}
+		assert.Equal(t, "/notices", r.path)
+		assert.Empty(t, r.signature) // the community doesn't have a secret
+		payload := &notifiers.WebhookPayload{}
+		err = json.Unmarshal(r.body, payload)
+		assert.NoError(t, err)
+		assert.Equal(t, notifiers.WebhookPayloadTypeNotice, payload.Type)
+		assert.Nil(t, payload.Decision)
+		assert.Equal(t, &notifiers.WebhookNotice{Text: "plain", Html: "<b>html</b>"}, payload.Notice)
+	}
+}
+
+// failingDestinationsStorage - Fails to look up webhook destinations, but otherwise behaves like the wrapped storage.
+type failingDestinationsStorage struct {
+	storage.PersistentStorage
+}
+
+func (s *failingDestinationsStorage) GetWebhookDestinations(ctx context.Context, communityId string) ([]*storage.StoredWebhookDestination, error) {
+	return nil, test.SimulatedError
+}
+
+func TestWebhookSendNoticeWhenDestinationsFail(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	statusCode := &atomic.Int32{}
+	statusCode.Store(http.StatusOK)
+	server, received := makeWebhookServer(t, statusCode)
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	notifier := makeWebhookNotifier(t, &failingDestinationsStorage{PersistentStorage: db}, ps, server)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	community.Config.WebhookUrl = internal.Pointer(server.URL + "/legacy")
+	err = db.UpsertCommunity(ctx, community)
+	assert.NoError(t, err)
+
+	// The error is returned, but the legacy webhook still receives the notice
+	msgId, err := notifier.Send(community.CommunityId, "plain", "<b>html</b>")
+	assert.ErrorIs(t, err, test.SimulatedError)
+	assert.NotEmpty(t, msgId)
+	assert.Eventually(t, func() bool {
+		return len(received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "/legacy", received()[0].path)
+	assert.JSONEq(t, `{"text":"plain","html":"<b>html</b>"}`, string(received()[0].body))
+}
+
+func TestWebhookRetries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	statusCode := &atomic.Int32{}
+	statusCode.Store(http.StatusInternalServerError)
+	server, received := makeWebhookServer(t, statusCode)
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	notifier := makeWebhookNotifier(t, db, ps, server)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	err = db.UpsertWebhookDestination(ctx, &storage.StoredWebhookDestination{
+		Id:          "all",
+		CommunityId: community.CommunityId,
+		Url:         server.URL + "/all",
+		EventTypes:  []string{},
+	})
+	assert.NoError(t, err)
+
+	_, err = notifier.Send(community.CommunityId, "plain", "<b>html</b>")
+	assert.NoError(t, err)
+
+	// The first attempt fails, and the delivery is rescheduled with the retry interval as backoff
+	var deliveries []*storage.StoredWebhookDelivery
+	assert.Eventually(t, func() bool {
+		deliveries, err = db.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Hour).UnixMilli(), 0, 10)
+		return err == nil && len(deliveries) == 1 && deliveries[0].Attempts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, received(), 1)
+	assert.Equal(t, "unexpected response: 500 Internal Server Error", deliveries[0].LastError)
+
+	// The claim above moved the delivery to be due immediately, so retrying sends it again
+	statusCode.Store(http.StatusOK)
+	err = notifier.RetryDeliveries(ctx)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(received()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, received()[0].body, received()[1].body)
+
+	// Now that it's delivered, there's nothing left to retry
+	assert.Eventually(t, func() bool {
+		deliveries, err = db.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Hour).UnixMilli(), 0, 10)
+		return err == nil && len(deliveries) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebhookDestinationsCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	statusCode := &atomic.Int32{}
+	statusCode.Store(http.StatusOK)
+	server, received := makeWebhookServer(t, statusCode)
+	ps := test.NewMemoryPubsub(t)
+	defer ps.Close()
+	notifier := makeWebhookNotifier(t, db, ps, server)
+
+	community, err := db.CreateCommunity(ctx, "Test Community")
+	assert.NoError(t, err)
+	addDestination := func(id string) {
+		err := db.UpsertWebhookDestination(ctx, &storage.StoredWebhookDestination{
+			Id:          id,
+			CommunityId: community.CommunityId,
+			Url:         server.URL + "/" + id,
+			EventTypes:  []string{},
+		})
+		assert.NoError(t, err)
+	}
+	sendDecision := func() {
+		_, err := notifier.SendDecision(&storage.StoredDecision{
+			EventId:     "$event",
+			CommunityId: community.CommunityId,
+			ContentInfo: harms.NeutralContent(),
+		}, notifiers.WebhookPayloadTypeNotSpam)
+		assert.NoError(t, err)
+	}
+	receivedPaths := func() []string {
+		paths := make([]string, 0)
+		for _, r := range received() {
+			paths = append(paths, r.path)
+		}
+		return paths
+	}
+
+	addDestination("first")
+	sendDecision()
+	assert.Eventually(t, func() bool {
+		return len(received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The destinations are cached, so new destinations aren't used until the cache is invalidated
+	addDestination("second")
+	sendDecision()
+	assert.Eventually(t, func() bool {
+		return len(received()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"/first", "/first"}, receivedPaths())
+
+	// The database's trigger would normally publish this
+	err = ps.Publish(ctx, pubsub.TopicWebhookDestinations, community.CommunityId)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		sendDecision()
+		time.Sleep(50 * time.Millisecond)
+		return slices.Contains(receivedPaths(), "/second")
+	}, 5*time.Second, 100*time.Millisecond)
+}
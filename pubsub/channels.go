@@ -1,6 +1,11 @@
 package pubsub
 
-const TopicHellban = "policyserv_hellban_by_community"
+const TopicHellban = "policyserv_hellban_changed"
 const TopicCommunityConfig = "policyserv_community_config_changed"
 const TopicRoomCommunityId = "policyserv_room_community_id_changed"
 const TopicNewEduForDestination = "policyserv_edu_for_destination"
+const TopicOverride = "policyserv_override_changed"
+const TopicBlockedContent = "policyserv_blocked_content_changed"
+const TopicRaid = "policyserv_raid_changed"
+const TopicWebhookDestinations = "policyserv_webhook_destinations_changed"
+const TopicRoomMembers = "policyserv_room_members_changed"
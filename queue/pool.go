@@ -24,11 +24,15 @@ type PoolResult struct {
 
 	// The error processing the event, if any.
 	Err error
+
+	// When true, the room's community is in shadow mode and the ContentInfo should be recorded but not acted upon.
+	ShadowMode bool
 }
 
 type sfResult struct {
 	firstTimeSeen bool
 	contentInfo   *harms.ContentInfo
+	shadowMode    bool
 }
 
 type PoolConfig struct {
@@ -75,7 +79,7 @@ func (p *Pool) Submit(ctx context.Context, event gomatrixserverlib.PDU, mediaDow
 	t := metrics.StartQueueTimer()
 
 	// Note: waitCh might be nil or unbuffered, so we spawn this in a goroutine later on.
-	notifyResult := func(info *harms.ContentInfo, err error) {
+	notifyResult := func(info *harms.ContentInfo, shadowMode bool, err error) {
 		if err == nil {
 			t.ObserveDurationWithExemplar(prometheus.Labels{"waitedUntil": "result"})
 		} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
@@ -88,6 +92,7 @@ func (p *Pool) Submit(ctx context.Context, event gomatrixserverlib.PDU, mediaDow
 			res := &PoolResult{
 				ContentInfo: info,
 				Err:         err,
+				ShadowMode:  shadowMode,
 			}
 
 			// First, check to see if the channel is likely going to be closed already
@@ -110,7 +115,7 @@ func (p *Pool) Submit(ctx context.Context, event gomatrixserverlib.PDU, mediaDow
 		// If the context is cancelled, save CPU and don't bother checking
 		if err := ctx.Err(); err != nil {
 			defer metrics.RecordFailedEventCheck(event.RoomID().String())
-			go notifyResult(nil, err)
+			go notifyResult(nil, false, err)
 			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
 				log.Printf("Not checking %s because context was cancelled/timed out", event.EventID())
 				return
@@ -143,9 +148,9 @@ func (p *Pool) Submit(ctx context.Context, event gomatrixserverlib.PDU, mediaDow
 				// "should never happen"
 				err = errors.New("nil result")
 			}
-			go notifyResult(nil, err)
+			go notifyResult(nil, false, err)
 		} else {
-			go notifyResult(res.contentInfo, err)
+			go notifyResult(res.contentInfo, res.shadowMode, err)
 		}
 	}
 
@@ -159,9 +164,15 @@ func (p *Pool) doFilter(ctx context.Context, event gomatrixserverlib.PDU, mediaD
 		return nil, err
 	}
 	if res != nil {
+		// The community may have entered or left shadow mode since we last saw the event, so check again
+		set, err := p.communityManager.GetFilterSetForRoomId(ctx, event.RoomID().String())
+		if err != nil {
+			return nil, err
+		}
 		return &sfResult{
 			firstTimeSeen: false,
 			contentInfo:   res.ContentInfo,
+			shadowMode:    set != nil && set.IsShadowMode(),
 		}, nil
 	}
 
@@ -197,5 +208,6 @@ func (p *Pool) doFilter(ctx context.Context, event gomatrixserverlib.PDU, mediaD
 	return &sfResult{
 		firstTimeSeen: true,
 		contentInfo:   info,
+		shadowMode:    set.IsShadowMode(),
 	}, nil
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/matrix-org/policyserv/community"
 	"github.com/matrix-org/policyserv/config"
 	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/internal"
 	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/stretchr/testify/assert"
@@ -113,3 +114,64 @@ func TestPoolHandlesErrors(t *testing.T) {
 		Err:         test.SimulatedError,
 	}, poolResult)
 }
+
+func TestPoolShadowMode(t *testing.T) {
+	cnf, err := config.NewInstanceConfig()
+	assert.NoError(t, err)
+	assert.NotNil(t, cnf)
+
+	db := test.NewMemoryStorage(t)
+	defer db.Close()
+
+	pubsub := test.NewMemoryPubsub(t)
+	defer pubsub.Close()
+
+	manager, err := community.NewManager(cnf, db, pubsub, test.NewMatrixNotifier(t))
+	assert.NoError(t, err)
+	assert.NotNil(t, manager)
+
+	pool, err := NewPool(&PoolConfig{
+		ConcurrentPools: 1,
+		SizePerPool:     5,
+	}, manager, db)
+	assert.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	err = db.UpsertCommunity(context.Background(), &storage.StoredCommunity{
+		CommunityId: "shadow",
+		Name:        "Shadow Community",
+		Config: &config.CommunityConfig{
+			KeywordFilterKeywords: internal.Pointer([]string{"spammy"}),
+			ShadowModeEnabled:     internal.Pointer(true),
+		},
+	})
+	assert.NoError(t, err)
+	err = db.UpsertRoom(context.Background(), &storage.StoredRoom{
+		RoomId:      "!foo:example.org",
+		RoomVersion: "11",
+		CommunityId: "shadow",
+	})
+	assert.NoError(t, err)
+
+	// The event should still be classified as spam, but flagged as being in shadow mode
+	event := test.MustMakePDU(&test.BaseClientEvent{
+		EventId: "$event1",
+		RoomId:  "!foo:example.org",
+		Type:    "m.room.message",
+		Sender:  "@test1:example.org",
+		Content: map[string]interface{}{
+			"body": "spammy",
+		},
+	})
+	for i := 0; i < 2; i++ { // the second iteration uses the stored result
+		ch := make(chan *PoolResult, 1)
+		err = pool.Submit(context.Background(), event, nil, ch)
+		assert.NoError(t, err)
+
+		poolResult := <-ch
+		assert.NotNil(t, poolResult)
+		assert.NoError(t, poolResult.Err)
+		assert.True(t, poolResult.ShadowMode)
+		assert.Equal(t, harms.ContentClassProhibited, poolResult.ContentInfo.Class())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/policyserv/config"
@@ -17,6 +18,14 @@ type StoredRoom struct {
 	ModeratorUserId                string `json:"moderator_user_id"` // TODO: Drop
 	LastCachedStateTimestampMillis int64  `json:"last_cached_state_timestamp"`
 	CommunityId                    string `json:"community_id"`
+	RemovedFromSpace               bool   `json:"removed_from_space"`
+}
+
+// StoredRoomMember - The profile of a user joined to a room, as of the last time the room's state was learned.
+type StoredRoomMember struct {
+	UserId      string `json:"user_id"`
+	DisplayName string `json:"displayname"`
+	AvatarUrl   string `json:"avatar_url"`
 }
 
 type StoredEventResult struct {
@@ -30,7 +39,15 @@ type StoredCommunity struct {
 	Name             string                  `json:"name"`
 	Config           *config.CommunityConfig `json:"config"`
 	ApiAccessToken   *string                 `json:"-"` // don't export to/import from JSON
+	WebhookSecret    *string                 `json:"-"` // don't export to/import from JSON
 	CanSelfJoinRooms bool                    `json:"can_self_join_rooms"`
+	SpaceRoomId      string                  `json:"space_room_id"`
+}
+
+type StoredListRule struct {
+	EntityType     string // "m.policy.rule.user", etc
+	Entity         string // may contain glob characters
+	Recommendation string // "m.ban", etc
 }
 
 type StateLearnQueueItem struct {
@@ -51,6 +68,195 @@ type StoredMediaClassification struct {
 	Classifications StoredClassifications
 }
 
+// StoredMediaScores - An AI model's category scores for a piece of media. Scores don't depend on community config, so
+// they are shared by all communities.
+type StoredMediaScores struct {
+	MxcUri         string
+	Model          string
+	CategoryScores map[string]float64 // nil if the media was skipped rather than scored
+	// SizeBytes and MimeType describe the media, so skipped media can be skipped again without downloading it.
+	SizeBytes int64
+	MimeType  string
+}
+
+// StoredDecision - A record of how the filters handled an event. Only the final ContentInfo affects the event, but the
+// individual filter responses are kept so moderators can find out *why* an event was (or wasn't) flagged.
+type StoredDecision struct {
+	Id                     int64               `json:"id"`
+	EventId                string              `json:"event_id"`
+	CommunityId            string              `json:"community_id"`
+	RoomId                 string              `json:"room_id"`
+	SenderUserId           string              `json:"sender"`
+	EventType              string              `json:"event_type"`
+	FilterResponses        map[string][]string `json:"filter_responses"`
+	ShadowFilterResponses  map[string][]string `json:"shadow_filter_responses"`
+	ContentInfo            *harms.ContentInfo  `json:"-"` // can't be exported to/imported from JSON
+	DurationMillis         int64               `json:"duration_ms"`
+	DecidedTimestampMillis int64               `json:"decided_ts"`
+}
+
+// DecisionQuery - Filters for GetDecisions. Zero values are not used to filter, except for CommunityId which is
+// always required.
+type DecisionQuery struct {
+	CommunityId  string
+	EventId      string
+	RoomId       string
+	SenderUserId string
+	Harm         harms.Harm
+	// SinceTimestampMillis - Inclusive lower bound on StoredDecision.DecidedTimestampMillis
+	SinceTimestampMillis int64
+	// UntilTimestampMillis - Exclusive upper bound on StoredDecision.DecidedTimestampMillis
+	UntilTimestampMillis int64
+	// BeforeId - Only decisions with a lower StoredDecision.Id are returned. Used for pagination.
+	BeforeId int64
+	Limit    int
+}
+
+type OverrideKind string
+
+const (
+	OverrideKindEventId     OverrideKind = "event_id"
+	OverrideKindUserId      OverrideKind = "user_id"
+	OverrideKindContentHash OverrideKind = "content_hash"
+)
+
+// StoredOverride - A moderator's declaration that something is allowed within a community, regardless of what the
+// filters think. Used to correct false positives.
+type StoredOverride struct {
+	CommunityId            string       `json:"community_id"`
+	Kind                   OverrideKind `json:"kind"`
+	Value                  string       `json:"value"`
+	Reason                 string       `json:"reason"`
+	CreatedTimestampMillis int64        `json:"created_ts"`
+}
+
+// StoredHellban - A user whose events are considered spam within a community until the hellban expires. Expired
+// hellbans are kept for a while so repeat offenders can be given longer hellbans.
+type StoredHellban struct {
+	CommunityId            string `json:"community_id"`
+	UserId                 string `json:"user_id"`
+	ExpiresTimestampMillis int64  `json:"expires_ts"`
+	// Strikes - The number of automatic hellbans the user has received in a row.
+	Strikes int `json:"strikes"`
+}
+
+// IsActive - Returns whether the hellban has not yet expired at the given time.
+func (h *StoredHellban) IsActive(at time.Time) bool {
+	return h.ExpiresTimestampMillis > at.UnixMilli()
+}
+
+type ContentKind string
+
+const (
+	ContentKindFingerprint ContentKind = "fingerprint"
+	ContentKindMediaUri    ContentKind = "media_uri"
+)
+
+// StoredRecentContent - A fingerprint or media URI from a recently received event. These are kept for a while so the
+// content can be blocked if a moderator later redacts the event or bans its sender.
+type StoredRecentContent struct {
+	EventId                 string      `json:"event_id"`
+	CommunityId             string      `json:"community_id"`
+	RoomId                  string      `json:"room_id"`
+	Sender                  string      `json:"sender"`
+	Kind                    ContentKind `json:"kind"`
+	Value                   string      `json:"value"`
+	ReceivedTimestampMillis int64       `json:"received_ts"`
+}
+
+// StoredBlockedContent - A fingerprint or media URI which is considered harmful within a community until it expires,
+// because a moderator removed it.
+type StoredBlockedContent struct {
+	CommunityId            string      `json:"community_id"`
+	Kind                   ContentKind `json:"kind"`
+	Value                  string      `json:"value"`
+	EventId                string      `json:"event_id"` // the most recent event the content was learned from
+	ExpiresTimestampMillis int64       `json:"expires_ts"`
+}
+
+// StoredRaid - A period where a room (or the whole community) is receiving an unusual number of joins. Events from
+// users who joined during the raid, or who aren't trusted, are considered spam until the raid expires.
+type StoredRaid struct {
+	CommunityId string `json:"community_id"`
+	// RoomId - The room being raided, or an empty string if the raid affects the whole community.
+	RoomId                 string `json:"room_id"`
+	StartedTimestampMillis int64  `json:"started_ts"`
+	ExpiresTimestampMillis int64  `json:"expires_ts"`
+	// IsManual - Whether a moderator started the raid, rather than the join rate exceeding the community's limits.
+	IsManual bool `json:"is_manual"`
+}
+
+// IsActive - Returns whether the raid has not yet expired at the given time.
+func (r *StoredRaid) IsActive(at time.Time) bool {
+	return r.ExpiresTimestampMillis > at.UnixMilli()
+}
+
+type MediaHashKind string
+
+const (
+	MediaHashKindSha256 MediaHashKind = "sha256"
+	MediaHashKindPHash  MediaHashKind = "phash"
+	MediaHashKindDHash  MediaHashKind = "dhash"
+)
+
+// StoredMediaHash - A hash of media which a community doesn't want posted, like a known shock image. SHA-256 hashes
+// only match identical files, while perceptual hashes also match images which have been resized or re-encoded.
+type StoredMediaHash struct {
+	CommunityId string        `json:"community_id"`
+	Bank        string        `json:"bank"`
+	Kind        MediaHashKind `json:"kind"`
+	Value       string        `json:"value"`
+	// MxcUri - The media the hash was computed from, if known.
+	MxcUri                 string `json:"mxc_uri"`
+	Reason                 string `json:"reason"`
+	CreatedTimestampMillis int64  `json:"created_ts"`
+}
+
+// StoredWebhookDestination - A URL which receives structured webhook payloads for a community, in addition to the
+// legacy webhook_url community config option.
+type StoredWebhookDestination struct {
+	Id          string `json:"id"`
+	CommunityId string `json:"community_id"`
+	Url         string `json:"url"`
+	// EventTypes - The payload types the destination is subscribed to. An empty slice subscribes to everything.
+	EventTypes             []string `json:"event_types"`
+	CreatedTimestampMillis int64    `json:"created_ts"`
+}
+
+// StoredWebhookDelivery - A webhook payload which has not yet been accepted by its destination.
+type StoredWebhookDelivery struct {
+	Id            string
+	DestinationId string
+	CommunityId   string
+	Url           string
+	Payload       json.RawMessage
+	Attempts      int
+	// NextAttemptTimestampMillis - When the delivery may next be attempted. Claiming a delivery pushes this forward so
+	// other processes don't attempt it at the same time.
+	NextAttemptTimestampMillis int64
+	LastError                  string
+	CreatedTimestampMillis     int64
+}
+
+// StoredAuditRoom - A room policyserv has been invited to for sending community audit messages. Unlike StoredRoom,
+// audit rooms are not protected by policyserv.
+type StoredAuditRoom struct {
+	RoomId      string
+	RoomVersion string
+	// Via - The server which invited policyserv to the room, used to join it.
+	Via string
+	// Servers - Where audit messages are sent. This is every server with a joined member when policyserv joined the
+	// room, plus any server which has sent an event to the room since.
+	Servers            []string
+	CreateEventId      string
+	PowerLevelsEventId string
+	// MemberEventId - policyserv's own join event, or empty if policyserv hasn't joined (or has since left) the room.
+	MemberEventId string
+	// PrevEventIds - The latest events policyserv knows about in the room, used as prev_events for the next message.
+	PrevEventIds []string
+	Depth        int64
+}
+
 type StoredEdu struct {
 	Destination string
 	Payload     gomatrixserverlib.EDU
@@ -127,12 +333,26 @@ type PersistentStorage interface {
 	Close() error
 
 	GetAllRooms(ctx context.Context) ([]*StoredRoom, error)
+	GetRoomsByCommunityId(ctx context.Context, communityId string) ([]*StoredRoom, error)
 	GetRoom(ctx context.Context, roomId string) (*StoredRoom, error)
 	UpsertRoom(ctx context.Context, room *StoredRoom) error
+	// DeleteRoom - removes the room along with its learned state (members, policy rules, space children, trust data,
+	// etc). Event results and decisions for the room are kept. The room is also marked as removed from its community.
 	DeleteRoom(ctx context.Context, roomId string) error
+	// UpsertRemovedRoom - marks the room as removed from the community, so the community's space sync doesn't join it
+	// again.
+	UpsertRemovedRoom(ctx context.Context, communityId string, roomId string, removedTimestampMillis int64) error
+	// DeleteRemovedRoom - clears the removed marker, such as when the room is added back to the community. Clearing an
+	// unknown marker is not an error.
+	DeleteRemovedRoom(ctx context.Context, communityId string, roomId string) error
+	// IsRoomRemoved - returns true if the room is marked as removed from the community.
+	IsRoomRemoved(ctx context.Context, communityId string, roomId string) (bool, error)
 
 	GetEventResult(ctx context.Context, eventId string) (*StoredEventResult, error)
 	UpsertEventResult(ctx context.Context, event *StoredEventResult) error
+	// DeleteEventResult - forgets the event's result, so the event is checked again the next time it's seen. Deleting
+	// an unknown result is not an error.
+	DeleteEventResult(ctx context.Context, eventId string) error
 
 	// GetUserIdsAndDisplayNamesByRoomId - returns (userIds, displayNames, error) for user IDs joined to the room.
 	// Values are deduplicated.
@@ -140,16 +360,25 @@ type PersistentStorage interface {
 	// SetUserIdsAndDisplayNamesByRoomId - replaces the stored user IDs and display names for a given room. The supplied
 	// slices MUST be the same length, and ordered against the user IDs slice.
 	SetUserIdsAndDisplayNamesByRoomId(ctx context.Context, roomId string, userIds []string, displayNames []string) error
+	// GetRoomMembers - returns the stored profiles of users joined to the room. Unlike GetUserIdsAndDisplayNamesByRoomId,
+	// the display names and avatars are kept with their user IDs.
+	GetRoomMembers(ctx context.Context, roomId string) ([]*StoredRoomMember, error)
+	// SetRoomMembers - replaces the stored profiles for users joined to the room.
+	SetRoomMembers(ctx context.Context, roomId string, members []*StoredRoomMember) error
 
+	// IsUserBannedInList - returns whether the user is banned by an `m.ban` user or server rule in the list.
 	IsUserBannedInList(ctx context.Context, listRoomId string, userId string) (bool, error)
-	// SetListBanRules - sets the listRoomId's ban rules to the entityToEntityType map.
-	// Example entityToEntityMap: {"@user:example.org":"m.policy.rule.user"}
-	SetListBanRules(ctx context.Context, listRoomId string, entityToEntityType map[string]string) error
+	// SetListRules - replaces the listRoomId's policy rules.
+	SetListRules(ctx context.Context, listRoomId string, rules []*StoredListRule) error
+	// GetListRules - returns the listRoomId's policy rules, in no particular order.
+	GetListRules(ctx context.Context, listRoomId string) ([]*StoredListRule, error)
 
 	CreateCommunity(ctx context.Context, name string) (*StoredCommunity, error)
 	UpsertCommunity(ctx context.Context, community *StoredCommunity) error
 	GetCommunity(ctx context.Context, id string) (*StoredCommunity, error)
 	GetCommunityByAccessToken(ctx context.Context, accessToken string) (*StoredCommunity, error)
+	// GetCommunitiesWithSpaces - returns the communities which have a SpaceRoomId set.
+	GetCommunitiesWithSpaces(ctx context.Context) ([]*StoredCommunity, error)
 
 	// PopStateLearnQueue - returns the next item in the state learn queue, or nil if the queue is empty.
 	// The caller is responsible for calling Commit() on the returned Transaction, completing the operation.
@@ -163,9 +392,30 @@ type PersistentStorage interface {
 
 	UpsertKeywordTemplate(ctx context.Context, template *StoredKeywordTemplate) error
 	GetKeywordTemplate(ctx context.Context, name string) (*StoredKeywordTemplate, error)
+	// UpsertCommunityKeywordTemplate - like UpsertKeywordTemplate, but the template is only visible to the community.
+	UpsertCommunityKeywordTemplate(ctx context.Context, communityId string, template *StoredKeywordTemplate) error
+	// GetCommunityKeywordTemplate - returns a template set by UpsertCommunityKeywordTemplate. Like GetKeywordTemplate,
+	// this returns sql.ErrNoRows if the template doesn't exist. Instance-wide templates are not returned.
+	GetCommunityKeywordTemplate(ctx context.Context, communityId string, name string) (*StoredKeywordTemplate, error)
+	// DeleteCommunityKeywordTemplate - removes a template set by UpsertCommunityKeywordTemplate, if it exists. Deleting
+	// an unknown template is not an error.
+	DeleteCommunityKeywordTemplate(ctx context.Context, communityId string, name string) error
 
 	UpsertMediaClassification(ctx context.Context, classification *StoredMediaClassification) error
 	GetMediaClassification(ctx context.Context, mxcUri string, communityId string) (*StoredMediaClassification, error)
+	// DeleteMediaClassifications - removes the community's cached media classifications, so media is scanned again.
+	DeleteMediaClassifications(ctx context.Context, communityId string) error
+	UpsertMediaScores(ctx context.Context, scores *StoredMediaScores) error
+	// GetMediaScores - returns the model's cached scores for the media, or nil if the media hasn't been scored.
+	GetMediaScores(ctx context.Context, mxcUri string, model string) (*StoredMediaScores, error)
+
+	UpsertMediaHash(ctx context.Context, hash *StoredMediaHash) error
+	// DeleteMediaHash - removes the hash from the bank, if it exists. Deleting an unknown hash is not an error.
+	DeleteMediaHash(ctx context.Context, communityId string, bank string, kind MediaHashKind, value string) error
+	// DeleteMediaHashesByMxcUri - removes all hashes (from all banks) which were computed from the media.
+	DeleteMediaHashesByMxcUri(ctx context.Context, communityId string, mxcUri string) error
+	// GetMediaHashes - returns all hashes for the community, oldest first.
+	GetMediaHashes(ctx context.Context, communityId string) ([]*StoredMediaHash, error)
 
 	// BeginMatrixTransaction - pulls the data required to send (over federation) a transaction of data to a destination.
 	// The caller is responsible for calling Commit() on the returned SQL Transaction to indicate that the MatrixTransaction
@@ -174,4 +424,84 @@ type PersistentStorage interface {
 	BeginMatrixTransaction(ctx context.Context, destination string) (*MatrixTransaction, Transaction, error)
 	InsertEdu(ctx context.Context, edu *StoredEdu) error // note: not an Upsert operation
 	GetDestinationsNeedingCatchup(ctx context.Context) ([]string, error)
+
+	// InsertRoomMemberJoin - records that the user joined the room at the given timestamp. If the user is already
+	// recorded as joined, the existing timestamp is kept.
+	InsertRoomMemberJoin(ctx context.Context, roomId string, userId string, joinedTimestampMillis int64) error
+	DeleteRoomMemberJoin(ctx context.Context, roomId string, userId string) error
+	// GetRoomMemberJoinTimestamp - returns the timestamp recorded by InsertRoomMemberJoin, or zero if the user is not
+	// known to be joined to the room.
+	GetRoomMemberJoinTimestamp(ctx context.Context, roomId string, userId string) (int64, error)
+
+	InsertDecision(ctx context.Context, decision *StoredDecision) error // note: not an Upsert operation
+	// GetDecisions - returns the decisions matching the query, newest first.
+	GetDecisions(ctx context.Context, query *DecisionQuery) ([]*StoredDecision, error)
+	// DeleteDecisionsBefore - removes decisions (across all communities) which were made before the given timestamp.
+	DeleteDecisionsBefore(ctx context.Context, beforeTimestampMillis int64) error
+
+	UpsertOverride(ctx context.Context, override *StoredOverride) error
+	// DeleteOverride - removes the override, if it exists. Deleting an unknown override is not an error.
+	DeleteOverride(ctx context.Context, communityId string, kind OverrideKind, value string) error
+	// GetOverrides - returns all overrides for the community, oldest first.
+	GetOverrides(ctx context.Context, communityId string) ([]*StoredOverride, error)
+
+	UpsertHellban(ctx context.Context, hellban *StoredHellban) error
+	// DeleteHellban - removes the hellban, if it exists, including its strikes. Deleting an unknown hellban is not an error.
+	DeleteHellban(ctx context.Context, communityId string, userId string) error
+	// GetHellban - returns the user's hellban in the community, or nil if there isn't one. The returned hellban may
+	// have expired.
+	GetHellban(ctx context.Context, communityId string, userId string) (*StoredHellban, error)
+	// GetActiveHellbans - returns the community's hellbans which have not yet expired, soonest expiring first.
+	GetActiveHellbans(ctx context.Context, communityId string) ([]*StoredHellban, error)
+	// DeleteHellbansExpiredBefore - removes hellbans (across all communities) which expired before the given timestamp.
+	DeleteHellbansExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error
+
+	// InsertRecentContents - stores the contents of a recently received event. Contents which are already stored are ignored.
+	InsertRecentContents(ctx context.Context, contents []*StoredRecentContent) error
+	// GetRecentContentsForEvent - returns the stored contents of the event, if any.
+	GetRecentContentsForEvent(ctx context.Context, eventId string) ([]*StoredRecentContent, error)
+	// GetRecentContentsForSender - returns the stored contents of events the user sent in the community, oldest first.
+	GetRecentContentsForSender(ctx context.Context, communityId string, sender string) ([]*StoredRecentContent, error)
+	// DeleteRecentContentsBefore - removes contents (across all communities) which were received before the given timestamp.
+	DeleteRecentContentsBefore(ctx context.Context, receivedBeforeTimestampMillis int64) error
+
+	// UpsertBlockedContents - stores the blocked contents in a single transaction, so filter sets only reload once.
+	UpsertBlockedContents(ctx context.Context, blocked []*StoredBlockedContent) error
+	// GetActiveBlockedContents - returns the community's blocked contents which have not yet expired.
+	GetActiveBlockedContents(ctx context.Context, communityId string) ([]*StoredBlockedContent, error)
+	// DeleteBlockedContentsExpiredBefore - removes blocked contents (across all communities) which expired before the given timestamp.
+	DeleteBlockedContentsExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error
+
+	UpsertRaid(ctx context.Context, raid *StoredRaid) error
+	// DeleteRaid - ends the raid, if it exists. Deleting an unknown raid is not an error.
+	DeleteRaid(ctx context.Context, communityId string, roomId string) error
+	// GetActiveRaids - returns the community's raids which have not yet expired, soonest expiring first.
+	GetActiveRaids(ctx context.Context, communityId string) ([]*StoredRaid, error)
+	// DeleteRaidsExpiredBefore - removes raids (across all communities) which expired before the given timestamp.
+	DeleteRaidsExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error
+
+	UpsertWebhookDestination(ctx context.Context, destination *StoredWebhookDestination) error
+	// DeleteWebhookDestination - removes the destination and its pending deliveries, if it exists. Deleting an unknown
+	// destination is not an error.
+	DeleteWebhookDestination(ctx context.Context, communityId string, id string) error
+	// GetWebhookDestinations - returns all webhook destinations for the community, oldest first.
+	GetWebhookDestinations(ctx context.Context, communityId string) ([]*StoredWebhookDestination, error)
+
+	UpsertWebhookDelivery(ctx context.Context, delivery *StoredWebhookDelivery) error
+	// DeleteWebhookDelivery - removes the delivery, if it exists. Deleting an unknown delivery is not an error.
+	DeleteWebhookDelivery(ctx context.Context, id string) error
+	// ClaimWebhookDeliveries - returns up to `limit` deliveries (across all communities) which are due to be attempted
+	// before the given timestamp, oldest first. The returned deliveries are not returned again until claimUntilTimestampMillis,
+	// giving the caller time to attempt them.
+	ClaimWebhookDeliveries(ctx context.Context, dueBeforeTimestampMillis int64, claimUntilTimestampMillis int64, limit int) ([]*StoredWebhookDelivery, error)
+
+	UpsertAuditRoom(ctx context.Context, room *StoredAuditRoom) error
+	// GetAuditRoom - returns the audit room, or nil if policyserv hasn't been invited to it.
+	GetAuditRoom(ctx context.Context, roomId string) (*StoredAuditRoom, error)
+	// GetCommunitiesByAuditRoomId - returns the communities which have configured the room as their audit room.
+	GetCommunitiesByAuditRoomId(ctx context.Context, roomId string) ([]*StoredCommunity, error)
+
+	// SetSpaceChildren - replaces the stored child room IDs for the given space room ID.
+	SetSpaceChildren(ctx context.Context, spaceRoomId string, childRoomIds []string) error
+	GetSpaceChildren(ctx context.Context, spaceRoomId string) ([]string, error)
 }
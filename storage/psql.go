@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"database/sql/driver"
@@ -8,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
@@ -46,31 +48,84 @@ type PostgresStorage struct {
 	learnStateCache *cache.Cache[string, error]
 
 	roomSelectAll                        *sql.Stmt
+	roomSelectByCommunityId              *sql.Stmt
 	roomSelect                           *sql.Stmt
 	roomUpsert                           *sql.Stmt
 	roomDelete                           *sql.Stmt
+	removedRoomUpsert                    *sql.Stmt
+	removedRoomDelete                    *sql.Stmt
+	removedRoomSelect                    *sql.Stmt
 	eventResultSelect                    *sql.Stmt
 	eventResultUpsert                    *sql.Stmt
+	eventResultDelete                    *sql.Stmt
 	userIdsAndDisplayNamesByRoomIdSelect *sql.Stmt
+	roomMembersSelect                    *sql.Stmt
 	banRulesSelectForRoom                *sql.Stmt
 	communityUpsert                      *sql.Stmt
 	communitySelect                      *sql.Stmt
 	communitySelectByAccessToken         *sql.Stmt
+	communitiesSelectWithSpace           *sql.Stmt
 	stateLearnQueueInsert                *sql.Stmt
 	trustDataSelect                      *sql.Stmt
 	trustDataUpsert                      *sql.Stmt
 	keywordTemplateSelect                *sql.Stmt
 	keywordTemplateUpsert                *sql.Stmt
+	communityKeywordTemplateSelect       *sql.Stmt
+	communityKeywordTemplateUpsert       *sql.Stmt
+	communityKeywordTemplateDelete       *sql.Stmt
 	mediaClassificationSelect            *sql.Stmt
 	mediaClassificationUpsert            *sql.Stmt
+	mediaClassificationsDelete           *sql.Stmt
+	mediaScoresSelect                    *sql.Stmt
+	mediaScoresUpsert                    *sql.Stmt
+	mediaHashUpsert                      *sql.Stmt
+	mediaHashDelete                      *sql.Stmt
+	mediaHashesDeleteByMxcUri            *sql.Stmt
+	mediaHashesSelect                    *sql.Stmt
 	destinationUpsert                    *sql.Stmt
 	eduInsert                            *sql.Stmt
 	destinationsNeedingCatchupSelect     *sql.Stmt
+	roomMemberJoinInsert                 *sql.Stmt
+	roomMemberJoinDelete                 *sql.Stmt
+	roomMemberJoinSelect                 *sql.Stmt
+	spaceChildrenSelect                  *sql.Stmt
+	decisionInsert                       *sql.Stmt
+	decisionsSelect                      *sql.Stmt
+	decisionsDeleteBefore                *sql.Stmt
+	overrideUpsert                       *sql.Stmt
+	overrideDelete                       *sql.Stmt
+	overridesSelect                      *sql.Stmt
+	hellbanUpsert                        *sql.Stmt
+	hellbanDelete                        *sql.Stmt
+	hellbanSelect                        *sql.Stmt
+	hellbansSelectActive                 *sql.Stmt
+	hellbansDeleteExpired                *sql.Stmt
+	recentContentInsert                  *sql.Stmt
+	recentContentsSelectForEvent         *sql.Stmt
+	recentContentsSelectForSender        *sql.Stmt
+	recentContentsDeleteBefore           *sql.Stmt
+	blockedContentUpsert                 *sql.Stmt
+	blockedContentsSelectActive          *sql.Stmt
+	blockedContentsDeleteExpired         *sql.Stmt
+	raidUpsert                           *sql.Stmt
+	raidDelete                           *sql.Stmt
+	raidsSelectActive                    *sql.Stmt
+	raidsDeleteExpired                   *sql.Stmt
+	webhookDestinationUpsert             *sql.Stmt
+	webhookDestinationDelete             *sql.Stmt
+	webhookDestinationsSelect            *sql.Stmt
+	webhookDeliveryUpsert                *sql.Stmt
+	webhookDeliveryDelete                *sql.Stmt
+	webhookDeliveriesClaim               *sql.Stmt
+	auditRoomUpsert                      *sql.Stmt
+	auditRoomSelect                      *sql.Stmt
+	communitiesSelectByAuditRoomId       *sql.Stmt
 
 	//userIdsAndDisplayNamesByRoomIdUpsert *sql.Stmt // We do the upsert manually to enter a transaction instead
 	//banRulesUpsertForRoom                *sql.Stmt // We do the upsert manually to enter a transaction instead
 	//stateLearnQueueSelect                *sql.Stmt // We do the select/delete manually to enter a transaction instead
 	//eduSelect                            *sql.Stmt // We do the select/delete manually to enter a transaction instead
+	//spaceChildrenUpsert                  *sql.Stmt // We do the upsert manually to enter a transaction instead
 }
 
 func NewPostgresStorage(config *PostgresStorageConfig) (*PostgresStorage, error) {
@@ -115,37 +170,59 @@ func (s *PostgresStorage) prepare(migrationsDir string) error {
 
 	// Now set up all the prepared statements
 	var err error
-	if s.roomSelectAll, err = s.readonlyDb.Prepare("SELECT room_id, room_version, moderator_user_id, last_state_update_ts, community_id FROM rooms"); err != nil {
+	if s.roomSelectAll, err = s.readonlyDb.Prepare("SELECT room_id, room_version, moderator_user_id, last_state_update_ts, community_id, removed_from_space FROM rooms"); err != nil {
 		return err
 	}
-	if s.roomSelect, err = s.readonlyDb.Prepare("SELECT room_id, room_version, moderator_user_id, last_state_update_ts, community_id FROM rooms WHERE room_id = $1"); err != nil {
+	if s.roomSelectByCommunityId, err = s.readonlyDb.Prepare("SELECT room_id, room_version, moderator_user_id, last_state_update_ts, community_id, removed_from_space FROM rooms WHERE community_id = $1"); err != nil {
 		return err
 	}
-	if s.roomUpsert, err = s.db.Prepare("INSERT INTO rooms (room_id, room_version, moderator_user_id, last_state_update_ts, community_id) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (room_id) DO UPDATE SET room_version = $2, moderator_user_id = $3, last_state_update_ts = $4, community_id = $5;"); err != nil {
+	if s.roomSelect, err = s.readonlyDb.Prepare("SELECT room_id, room_version, moderator_user_id, last_state_update_ts, community_id, removed_from_space FROM rooms WHERE room_id = $1"); err != nil {
+		return err
+	}
+	if s.roomUpsert, err = s.db.Prepare("INSERT INTO rooms (room_id, room_version, moderator_user_id, last_state_update_ts, community_id, removed_from_space) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (room_id) DO UPDATE SET room_version = $2, moderator_user_id = $3, last_state_update_ts = $4, community_id = $5, removed_from_space = $6;"); err != nil {
 		return err
 	}
 	if s.roomDelete, err = s.db.Prepare("DELETE FROM rooms WHERE room_id = $1;"); err != nil {
 		return err
 	}
+	if s.removedRoomUpsert, err = s.db.Prepare("INSERT INTO removed_rooms (community_id, room_id, removed_ts) VALUES ($1, $2, $3) ON CONFLICT (community_id, room_id) DO UPDATE SET removed_ts = $3;"); err != nil {
+		return err
+	}
+	if s.removedRoomDelete, err = s.db.Prepare("DELETE FROM removed_rooms WHERE community_id = $1 AND room_id = $2;"); err != nil {
+		return err
+	}
+	// Note: we use the writable database so a room removed moments ago isn't joined again by a lagging replica
+	if s.removedRoomSelect, err = s.db.Prepare("SELECT EXISTS(SELECT 1 FROM removed_rooms WHERE community_id = $1 AND room_id = $2);"); err != nil {
+		return err
+	}
 	if s.eventResultSelect, err = s.readonlyDb.Prepare("SELECT event_id, is_probably_spam, confidence_vectors FROM events WHERE event_id = $1"); err != nil {
 		return err
 	}
 	if s.eventResultUpsert, err = s.db.Prepare("INSERT INTO events (event_id, is_probably_spam, confidence_vectors) VALUES ($1, $2, $3) ON CONFLICT (event_id) DO UPDATE SET is_probably_spam = $2, confidence_vectors = $3;"); err != nil {
 		return err
 	}
+	if s.eventResultDelete, err = s.db.Prepare("DELETE FROM events WHERE event_id = $1;"); err != nil {
+		return err
+	}
 	if s.userIdsAndDisplayNamesByRoomIdSelect, err = s.readonlyDb.Prepare("SELECT user_id, displayname FROM displaynames WHERE room_id = $1"); err != nil {
 		return err
 	}
-	if s.banRulesSelectForRoom, err = s.readonlyDb.Prepare("SELECT entity_type, entity_id FROM ban_rules WHERE room_id = $1;"); err != nil {
+	if s.roomMembersSelect, err = s.readonlyDb.Prepare("SELECT user_id, displayname, avatar_url FROM displaynames WHERE room_id = $1;"); err != nil {
+		return err
+	}
+	if s.banRulesSelectForRoom, err = s.readonlyDb.Prepare("SELECT entity_type, entity_id, recommendation FROM ban_rules WHERE room_id = $1;"); err != nil {
 		return err
 	}
-	if s.communityUpsert, err = s.db.Prepare("INSERT INTO communities (id, name, config, api_access_token, can_self_join_rooms) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO UPDATE SET name = $2, config = $3, api_access_token = $4, can_self_join_rooms = $5;"); err != nil {
+	if s.communityUpsert, err = s.db.Prepare("INSERT INTO communities (id, name, config, api_access_token, can_self_join_rooms, space_room_id, webhook_secret) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO UPDATE SET name = $2, config = $3, api_access_token = $4, can_self_join_rooms = $5, space_room_id = $6, webhook_secret = $7;"); err != nil {
 		return err
 	}
-	if s.communitySelect, err = s.readonlyDb.Prepare("SELECT id, name, config, api_access_token, can_self_join_rooms FROM communities WHERE id = $1"); err != nil {
+	if s.communitySelect, err = s.readonlyDb.Prepare("SELECT id, name, config, api_access_token, can_self_join_rooms, space_room_id, webhook_secret FROM communities WHERE id = $1"); err != nil {
 		return err
 	}
-	if s.communitySelectByAccessToken, err = s.readonlyDb.Prepare("SELECT id, name, config, api_access_token, can_self_join_rooms FROM communities WHERE api_access_token = $1;"); err != nil {
+	if s.communitySelectByAccessToken, err = s.readonlyDb.Prepare("SELECT id, name, config, api_access_token, can_self_join_rooms, space_room_id, webhook_secret FROM communities WHERE api_access_token = $1;"); err != nil {
+		return err
+	}
+	if s.communitiesSelectWithSpace, err = s.readonlyDb.Prepare("SELECT id, name, config, api_access_token, can_self_join_rooms, space_room_id, webhook_secret FROM communities WHERE space_room_id != '';"); err != nil {
 		return err
 	}
 	if s.stateLearnQueueInsert, err = s.db.Prepare("INSERT INTO state_learn_queue (room_id, at_event_id, via, after_ts) VALUES ($1, $2, $3, $4) ON CONFLICT (room_id) DO NOTHING;"); err != nil {
@@ -163,10 +240,40 @@ func (s *PostgresStorage) prepare(migrationsDir string) error {
 	if s.keywordTemplateUpsert, err = s.db.Prepare("INSERT INTO keyword_templates (name, body) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET body = $2;"); err != nil {
 		return err
 	}
+	if s.communityKeywordTemplateSelect, err = s.readonlyDb.Prepare("SELECT name, body FROM community_keyword_templates WHERE community_id = $1 AND name = $2;"); err != nil {
+		return err
+	}
+	if s.communityKeywordTemplateUpsert, err = s.db.Prepare("INSERT INTO community_keyword_templates (community_id, name, body) VALUES ($1, $2, $3) ON CONFLICT (community_id, name) DO UPDATE SET body = $3;"); err != nil {
+		return err
+	}
+	if s.communityKeywordTemplateDelete, err = s.db.Prepare("DELETE FROM community_keyword_templates WHERE community_id = $1 AND name = $2;"); err != nil {
+		return err
+	}
 	if s.mediaClassificationSelect, err = s.readonlyDb.Prepare("SELECT mxc_uri, community_id, classifications FROM media_classifications WHERE mxc_uri = $1 AND community_id = $2;"); err != nil {
 		return err
 	}
-	if s.mediaClassificationUpsert, err = s.db.Prepare("INSERT INTO media_classifications (mxc_uri, community_id, classifications) VALUES ($1, $2, $3) ON CONFLICT (mxc_uri, community_id) DO UPDATE SET classifications = $3;"); err != nil {
+	if s.mediaClassificationUpsert, err = s.db.Prepare("INSERT INTO media_classifications (mxc_uri, community_id, classifications) VALUES ($1, $2, $3) ON CONFLICT (mxc_uri, community_id) WHERE model = '' DO UPDATE SET classifications = $3;"); err != nil {
+		return err
+	}
+	if s.mediaClassificationsDelete, err = s.db.Prepare("DELETE FROM media_classifications WHERE community_id = $1;"); err != nil {
+		return err
+	}
+	if s.mediaScoresSelect, err = s.readonlyDb.Prepare("SELECT mxc_uri, model, category_scores, size_bytes, mime_type FROM media_classifications WHERE mxc_uri = $1 AND model = $2 AND model <> '';"); err != nil {
+		return err
+	}
+	if s.mediaScoresUpsert, err = s.db.Prepare("INSERT INTO media_classifications (mxc_uri, model, category_scores, size_bytes, mime_type) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (mxc_uri, model) WHERE model <> '' DO UPDATE SET category_scores = $3, size_bytes = $4, mime_type = $5;"); err != nil {
+		return err
+	}
+	if s.mediaHashUpsert, err = s.db.Prepare("INSERT INTO media_hashes (community_id, bank, kind, value, mxc_uri, reason, created_ts) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (community_id, bank, kind, value) DO UPDATE SET mxc_uri = $5, reason = $6, created_ts = $7;"); err != nil {
+		return err
+	}
+	if s.mediaHashDelete, err = s.db.Prepare("DELETE FROM media_hashes WHERE community_id = $1 AND bank = $2 AND kind = $3 AND value = $4;"); err != nil {
+		return err
+	}
+	if s.mediaHashesDeleteByMxcUri, err = s.db.Prepare("DELETE FROM media_hashes WHERE community_id = $1 AND mxc_uri = $2;"); err != nil {
+		return err
+	}
+	if s.mediaHashesSelect, err = s.readonlyDb.Prepare("SELECT community_id, bank, kind, value, mxc_uri, reason, created_ts FROM media_hashes WHERE community_id = $1 ORDER BY created_ts ASC;"); err != nil {
 		return err
 	}
 	if s.destinationUpsert, err = s.db.Prepare("INSERT INTO destinations (destination) VALUES ($1) ON CONFLICT (destination) DO NOTHING;"); err != nil {
@@ -182,6 +289,122 @@ func (s *PostgresStorage) prepare(migrationsDir string) error {
 	if s.destinationsNeedingCatchupSelect, err = s.db.Prepare("SELECT DISTINCT sub.destination FROM (SELECT destination FROM destination_edus FOR UPDATE SKIP LOCKED) AS sub;"); err != nil {
 		return err
 	}
+	if s.roomMemberJoinInsert, err = s.db.Prepare("INSERT INTO room_member_joins (room_id, user_id, joined_ts) VALUES ($1, $2, $3) ON CONFLICT (room_id, user_id) DO NOTHING;"); err != nil {
+		return err
+	}
+	if s.roomMemberJoinDelete, err = s.db.Prepare("DELETE FROM room_member_joins WHERE room_id = $1 AND user_id = $2;"); err != nil {
+		return err
+	}
+	if s.roomMemberJoinSelect, err = s.readonlyDb.Prepare("SELECT joined_ts FROM room_member_joins WHERE room_id = $1 AND user_id = $2;"); err != nil {
+		return err
+	}
+	if s.spaceChildrenSelect, err = s.readonlyDb.Prepare("SELECT child_room_id FROM space_children WHERE space_room_id = $1;"); err != nil {
+		return err
+	}
+	if s.decisionInsert, err = s.db.Prepare("INSERT INTO decisions (event_id, community_id, room_id, sender, event_type, filter_responses, shadow_filter_responses, classifications, duration_ms, decided_ts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;"); err != nil {
+		return err
+	}
+	// Filters which aren't in use are given zero values by GetDecisions, so we ignore them here. This is a bit more
+	// awkward to read than building the query dynamically, but lets us use a prepared statement.
+	if s.decisionsSelect, err = s.readonlyDb.Prepare("SELECT id, event_id, community_id, room_id, sender, event_type, filter_responses, shadow_filter_responses, classifications, duration_ms, decided_ts FROM decisions WHERE community_id = $1 AND ($2::text = '' OR event_id = $2) AND ($3::text = '' OR room_id = $3) AND ($4::text = '' OR sender = $4) AND ($5::text = '' OR classifications @> jsonb_build_array($5::text)) AND ($6::bigint = 0 OR decided_ts >= $6) AND ($7::bigint = 0 OR decided_ts < $7) AND ($8::bigint = 0 OR id < $8) ORDER BY id DESC LIMIT $9;"); err != nil {
+		return err
+	}
+	if s.decisionsDeleteBefore, err = s.db.Prepare("DELETE FROM decisions WHERE decided_ts < $1;"); err != nil {
+		return err
+	}
+	if s.overrideUpsert, err = s.db.Prepare("INSERT INTO overrides (community_id, kind, value, reason, created_ts) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (community_id, kind, value) DO UPDATE SET reason = $4, created_ts = $5;"); err != nil {
+		return err
+	}
+	if s.overrideDelete, err = s.db.Prepare("DELETE FROM overrides WHERE community_id = $1 AND kind = $2 AND value = $3;"); err != nil {
+		return err
+	}
+	if s.overridesSelect, err = s.readonlyDb.Prepare("SELECT community_id, kind, value, reason, created_ts FROM overrides WHERE community_id = $1 ORDER BY created_ts ASC;"); err != nil {
+		return err
+	}
+	if s.hellbanUpsert, err = s.db.Prepare("INSERT INTO hellbans (community_id, user_id, expires_ts, strikes) VALUES ($1, $2, $3, $4) ON CONFLICT (community_id, user_id) DO UPDATE SET expires_ts = $3, strikes = $4;"); err != nil {
+		return err
+	}
+	if s.hellbanDelete, err = s.db.Prepare("DELETE FROM hellbans WHERE community_id = $1 AND user_id = $2;"); err != nil {
+		return err
+	}
+	// Note: we use the writable database for hellbans because the postfilter reads them back immediately
+	if s.hellbanSelect, err = s.db.Prepare("SELECT community_id, user_id, expires_ts, strikes FROM hellbans WHERE community_id = $1 AND user_id = $2;"); err != nil {
+		return err
+	}
+	if s.hellbansSelectActive, err = s.readonlyDb.Prepare("SELECT community_id, user_id, expires_ts, strikes FROM hellbans WHERE community_id = $1 AND expires_ts > $2 ORDER BY expires_ts ASC;"); err != nil {
+		return err
+	}
+	if s.hellbansDeleteExpired, err = s.db.Prepare("DELETE FROM hellbans WHERE expires_ts < $1;"); err != nil {
+		return err
+	}
+	if s.recentContentInsert, err = s.db.Prepare("INSERT INTO recent_contents (event_id, community_id, room_id, sender, kind, value, received_ts) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (event_id, kind, value) DO NOTHING;"); err != nil {
+		return err
+	}
+	// Note: we use the writable database for recent contents because moderators can act on an event moments after it arrives
+	if s.recentContentsSelectForEvent, err = s.db.Prepare("SELECT event_id, community_id, room_id, sender, kind, value, received_ts FROM recent_contents WHERE event_id = $1;"); err != nil {
+		return err
+	}
+	if s.recentContentsSelectForSender, err = s.db.Prepare("SELECT event_id, community_id, room_id, sender, kind, value, received_ts FROM recent_contents WHERE community_id = $1 AND sender = $2 ORDER BY received_ts ASC;"); err != nil {
+		return err
+	}
+	if s.recentContentsDeleteBefore, err = s.db.Prepare("DELETE FROM recent_contents WHERE received_ts < $1;"); err != nil {
+		return err
+	}
+	if s.blockedContentUpsert, err = s.db.Prepare("INSERT INTO blocked_contents (community_id, kind, value, event_id, expires_ts) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (community_id, kind, value) DO UPDATE SET event_id = $4, expires_ts = $5;"); err != nil {
+		return err
+	}
+	if s.blockedContentsSelectActive, err = s.readonlyDb.Prepare("SELECT community_id, kind, value, event_id, expires_ts FROM blocked_contents WHERE community_id = $1 AND expires_ts > $2;"); err != nil {
+		return err
+	}
+	if s.blockedContentsDeleteExpired, err = s.db.Prepare("DELETE FROM blocked_contents WHERE expires_ts < $1;"); err != nil {
+		return err
+	}
+	if s.raidUpsert, err = s.db.Prepare("INSERT INTO raids (community_id, room_id, started_ts, expires_ts, is_manual) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (community_id, room_id) DO UPDATE SET started_ts = $3, expires_ts = $4, is_manual = $5;"); err != nil {
+		return err
+	}
+	if s.raidDelete, err = s.db.Prepare("DELETE FROM raids WHERE community_id = $1 AND room_id = $2;"); err != nil {
+		return err
+	}
+	// Note: we use the writable database for raids because filters reload them as soon as they're notified of a change
+	if s.raidsSelectActive, err = s.db.Prepare("SELECT community_id, room_id, started_ts, expires_ts, is_manual FROM raids WHERE community_id = $1 AND expires_ts > $2 ORDER BY expires_ts ASC;"); err != nil {
+		return err
+	}
+	if s.raidsDeleteExpired, err = s.db.Prepare("DELETE FROM raids WHERE expires_ts < $1;"); err != nil {
+		return err
+	}
+	if s.webhookDestinationUpsert, err = s.db.Prepare("INSERT INTO webhook_destinations (id, community_id, url, event_types, created_ts) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO UPDATE SET url = $3, event_types = $4;"); err != nil {
+		return err
+	}
+	// Note: pending deliveries are removed by the `ON DELETE CASCADE` on webhook_deliveries
+	if s.webhookDestinationDelete, err = s.db.Prepare("DELETE FROM webhook_destinations WHERE community_id = $1 AND id = $2;"); err != nil {
+		return err
+	}
+	// Note: we use the writable database for webhook destinations because they're read on every decision, and a
+	// destination should start receiving payloads as soon as it's added.
+	if s.webhookDestinationsSelect, err = s.db.Prepare("SELECT id, community_id, url, event_types, created_ts FROM webhook_destinations WHERE community_id = $1 ORDER BY created_ts ASC;"); err != nil {
+		return err
+	}
+	if s.webhookDeliveryUpsert, err = s.db.Prepare("INSERT INTO webhook_deliveries (id, destination_id, community_id, url, payload, attempts, next_attempt_ts, last_error, created_ts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (id) DO UPDATE SET attempts = $6, next_attempt_ts = $7, last_error = $8;"); err != nil {
+		return err
+	}
+	if s.webhookDeliveryDelete, err = s.db.Prepare("DELETE FROM webhook_deliveries WHERE id = $1;"); err != nil {
+		return err
+	}
+	// Like destinationsNeedingCatchupSelect, `FOR UPDATE SKIP LOCKED` stops two processes from claiming the same deliveries.
+	// The claim itself is just pushing next_attempt_ts forwards, so a process which dies mid-delivery doesn't lose anything.
+	if s.webhookDeliveriesClaim, err = s.db.Prepare("UPDATE webhook_deliveries SET next_attempt_ts = $2 WHERE id IN (SELECT id FROM webhook_deliveries WHERE next_attempt_ts <= $1 ORDER BY next_attempt_ts ASC LIMIT $3 FOR UPDATE SKIP LOCKED) RETURNING id, destination_id, community_id, url, payload, attempts, next_attempt_ts, last_error, created_ts;"); err != nil {
+		return err
+	}
+	if s.auditRoomUpsert, err = s.db.Prepare("INSERT INTO audit_rooms (room_id, room_version, via, servers, create_event_id, power_levels_event_id, member_event_id, prev_event_ids, depth) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (room_id) DO UPDATE SET room_version = $2, via = $3, servers = $4, create_event_id = $5, power_levels_event_id = $6, member_event_id = $7, prev_event_ids = $8, depth = $9;"); err != nil {
+		return err
+	}
+	// Note: we use the writable database for audit rooms because the prev events change with every message we send
+	if s.auditRoomSelect, err = s.db.Prepare("SELECT room_id, room_version, via, servers, create_event_id, power_levels_event_id, member_event_id, prev_event_ids, depth FROM audit_rooms WHERE room_id = $1;"); err != nil {
+		return err
+	}
+	if s.communitiesSelectByAuditRoomId, err = s.readonlyDb.Prepare("SELECT id, name, config, api_access_token, can_self_join_rooms, space_room_id, webhook_secret FROM communities WHERE config->>'audit_room_id' = $1;"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -219,7 +442,33 @@ func (s *PostgresStorage) GetAllRooms(ctx context.Context) ([]*StoredRoom, error
 	var rooms []*StoredRoom
 	for rows.Next() {
 		room := &StoredRoom{}
-		err = rows.Scan(&room.RoomId, &room.RoomVersion, &room.ModeratorUserId, &room.LastCachedStateTimestampMillis, &room.CommunityId)
+		err = rows.Scan(&room.RoomId, &room.RoomVersion, &room.ModeratorUserId, &room.LastCachedStateTimestampMillis, &room.CommunityId, &room.RemovedFromSpace)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	return rooms, nil
+}
+
+func (s *PostgresStorage) GetRoomsByCommunityId(ctx context.Context, communityId string) ([]*StoredRoom, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetRoomsByCommunityId")
+	defer t.ObserveDuration()
+
+	rows, err := s.roomSelectByCommunityId.QueryContext(ctx, communityId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredRoom, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := make([]*StoredRoom, 0)
+	for rows.Next() {
+		room := &StoredRoom{}
+		err = rows.Scan(&room.RoomId, &room.RoomVersion, &room.ModeratorUserId, &room.LastCachedStateTimestampMillis, &room.CommunityId, &room.RemovedFromSpace)
 		if err != nil {
 			return nil, err
 		}
@@ -234,7 +483,7 @@ func (s *PostgresStorage) GetRoom(ctx context.Context, roomId string) (*StoredRo
 	defer t.ObserveDuration()
 
 	room := &StoredRoom{}
-	if err := s.roomSelect.QueryRowContext(ctx, roomId).Scan(&room.RoomId, &room.RoomVersion, &room.ModeratorUserId, &room.LastCachedStateTimestampMillis, &room.CommunityId); err != nil {
+	if err := s.roomSelect.QueryRowContext(ctx, roomId).Scan(&room.RoomId, &room.RoomVersion, &room.ModeratorUserId, &room.LastCachedStateTimestampMillis, &room.CommunityId, &room.RemovedFromSpace); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -249,7 +498,7 @@ func (s *PostgresStorage) UpsertRoom(ctx context.Context, room *StoredRoom) erro
 
 	// Note: due to the `ps_room_community_change` trigger, we don't need to `NOTIFY policyserv_room_community_id_changed` here when the community ID changes.
 
-	_, err := s.roomUpsert.ExecContext(ctx, room.RoomId, room.RoomVersion, room.ModeratorUserId, room.LastCachedStateTimestampMillis, room.CommunityId)
+	_, err := s.roomUpsert.ExecContext(ctx, room.RoomId, room.RoomVersion, room.ModeratorUserId, room.LastCachedStateTimestampMillis, room.CommunityId, room.RemovedFromSpace)
 	if err != nil {
 		return err
 	}
@@ -260,11 +509,64 @@ func (s *PostgresStorage) DeleteRoom(ctx context.Context, roomId string) error {
 	t := dbmetrics.StartSelfDatabaseTimer("DeleteRoom")
 	defer t.ObserveDuration()
 
-	_, err := s.roomDelete.ExecContext(ctx, roomId)
+	txn, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer txn.Rollback() // no-op if committed
+
+	// Clear everything we've learned about the room, so it starts fresh if it's ever protected again. Trust sources
+	// which store data about a room do so under the room ID. Event results and decisions are deliberately kept.
+	for _, query := range []string{
+		"DELETE FROM displaynames WHERE room_id = $1;",
+		"DELETE FROM ban_rules WHERE room_id = $1;",
+		"DELETE FROM room_member_joins WHERE room_id = $1;",
+		"DELETE FROM space_children WHERE space_room_id = $1;",
+		"DELETE FROM state_learn_queue WHERE room_id = $1;",
+		"DELETE FROM trust_data WHERE key = $1;",
+	} {
+		if _, err = txn.ExecContext(ctx, query, roomId); err != nil {
+			return err
+		}
+	}
+
+	// Remember that the room was removed, so the community's space sync doesn't join it again
+	_, err = txn.ExecContext(ctx, "INSERT INTO removed_rooms (community_id, room_id, removed_ts) SELECT community_id, room_id, $2 FROM rooms WHERE room_id = $1 ON CONFLICT (community_id, room_id) DO UPDATE SET removed_ts = $2;", roomId, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	// Note: due to the `ps_room_delete` trigger, we don't need to `NOTIFY policyserv_room_community_id_changed` here.
+	_, err = txn.StmtContext(ctx, s.roomDelete).ExecContext(ctx, roomId)
+	if err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+func (s *PostgresStorage) UpsertRemovedRoom(ctx context.Context, communityId string, roomId string, removedTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertRemovedRoom")
+	defer t.ObserveDuration()
+
+	_, err := s.removedRoomUpsert.ExecContext(ctx, communityId, roomId, removedTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) DeleteRemovedRoom(ctx context.Context, communityId string, roomId string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteRemovedRoom")
+	defer t.ObserveDuration()
+
+	_, err := s.removedRoomDelete.ExecContext(ctx, communityId, roomId)
+	return err
+}
+
+func (s *PostgresStorage) IsRoomRemoved(ctx context.Context, communityId string, roomId string) (bool, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("IsRoomRemoved")
+	defer t.ObserveDuration()
+
+	var removed bool
+	err := s.removedRoomSelect.QueryRowContext(ctx, communityId, roomId).Scan(&removed)
+	return removed, err
 }
 
 func (s *PostgresStorage) GetEventResult(ctx context.Context, eventId string) (*StoredEventResult, error) {
@@ -305,8 +607,9 @@ func (s *PostgresStorage) GetEventResult(ctx context.Context, eventId string) (*
 		if wasAllowed && len(harmIds) == 0 {
 			// an event's content info can only be "allowed" if no other harms were found
 			eventResult.ContentInfo = harms.AllowedContent()
+		} else {
+			eventResult.ContentInfo = harms.ProhibitedContent(harmIds...)
 		}
-		eventResult.ContentInfo = harms.ProhibitedContent(harmIds...)
 	} else {
 		eventResult.ContentInfo = harms.NeutralContent()
 	}
@@ -347,6 +650,14 @@ func (s *PostgresStorage) UpsertEventResult(ctx context.Context, event *StoredEv
 	return nil
 }
 
+func (s *PostgresStorage) DeleteEventResult(ctx context.Context, eventId string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteEventResult")
+	defer t.ObserveDuration()
+
+	_, err := s.eventResultDelete.ExecContext(ctx, eventId)
+	return err
+}
+
 func (s *PostgresStorage) GetUserIdsAndDisplayNamesByRoomId(ctx context.Context, roomId string) ([]string, []string, error) {
 	t := dbmetrics.StartSelfDatabaseTimer("GetUserIdsAndDisplayNamesByRoomId")
 	defer t.ObserveDuration()
@@ -396,6 +707,49 @@ func (s *PostgresStorage) SetUserIdsAndDisplayNamesByRoomId(ctx context.Context,
 	return txn.Commit()
 }
 
+func (s *PostgresStorage) GetRoomMembers(ctx context.Context, roomId string) ([]*StoredRoomMember, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetRoomMembers")
+	defer t.ObserveDuration()
+
+	rows, err := s.roomMembersSelect.QueryContext(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]*StoredRoomMember, 0)
+	for rows.Next() {
+		member := &StoredRoomMember{}
+		if err = rows.Scan(&member.UserId, &member.DisplayName, &member.AvatarUrl); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (s *PostgresStorage) SetRoomMembers(ctx context.Context, roomId string, members []*StoredRoomMember) error {
+	t := dbmetrics.StartSelfDatabaseTimer("SetRoomMembers")
+	defer t.ObserveDuration()
+
+	txn, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback() // no-op if committed
+
+	if _, err = txn.ExecContext(ctx, "DELETE FROM displaynames WHERE room_id = $1;", roomId); err != nil {
+		return err
+	}
+	for _, member := range members {
+		if _, err = txn.ExecContext(ctx, "INSERT INTO displaynames (room_id, user_id, displayname, avatar_url) VALUES ($1, $2, $3, $4);", roomId, member.UserId, member.DisplayName, member.AvatarUrl); err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
 func (s *PostgresStorage) IsUserBannedInList(ctx context.Context, listRoomId string, userId string) (bool, error) {
 	t := dbmetrics.StartSelfDatabaseTimer("IsUserBannedInList")
 	defer t.ObserveDuration()
@@ -405,25 +759,22 @@ func (s *PostgresStorage) IsUserBannedInList(ctx context.Context, listRoomId str
 		return false, err
 	}
 
-	rows, err := s.banRulesSelectForRoom.QueryContext(ctx, listRoomId)
+	rules, err := s.GetListRules(ctx, listRoomId)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
-		}
 		return false, err
 	}
-	for rows.Next() {
-		var entityType string
-		var entityId string
-		if err = rows.Scan(&entityType, &entityId); err != nil {
-			return false, err
+	for _, rule := range rules {
+		if rule.Recommendation != "m.ban" {
+			continue
 		}
 		entity := parsedUserId.String()
-		if entityType == "m.policy.rule.server" {
+		if rule.EntityType == "m.policy.rule.server" {
 			entity = string(parsedUserId.Domain())
+		} else if rule.EntityType != "m.policy.rule.user" {
+			continue
 		}
-		if glob.Glob(entityId, entity) {
-			log.Println("User", userId, "is banned via list", listRoomId, "with rule", entityId, " (entity type:", entityType, ")")
+		if glob.Glob(rule.Entity, entity) {
+			log.Println("User", userId, "is banned via list", listRoomId, "with rule", rule.Entity, " (entity type:", rule.EntityType, ")")
 			return true, nil
 		}
 	}
@@ -431,8 +782,32 @@ func (s *PostgresStorage) IsUserBannedInList(ctx context.Context, listRoomId str
 	return false, nil
 }
 
-func (s *PostgresStorage) SetListBanRules(ctx context.Context, listRoomId string, entityToEntityType map[string]string) error {
-	t := dbmetrics.StartSelfDatabaseTimer("SetListBanRules")
+func (s *PostgresStorage) GetListRules(ctx context.Context, listRoomId string) ([]*StoredListRule, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetListRules")
+	defer t.ObserveDuration()
+
+	rows, err := s.banRulesSelectForRoom.QueryContext(ctx, listRoomId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredListRule, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]*StoredListRule, 0)
+	for rows.Next() {
+		rule := &StoredListRule{}
+		if err = rows.Scan(&rule.EntityType, &rule.Entity, &rule.Recommendation); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (s *PostgresStorage) SetListRules(ctx context.Context, listRoomId string, rules []*StoredListRule) error {
+	t := dbmetrics.StartSelfDatabaseTimer("SetListRules")
 	defer t.ObserveDuration()
 
 	txn, err := s.db.Begin()
@@ -444,8 +819,8 @@ func (s *PostgresStorage) SetListBanRules(ctx context.Context, listRoomId string
 	if _, err = txn.Exec("DELETE FROM ban_rules WHERE room_id = $1;", listRoomId); err != nil {
 		return err
 	}
-	for entity, entityType := range entityToEntityType {
-		if _, err = txn.Exec("INSERT INTO ban_rules (room_id, entity_type, entity_id) VALUES ($1, $2, $3);", listRoomId, entityType, entity); err != nil {
+	for _, rule := range rules {
+		if _, err = txn.Exec("INSERT INTO ban_rules (room_id, entity_type, entity_id, recommendation) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;", listRoomId, rule.EntityType, rule.Entity, rule.Recommendation); err != nil {
 			return err
 		}
 	}
@@ -469,6 +844,8 @@ func (s *PostgresStorage) CreateCommunity(ctx context.Context, name string) (*St
 		community.Config,
 		community.ApiAccessToken,
 		community.CanSelfJoinRooms,
+		community.SpaceRoomId,
+		community.WebhookSecret,
 	)
 	if err != nil {
 		return nil, err
@@ -489,6 +866,8 @@ func (s *PostgresStorage) UpsertCommunity(ctx context.Context, community *Stored
 		community.Config,
 		community.ApiAccessToken,
 		community.CanSelfJoinRooms,
+		community.SpaceRoomId,
+		community.WebhookSecret,
 	)
 	if err != nil {
 		return err
@@ -507,6 +886,8 @@ func (s *PostgresStorage) GetCommunity(ctx context.Context, communityId string)
 		&community.Config,
 		&community.ApiAccessToken,
 		&community.CanSelfJoinRooms,
+		&community.SpaceRoomId,
+		&community.WebhookSecret,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -527,6 +908,8 @@ func (s *PostgresStorage) GetCommunityByAccessToken(ctx context.Context, accessT
 		&community.Config,
 		&community.ApiAccessToken,
 		&community.CanSelfJoinRooms,
+		&community.SpaceRoomId,
+		&community.WebhookSecret,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -536,6 +919,36 @@ func (s *PostgresStorage) GetCommunityByAccessToken(ctx context.Context, accessT
 	return community, nil
 }
 
+func (s *PostgresStorage) GetCommunitiesWithSpaces(ctx context.Context) ([]*StoredCommunity, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetCommunitiesWithSpaces")
+	defer t.ObserveDuration()
+
+	rows, err := s.communitiesSelectWithSpace.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	communities := make([]*StoredCommunity, 0)
+	for rows.Next() {
+		community := &StoredCommunity{}
+		err = rows.Scan(
+			&community.CommunityId,
+			&community.Name,
+			&community.Config,
+			&community.ApiAccessToken,
+			&community.CanSelfJoinRooms,
+			&community.SpaceRoomId,
+			&community.WebhookSecret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, community)
+	}
+	return communities, rows.Err()
+}
+
 func (s *PostgresStorage) PushStateLearnQueue(ctx context.Context, item *StateLearnQueueItem) error {
 	t := dbmetrics.StartSelfDatabaseTimer("PushStateLearnQueue")
 	defer t.ObserveDuration()
@@ -633,6 +1046,35 @@ func (s *PostgresStorage) GetKeywordTemplate(ctx context.Context, name string) (
 	return val, nil
 }
 
+func (s *PostgresStorage) UpsertCommunityKeywordTemplate(ctx context.Context, communityId string, template *StoredKeywordTemplate) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertCommunityKeywordTemplate")
+	defer t.ObserveDuration()
+
+	_, err := s.communityKeywordTemplateUpsert.ExecContext(ctx, communityId, template.Name, template.Body)
+	return err
+}
+
+func (s *PostgresStorage) DeleteCommunityKeywordTemplate(ctx context.Context, communityId string, name string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteCommunityKeywordTemplate")
+	defer t.ObserveDuration()
+
+	_, err := s.communityKeywordTemplateDelete.ExecContext(ctx, communityId, name)
+	return err
+}
+
+func (s *PostgresStorage) GetCommunityKeywordTemplate(ctx context.Context, communityId string, name string) (*StoredKeywordTemplate, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetCommunityKeywordTemplate")
+	defer t.ObserveDuration()
+
+	r := s.communityKeywordTemplateSelect.QueryRowContext(ctx, communityId, name)
+	val := &StoredKeywordTemplate{}
+	err := r.Scan(&val.Name, &val.Body)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
 func (s *PostgresStorage) UpsertMediaClassification(ctx context.Context, mediaClassification *StoredMediaClassification) error {
 	t := dbmetrics.StartSelfDatabaseTimer("UpsertMediaClassification")
 	defer t.ObserveDuration()
@@ -654,31 +1096,128 @@ func (s *PostgresStorage) GetMediaClassification(ctx context.Context, mxcUri str
 	return val, nil
 }
 
-func (s *PostgresStorage) InsertEdu(ctx context.Context, edu *StoredEdu) error {
-	t := dbmetrics.StartSelfDatabaseTimer("UpsertEdu")
+func (s *PostgresStorage) DeleteMediaClassifications(ctx context.Context, communityId string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteMediaClassifications")
 	defer t.ObserveDuration()
 
-	// We need to do two things: ensure the destination exists and insert the EDU. We don't need to do this in a transaction
-	// because the destination can exist with zero or more EDUs (meaning inserting the EDU can fail, but inserting the
-	// destination can't).
-
-	_, err := s.destinationUpsert.ExecContext(ctx, edu.Destination)
-	if err != nil {
-		return err
-	}
-
-	// The insert will also cause a pg_notify back to policyserv to actually prepare/send the transaction
-	wrappedPayload := &psqlEduPayload{edu.Payload}
-	_, err = s.eduInsert.ExecContext(ctx, edu.Destination, wrappedPayload)
+	_, err := s.mediaClassificationsDelete.ExecContext(ctx, communityId)
 	return err
 }
 
-func (s *PostgresStorage) BeginMatrixTransaction(ctx context.Context, destination string) (*MatrixTransaction, Transaction, error) {
-	t := dbmetrics.StartSelfDatabaseTimer("BeginMatrixTransaction")
+func (s *PostgresStorage) UpsertMediaScores(ctx context.Context, scores *StoredMediaScores) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertMediaScores")
 	defer t.ObserveDuration()
 
-	txn, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
+	var categoryScores []byte // null for skipped media
+	if scores.CategoryScores != nil {
+		var err error
+		if categoryScores, err = json.Marshal(scores.CategoryScores); err != nil {
+			return err
+		}
+	}
+	_, err := s.mediaScoresUpsert.ExecContext(ctx, scores.MxcUri, scores.Model, categoryScores, scores.SizeBytes, scores.MimeType)
+	return err
+}
+
+func (s *PostgresStorage) GetMediaScores(ctx context.Context, mxcUri string, model string) (*StoredMediaScores, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetMediaScores")
+	defer t.ObserveDuration()
+
+	val := &StoredMediaScores{}
+	categoryScores := make([]byte, 0)
+	sizeBytes := sql.NullInt64{}
+	mimeType := sql.NullString{}
+	err := s.mediaScoresSelect.QueryRowContext(ctx, mxcUri, model).Scan(&val.MxcUri, &val.Model, &categoryScores, &sizeBytes, &mimeType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if categoryScores != nil {
+		if err = json.Unmarshal(categoryScores, &val.CategoryScores); err != nil {
+			return nil, err
+		}
+	}
+	val.SizeBytes = sizeBytes.Int64
+	val.MimeType = mimeType.String
+	return val, nil
+}
+
+func (s *PostgresStorage) UpsertMediaHash(ctx context.Context, hash *StoredMediaHash) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertMediaHash")
+	defer t.ObserveDuration()
+
+	_, err := s.mediaHashUpsert.ExecContext(ctx, hash.CommunityId, hash.Bank, string(hash.Kind), hash.Value, hash.MxcUri, hash.Reason, hash.CreatedTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) DeleteMediaHash(ctx context.Context, communityId string, bank string, kind MediaHashKind, value string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteMediaHash")
+	defer t.ObserveDuration()
+
+	_, err := s.mediaHashDelete.ExecContext(ctx, communityId, bank, string(kind), value)
+	return err
+}
+
+func (s *PostgresStorage) DeleteMediaHashesByMxcUri(ctx context.Context, communityId string, mxcUri string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteMediaHashesByMxcUri")
+	defer t.ObserveDuration()
+
+	_, err := s.mediaHashesDeleteByMxcUri.ExecContext(ctx, communityId, mxcUri)
+	return err
+}
+
+func (s *PostgresStorage) GetMediaHashes(ctx context.Context, communityId string) ([]*StoredMediaHash, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetMediaHashes")
+	defer t.ObserveDuration()
+
+	rows, err := s.mediaHashesSelect.QueryContext(ctx, communityId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredMediaHash, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make([]*StoredMediaHash, 0)
+	for rows.Next() {
+		hash := &StoredMediaHash{}
+		err = rows.Scan(&hash.CommunityId, &hash.Bank, &hash.Kind, &hash.Value, &hash.MxcUri, &hash.Reason, &hash.CreatedTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+func (s *PostgresStorage) InsertEdu(ctx context.Context, edu *StoredEdu) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertEdu")
+	defer t.ObserveDuration()
+
+	// We need to do two things: ensure the destination exists and insert the EDU. We don't need to do this in a transaction
+	// because the destination can exist with zero or more EDUs (meaning inserting the EDU can fail, but inserting the
+	// destination can't).
+
+	_, err := s.destinationUpsert.ExecContext(ctx, edu.Destination)
+	if err != nil {
+		return err
+	}
+
+	// The insert will also cause a pg_notify back to policyserv to actually prepare/send the transaction
+	wrappedPayload := &psqlEduPayload{edu.Payload}
+	_, err = s.eduInsert.ExecContext(ctx, edu.Destination, wrappedPayload)
+	return err
+}
+
+func (s *PostgresStorage) BeginMatrixTransaction(ctx context.Context, destination string) (*MatrixTransaction, Transaction, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("BeginMatrixTransaction")
+	defer t.ObserveDuration()
+
+	txn, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -752,6 +1291,142 @@ func (s *PostgresStorage) GetDestinationsNeedingCatchup(ctx context.Context) ([]
 	return destinations, nil
 }
 
+func (s *PostgresStorage) InsertRoomMemberJoin(ctx context.Context, roomId string, userId string, joinedTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("InsertRoomMemberJoin")
+	defer t.ObserveDuration()
+
+	_, err := s.roomMemberJoinInsert.ExecContext(ctx, roomId, userId, joinedTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) DeleteRoomMemberJoin(ctx context.Context, roomId string, userId string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteRoomMemberJoin")
+	defer t.ObserveDuration()
+
+	_, err := s.roomMemberJoinDelete.ExecContext(ctx, roomId, userId)
+	return err
+}
+
+func (s *PostgresStorage) GetRoomMemberJoinTimestamp(ctx context.Context, roomId string, userId string) (int64, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetRoomMemberJoinTimestamp")
+	defer t.ObserveDuration()
+
+	var ts int64
+	err := s.roomMemberJoinSelect.QueryRowContext(ctx, roomId, userId).Scan(&ts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return ts, nil
+}
+
+func (s *PostgresStorage) SetSpaceChildren(ctx context.Context, spaceRoomId string, childRoomIds []string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("SetSpaceChildren")
+	defer t.ObserveDuration()
+
+	txn, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if _, err = txn.Exec("DELETE FROM space_children WHERE space_room_id = $1;", spaceRoomId); err != nil {
+		return err
+	}
+	for _, childRoomId := range childRoomIds {
+		if _, err = txn.Exec("INSERT INTO space_children (space_room_id, child_room_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;", spaceRoomId, childRoomId); err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func (s *PostgresStorage) GetSpaceChildren(ctx context.Context, spaceRoomId string) ([]string, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetSpaceChildren")
+	defer t.ObserveDuration()
+
+	rows, err := s.spaceChildrenSelect.QueryContext(ctx, spaceRoomId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]string, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	childRoomIds := make([]string, 0)
+	for rows.Next() {
+		var childRoomId string
+		if err = rows.Scan(&childRoomId); err != nil {
+			return nil, err
+		}
+		childRoomIds = append(childRoomIds, childRoomId)
+	}
+	return childRoomIds, nil
+}
+
+func (s *PostgresStorage) InsertDecision(ctx context.Context, decision *StoredDecision) error {
+	t := dbmetrics.StartSelfDatabaseTimer("InsertDecision")
+	defer t.ObserveDuration()
+
+	filterResponses, err := json.Marshal(decision.FilterResponses)
+	if err != nil {
+		return err
+	}
+	shadowFilterResponses, err := json.Marshal(decision.ShadowFilterResponses)
+	if err != nil {
+		return err
+	}
+	classifications := StoredClassifications{decision.ContentInfo}
+	return s.decisionInsert.QueryRowContext(ctx, decision.EventId, decision.CommunityId, decision.RoomId, decision.SenderUserId, decision.EventType, filterResponses, shadowFilterResponses, classifications, decision.DurationMillis, decision.DecidedTimestampMillis).Scan(&decision.Id)
+}
+
+func (s *PostgresStorage) GetDecisions(ctx context.Context, query *DecisionQuery) ([]*StoredDecision, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetDecisions")
+	defer t.ObserveDuration()
+
+	rows, err := s.decisionsSelect.QueryContext(ctx, query.CommunityId, query.EventId, query.RoomId, query.SenderUserId, string(query.Harm), query.SinceTimestampMillis, query.UntilTimestampMillis, query.BeforeId, query.Limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredDecision, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := make([]*StoredDecision, 0)
+	for rows.Next() {
+		decision := &StoredDecision{}
+		var filterResponses []byte
+		var shadowFilterResponses []byte
+		classifications := &StoredClassifications{}
+		err = rows.Scan(&decision.Id, &decision.EventId, &decision.CommunityId, &decision.RoomId, &decision.SenderUserId, &decision.EventType, &filterResponses, &shadowFilterResponses, classifications, &decision.DurationMillis, &decision.DecidedTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(filterResponses, &decision.FilterResponses); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(shadowFilterResponses, &decision.ShadowFilterResponses); err != nil {
+			return nil, err
+		}
+		decision.ContentInfo = classifications.ContentInfo
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+func (s *PostgresStorage) DeleteDecisionsBefore(ctx context.Context, beforeTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteDecisionsBefore")
+	defer t.ObserveDuration()
+
+	_, err := s.decisionsDeleteBefore.ExecContext(ctx, beforeTimestampMillis)
+	return err
+}
+
 // Deduplicates strings given to it
 type identifierSet struct {
 	identifiers map[string]bool
@@ -794,3 +1469,434 @@ func (e *psqlEduPayload) Scan(src interface{}) error {
 	}
 	return json.Unmarshal(b, &e.EDU)
 }
+
+func (s *PostgresStorage) UpsertOverride(ctx context.Context, override *StoredOverride) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertOverride")
+	defer t.ObserveDuration()
+
+	_, err := s.overrideUpsert.ExecContext(ctx, override.CommunityId, string(override.Kind), override.Value, override.Reason, override.CreatedTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) DeleteOverride(ctx context.Context, communityId string, kind OverrideKind, value string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteOverride")
+	defer t.ObserveDuration()
+
+	_, err := s.overrideDelete.ExecContext(ctx, communityId, string(kind), value)
+	return err
+}
+
+func (s *PostgresStorage) GetOverrides(ctx context.Context, communityId string) ([]*StoredOverride, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetOverrides")
+	defer t.ObserveDuration()
+
+	rows, err := s.overridesSelect.QueryContext(ctx, communityId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredOverride, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := make([]*StoredOverride, 0)
+	for rows.Next() {
+		override := &StoredOverride{}
+		err = rows.Scan(&override.CommunityId, &override.Kind, &override.Value, &override.Reason, &override.CreatedTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+func (s *PostgresStorage) UpsertHellban(ctx context.Context, hellban *StoredHellban) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertHellban")
+	defer t.ObserveDuration()
+
+	_, err := s.hellbanUpsert.ExecContext(ctx, hellban.CommunityId, hellban.UserId, hellban.ExpiresTimestampMillis, hellban.Strikes)
+	return err
+}
+
+func (s *PostgresStorage) DeleteHellban(ctx context.Context, communityId string, userId string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteHellban")
+	defer t.ObserveDuration()
+
+	_, err := s.hellbanDelete.ExecContext(ctx, communityId, userId)
+	return err
+}
+
+func (s *PostgresStorage) GetHellban(ctx context.Context, communityId string, userId string) (*StoredHellban, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetHellban")
+	defer t.ObserveDuration()
+
+	hellban := &StoredHellban{}
+	err := s.hellbanSelect.QueryRowContext(ctx, communityId, userId).Scan(&hellban.CommunityId, &hellban.UserId, &hellban.ExpiresTimestampMillis, &hellban.Strikes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return hellban, nil
+}
+
+func (s *PostgresStorage) GetActiveHellbans(ctx context.Context, communityId string) ([]*StoredHellban, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetActiveHellbans")
+	defer t.ObserveDuration()
+
+	rows, err := s.hellbansSelectActive.QueryContext(ctx, communityId, time.Now().UnixMilli())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredHellban, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	hellbans := make([]*StoredHellban, 0)
+	for rows.Next() {
+		hellban := &StoredHellban{}
+		err = rows.Scan(&hellban.CommunityId, &hellban.UserId, &hellban.ExpiresTimestampMillis, &hellban.Strikes)
+		if err != nil {
+			return nil, err
+		}
+		hellbans = append(hellbans, hellban)
+	}
+	return hellbans, nil
+}
+
+func (s *PostgresStorage) DeleteHellbansExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteHellbansExpiredBefore")
+	defer t.ObserveDuration()
+
+	_, err := s.hellbansDeleteExpired.ExecContext(ctx, expiredBeforeTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) InsertRecentContents(ctx context.Context, contents []*StoredRecentContent) error {
+	t := dbmetrics.StartSelfDatabaseTimer("InsertRecentContents")
+	defer t.ObserveDuration()
+
+	for _, c := range contents {
+		_, err := s.recentContentInsert.ExecContext(ctx, c.EventId, c.CommunityId, c.RoomId, c.Sender, c.Kind, c.Value, c.ReceivedTimestampMillis)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStorage) GetRecentContentsForEvent(ctx context.Context, eventId string) ([]*StoredRecentContent, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetRecentContentsForEvent")
+	defer t.ObserveDuration()
+
+	rows, err := s.recentContentsSelectForEvent.QueryContext(ctx, eventId)
+	return scanRecentContents(rows, err)
+}
+
+func (s *PostgresStorage) GetRecentContentsForSender(ctx context.Context, communityId string, sender string) ([]*StoredRecentContent, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetRecentContentsForSender")
+	defer t.ObserveDuration()
+
+	rows, err := s.recentContentsSelectForSender.QueryContext(ctx, communityId, sender)
+	return scanRecentContents(rows, err)
+}
+
+func scanRecentContents(rows *sql.Rows, err error) ([]*StoredRecentContent, error) {
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredRecentContent, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	contents := make([]*StoredRecentContent, 0)
+	for rows.Next() {
+		c := &StoredRecentContent{}
+		err = rows.Scan(&c.EventId, &c.CommunityId, &c.RoomId, &c.Sender, &c.Kind, &c.Value, &c.ReceivedTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, c)
+	}
+	return contents, nil
+}
+
+func (s *PostgresStorage) DeleteRecentContentsBefore(ctx context.Context, receivedBeforeTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteRecentContentsBefore")
+	defer t.ObserveDuration()
+
+	_, err := s.recentContentsDeleteBefore.ExecContext(ctx, receivedBeforeTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) UpsertBlockedContents(ctx context.Context, blocked []*StoredBlockedContent) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertBlockedContents")
+	defer t.ObserveDuration()
+
+	// Postgres collapses the notifications sent by the trigger within a transaction, so filter sets reload once
+	txn, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	stmt := txn.StmtContext(ctx, s.blockedContentUpsert)
+	for _, b := range blocked {
+		if _, err = stmt.ExecContext(ctx, b.CommunityId, b.Kind, b.Value, b.EventId, b.ExpiresTimestampMillis); err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func (s *PostgresStorage) GetActiveBlockedContents(ctx context.Context, communityId string) ([]*StoredBlockedContent, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetActiveBlockedContents")
+	defer t.ObserveDuration()
+
+	rows, err := s.blockedContentsSelectActive.QueryContext(ctx, communityId, time.Now().UnixMilli())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredBlockedContent, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := make([]*StoredBlockedContent, 0)
+	for rows.Next() {
+		b := &StoredBlockedContent{}
+		err = rows.Scan(&b.CommunityId, &b.Kind, &b.Value, &b.EventId, &b.ExpiresTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, nil
+}
+
+func (s *PostgresStorage) DeleteBlockedContentsExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteBlockedContentsExpiredBefore")
+	defer t.ObserveDuration()
+
+	_, err := s.blockedContentsDeleteExpired.ExecContext(ctx, expiredBeforeTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) UpsertRaid(ctx context.Context, raid *StoredRaid) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertRaid")
+	defer t.ObserveDuration()
+
+	_, err := s.raidUpsert.ExecContext(ctx, raid.CommunityId, raid.RoomId, raid.StartedTimestampMillis, raid.ExpiresTimestampMillis, raid.IsManual)
+	return err
+}
+
+func (s *PostgresStorage) DeleteRaid(ctx context.Context, communityId string, roomId string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteRaid")
+	defer t.ObserveDuration()
+
+	_, err := s.raidDelete.ExecContext(ctx, communityId, roomId)
+	return err
+}
+
+func (s *PostgresStorage) GetActiveRaids(ctx context.Context, communityId string) ([]*StoredRaid, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetActiveRaids")
+	defer t.ObserveDuration()
+
+	rows, err := s.raidsSelectActive.QueryContext(ctx, communityId, time.Now().UnixMilli())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredRaid, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	raids := make([]*StoredRaid, 0)
+	for rows.Next() {
+		raid := &StoredRaid{}
+		err = rows.Scan(&raid.CommunityId, &raid.RoomId, &raid.StartedTimestampMillis, &raid.ExpiresTimestampMillis, &raid.IsManual)
+		if err != nil {
+			return nil, err
+		}
+		raids = append(raids, raid)
+	}
+	return raids, nil
+}
+
+func (s *PostgresStorage) DeleteRaidsExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteRaidsExpiredBefore")
+	defer t.ObserveDuration()
+
+	_, err := s.raidsDeleteExpired.ExecContext(ctx, expiredBeforeTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) UpsertWebhookDestination(ctx context.Context, destination *StoredWebhookDestination) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertWebhookDestination")
+	defer t.ObserveDuration()
+
+	eventTypes, err := json.Marshal(destination.EventTypes)
+	if err != nil {
+		return err
+	}
+	_, err = s.webhookDestinationUpsert.ExecContext(ctx, destination.Id, destination.CommunityId, destination.Url, eventTypes, destination.CreatedTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) DeleteWebhookDestination(ctx context.Context, communityId string, id string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteWebhookDestination")
+	defer t.ObserveDuration()
+
+	_, err := s.webhookDestinationDelete.ExecContext(ctx, communityId, id)
+	return err
+}
+
+func (s *PostgresStorage) GetWebhookDestinations(ctx context.Context, communityId string) ([]*StoredWebhookDestination, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetWebhookDestinations")
+	defer t.ObserveDuration()
+
+	rows, err := s.webhookDestinationsSelect.QueryContext(ctx, communityId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredWebhookDestination, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	destinations := make([]*StoredWebhookDestination, 0)
+	for rows.Next() {
+		destination := &StoredWebhookDestination{}
+		eventTypes := make([]byte, 0)
+		err = rows.Scan(&destination.Id, &destination.CommunityId, &destination.Url, &eventTypes, &destination.CreatedTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(eventTypes, &destination.EventTypes); err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, destination)
+	}
+	return destinations, nil
+}
+
+func (s *PostgresStorage) UpsertWebhookDelivery(ctx context.Context, delivery *StoredWebhookDelivery) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertWebhookDelivery")
+	defer t.ObserveDuration()
+
+	_, err := s.webhookDeliveryUpsert.ExecContext(ctx, delivery.Id, delivery.DestinationId, delivery.CommunityId, delivery.Url, []byte(delivery.Payload), delivery.Attempts, delivery.NextAttemptTimestampMillis, delivery.LastError, delivery.CreatedTimestampMillis)
+	return err
+}
+
+func (s *PostgresStorage) DeleteWebhookDelivery(ctx context.Context, id string) error {
+	t := dbmetrics.StartSelfDatabaseTimer("DeleteWebhookDelivery")
+	defer t.ObserveDuration()
+
+	_, err := s.webhookDeliveryDelete.ExecContext(ctx, id)
+	return err
+}
+
+func (s *PostgresStorage) ClaimWebhookDeliveries(ctx context.Context, dueBeforeTimestampMillis int64, claimUntilTimestampMillis int64, limit int) ([]*StoredWebhookDelivery, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("ClaimWebhookDeliveries")
+	defer t.ObserveDuration()
+
+	rows, err := s.webhookDeliveriesClaim.QueryContext(ctx, dueBeforeTimestampMillis, claimUntilTimestampMillis, limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]*StoredWebhookDelivery, 0), nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*StoredWebhookDelivery, 0)
+	for rows.Next() {
+		delivery := &StoredWebhookDelivery{}
+		payload := make([]byte, 0)
+		err = rows.Scan(&delivery.Id, &delivery.DestinationId, &delivery.CommunityId, &delivery.Url, &payload, &delivery.Attempts, &delivery.NextAttemptTimestampMillis, &delivery.LastError, &delivery.CreatedTimestampMillis)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	// RETURNING doesn't preserve the subquery's order
+	slices.SortFunc(deliveries, func(a, b *StoredWebhookDelivery) int {
+		return cmp.Compare(a.CreatedTimestampMillis, b.CreatedTimestampMillis)
+	})
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresStorage) UpsertAuditRoom(ctx context.Context, room *StoredAuditRoom) error {
+	t := dbmetrics.StartSelfDatabaseTimer("UpsertAuditRoom")
+	defer t.ObserveDuration()
+
+	servers, err := json.Marshal(room.Servers)
+	if err != nil {
+		return err
+	}
+	prevEventIds, err := json.Marshal(room.PrevEventIds)
+	if err != nil {
+		return err
+	}
+	_, err = s.auditRoomUpsert.ExecContext(ctx, room.RoomId, room.RoomVersion, room.Via, servers, room.CreateEventId, room.PowerLevelsEventId, room.MemberEventId, prevEventIds, room.Depth)
+	return err
+}
+
+func (s *PostgresStorage) GetAuditRoom(ctx context.Context, roomId string) (*StoredAuditRoom, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetAuditRoom")
+	defer t.ObserveDuration()
+
+	room := &StoredAuditRoom{}
+	servers := make([]byte, 0)
+	prevEventIds := make([]byte, 0)
+	err := s.auditRoomSelect.QueryRowContext(ctx, roomId).Scan(&room.RoomId, &room.RoomVersion, &room.Via, &servers, &room.CreateEventId, &room.PowerLevelsEventId, &room.MemberEventId, &prevEventIds, &room.Depth)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(servers, &room.Servers); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(prevEventIds, &room.PrevEventIds); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *PostgresStorage) GetCommunitiesByAuditRoomId(ctx context.Context, roomId string) ([]*StoredCommunity, error) {
+	t := dbmetrics.StartSelfDatabaseTimer("GetCommunitiesByAuditRoomId")
+	defer t.ObserveDuration()
+
+	rows, err := s.communitiesSelectByAuditRoomId.QueryContext(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	communities := make([]*StoredCommunity, 0)
+	for rows.Next() {
+		community := &StoredCommunity{}
+		err = rows.Scan(
+			&community.CommunityId,
+			&community.Name,
+			&community.Config,
+			&community.ApiAccessToken,
+			&community.CanSelfJoinRooms,
+			&community.SpaceRoomId,
+			&community.WebhookSecret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, community)
+	}
+	return communities, rows.Err()
+}
@@ -0,0 +1,26 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// CleanupOldDecisions - Removes decisions which are older than the retention period. Decisions are recorded for every
+// event, so would otherwise grow without bound.
+func CleanupOldDecisions(db storage.PersistentStorage, retention time.Duration) {
+	log.Println("Running decision cleanup task...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := db.DeleteDecisionsBefore(ctx, time.Now().Add(-retention).UnixMilli())
+	if err != nil {
+		log.Printf("Failed to clean up old decisions: %v", err)
+		return
+	}
+
+	log.Println("Finished decision cleanup task")
+}
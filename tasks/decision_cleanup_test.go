@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/harms"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupOldDecisionsTask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+
+	now := time.Now()
+	decisions := map[string]int64{
+		"$recent": now.Add(-1 * time.Hour).UnixMilli(),
+		"$old":    now.Add(-48 * time.Hour).UnixMilli(),
+	}
+	for eventId, decidedTs := range decisions {
+		err := db.InsertDecision(ctx, &storage.StoredDecision{
+			EventId:                eventId,
+			CommunityId:            "default",
+			RoomId:                 "!room:example.org",
+			SenderUserId:           "@user:example.org",
+			EventType:              "m.room.message",
+			ContentInfo:            harms.NeutralContent(),
+			DecidedTimestampMillis: decidedTs,
+		})
+		assert.NoError(t, err)
+	}
+
+	CleanupOldDecisions(db, 24*time.Hour)
+
+	remaining, err := db.GetDecisions(ctx, &storage.DecisionQuery{CommunityId: "default", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, "$recent", remaining[0].EventId)
+}
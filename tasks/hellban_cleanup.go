@@ -0,0 +1,26 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/filter"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// CleanupExpiredHellbans - Removes hellbans which expired long enough ago that they no longer count as strikes.
+func CleanupExpiredHellbans(db storage.PersistentStorage) {
+	log.Println("Running hellban cleanup task...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := db.DeleteHellbansExpiredBefore(ctx, time.Now().Add(-1*filter.HellbanStrikeResetTime).UnixMilli())
+	if err != nil {
+		log.Printf("Failed to clean up expired hellbans: %v", err)
+		return
+	}
+
+	log.Println("Finished hellban cleanup task")
+}
@@ -0,0 +1,47 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/filter"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupExpiredHellbansTask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+
+	now := time.Now()
+	hellbans := map[string]int64{
+		"@active:example.org":    now.Add(10 * time.Minute).UnixMilli(),
+		"@recent:example.org":    now.Add(-10 * time.Minute).UnixMilli(), // still counts as a strike
+		"@forgotten:example.org": now.Add(-1 * filter.HellbanStrikeResetTime).Add(-1 * time.Minute).UnixMilli(),
+	}
+	for userId, expires := range hellbans {
+		err := db.UpsertHellban(ctx, &storage.StoredHellban{
+			CommunityId:            "default",
+			UserId:                 userId,
+			ExpiresTimestampMillis: expires,
+			Strikes:                1,
+		})
+		assert.NoError(t, err)
+	}
+
+	CleanupExpiredHellbans(db)
+
+	for userId := range hellbans {
+		hellban, err := db.GetHellban(ctx, "default", userId)
+		assert.NoError(t, err)
+		if userId == "@forgotten:example.org" {
+			assert.Nil(t, hellban)
+		} else {
+			assert.NotNil(t, hellban, userId)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/homeserver"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// CleanupModeratorBlocklist - Removes recent contents which are too old for moderators to act on, and blocked contents
+// which have expired.
+func CleanupModeratorBlocklist(db storage.PersistentStorage) {
+	log.Println("Running moderator blocklist cleanup task...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	err := db.DeleteRecentContentsBefore(ctx, now.Add(-1*homeserver.RecentContentRetention).UnixMilli())
+	if err != nil {
+		log.Printf("Failed to clean up recent contents: %v", err)
+		return
+	}
+	err = db.DeleteBlockedContentsExpiredBefore(ctx, now.UnixMilli())
+	if err != nil {
+		log.Printf("Failed to clean up expired blocked contents: %v", err)
+		return
+	}
+
+	log.Println("Finished moderator blocklist cleanup task")
+}
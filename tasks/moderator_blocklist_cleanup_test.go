@@ -0,0 +1,64 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/homeserver"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupModeratorBlocklistTask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+
+	now := time.Now()
+	err := db.InsertRecentContents(ctx, []*storage.StoredRecentContent{{
+		EventId:                 "$recent",
+		CommunityId:             "default",
+		RoomId:                  "!room:example.org",
+		Sender:                  "@alice:example.org",
+		Kind:                    storage.ContentKindMediaUri,
+		Value:                   "mxc://example.org/recent",
+		ReceivedTimestampMillis: now.Add(-10 * time.Minute).UnixMilli(),
+	}, {
+		EventId:                 "$old",
+		CommunityId:             "default",
+		RoomId:                  "!room:example.org",
+		Sender:                  "@alice:example.org",
+		Kind:                    storage.ContentKindMediaUri,
+		Value:                   "mxc://example.org/old",
+		ReceivedTimestampMillis: now.Add(-1 * homeserver.RecentContentRetention).Add(-1 * time.Minute).UnixMilli(),
+	}})
+	assert.NoError(t, err)
+	for value, expires := range map[string]int64{
+		"mxc://example.org/active":  now.Add(10 * time.Minute).UnixMilli(),
+		"mxc://example.org/expired": now.Add(-10 * time.Minute).UnixMilli(),
+	} {
+		err = db.UpsertBlockedContents(ctx, []*storage.StoredBlockedContent{{
+			CommunityId:            "default",
+			Kind:                   storage.ContentKindMediaUri,
+			Value:                  value,
+			EventId:                "$whatever",
+			ExpiresTimestampMillis: expires,
+		}})
+		assert.NoError(t, err)
+	}
+
+	CleanupModeratorBlocklist(db)
+
+	contents, err := db.GetRecentContentsForSender(ctx, "default", "@alice:example.org")
+	assert.NoError(t, err)
+	assert.Len(t, contents, 1)
+	assert.Equal(t, "$recent", contents[0].EventId)
+
+	blocked, err := db.GetActiveBlockedContents(ctx, "default")
+	assert.NoError(t, err)
+	assert.Len(t, blocked, 1)
+	assert.Equal(t, "mxc://example.org/active", blocked[0].Value)
+}
@@ -0,0 +1,26 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/storage"
+)
+
+// CleanupExpiredRaids - Removes raids which have ended. Raid prefilters already ignore expired raids, so this only keeps
+// the table small.
+func CleanupExpiredRaids(db storage.PersistentStorage) {
+	log.Println("Running raid cleanup task...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := db.DeleteRaidsExpiredBefore(ctx, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("Failed to clean up expired raids: %v", err)
+		return
+	}
+
+	log.Println("Finished raid cleanup task")
+}
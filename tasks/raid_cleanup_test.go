@@ -0,0 +1,40 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupExpiredRaidsTask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+
+	now := time.Now()
+	raids := map[string]int64{
+		"!active:example.org": now.Add(10 * time.Minute).UnixMilli(),
+		"!ended:example.org":  now.Add(-10 * time.Minute).UnixMilli(),
+	}
+	for roomId, expires := range raids {
+		err := db.UpsertRaid(ctx, &storage.StoredRaid{
+			CommunityId:            "default",
+			RoomId:                 roomId,
+			StartedTimestampMillis: now.Add(-30 * time.Minute).UnixMilli(),
+			ExpiresTimestampMillis: expires,
+		})
+		assert.NoError(t, err)
+	}
+
+	CleanupExpiredRaids(db)
+
+	active, err := db.GetActiveRaids(ctx, "default")
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+	assert.Equal(t, "!active:example.org", active[0].RoomId)
+}
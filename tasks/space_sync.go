@@ -0,0 +1,141 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/matrix-org/policyserv/homeserver"
+	"github.com/matrix-org/policyserv/notifiers"
+	"github.com/matrix-org/policyserv/storage"
+)
+
+func SyncCommunitySpaces(homeserver *homeserver.Homeserver, db storage.PersistentStorage, notifier notifiers.MatrixNotifier, joinServer string) {
+	log.Println("Running space sync task...")
+
+	// Joins can take a while, so give ourselves plenty of time
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	communities, err := db.GetCommunitiesWithSpaces(ctx)
+	if err != nil {
+		log.Printf("Failed to get communities with spaces: %v", err)
+		return
+	}
+
+	for _, community := range communities {
+		err = syncCommunitySpace(ctx, homeserver, db, notifier, joinServer, community)
+		if err != nil {
+			log.Printf("[%s] Non-fatal error syncing space %s: %v", community.CommunityId, community.SpaceRoomId, err)
+		}
+	}
+
+	log.Println("Finished space sync task")
+}
+
+func syncCommunitySpace(ctx context.Context, homeserver *homeserver.Homeserver, db storage.PersistentStorage, notifier notifiers.MatrixNotifier, joinServer string, community *storage.StoredCommunity) error {
+	// We need to be in the space to learn its children. The children are learned by the usual state learning process,
+	// including when we first join the space.
+	space, err := db.GetRoom(ctx, community.SpaceRoomId)
+	if err != nil {
+		return err
+	}
+	if space == nil {
+		if !community.CanSelfJoinRooms {
+			return fmt.Errorf("space is not protected and the community cannot self-join rooms")
+		}
+		removed, err := db.IsRoomRemoved(ctx, community.CommunityId, community.SpaceRoomId)
+		if err != nil {
+			return err
+		}
+		if removed {
+			return fmt.Errorf("space was removed from the community")
+		}
+		log.Printf("[%s] Joining space %s", community.CommunityId, community.SpaceRoomId)
+		space, err = homeserver.JoinRoom(ctx, community.SpaceRoomId, joinServer, community.CommunityId)
+		if err != nil {
+			return err
+		}
+	}
+	if space.CommunityId != community.CommunityId {
+		return fmt.Errorf("space is protected by another community (%s)", space.CommunityId)
+	}
+
+	childRoomIds, err := db.GetSpaceChildren(ctx, space.RoomId)
+	if err != nil {
+		return err
+	}
+	for _, childRoomId := range childRoomIds {
+		child, err := db.GetRoom(ctx, childRoomId)
+		if err != nil {
+			return err
+		}
+		if child != nil {
+			if child.CommunityId != community.CommunityId {
+				// We don't steal rooms from other communities. The admin API can move them if needed.
+				log.Printf("[%s] Space child %s is protected by another community (%s)", community.CommunityId, childRoomId, child.CommunityId)
+			}
+			continue
+		}
+		if !community.CanSelfJoinRooms {
+			log.Printf("[%s] Not joining space child %s because the community cannot self-join rooms", community.CommunityId, childRoomId)
+			continue
+		}
+		removed, err := db.IsRoomRemoved(ctx, community.CommunityId, childRoomId)
+		if err != nil {
+			return err
+		}
+		if removed {
+			// The room was removed through the API, so it stays removed until it's added back the same way
+			log.Printf("[%s] Not joining space child %s because it was removed from the community", community.CommunityId, childRoomId)
+			continue
+		}
+
+		log.Printf("[%s] Joining space child %s", community.CommunityId, childRoomId)
+		if _, err = homeserver.JoinRoom(ctx, childRoomId, joinServer, community.CommunityId); err != nil {
+			// Try the remaining children anyway - we'll try this one again next time
+			log.Printf("[%s] Non-fatal error joining space child %s: %v", community.CommunityId, childRoomId, err)
+		}
+	}
+
+	// Flag rooms which aren't (or are no longer) in the space. We don't leave them automatically because a mistaken
+	// edit to the space would otherwise leave the rooms unprotected.
+	rooms, err := db.GetRoomsByCommunityId(ctx, community.CommunityId)
+	if err != nil {
+		return err
+	}
+	for _, room := range rooms {
+		removed := room.RoomId != space.RoomId && !slices.Contains(childRoomIds, room.RoomId)
+		if removed == room.RemovedFromSpace {
+			continue // no change
+		}
+
+		// Copy the room rather than changing the stored value in place
+		updated := *room
+		updated.RemovedFromSpace = removed
+		if err = db.UpsertRoom(ctx, &updated); err != nil {
+			return err
+		}
+		if !removed {
+			log.Printf("[%s] Room %s is back in space %s", community.CommunityId, room.RoomId, space.RoomId)
+			continue
+		}
+
+		log.Printf("[%s] Room %s is not in space %s", community.CommunityId, room.RoomId, space.RoomId)
+		escapedRoomId := html.EscapeString(room.RoomId)
+		escapedSpaceId := html.EscapeString(space.RoomId)
+		htmlText := fmt.Sprintf("The room <code>%s</code> (<a href=\"https://matrix.to/#/%s\">%s</a>) is not a child of the space <code>%s</code>, but is still protected by policyserv. Remove the room from the community if it should no longer be protected.", escapedRoomId, escapedRoomId, escapedRoomId, escapedSpaceId)
+		plainText := fmt.Sprintf("The room %s is not a child of the space %s, but is still protected by policyserv. Remove the room from the community if it should no longer be protected.", room.RoomId, space.RoomId)
+		msgId, err := notifier.Send(community.CommunityId, plainText, htmlText)
+		if err != nil {
+			log.Printf("[%s] Non-fatal error sending notice about %s: %v", community.CommunityId, room.RoomId, err)
+			continue
+		}
+		log.Printf("[%s] Notice about %s sent: %s", community.CommunityId, room.RoomId, msgId)
+	}
+
+	return nil
+}
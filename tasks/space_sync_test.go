@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/matrix-org/policyserv/homeserver"
+	"github.com/matrix-org/policyserv/storage"
+	"github.com/matrix-org/policyserv/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCommunitySpacesTask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := test.NewMemoryStorage(t)
+	notifier := test.NewMatrixNotifier(t)
+	hs := homeserver.NewMockServerForTest(t, db, func(c *homeserver.Config) {
+		c.SkipVerify = true // out httptest server will have an unknown authority
+	})
+
+	// Prepare a test server to record which rooms we try to join. We don't need the joins to succeed.
+	lock := sync.Mutex{}
+	joinAttempts := make([]string, 0)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/_matrix/federation/v1/make_join/") {
+			roomId, _ := url.PathUnescape(strings.Split(r.URL.Path, "/")[5])
+			lock.Lock()
+			joinAttempts = append(joinAttempts, roomId)
+			lock.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errcode":"M_NOT_FOUND","error":"Not found"}`))
+	}
+	localhost := httptest.NewTLSServer(http.HandlerFunc(handler))
+	defer localhost.Close()
+	parsed, err := url.Parse(localhost.URL)
+	assert.NoError(t, err) // "should never happen"
+	joinServer := fmt.Sprintf("127.0.0.1:%s", parsed.Port())
+
+	community, err := db.CreateCommunity(ctx, "Spacey")
+	assert.NoError(t, err)
+	community.CanSelfJoinRooms = true
+	community.SpaceRoomId = "!space:example.org"
+	assert.NoError(t, db.UpsertCommunity(ctx, community))
+	otherCommunity, err := db.CreateCommunity(ctx, "Other")
+	assert.NoError(t, err)
+	noJoinCommunity, err := db.CreateCommunity(ctx, "No self-join")
+	assert.NoError(t, err)
+	noJoinCommunity.SpaceRoomId = "!unjoined_space:example.org"
+	assert.NoError(t, db.UpsertCommunity(ctx, noJoinCommunity))
+
+	for _, room := range []*storage.StoredRoom{{
+		RoomId:      community.SpaceRoomId,
+		RoomVersion: "11",
+		CommunityId: community.CommunityId,
+	}, {
+		RoomId:      "!known_child:example.org",
+		RoomVersion: "11",
+		CommunityId: community.CommunityId,
+	}, {
+		RoomId:      "!other_child:example.org",
+		RoomVersion: "11",
+		CommunityId: otherCommunity.CommunityId,
+	}, {
+		RoomId:      "!not_in_space:example.org",
+		RoomVersion: "11",
+		CommunityId: community.CommunityId,
+	}} {
+		assert.NoError(t, db.UpsertRoom(ctx, room))
+	}
+	err = db.SetSpaceChildren(ctx, community.SpaceRoomId, []string{"!known_child:example.org", "!other_child:example.org", "!new_child:example.org"})
+	assert.NoError(t, err)
+
+	assertRemovedFromSpace := func(roomId string, communityId string, expected bool) {
+		room, err := db.GetRoom(ctx, roomId)
+		assert.NoError(t, err)
+		assert.NotNil(t, room)
+		assert.Equal(t, communityId, room.CommunityId)
+		assert.Equal(t, expected, room.RemovedFromSpace)
+	}
+
+	SyncCommunitySpaces(hs, db, notifier, joinServer)
+
+	// Only the new child should have been joined. The unjoined space belongs to a community which can't self-join.
+	assert.Equal(t, []string{"!new_child:example.org"}, joinAttempts)
+	assertRemovedFromSpace(community.SpaceRoomId, community.CommunityId, false)
+	assertRemovedFromSpace("!known_child:example.org", community.CommunityId, false)
+	assertRemovedFromSpace("!other_child:example.org", otherCommunity.CommunityId, false)
+	assertRemovedFromSpace("!not_in_space:example.org", community.CommunityId, true)
+	assert.Len(t, notifier.SentTo(community.CommunityId), 1)
+	assert.Contains(t, notifier.SentTo(community.CommunityId)[0], "!not_in_space:example.org")
+
+	// Running again shouldn't notify about the same room twice
+	SyncCommunitySpaces(hs, db, notifier, joinServer)
+	assert.Len(t, notifier.SentTo(community.CommunityId), 1)
+
+	// Adding the room to the space clears the flag
+	err = db.SetSpaceChildren(ctx, community.SpaceRoomId, []string{"!known_child:example.org", "!not_in_space:example.org"})
+	assert.NoError(t, err)
+	SyncCommunitySpaces(hs, db, notifier, joinServer)
+	assertRemovedFromSpace("!not_in_space:example.org", community.CommunityId, false)
+	assert.Len(t, notifier.SentTo(community.CommunityId), 1)
+
+	// Rooms removed from the community aren't joined again, even though they're still in the space
+	lock.Lock()
+	joinAttempts = joinAttempts[:0]
+	lock.Unlock()
+	assert.NoError(t, db.DeleteRoom(ctx, "!known_child:example.org"))
+	SyncCommunitySpaces(hs, db, notifier, joinServer)
+	assert.Empty(t, joinAttempts)
+
+	// ... and the same goes for the space itself
+	assert.NoError(t, db.DeleteRoom(ctx, community.SpaceRoomId))
+	SyncCommunitySpaces(hs, db, notifier, joinServer)
+	assert.Empty(t, joinAttempts)
+
+	// Rooms removed from a different community can still be joined
+	assert.NoError(t, db.UpsertRoom(ctx, &storage.StoredRoom{
+		RoomId:      "!moved_space:example.org",
+		RoomVersion: "11",
+		CommunityId: otherCommunity.CommunityId,
+	}))
+	assert.NoError(t, db.DeleteRoom(ctx, "!moved_space:example.org"))
+	community.SpaceRoomId = "!moved_space:example.org"
+	assert.NoError(t, db.UpsertCommunity(ctx, community))
+	SyncCommunitySpaces(hs, db, notifier, joinServer)
+	assert.Equal(t, []string{"!moved_space:example.org"}, joinAttempts)
+}
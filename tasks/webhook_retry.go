@@ -0,0 +1,21 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/matrix-org/policyserv/notifiers"
+)
+
+// RetryWebhookDeliveries - Re-attempts structured webhook payloads which previously failed to deliver.
+func RetryWebhookDeliveries(notifier *notifiers.WebhookMatrixNotifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	err := notifier.RetryDeliveries(ctx)
+	if err != nil {
+		log.Printf("Failed to retry webhook deliveries: %v", err)
+		return
+	}
+}
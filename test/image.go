@@ -0,0 +1,31 @@
+package test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MustMakeImage - Draws a PNG image of the given size. Images with the same variant look the same regardless of size,
+// so they have similar perceptual hashes, while different variants look different.
+func MustMakeImage(t *testing.T, width int, height int, variant int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx := float64(x) / float64(width)
+			fy := float64(y) / float64(height)
+			// Each variant draws waves at a different angle and frequency over a gradient
+			wave := 0.5 + 0.5*math.Sin(2*math.Pi*(fx*float64(variant+1)+fy*float64(3-variant%4)))
+			img.Set(x, y, color.RGBA{R: uint8(255 * fx), G: uint8(255 * wave), B: uint8(255 * fy), A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, img)
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/matrix-org/policyserv/media"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,7 +30,7 @@ func (s *StaticMediaDownloader) Set(origin string, mediaId string, bytes []byte)
 	return s
 }
 
-func (s *StaticMediaDownloader) DownloadMedia(ctx context.Context, origin string, mediaId string) ([]byte, error) {
+func (s *StaticMediaDownloader) DownloadMedia(ctx context.Context, origin string, mediaId string, maxBytes int64) ([]byte, error) {
 	assert.NotNil(s.T, ctx, "context is required")
 
 	s.DownloadCalls++
@@ -42,6 +43,9 @@ func (s *StaticMediaDownloader) DownloadMedia(ctx context.Context, origin string
 			return nil, ctx.Err()
 		}
 	}
+	if ok && maxBytes > 0 && int64(len(b)) > maxBytes {
+		return nil, media.MediaTooLargeError
+	}
 	if ok {
 		return b, nil
 	}
@@ -6,6 +6,7 @@ import (
 	"testing/synctest"
 	"time"
 
+	"github.com/matrix-org/policyserv/media"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,16 +17,24 @@ func TestMediaDownloader(t *testing.T) {
 
 	downloader := MustMakeMediaDownloader(t)
 
-	b, err := downloader.DownloadMedia(context.Background(), "example.org", "abc123")
+	b, err := downloader.DownloadMedia(context.Background(), "example.org", "abc123", 0)
 	assert.ErrorContains(t, err, "media not found")
 	assert.Nil(t, b)
 
 	downloader2 := downloader.Set("example.org", "abc123", []byte("test")) // should be chainable
 	assert.Equal(t, downloader, downloader2)
 
-	b, err = downloader.DownloadMedia(context.Background(), "example.org", "abc123")
+	b, err = downloader.DownloadMedia(context.Background(), "example.org", "abc123", 0)
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("test"), b)
+
+	// Limits are respected
+	b, err = downloader.DownloadMedia(context.Background(), "example.org", "abc123", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("test"), b)
+	b, err = downloader.DownloadMedia(context.Background(), "example.org", "abc123", 3)
+	assert.ErrorIs(t, err, media.MediaTooLargeError)
+	assert.Nil(t, b)
 }
 
 func TestMediaDownloaderSleepsOnRequest(t *testing.T) {
@@ -37,7 +46,7 @@ func TestMediaDownloaderSleepsOnRequest(t *testing.T) {
 
 		downloader.Set("example.org", "abc123", SleepFor60SecondsOnDownload)
 
-		b, err := downloader.DownloadMedia(context.Background(), "example.org", "abc123")
+		b, err := downloader.DownloadMedia(context.Background(), "example.org", "abc123", 0)
 		assert.NoError(t, err)
 		assert.Equal(t, SleepFor60SecondsOnDownload, b)
 		assert.True(t, time.Since(start) >= 60*time.Second)
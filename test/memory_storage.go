@@ -1,12 +1,16 @@
 package test
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"maps"
+	"slices"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/gomatrixserverlib/spec"
@@ -30,16 +34,40 @@ type MemoryStorage struct {
 	t                      *testing.T
 	rooms                  map[string]*storage.StoredRoom
 	events                 map[string]*storage.StoredEventResult
-	userIdsDisplayNames    map[string][][]string        // roomId -> [userIds, displayNames]
-	policyRules            map[string]map[string]string // roomId -> entity(userId, server name, etc) -> entityType(m.policy.rule.user, etc)
+	userIdsDisplayNames    map[string][][]string                  // roomId -> [userIds, displayNames]
+	roomMembers            map[string][]*storage.StoredRoomMember // roomId -> members
+	policyRules            map[string][]*storage.StoredListRule   // roomId -> rules
 	communities            map[string]*storage.StoredCommunity
 	learnStateQueue        []*storage.StateLearnQueueItem
 	pendingLearnStateQueue []*storage.StateLearnQueueItem
 	trustData              map[string]map[string][]byte // sourceName -> key -> JSON value
 	keywordTemplates       map[string]*storage.StoredKeywordTemplate
+	communityTemplates     map[string]map[string]*storage.StoredKeywordTemplate     // communityId -> name -> template
 	mediaClassifications   map[string]map[string]*storage.StoredMediaClassification // mxcUri -> communityId -> classification
+	mediaScores            map[string]map[string]*storage.StoredMediaScores         // mxcUri -> model -> scores
+	mediaScoresLock        sync.Mutex                                               // scores are read and written by concurrent filters
 	destinationLocks       map[string]*sync.Mutex
 	destinationEdus        map[string][]*memoryDestinationEdu
+	roomMemberJoins        map[string]map[string]int64                    // roomId -> userId -> joined timestamp
+	spaceChildren          map[string][]string                            // spaceRoomId -> [childRoomId]
+	removedRooms           map[string]map[string]int64                    // communityId -> roomId -> removed timestamp
+	decisions              []*storage.StoredDecision                      // oldest first
+	decisionsLock          sync.Mutex                                     // decisions are typically inserted async
+	overrides              map[string][]*storage.StoredOverride           // communityId -> [override], oldest first
+	hellbans               map[string]map[string]*storage.StoredHellban   // communityId -> userId -> hellban
+	hellbansLock           sync.Mutex                                     // hellbans are read and written by concurrent filters
+	recentContents         []*storage.StoredRecentContent                 // oldest first
+	blockedContents        map[string][]*storage.StoredBlockedContent     // communityId -> [blocked content]
+	contentsLock           sync.Mutex                                     // contents are typically written async
+	raids                  map[string]map[string]*storage.StoredRaid      // communityId -> roomId -> raid
+	raidsLock              sync.Mutex                                     // raids are read and written by concurrent filters
+	mediaHashes            map[string][]*storage.StoredMediaHash          // communityId -> [hash], oldest first
+	mediaHashesLock        sync.Mutex                                     // hashes are read by concurrent scans
+	webhookDestinations    map[string][]*storage.StoredWebhookDestination // communityId -> [destination], oldest first
+	webhookDeliveries      map[string]*storage.StoredWebhookDelivery      // id -> delivery
+	webhooksLock           sync.Mutex                                     // deliveries are written by concurrent workers
+	auditRooms             map[string]*storage.StoredAuditRoom            // roomId -> audit room
+	auditRoomsLock         sync.Mutex                                     // audit rooms are written by concurrent notifications
 }
 
 func NewMemoryStorage(t *testing.T) *MemoryStorage {
@@ -48,15 +76,31 @@ func NewMemoryStorage(t *testing.T) *MemoryStorage {
 		rooms:                  make(map[string]*storage.StoredRoom),
 		events:                 make(map[string]*storage.StoredEventResult),
 		userIdsDisplayNames:    make(map[string][][]string),
-		policyRules:            make(map[string]map[string]string),
+		roomMembers:            make(map[string][]*storage.StoredRoomMember),
+		policyRules:            make(map[string][]*storage.StoredListRule),
 		communities:            make(map[string]*storage.StoredCommunity),
 		learnStateQueue:        make([]*storage.StateLearnQueueItem, 0),
 		pendingLearnStateQueue: make([]*storage.StateLearnQueueItem, 0),
 		trustData:              make(map[string]map[string][]byte),
 		keywordTemplates:       make(map[string]*storage.StoredKeywordTemplate),
+		communityTemplates:     make(map[string]map[string]*storage.StoredKeywordTemplate),
 		mediaClassifications:   make(map[string]map[string]*storage.StoredMediaClassification),
+		mediaScores:            make(map[string]map[string]*storage.StoredMediaScores),
 		destinationLocks:       make(map[string]*sync.Mutex),
 		destinationEdus:        make(map[string][]*memoryDestinationEdu),
+		roomMemberJoins:        make(map[string]map[string]int64),
+		spaceChildren:          make(map[string][]string),
+		removedRooms:           make(map[string]map[string]int64),
+		decisions:              make([]*storage.StoredDecision, 0),
+		overrides:              make(map[string][]*storage.StoredOverride),
+		hellbans:               make(map[string]map[string]*storage.StoredHellban),
+		recentContents:         make([]*storage.StoredRecentContent, 0),
+		blockedContents:        make(map[string][]*storage.StoredBlockedContent),
+		raids:                  make(map[string]map[string]*storage.StoredRaid),
+		mediaHashes:            make(map[string][]*storage.StoredMediaHash),
+		webhookDestinations:    make(map[string][]*storage.StoredWebhookDestination),
+		webhookDeliveries:      make(map[string]*storage.StoredWebhookDelivery),
+		auditRooms:             make(map[string]*storage.StoredAuditRoom),
 	}
 }
 
@@ -75,6 +119,18 @@ func (m *MemoryStorage) GetAllRooms(ctx context.Context) ([]*storage.StoredRoom,
 	return rooms, nil
 }
 
+func (m *MemoryStorage) GetRoomsByCommunityId(ctx context.Context, communityId string) ([]*storage.StoredRoom, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	rooms := make([]*storage.StoredRoom, 0)
+	for _, room := range m.rooms {
+		if room.CommunityId == communityId {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
 func (m *MemoryStorage) GetRoom(ctx context.Context, roomId string) (*storage.StoredRoom, error) {
 	assert.NotNil(m.t, ctx, "context is required")
 
@@ -91,10 +147,50 @@ func (m *MemoryStorage) UpsertRoom(ctx context.Context, room *storage.StoredRoom
 func (m *MemoryStorage) DeleteRoom(ctx context.Context, roomId string) error {
 	assert.NotNil(m.t, ctx, "context is required")
 
+	if room, ok := m.rooms[roomId]; ok {
+		if err := m.UpsertRemovedRoom(ctx, room.CommunityId, roomId, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+	}
 	delete(m.rooms, roomId)
+	delete(m.userIdsDisplayNames, roomId)
+	delete(m.roomMembers, roomId)
+	delete(m.policyRules, roomId)
+	delete(m.roomMemberJoins, roomId)
+	delete(m.spaceChildren, roomId)
+	m.learnStateQueue = slices.DeleteFunc(m.learnStateQueue, func(item *storage.StateLearnQueueItem) bool {
+		return item.RoomId == roomId
+	})
+	for _, bySource := range m.trustData {
+		delete(bySource, roomId)
+	}
 	return nil
 }
 
+func (m *MemoryStorage) UpsertRemovedRoom(ctx context.Context, communityId string, roomId string, removedTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	if m.removedRooms[communityId] == nil {
+		m.removedRooms[communityId] = make(map[string]int64)
+	}
+	m.removedRooms[communityId][roomId] = removedTimestampMillis
+	return nil
+}
+
+func (m *MemoryStorage) DeleteRemovedRoom(ctx context.Context, communityId string, roomId string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	delete(m.removedRooms[communityId], roomId)
+	return nil
+}
+
+func (m *MemoryStorage) IsRoomRemoved(ctx context.Context, communityId string, roomId string) (bool, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	_, ok := m.removedRooms[communityId][roomId]
+	return ok, nil
+}
+
 func (m *MemoryStorage) GetEventResult(ctx context.Context, eventId string) (*storage.StoredEventResult, error) {
 	assert.NotNil(m.t, ctx, "context is required")
 
@@ -112,6 +208,13 @@ func (m *MemoryStorage) UpsertEventResult(ctx context.Context, event *storage.St
 	return nil
 }
 
+func (m *MemoryStorage) DeleteEventResult(ctx context.Context, eventId string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	delete(m.events, eventId)
+	return nil
+}
+
 func (m *MemoryStorage) GetUserIdsAndDisplayNamesByRoomId(ctx context.Context, roomId string) ([]string, []string, error) {
 	assert.NotNil(m.t, ctx, "context is required")
 
@@ -125,6 +228,41 @@ func (m *MemoryStorage) GetUserIdsAndDisplayNamesByRoomId(ctx context.Context, r
 func (m *MemoryStorage) SetUserIdsAndDisplayNamesByRoomId(ctx context.Context, roomId string, userIds []string, displayNames []string) error {
 	assert.NotNil(m.t, ctx, "context is required")
 
+	m.userIdsDisplayNames[roomId] = [][]string{userIds, displayNames}
+	members := make([]*storage.StoredRoomMember, 0)
+	for i, userId := range userIds {
+		member := &storage.StoredRoomMember{UserId: userId}
+		if i < len(displayNames) { // some tests only supply user IDs
+			member.DisplayName = displayNames[i]
+		}
+		members = append(members, member)
+	}
+	m.roomMembers[roomId] = members
+	return nil
+}
+
+func (m *MemoryStorage) GetRoomMembers(ctx context.Context, roomId string) ([]*storage.StoredRoomMember, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	members := make([]*storage.StoredRoomMember, 0)
+	for _, member := range m.roomMembers[roomId] {
+		members = append(members, mustClone(m.t, member))
+	}
+	return members, nil
+}
+
+func (m *MemoryStorage) SetRoomMembers(ctx context.Context, roomId string, members []*storage.StoredRoomMember) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	userIds := make([]string, 0)
+	displayNames := make([]string, 0)
+	stored := make([]*storage.StoredRoomMember, 0)
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+		displayNames = append(displayNames, member.DisplayName)
+		stored = append(stored, mustClone(m.t, member))
+	}
+	m.roomMembers[roomId] = stored
 	m.userIdsDisplayNames[roomId] = [][]string{userIds, displayNames}
 	return nil
 }
@@ -142,12 +280,17 @@ func (m *MemoryStorage) IsUserBannedInList(ctx context.Context, listRoomId strin
 		return false, err
 	}
 
-	for entityId, entityType := range rules {
+	for _, rule := range rules {
+		if rule.Recommendation != "m.ban" {
+			continue
+		}
 		entity := parsedUserId.String()
-		if entityType == "m.policy.rule.server" {
+		if rule.EntityType == "m.policy.rule.server" {
 			entity = string(parsedUserId.Domain())
+		} else if rule.EntityType != "m.policy.rule.user" {
+			continue
 		}
-		if glob.Glob(entityId, entity) {
+		if glob.Glob(rule.Entity, entity) {
 			return true, nil
 		}
 	}
@@ -155,13 +298,24 @@ func (m *MemoryStorage) IsUserBannedInList(ctx context.Context, listRoomId strin
 	return false, nil
 }
 
-func (m *MemoryStorage) SetListBanRules(ctx context.Context, listRoomId string, entityToEntityType map[string]string) error {
+func (m *MemoryStorage) SetListRules(ctx context.Context, listRoomId string, rules []*storage.StoredListRule) error {
 	assert.NotNil(m.t, ctx, "context is required")
 
-	m.policyRules[listRoomId] = entityToEntityType
+	m.policyRules[listRoomId] = rules
 	return nil
 }
 
+func (m *MemoryStorage) GetListRules(ctx context.Context, listRoomId string) ([]*storage.StoredListRule, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	rules := make([]*storage.StoredListRule, 0)
+	for _, rule := range m.policyRules[listRoomId] {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	return rules, nil
+}
+
 func (m *MemoryStorage) CreateCommunity(ctx context.Context, name string) (*storage.StoredCommunity, error) {
 	assert.NotNil(m.t, ctx, "context is required")
 
@@ -197,6 +351,19 @@ func (m *MemoryStorage) GetCommunityByAccessToken(ctx context.Context, accessTok
 	return nil, nil
 }
 
+func (m *MemoryStorage) GetCommunitiesWithSpaces(ctx context.Context) ([]*storage.StoredCommunity, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	communities := make([]*storage.StoredCommunity, 0)
+	for _, community := range m.communities {
+		if community.SpaceRoomId != "" {
+			// We clone to prevent mutations causing the storage to also be updated
+			communities = append(communities, mustClone(m.t, community))
+		}
+	}
+	return communities, nil
+}
+
 func (m *MemoryStorage) UpsertCommunity(ctx context.Context, community *storage.StoredCommunity) error {
 	assert.NotNil(m.t, ctx, "context is required")
 	// We clone to prevent mutations causing the storage to also be updated
@@ -267,6 +434,32 @@ func (m *MemoryStorage) UpsertKeywordTemplate(ctx context.Context, template *sto
 	return nil
 }
 
+func (m *MemoryStorage) GetCommunityKeywordTemplate(ctx context.Context, communityId string, name string) (*storage.StoredKeywordTemplate, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	val, ok := m.communityTemplates[communityId][name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return val, nil
+}
+
+func (m *MemoryStorage) UpsertCommunityKeywordTemplate(ctx context.Context, communityId string, template *storage.StoredKeywordTemplate) error {
+	assert.NotNil(m.t, ctx, "context is required")
+	if _, ok := m.communityTemplates[communityId]; !ok {
+		m.communityTemplates[communityId] = make(map[string]*storage.StoredKeywordTemplate)
+	}
+	m.communityTemplates[communityId][template.Name] = template
+	return nil
+}
+
+func (m *MemoryStorage) DeleteCommunityKeywordTemplate(ctx context.Context, communityId string, name string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+	delete(m.communityTemplates[communityId], name)
+	return nil
+}
+
 func (m *MemoryStorage) GetMediaClassification(ctx context.Context, mxcUri string, communityId string) (*storage.StoredMediaClassification, error) {
 	assert.NotNil(m.t, ctx, "context is required")
 
@@ -291,6 +484,97 @@ func (m *MemoryStorage) UpsertMediaClassification(ctx context.Context, classific
 	return nil
 }
 
+func (m *MemoryStorage) DeleteMediaClassifications(ctx context.Context, communityId string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	for _, byCommunity := range m.mediaClassifications {
+		delete(byCommunity, communityId)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) UpsertMediaScores(ctx context.Context, scores *storage.StoredMediaScores) error {
+	assert.NotNil(m.t, ctx, "context is required")
+	m.mediaScoresLock.Lock()
+	defer m.mediaScoresLock.Unlock()
+
+	if m.mediaScores[scores.MxcUri] == nil {
+		m.mediaScores[scores.MxcUri] = make(map[string]*storage.StoredMediaScores)
+	}
+	cloned := mustClone(m.t, scores)
+	cloned.CategoryScores = maps.Clone(scores.CategoryScores)
+	m.mediaScores[scores.MxcUri][scores.Model] = cloned
+	return nil
+}
+
+func (m *MemoryStorage) GetMediaScores(ctx context.Context, mxcUri string, model string) (*storage.StoredMediaScores, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+	m.mediaScoresLock.Lock()
+	defer m.mediaScoresLock.Unlock()
+
+	val, ok := m.mediaScores[mxcUri][model]
+	if !ok {
+		return nil, nil
+	}
+	cloned := mustClone(m.t, val)
+	cloned.CategoryScores = maps.Clone(val.CategoryScores)
+	return cloned, nil
+}
+
+func (m *MemoryStorage) UpsertMediaHash(ctx context.Context, hash *storage.StoredMediaHash) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.mediaHashesLock.Lock()
+	defer m.mediaHashesLock.Unlock()
+
+	hashes := m.mediaHashes[hash.CommunityId]
+	for i, h := range hashes {
+		if h.Bank == hash.Bank && h.Kind == hash.Kind && h.Value == hash.Value {
+			hashes[i] = mustClone(m.t, hash)
+			return nil
+		}
+	}
+	m.mediaHashes[hash.CommunityId] = append(hashes, mustClone(m.t, hash))
+	return nil
+}
+
+func (m *MemoryStorage) DeleteMediaHash(ctx context.Context, communityId string, bank string, kind storage.MediaHashKind, value string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.mediaHashesLock.Lock()
+	defer m.mediaHashesLock.Unlock()
+
+	m.mediaHashes[communityId] = slices.DeleteFunc(m.mediaHashes[communityId], func(h *storage.StoredMediaHash) bool {
+		return h.Bank == bank && h.Kind == kind && h.Value == value
+	})
+	return nil
+}
+
+func (m *MemoryStorage) DeleteMediaHashesByMxcUri(ctx context.Context, communityId string, mxcUri string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.mediaHashesLock.Lock()
+	defer m.mediaHashesLock.Unlock()
+
+	m.mediaHashes[communityId] = slices.DeleteFunc(m.mediaHashes[communityId], func(h *storage.StoredMediaHash) bool {
+		return h.MxcUri == mxcUri
+	})
+	return nil
+}
+
+func (m *MemoryStorage) GetMediaHashes(ctx context.Context, communityId string) ([]*storage.StoredMediaHash, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.mediaHashesLock.Lock()
+	defer m.mediaHashesLock.Unlock()
+
+	hashes := make([]*storage.StoredMediaHash, 0)
+	for _, h := range m.mediaHashes[communityId] {
+		hashes = append(hashes, mustClone(m.t, h))
+	}
+	return hashes, nil
+}
+
 func (m *MemoryStorage) InsertEdu(ctx context.Context, edu *storage.StoredEdu) error {
 	assert.NotNil(m.t, ctx, "context is required")
 
@@ -369,6 +653,517 @@ func (m *MemoryStorage) GetDestinationsNeedingCatchup(ctx context.Context) ([]st
 	return destinations, nil
 }
 
+func (m *MemoryStorage) InsertRoomMemberJoin(ctx context.Context, roomId string, userId string, joinedTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	if m.roomMemberJoins[roomId] == nil {
+		m.roomMemberJoins[roomId] = make(map[string]int64)
+	}
+	if _, ok := m.roomMemberJoins[roomId][userId]; !ok {
+		m.roomMemberJoins[roomId][userId] = joinedTimestampMillis
+	}
+	return nil
+}
+
+func (m *MemoryStorage) DeleteRoomMemberJoin(ctx context.Context, roomId string, userId string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	if m.roomMemberJoins[roomId] != nil {
+		delete(m.roomMemberJoins[roomId], userId)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetRoomMemberJoinTimestamp(ctx context.Context, roomId string, userId string) (int64, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	if m.roomMemberJoins[roomId] == nil {
+		return 0, nil
+	}
+	return m.roomMemberJoins[roomId][userId], nil
+}
+
+func (m *MemoryStorage) SetSpaceChildren(ctx context.Context, spaceRoomId string, childRoomIds []string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.spaceChildren[spaceRoomId] = slices.Clone(childRoomIds)
+	return nil
+}
+
+func (m *MemoryStorage) GetSpaceChildren(ctx context.Context, spaceRoomId string) ([]string, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	val, ok := m.spaceChildren[spaceRoomId]
+	if !ok {
+		return make([]string, 0), nil
+	}
+	return slices.Clone(val), nil
+}
+
+func (m *MemoryStorage) InsertDecision(ctx context.Context, decision *storage.StoredDecision) error {
+	assert.NotNil(m.t, ctx, "context is required")
+	m.decisionsLock.Lock()
+	defer m.decisionsLock.Unlock()
+
+	decision.Id = 1
+	if len(m.decisions) > 0 {
+		// Old decisions may have been deleted, so we can't use the length
+		decision.Id = m.decisions[len(m.decisions)-1].Id + 1
+	}
+	m.decisions = append(m.decisions, mustClone(m.t, decision))
+	return nil
+}
+
+func (m *MemoryStorage) GetDecisions(ctx context.Context, query *storage.DecisionQuery) ([]*storage.StoredDecision, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+	assert.NotEmpty(m.t, query.CommunityId, "community ID is required")
+	m.decisionsLock.Lock()
+	defer m.decisionsLock.Unlock()
+
+	decisions := make([]*storage.StoredDecision, 0)
+	for i := len(m.decisions) - 1; i >= 0 && len(decisions) < query.Limit; i-- {
+		d := m.decisions[i]
+		if d.CommunityId != query.CommunityId {
+			continue
+		}
+		if query.EventId != "" && d.EventId != query.EventId {
+			continue
+		}
+		if query.RoomId != "" && d.RoomId != query.RoomId {
+			continue
+		}
+		if query.SenderUserId != "" && d.SenderUserId != query.SenderUserId {
+			continue
+		}
+		if query.Harm != "" && !slices.Contains(d.ContentInfo.Harms(), query.Harm) {
+			continue
+		}
+		if query.SinceTimestampMillis != 0 && d.DecidedTimestampMillis < query.SinceTimestampMillis {
+			continue
+		}
+		if query.UntilTimestampMillis != 0 && d.DecidedTimestampMillis >= query.UntilTimestampMillis {
+			continue
+		}
+		if query.BeforeId != 0 && d.Id >= query.BeforeId {
+			continue
+		}
+		decisions = append(decisions, mustClone(m.t, d))
+	}
+	return decisions, nil
+}
+
+func (m *MemoryStorage) DeleteDecisionsBefore(ctx context.Context, beforeTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+	m.decisionsLock.Lock()
+	defer m.decisionsLock.Unlock()
+
+	m.decisions = slices.DeleteFunc(m.decisions, func(d *storage.StoredDecision) bool {
+		return d.DecidedTimestampMillis < beforeTimestampMillis
+	})
+	return nil
+}
+
+func (m *MemoryStorage) UpsertOverride(ctx context.Context, override *storage.StoredOverride) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	overrides := m.overrides[override.CommunityId]
+	for i, o := range overrides {
+		if o.Kind == override.Kind && o.Value == override.Value {
+			overrides[i] = mustClone(m.t, override)
+			return nil
+		}
+	}
+	m.overrides[override.CommunityId] = append(overrides, mustClone(m.t, override))
+	return nil
+}
+
+func (m *MemoryStorage) DeleteOverride(ctx context.Context, communityId string, kind storage.OverrideKind, value string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.overrides[communityId] = slices.DeleteFunc(m.overrides[communityId], func(o *storage.StoredOverride) bool {
+		return o.Kind == kind && o.Value == value
+	})
+	return nil
+}
+
+func (m *MemoryStorage) GetOverrides(ctx context.Context, communityId string) ([]*storage.StoredOverride, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	overrides := make([]*storage.StoredOverride, 0)
+	for _, o := range m.overrides[communityId] {
+		overrides = append(overrides, mustClone(m.t, o))
+	}
+	return overrides, nil
+}
+
+func (m *MemoryStorage) UpsertHellban(ctx context.Context, hellban *storage.StoredHellban) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.hellbansLock.Lock()
+	defer m.hellbansLock.Unlock()
+
+	if _, ok := m.hellbans[hellban.CommunityId]; !ok {
+		m.hellbans[hellban.CommunityId] = make(map[string]*storage.StoredHellban)
+	}
+	m.hellbans[hellban.CommunityId][hellban.UserId] = mustClone(m.t, hellban)
+	return nil
+}
+
+func (m *MemoryStorage) DeleteHellban(ctx context.Context, communityId string, userId string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.hellbansLock.Lock()
+	defer m.hellbansLock.Unlock()
+
+	delete(m.hellbans[communityId], userId)
+	return nil
+}
+
+func (m *MemoryStorage) GetHellban(ctx context.Context, communityId string, userId string) (*storage.StoredHellban, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.hellbansLock.Lock()
+	defer m.hellbansLock.Unlock()
+
+	return mustClone(m.t, m.hellbans[communityId][userId]), nil
+}
+
+func (m *MemoryStorage) GetActiveHellbans(ctx context.Context, communityId string) ([]*storage.StoredHellban, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.hellbansLock.Lock()
+	defer m.hellbansLock.Unlock()
+
+	now := time.Now()
+	hellbans := make([]*storage.StoredHellban, 0)
+	for _, h := range m.hellbans[communityId] {
+		if h.IsActive(now) {
+			hellbans = append(hellbans, mustClone(m.t, h))
+		}
+	}
+	slices.SortFunc(hellbans, func(a, b *storage.StoredHellban) int {
+		return cmp.Compare(a.ExpiresTimestampMillis, b.ExpiresTimestampMillis)
+	})
+	return hellbans, nil
+}
+
+func (m *MemoryStorage) DeleteHellbansExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.hellbansLock.Lock()
+	defer m.hellbansLock.Unlock()
+
+	for _, byUserId := range m.hellbans {
+		maps.DeleteFunc(byUserId, func(userId string, h *storage.StoredHellban) bool {
+			return h.ExpiresTimestampMillis < expiredBeforeTimestampMillis
+		})
+	}
+	return nil
+}
+
+func (m *MemoryStorage) InsertRecentContents(ctx context.Context, contents []*storage.StoredRecentContent) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	for _, c := range contents {
+		exists := slices.ContainsFunc(m.recentContents, func(existing *storage.StoredRecentContent) bool {
+			return existing.EventId == c.EventId && existing.Kind == c.Kind && existing.Value == c.Value
+		})
+		if !exists {
+			m.recentContents = append(m.recentContents, mustClone(m.t, c))
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetRecentContentsForEvent(ctx context.Context, eventId string) ([]*storage.StoredRecentContent, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	contents := make([]*storage.StoredRecentContent, 0)
+	for _, c := range m.recentContents {
+		if c.EventId == eventId {
+			contents = append(contents, mustClone(m.t, c))
+		}
+	}
+	return contents, nil
+}
+
+func (m *MemoryStorage) GetRecentContentsForSender(ctx context.Context, communityId string, sender string) ([]*storage.StoredRecentContent, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	contents := make([]*storage.StoredRecentContent, 0)
+	for _, c := range m.recentContents {
+		if c.CommunityId == communityId && c.Sender == sender {
+			contents = append(contents, mustClone(m.t, c))
+		}
+	}
+	return contents, nil
+}
+
+func (m *MemoryStorage) DeleteRecentContentsBefore(ctx context.Context, receivedBeforeTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	m.recentContents = slices.DeleteFunc(m.recentContents, func(c *storage.StoredRecentContent) bool {
+		return c.ReceivedTimestampMillis < receivedBeforeTimestampMillis
+	})
+	return nil
+}
+
+func (m *MemoryStorage) UpsertBlockedContents(ctx context.Context, blocked []*storage.StoredBlockedContent) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	for _, b := range blocked {
+		m.blockedContents[b.CommunityId] = slices.DeleteFunc(m.blockedContents[b.CommunityId], func(existing *storage.StoredBlockedContent) bool {
+			return existing.Kind == b.Kind && existing.Value == b.Value
+		})
+		m.blockedContents[b.CommunityId] = append(m.blockedContents[b.CommunityId], mustClone(m.t, b))
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetActiveBlockedContents(ctx context.Context, communityId string) ([]*storage.StoredBlockedContent, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	now := time.Now().UnixMilli()
+	blocked := make([]*storage.StoredBlockedContent, 0)
+	for _, b := range m.blockedContents[communityId] {
+		if b.ExpiresTimestampMillis > now {
+			blocked = append(blocked, mustClone(m.t, b))
+		}
+	}
+	return blocked, nil
+}
+
+func (m *MemoryStorage) DeleteBlockedContentsExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.contentsLock.Lock()
+	defer m.contentsLock.Unlock()
+
+	for communityId, blocked := range m.blockedContents {
+		m.blockedContents[communityId] = slices.DeleteFunc(blocked, func(b *storage.StoredBlockedContent) bool {
+			return b.ExpiresTimestampMillis < expiredBeforeTimestampMillis
+		})
+	}
+	return nil
+}
+
+func (m *MemoryStorage) UpsertRaid(ctx context.Context, raid *storage.StoredRaid) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.raidsLock.Lock()
+	defer m.raidsLock.Unlock()
+
+	if _, ok := m.raids[raid.CommunityId]; !ok {
+		m.raids[raid.CommunityId] = make(map[string]*storage.StoredRaid)
+	}
+	m.raids[raid.CommunityId][raid.RoomId] = mustClone(m.t, raid)
+	return nil
+}
+
+func (m *MemoryStorage) DeleteRaid(ctx context.Context, communityId string, roomId string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.raidsLock.Lock()
+	defer m.raidsLock.Unlock()
+
+	delete(m.raids[communityId], roomId)
+	return nil
+}
+
+func (m *MemoryStorage) GetActiveRaids(ctx context.Context, communityId string) ([]*storage.StoredRaid, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.raidsLock.Lock()
+	defer m.raidsLock.Unlock()
+
+	now := time.Now()
+	raids := make([]*storage.StoredRaid, 0)
+	for _, r := range m.raids[communityId] {
+		if r.IsActive(now) {
+			raids = append(raids, mustClone(m.t, r))
+		}
+	}
+	slices.SortFunc(raids, func(a, b *storage.StoredRaid) int {
+		return cmp.Compare(a.ExpiresTimestampMillis, b.ExpiresTimestampMillis)
+	})
+	return raids, nil
+}
+
+func (m *MemoryStorage) DeleteRaidsExpiredBefore(ctx context.Context, expiredBeforeTimestampMillis int64) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.raidsLock.Lock()
+	defer m.raidsLock.Unlock()
+
+	for _, byRoomId := range m.raids {
+		maps.DeleteFunc(byRoomId, func(roomId string, r *storage.StoredRaid) bool {
+			return r.ExpiresTimestampMillis < expiredBeforeTimestampMillis
+		})
+	}
+	return nil
+}
+
+func (m *MemoryStorage) UpsertWebhookDestination(ctx context.Context, destination *storage.StoredWebhookDestination) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.webhooksLock.Lock()
+	defer m.webhooksLock.Unlock()
+
+	cloned := mustClone(m.t, destination)
+	cloned.EventTypes = slices.Clone(destination.EventTypes)
+	destinations := m.webhookDestinations[destination.CommunityId]
+	for i, d := range destinations {
+		if d.Id == destination.Id {
+			cloned.CreatedTimestampMillis = d.CreatedTimestampMillis // not updated on conflict
+			destinations[i] = cloned
+			return nil
+		}
+	}
+	m.webhookDestinations[destination.CommunityId] = append(destinations, cloned)
+	return nil
+}
+
+func (m *MemoryStorage) DeleteWebhookDestination(ctx context.Context, communityId string, id string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.webhooksLock.Lock()
+	defer m.webhooksLock.Unlock()
+
+	m.webhookDestinations[communityId] = slices.DeleteFunc(m.webhookDestinations[communityId], func(d *storage.StoredWebhookDestination) bool {
+		return d.Id == id
+	})
+	maps.DeleteFunc(m.webhookDeliveries, func(deliveryId string, d *storage.StoredWebhookDelivery) bool {
+		return d.CommunityId == communityId && d.DestinationId == id
+	})
+	return nil
+}
+
+func (m *MemoryStorage) GetWebhookDestinations(ctx context.Context, communityId string) ([]*storage.StoredWebhookDestination, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.webhooksLock.Lock()
+	defer m.webhooksLock.Unlock()
+
+	destinations := make([]*storage.StoredWebhookDestination, 0)
+	for _, d := range m.webhookDestinations[communityId] {
+		cloned := mustClone(m.t, d)
+		cloned.EventTypes = slices.Clone(d.EventTypes)
+		destinations = append(destinations, cloned)
+	}
+	return destinations, nil
+}
+
+func (m *MemoryStorage) UpsertWebhookDelivery(ctx context.Context, delivery *storage.StoredWebhookDelivery) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.webhooksLock.Lock()
+	defer m.webhooksLock.Unlock()
+
+	cloned := mustClone(m.t, delivery)
+	cloned.Payload = slices.Clone(delivery.Payload)
+	m.webhookDeliveries[delivery.Id] = cloned
+	return nil
+}
+
+func (m *MemoryStorage) DeleteWebhookDelivery(ctx context.Context, id string) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.webhooksLock.Lock()
+	defer m.webhooksLock.Unlock()
+
+	delete(m.webhookDeliveries, id)
+	return nil
+}
+
+func (m *MemoryStorage) ClaimWebhookDeliveries(ctx context.Context, dueBeforeTimestampMillis int64, claimUntilTimestampMillis int64, limit int) ([]*storage.StoredWebhookDelivery, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.webhooksLock.Lock()
+	defer m.webhooksLock.Unlock()
+
+	due := make([]*storage.StoredWebhookDelivery, 0)
+	for _, d := range m.webhookDeliveries {
+		if d.NextAttemptTimestampMillis <= dueBeforeTimestampMillis {
+			due = append(due, d)
+		}
+	}
+	slices.SortFunc(due, func(a, b *storage.StoredWebhookDelivery) int {
+		return cmp.Compare(a.CreatedTimestampMillis, b.CreatedTimestampMillis)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*storage.StoredWebhookDelivery, 0)
+	for _, d := range due {
+		d.NextAttemptTimestampMillis = claimUntilTimestampMillis
+		cloned := mustClone(m.t, d)
+		cloned.Payload = slices.Clone(d.Payload)
+		claimed = append(claimed, cloned)
+	}
+	return claimed, nil
+}
+
+func (m *MemoryStorage) UpsertAuditRoom(ctx context.Context, room *storage.StoredAuditRoom) error {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.auditRoomsLock.Lock()
+	defer m.auditRoomsLock.Unlock()
+
+	cloned := mustClone(m.t, room)
+	cloned.Servers = slices.Clone(room.Servers)
+	cloned.PrevEventIds = slices.Clone(room.PrevEventIds)
+	m.auditRooms[room.RoomId] = cloned
+	return nil
+}
+
+func (m *MemoryStorage) GetAuditRoom(ctx context.Context, roomId string) (*storage.StoredAuditRoom, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	m.auditRoomsLock.Lock()
+	defer m.auditRoomsLock.Unlock()
+
+	room, ok := m.auditRooms[roomId]
+	if !ok {
+		return nil, nil
+	}
+	cloned := mustClone(m.t, room)
+	cloned.Servers = slices.Clone(room.Servers)
+	cloned.PrevEventIds = slices.Clone(room.PrevEventIds)
+	return cloned, nil
+}
+
+func (m *MemoryStorage) GetCommunitiesByAuditRoomId(ctx context.Context, roomId string) ([]*storage.StoredCommunity, error) {
+	assert.NotNil(m.t, ctx, "context is required")
+
+	communities := make([]*storage.StoredCommunity, 0)
+	for _, community := range m.communities {
+		if community.Config != nil && internal.Dereference(community.Config.AuditRoomId) == roomId {
+			// We clone to prevent mutations causing the storage to also be updated
+			communities = append(communities, mustClone(m.t, community))
+		}
+	}
+	return communities, nil
+}
+
 // mustClone - clones structs for reuse elsewhere. This does a relatively shallow clone using primitives.
 // See implementation for details.
 func mustClone[T any](t *testing.T, val *T) *T {
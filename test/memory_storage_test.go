@@ -25,9 +25,11 @@ func TestMemoryStorageReturnsEventErrorResultOnId(t *testing.T) {
 func TestMemoryStorageGlobMatching(t *testing.T) {
 	roomId := "!example"
 	s := NewMemoryStorage(t)
-	err := s.SetListBanRules(context.Background(), roomId, map[string]string{
-		"@alice*:*":     "m.policy.rule.user",
-		"*.example.org": "m.policy.rule.server",
+	err := s.SetListRules(context.Background(), roomId, []*storage.StoredListRule{
+		{EntityType: "m.policy.rule.user", Entity: "@alice*:*", Recommendation: "m.ban"},
+		{EntityType: "m.policy.rule.server", Entity: "*.example.org", Recommendation: "m.ban"},
+		{EntityType: "m.policy.rule.user", Entity: "@carol:*", Recommendation: "org.example.not_a_ban"},
+		{EntityType: "m.policy.rule.room", Entity: "*", Recommendation: "m.ban"},
 	})
 	assert.NoError(t, err)
 
@@ -42,6 +44,7 @@ func TestMemoryStorageGlobMatching(t *testing.T) {
 	assertBannedState("@alice:subdomain.example.org", true)
 	assertBannedState("@bob:subdomain.example.org", true)
 	assertBannedState("@bob:example.org", false)
+	assertBannedState("@carol:example.org", false)
 }
 
 func TestMemoryStorageStateLearnQueue(t *testing.T) {
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/matrix-org/policyserv/notifiers"
@@ -12,11 +13,22 @@ type MatrixNotifier struct {
 	notifiers.MatrixNotifier
 
 	t *testing.T
+
+	lock      sync.Mutex
+	sent      map[string][]string        // communityId -> [plainText]
+	decisions map[string][]*sentDecision // communityId -> [decision]
+}
+
+type sentDecision struct {
+	decision    *storage.StoredDecision
+	payloadType notifiers.WebhookPayloadType
 }
 
 func NewMatrixNotifier(t *testing.T) *MatrixNotifier {
 	return &MatrixNotifier{
-		t: t,
+		t:         t,
+		sent:      make(map[string][]string),
+		decisions: make(map[string][]*sentDecision),
 	}
 }
 
@@ -24,5 +36,43 @@ func (n *MatrixNotifier) Send(communityId string, plainText string, htmlText str
 	assert.NotEmpty(n.t, communityId, "communityId is required")
 	assert.NotEmpty(n.t, plainText, "plainText is required")
 	assert.NotEmpty(n.t, htmlText, "htmlText is required")
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.sent[communityId] = append(n.sent[communityId], plainText)
+
 	return storage.NextId(), nil
 }
+
+// SentTo - Returns the plain text of the messages sent to the community so far, oldest first.
+func (n *MatrixNotifier) SentTo(communityId string) []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]string{}, n.sent[communityId]...)
+}
+
+func (n *MatrixNotifier) SendDecision(decision *storage.StoredDecision, payloadType notifiers.WebhookPayloadType) (string, error) {
+	assert.NotNil(n.t, decision, "decision is required")
+	assert.NotEmpty(n.t, decision.CommunityId, "decision.CommunityId is required")
+	assert.NotEmpty(n.t, payloadType, "payloadType is required")
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.decisions[decision.CommunityId] = append(n.decisions[decision.CommunityId], &sentDecision{
+		decision:    decision,
+		payloadType: payloadType,
+	})
+
+	return storage.NextId(), nil
+}
+
+// DecisionTypesSentTo - Returns the payload types of the decisions sent to the community so far, oldest first.
+func (n *MatrixNotifier) DecisionTypesSentTo(communityId string) []notifiers.WebhookPayloadType {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	types := make([]notifiers.WebhookPayloadType, 0)
+	for _, d := range n.decisions[communityId] {
+		types = append(types, d.payloadType)
+	}
+	return types
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// KeywordInvalidResponse - Used by tests to cause the chat server to reply with something that isn't a classification.
+const KeywordInvalidResponse = "MX_INVALID_RESPONSE"
+
+// MakeOpenAIChatServer - Creates a mock OpenAI-compatible Chat Completions API server for use in tests. It uses the same
+// keywords as MakeOpenAIModerationServer, replying with category scores.
+func MakeOpenAIChatServer(t *testing.T, apiKey string, model string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer "+apiKey)
+		assert.Equal(t, r.URL.Path, "/chat/completions") // we only handle Chat Completions API stuff here
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err) // "should never happen"
+		}
+		req := struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}{}
+		err = json.Unmarshal(b, &req)
+		assert.NoError(t, err)
+		assert.Equal(t, model, req.Model)
+		assert.Len(t, req.Messages, 2)
+		assert.Equal(t, "system", req.Messages[0].Role)
+		assert.NotEmpty(t, req.Messages[0].Content)
+		assert.Equal(t, "user", req.Messages[1].Role)
+		message := req.Messages[1].Content
+
+		var reply string
+		if strings.Contains(message, KeywordSpammyCSAM) {
+			// Models like to wrap JSON in code fences
+			reply = "```json\n{\"sexual\": 0.9, \"sexual/minors\": 0.98}\n```"
+		} else if strings.Contains(message, KeywordSpammy) {
+			reply = `{"harassment": 0.7, "hate": 0.2}`
+		} else if strings.Contains(message, KeywordNeutral) {
+			reply = `{"harassment": 0.01, "hate": 0}`
+		} else if strings.Contains(message, KeywordInvalidResponse) {
+			reply = "I'm sorry, I can't help with that."
+		} else if strings.Contains(message, KeywordIntentionalFail) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError) // should prevent automatic retry from happening
+			// This is a mock OpenAI API error
+			_, _ = w.Write([]byte(`{"error":{"code": "X-ERROR","message":"Intentional fail","param":"x","type":"x"}}`))
+			return
+		} else {
+			t.Fatalf("Unexpected request: %s", string(b))
+		}
+
+		b, err = json.Marshal(map[string]any{
+			"id":      "1",
+			"object":  "chat.completion",
+			"created": 0,
+			"model":   model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"finish_reason": "stop",
+				"message": map[string]any{
+					"role":    "assistant",
+					"content": reply,
+				},
+			}},
+		})
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}))
+}
@@ -1,6 +1,8 @@
 package test
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,7 +19,7 @@ import (
 // Dev note: Usually we'd write a dedicated test for utilities like this, however the entire functionality is covered by
 // other tests using it, so it should be fine.
 
-// KeywordSpammy - Used by tests to always flag a message as generic spam.
+// KeywordSpammy - Used by tests to always flag a message as harassment.
 const KeywordSpammy = "MX_SPAMMY"
 
 // KeywordSpammyCSAM - Used by tests to always flag a message as "containing CSAM".
@@ -45,6 +47,12 @@ func MustMakeKeywordEvent(keyword string) gomatrixserverlib.PDU {
 	})
 }
 
+// MustMakeKeywordImage - Creates a PNG image which the mock OpenAI Moderation API server treats like a message
+// containing the keyword. The keyword is appended after the image data, so the image is still detected as a PNG.
+func MustMakeKeywordImage(t *testing.T, keyword string) []byte {
+	return append(MustMakeImage(t, 16, 16, 0), []byte(keyword)...)
+}
+
 // MakeOpenAIModerationServer - Creates a mock OpenAI Moderation API server for use in tests.
 func MakeOpenAIModerationServer(t *testing.T, apiKey string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -63,7 +71,9 @@ func MakeOpenAIModerationServer(t *testing.T, apiKey string) *httptest.Server {
 		}
 		req := string(b)
 
-		if strings.Contains(req, KeywordSpammyCSAM) {
+		if strings.Contains(req, `"image_url"`) {
+			modServerHandleImage(t, w, b)
+		} else if strings.Contains(req, KeywordSpammyCSAM) {
 			modServerHandleKeywordSpammyCSAM(t, w, req)
 		} else if strings.Contains(req, KeywordSpammy) {
 			modServerHandleKeywordSpammy(t, w, req)
@@ -105,12 +115,15 @@ func modServerHandleKeywordSpammyCSAM(t *testing.T, w http.ResponseWriter, body
 		Results: []openai.Moderation{{
 			Flagged: true, // flagged, and...
 			Categories: openai.ModerationCategories{
+				Sexual:       true,
 				SexualMinors: true, // ... is detected as CSAM
 			},
 			CategoryScores: openai.ModerationCategoryScores{
+				Sexual:       0.9,
 				SexualMinors: 1.0,
 			},
 			CategoryAppliedInputTypes: openai.ModerationCategoryAppliedInputTypes{
+				Sexual:       []string{"text"},
 				SexualMinors: []string{"text"},
 			},
 		}},
@@ -129,14 +142,18 @@ func modServerHandleKeywordSpammy(t *testing.T, w http.ResponseWriter, body stri
 		ID:    "1",
 		Model: openai.ModerationModelOmniModerationLatest,
 		Results: []openai.Moderation{{
-			Flagged: true, // flagged, but...
+			Flagged: true, // flagged for harassment, but...
 			Categories: openai.ModerationCategories{
+				Harassment:   true,
 				SexualMinors: false, // ... not CSAM to avoid accidentally causing that code to activate
 			},
 			CategoryScores: openai.ModerationCategoryScores{
+				Harassment:   0.7,
+				Hate:         0.2,
 				SexualMinors: 0.0,
 			},
 			CategoryAppliedInputTypes: openai.ModerationCategoryAppliedInputTypes{
+				Harassment:   []string{"text"},
 				SexualMinors: []string{"text"},
 			},
 		}},
@@ -174,3 +191,53 @@ func modServerHandleKeywordIntentionalFail(t *testing.T, w http.ResponseWriter,
 	// This is a mock OpenAI API error
 	_, _ = w.Write([]byte(`{"error":{"code": "X-ERROR","message":"Intentional fail","param":"x","type":"x"}}`))
 }
+
+func modServerHandleImage(t *testing.T, w http.ResponseWriter, body []byte) {
+	req := struct {
+		Input []struct {
+			Type     string `json:"type"`
+			ImageURL struct {
+				URL string `json:"url"`
+			} `json:"image_url"`
+		} `json:"input"`
+		Model string `json:"model"`
+	}{}
+	err := json.Unmarshal(body, &req)
+	assert.NoError(t, err)
+	assert.Equal(t, openai.ModerationModelOmniModerationLatest, req.Model)
+	assert.Len(t, req.Input, 1) // images are scored one at a time
+	assert.Equal(t, "image_url", req.Input[0].Type)
+	prefix := "data:image/png;base64,"
+	assert.True(t, strings.HasPrefix(req.Input[0].ImageURL.URL, prefix))
+	img, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Input[0].ImageURL.URL, prefix))
+	assert.NoError(t, err)
+
+	result := openai.Moderation{}
+	if bytes.HasSuffix(img, []byte(KeywordSpammy)) {
+		result = openai.Moderation{
+			Flagged:        true,
+			Categories:     openai.ModerationCategories{Sexual: true},
+			CategoryScores: openai.ModerationCategoryScores{Sexual: 0.9},
+			CategoryAppliedInputTypes: openai.ModerationCategoryAppliedInputTypes{
+				Sexual: []string{"image"},
+			},
+		}
+	} else if bytes.HasSuffix(img, []byte(KeywordIntentionalFail)) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"code": "X-ERROR","message":"Intentional fail","param":"x","type":"x"}}`))
+		return
+	} else if !bytes.HasSuffix(img, []byte(KeywordNeutral)) {
+		t.Fatalf("Unexpected image request")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	b, err := json.Marshal(openai.ModerationNewResponse{
+		ID:      "1",
+		Model:   openai.ModerationModelOmniModerationLatest,
+		Results: []openai.Moderation{result},
+	})
+	assert.NoError(t, err)
+	_, _ = w.Write(b)
+}
@@ -19,6 +19,7 @@ type BaseClientEvent struct {
 	StateKey    *string                      `json:"state_key"`
 	Sender      string                       `json:"sender"`
 	Content     map[string]any               `json:"content"`
+	Redacts     string                       `json:"redacts,omitempty"`
 	StickyUntil time.Time                    `json:"-"` // exclude from JSON to avoid making the event improper/too large
 	Signatures  map[string]map[string]string `json:"signatures,omitempty"`
 
@@ -177,7 +178,11 @@ func (n *noopPDU) HistoryVisibility() (gomatrixserverlib.HistoryVisibility, erro
 }
 
 func (n *noopPDU) Membership() (string, error) {
-	return "", errors.New("wrong event type")
+	if n.base.Type != "m.room.member" || n.base.StateKey == nil {
+		return "", errors.New("wrong event type")
+	}
+	membership, _ := n.base.Content["membership"].(string)
+	return membership, nil
 }
 
 func (n *noopPDU) PowerLevels() (*gomatrixserverlib.PowerLevelContent, error) {
@@ -185,7 +190,7 @@ func (n *noopPDU) PowerLevels() (*gomatrixserverlib.PowerLevelContent, error) {
 }
 
 func (n *noopPDU) Redacts() string {
-	return ""
+	return n.base.Redacts
 }
 
 func (n *noopPDU) Redacted() bool {
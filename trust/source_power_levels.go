@@ -44,6 +44,10 @@ func (s *PowerLevelsSource) IsUserAboveDefault(ctx context.Context, roomId strin
 	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
+	if err != nil {
+		// Don't treat the user as having the default power level, as that might make them a moderator
+		return false, err
+	}
 
 	userPl, ok := val.Users[userId]
 	if !ok {
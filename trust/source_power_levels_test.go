@@ -2,8 +2,10 @@ package trust
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/matrix-org/policyserv/storage"
 	"github.com/matrix-org/policyserv/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -107,3 +109,24 @@ func TestPowerLevelsSourceRejectsInvalidEvents(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "not a power levels event")
 }
+
+type failingTrustDataStorage struct {
+	storage.PersistentStorage
+}
+
+func (s *failingTrustDataStorage) GetTrustData(ctx context.Context, sourceName string, key string, result any) error {
+	return errors.New("database is down")
+}
+
+func TestPowerLevelsSourceFailsClosed(t *testing.T) {
+	t.Parallel()
+
+	db := test.NewMemoryStorage(t)
+	source, err := NewPowerLevelsSource(&failingTrustDataStorage{PersistentStorage: db})
+	assert.NoError(t, err)
+
+	// Database errors must not make everyone look like a moderator
+	ok, err := source.IsUserAboveDefault(context.Background(), "!a:example.org", "@user:example.org")
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
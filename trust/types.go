@@ -6,6 +6,12 @@ type Capability string
 
 const CapabilityMedia Capability = "media"
 
+// CapabilityProtectedIdentity - the user's display name and avatar are protected from impersonation by other users.
+const CapabilityProtectedIdentity Capability = "protected_identity"
+
+// CapabilityRaidBypass - the user can continue participating in rooms while a join raid is in progress.
+const CapabilityRaidBypass Capability = "raid_bypass"
+
 // Source - represents a source of trust. "Trust" is arbitrarily defined as a set of capabilities applied to users
 // in a room. This trust may be global, or it may be scoped to a community. Trust may also change over time.
 type Source interface {